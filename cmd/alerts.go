@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/database"
+)
+
+// alertGate suppresses alerts that were already emailed within the cooldown, so a
+// sustained breach is not repeated every cycle. A nil gate allows every alert.
+type alertGate struct {
+	db       *database.DB
+	cooldown time.Duration
+	now      time.Time
+	allowed  []string // Keys included in this cycle's email
+
+	// walletCooldown additionally holds back any alert for a wallet that was alerted
+	// on within it, whatever the alert type, so a flapping wallet is reported once
+	walletCooldown time.Duration
+	walletsAlerted map[string]bool // Wallets alerted on in this cycle's email
+}
+
+// newAlertGate returns a gate for this cycle, or nil when there is no cooldown or history
+func newAlertGate(db *database.DB, cooldown, walletCooldown time.Duration) *alertGate {
+	if db == nil || (cooldown <= 0 && walletCooldown <= 0) {
+		return nil
+	}
+	return &alertGate{
+		db:       db,
+		cooldown: cooldown,
+		now:      time.Now(),
+
+		walletCooldown: walletCooldown,
+		walletsAlerted: make(map[string]bool),
+	}
+}
+
+// allow reports whether the alert with key, raised for wallet, should be emailed
+func (g *alertGate) allow(wallet, key string) bool {
+	if g == nil {
+		return true
+	}
+
+	if last, ok := g.db.LastAlert(key); ok && g.now.Sub(last) < g.cooldown {
+		return false
+	}
+
+	// Several alerts for the same wallet in one email count as one
+	walletKey := "wallet:" + wallet
+	if g.walletCooldown > 0 && !g.walletsAlerted[wallet] {
+		if last, ok := g.db.LastAlert(walletKey); ok && g.now.Sub(last) < g.walletCooldown {
+			return false
+		}
+		g.walletsAlerted[wallet] = true
+		g.allowed = append(g.allowed, walletKey)
+	}
+
+	g.allowed = append(g.allowed, key)
+	return true
+}
+
+// commit records the alerts that were emailed this cycle
+func (g *alertGate) commit() error {
+	if g == nil {
+		return nil
+	}
+	return g.db.RecordAlerts(g.allowed, g.now)
+}
+
+// suppressedLine summarises alerts held back by the cooldown
+func suppressedLine(suppressed int) string {
+	return fmt.Sprintf("%d more suppressed by ALERT_COOLDOWN or ALERT_WALLET_COOLDOWN", suppressed)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/database"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+func TestAlertCooldown(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Each cycle checks the same breaches at its own time and records what it sent
+	type cycle struct {
+		after time.Duration
+		want  map[string]bool // Alert key, raised for wallet a unless noted, to whether it is sent
+	}
+	tests := []struct {
+		name           string
+		cooldown       time.Duration
+		walletCooldown time.Duration
+		cycles         []cycle
+	}{
+		{
+			name:     "repeated breach within the cooldown",
+			cooldown: time.Hour,
+			cycles: []cycle{
+				{after: 0, want: map[string]bool{"expect:a": true}},
+				{after: 30 * time.Minute, want: map[string]bool{"expect:a": false}},
+				{after: 61 * time.Minute, want: map[string]bool{"expect:a": true}},
+			},
+		},
+		{
+			name:     "cooldown is per alert key",
+			cooldown: time.Hour,
+			cycles: []cycle{
+				{after: 0, want: map[string]bool{"expect:a": true}},
+				{after: 30 * time.Minute, want: map[string]bool{"expect:a": false, "low_sol:a": true}},
+			},
+		},
+		{
+			name:           "wallet cooldown holds back other alerts for the wallet",
+			walletCooldown: time.Hour,
+			cycles: []cycle{
+				{after: 0, want: map[string]bool{"expect:a": true, "low_sol:a": true}},
+				{after: 30 * time.Minute, want: map[string]bool{"drop:a": false}},
+				{after: 90 * time.Minute, want: map[string]bool{"drop:a": true}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.Open(filepath.Join(t.TempDir(), "reporter.db"), time.Second)
+			if err != nil {
+				t.Fatalf("database.Open: %v", err)
+			}
+			defer db.Close()
+
+			for i, c := range tt.cycles {
+				gate := newAlertGate(db, tt.cooldown, tt.walletCooldown)
+				gate.now = start.Add(c.after)
+				for key, want := range c.want {
+					if got := gate.allow("a", key); got != want {
+						t.Errorf("cycle %d: alert %s sent = %v, want %v", i+1, key, got, want)
+					}
+				}
+				if err := gate.commit(); err != nil {
+					t.Fatalf("commit: %v", err)
+				}
+			}
+		})
+	}
+
+	if gate := newAlertGate(nil, time.Hour, 0); gate.allow("a", "expect:a") != true {
+		t.Error("a gate without history suppressed an alert")
+	}
+}
+
+func TestFlappingWalletAlertedOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reporter.db")
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rounder := rounding.Rounder{Places: 6, Mode: rounding.HalfUp}
+
+	// The wallet dips below the threshold, recovers and dips again every 10 minutes
+	tests := []struct {
+		after     time.Duration
+		sol       float64
+		wantAlert bool
+	}{
+		{after: 0, sol: 0.0001, wantAlert: true},
+		{after: 10 * time.Minute, sol: 1},
+		{after: 20 * time.Minute, sol: 0.0001},
+		{after: 30 * time.Minute, sol: 1},
+		{after: 40 * time.Minute, sol: 0.0002},
+		{after: 70 * time.Minute, sol: 0.0001, wantAlert: true},
+	}
+
+	for i, tt := range tests {
+		// Reopen the database each cycle, as separate runs would
+		db, err := database.Open(path, time.Second)
+		if err != nil {
+			t.Fatalf("database.Open: %v", err)
+		}
+		gate := newAlertGate(db, 0, time.Hour)
+		gate.now = start.Add(tt.after)
+
+		balances := []*solana.TokenBalance{{WalletAddress: "flapping", SolanaBalance: tt.sol, SolanaFetched: true}}
+		section := lowSolSection(balances, 0.001, rounder, gate)
+		alerted := strings.Contains(strings.Join(section.Lines, "\n"), "flapping:")
+		if alerted != tt.wantAlert {
+			t.Errorf("cycle %d: alerted = %v, want %v (%q)", i+1, alerted, tt.wantAlert, section.Lines)
+		}
+
+		if err := gate.commit(); err != nil {
+			t.Fatalf("commit: %v", err)
+		}
+		db.Close()
+	}
+}
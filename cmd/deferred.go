@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/mailer"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// deferredReportsFile holds the reports deferred during quiet hours, next to the checkpoint
+// journal, so a restart during the window does not lose them
+const deferredReportsFile = "deferred_reports.json"
+
+// deferredReport summarises a report whose email was held back during quiet hours
+type deferredReport struct {
+	Attachment mailer.Attachment
+	Total      int
+	Failed     int
+}
+
+// newDeferredReport summarises a cycle's balances for a later consolidated email
+func newDeferredReport(attachment mailer.Attachment, balances []*solana.TokenBalance) deferredReport {
+	deferred := deferredReport{Attachment: attachment, Total: len(balances)}
+	for _, balance := range balances {
+		if balance.FetchError != nil {
+			deferred.Failed++
+		}
+	}
+	return deferred
+}
+
+// deferredReportsPath returns where deferred reports are kept for a checkpoint path
+func deferredReportsPath(checkpointPath string) string {
+	return filepath.Join(filepath.Dir(checkpointPath), deferredReportsFile)
+}
+
+// loadDeferredReports reads the reports deferred so far; a missing file means there are none
+func loadDeferredReports(path string) ([]deferredReport, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deferred reports: %w", err)
+	}
+
+	var reports []deferredReport
+	if err := json.Unmarshal(content, &reports); err != nil {
+		return nil, fmt.Errorf("failed to parse deferred reports %s: %w", path, err)
+	}
+	return reports, nil
+}
+
+// deferReport adds a report to the deferred reports and returns how many are pending.
+// The file is replaced atomically so an interrupted write keeps the earlier reports.
+func deferReport(path string, report deferredReport) (int, error) {
+	reports, err := loadDeferredReports(path)
+	if err != nil {
+		return 0, err
+	}
+	reports = append(reports, report)
+
+	content, err := json.Marshal(reports)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode deferred reports: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create deferred reports directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return 0, fmt.Errorf("failed to write deferred reports: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("failed to write deferred reports: %w", err)
+	}
+	return len(reports), nil
+}
+
+// clearDeferredReports removes the deferred reports once they have been sent
+func clearDeferredReports(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove deferred reports: %w", err)
+	}
+	return nil
+}
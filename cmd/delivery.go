@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/config"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/database"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/mailer"
+)
+
+// verifyDeliveries checks the reports sent this cycle and records the outcomes in the
+// history database. Failed messages are resent once or raised as an alert, depending on
+// DELIVERY_FAIL_ACTION. It returns the number of messages that could not be verified.
+func verifyDeliveries(cfg *config.Config, mailClient *mailer.Mailer, deliveries []mailer.Delivery, db *database.DB, log *logger.Logger) int {
+	// Each check gets the full timeout, so a resent message is not verified against
+	// the time already spent on the original
+	verify := func(delivery mailer.Delivery) error {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.DeliveryTimeout)
+		defer cancel()
+
+		err := mailClient.VerifyDelivery(ctx, delivery)
+		recordDelivery(db, delivery, err, log)
+		return err
+	}
+
+	failed := 0
+	for _, delivery := range deliveries {
+		err := verify(delivery)
+
+		if err != nil && cfg.DeliveryFailAction == "retry" {
+			log.LogError(fmt.Sprintf("Delivery of %s could not be verified, resending", delivery.MessageID), err)
+			delivery, err = mailClient.Resend(delivery)
+			if err == nil {
+				err = verify(delivery)
+			}
+		}
+
+		if err != nil {
+			log.LogError(fmt.Sprintf("ALERT: delivery of report %s to %d recipients failed verification",
+				delivery.MessageID, len(delivery.Recipients)), err)
+			failed++
+			continue
+		}
+		log.Log(fmt.Sprintf("Verified delivery of %s (%d %s)", delivery.MessageID, delivery.Code, delivery.Response))
+	}
+	return failed
+}
+
+// recordDelivery stores a verification outcome when a history database is configured
+func recordDelivery(db *database.DB, delivery mailer.Delivery, verifyErr error, log *logger.Logger) {
+	if db == nil {
+		return
+	}
+
+	record := database.DeliveryRecord{
+		RunTimestamp: getRunTime(),
+		MessageID:    delivery.MessageID,
+		Server:       delivery.Server,
+		SMTPCode:     delivery.Code,
+		SMTPResponse: delivery.Response,
+		Verified:     verifyErr == nil,
+		CheckedAt:    time.Now(),
+	}
+	if verifyErr != nil {
+		record.Error = verifyErr.Error()
+	}
+	if err := db.RecordDelivery(record); err != nil {
+		log.LogError("Failed to record delivery verification", err)
+	}
+}
@@ -1,32 +1,111 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/nehalshaquib/solana-balance-reporter/internal/audit"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/checkpoint"
 	"github.com/nehalshaquib/solana-balance-reporter/internal/config"
 	"github.com/nehalshaquib/solana-balance-reporter/internal/csvwriter"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/database"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/graphql"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/health"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/jsonwriter"
 	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
 	"github.com/nehalshaquib/solana-balance-reporter/internal/mailer"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/manifest"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/metrics"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/notifier"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/queue"
 	"github.com/nehalshaquib/solana-balance-reporter/internal/reader"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/report"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/retention"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
 	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/stream"
+)
+
+// Build information, injected at build time via
+// -ldflags "-X main.version=<version> -X main.commit=<commit>"
+var (
+	version = "dev"
+	commit  = "unknown"
 )
 
 // Global variable to store current run timestamp
 var currentRunTimestamp string
 var timeFormatLock sync.Mutex
 
+// Checkpoint journal of the cycle in progress, used to resume interrupted cycles
+var activeJournal *checkpoint.Journal
+var journalLock sync.Mutex
+
+// Destination of cycle metrics; discards them unless METRICS_BACKEND is set
+var metricsSink metrics.Sink = metrics.Nop{}
+
+// Serves /healthz and /metrics when HEALTH_PORT is set; told the outcome of every cycle
+var healthServer *health.Server
+
+// Receives the JSON report instead of email when MAILER_BACKEND=queue
+var reportPublisher queue.Publisher
+
+// Downtime note for the first report after a restart with CATCH_UP, cleared once it is sent
+var catchUpNote *mailer.Section
+
+// History writer of the cycle in progress, fed as balances are fetched
+var activeHistory *database.Writer
+var historyLock sync.Mutex
+
+// Holds failed fetches back from history while a retry pass may still replace them
+var historySkipFailed bool
+
+// Stream of the cycle in progress, posting balances to STREAM_WEBHOOK_URL as they are fetched
+var activeStream *stream.Streamer
+var streamLock sync.Mutex
+
+// Process exit status, applied after every deferred cleanup in main has run
+var exitCode int
+
+// errCycleFailed is returned by runFetchAndReport when a cycle ends before its report went out
+var errCycleFailed = errors.New("cycle ended without a report; see the errors logged above")
+
 func main() {
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	showVersion := flag.Bool("version", false, "print the build version and exit")
+	withDeltas := flag.Bool("with-deltas", false, "add a token_change column with each wallet's change since the previous run to the CSV")
+	once := flag.Bool("once", false, "run a single cycle and exit with status 1 if it fails, for cron")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(buildVersion())
+		return
+	}
+
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		fmt.Printf("Failed to load configuration: %v\n", err)
 		os.Exit(1)
 	}
+	cfg.WithDeltas = *withDeltas
+	cfg.RunOnce = cfg.RunOnce || *once
 
 	// Initialize logger
 	log, err := logger.New(cfg.LogsDirPath)
@@ -35,51 +114,281 @@ func main() {
 		os.Exit(1)
 	}
 	defer log.Close()
+	log.MinLevel = cfg.LogLevel
+	log.MaxLogSizeMB = cfg.LogMaxSizeMB
+	log.MaxLogBackups = cfg.LogMaxBackups
 
-	log.Log("Solana Balance Reporter started")
+	log.Log(fmt.Sprintf("Solana Balance Reporter %s started", buildVersion()))
 
 	// Log configuration details (but mask sensitive info)
 	log.Log(fmt.Sprintf("Configuration loaded - RPC URL: %s, Token Mint: %s, Email From: %s",
 		maskString(cfg.SolanaRPCURL), cfg.TokenMintAddress, cfg.EmailFrom))
-	log.Log(fmt.Sprintf("SMTP configured - Server: %s, Port: %d", cfg.SMTPServer, cfg.SMTPPort))
-	log.Log(fmt.Sprintf("Performance settings - Timeout: %v, Max Retries: %d, Concurrency: %d",
-		cfg.RPCTimeout, cfg.MaxRetries, cfg.ConcurrencyLimit))
+	for i, server := range cfg.SMTPServers {
+		log.Log(fmt.Sprintf("SMTP configured - Server %d: %s, Port: %d", i+1, server.Host, server.Port))
+	}
+
+	// Handle one-off commands
+	if flag.Arg(0) == "capture-baseline" {
+		baseline, err := runCaptureBaseline(cfg, flag.Arg(1))
+		if err != nil {
+			log.LogError("Capturing baseline failed", err)
+			fmt.Printf("Capturing baseline failed: %v\n", err)
+			log.Close()
+			os.Exit(1)
+		}
+		log.Log(fmt.Sprintf("Captured baseline %q with %d wallets", baseline.Name, len(baseline.Balances)))
+		fmt.Printf("Captured baseline %q with %d wallets\n", baseline.Name, len(baseline.Balances))
+		return
+	}
+	if flag.Arg(0) == "test-email" {
+		if err := runTestEmail(cfg, log); err != nil {
+			log.LogError("Test email failed", err)
+			fmt.Printf("Test email failed: %v\n", err)
+			log.Close()
+			os.Exit(1)
+		}
+		fmt.Println("Test email sent successfully")
+		return
+	}
+
+	log.Log(fmt.Sprintf("Performance settings - Timeout: %v, Max Retries: %d, Mail Max Retries: %d, Concurrency: %d",
+		cfg.RPCTimeout, cfg.MaxRetries, cfg.MailMaxRetries, cfg.ConcurrencyLimit))
 
 	// Initialize components
 	addressReader := reader.New(cfg.AddressesFilePath, log)
-	solanaClient := solana.New(cfg.SolanaRPCURL, cfg.TokenMintAddress, cfg.RPCTimeout, cfg.MaxRetries, log)
-	csvWriter, err := csvwriter.New(cfg.CSVDirPath, log)
+	addressReader.Normalize = cfg.NormalizeAddresses
+	addressReader.Strict = cfg.StrictAddresses
+	addressReader.AllowDuplicates = cfg.AllowDuplicates
+	solanaClient := solana.New(cfg.SolanaRPCURL, cfg.TokenMintAddress, cfg.Commitment, cfg.RPCTimeout, cfg.MaxRetries, log)
+	solanaClient.FetchSol = cfg.FetchMode == "both"
+	solanaClient.BulkMode = cfg.BulkMode
+	solanaClient.PreferUIString = cfg.PreferUIString
+	onResult := func(balance *solana.TokenBalance) {
+		recordCheckpoint(balance, log)
+		recordHistory(balance)
+		recordStream(balance)
+	}
+	solanaClient.OnResult = onResult
+	solanaClient.RetryLogEvery = cfg.RetryLogEvery
+	solanaClient.ZeroBalanceCodes = cfg.ZeroBalanceRPCCodes
+	solanaClient.RetryOn500 = cfg.RetryOn500
+	solanaClient.MaxResponseBytes = cfg.MaxResponseBytes
+	if len(cfg.SolanaRPCURLs) > 1 {
+		solanaClient.SetEndpoints(cfg.SolanaRPCURLs)
+		masked := make([]string, len(cfg.SolanaRPCURLs))
+		for i, rpcURL := range cfg.SolanaRPCURLs {
+			masked[i] = maskString(rpcURL)
+		}
+		log.Log(fmt.Sprintf("RPC endpoints, in failover order: %s", strings.Join(masked, ", ")))
+	}
+
+	// Bound and cache DNS lookups of the RPC host
+	if cfg.DNSMaxLookups > 0 || cfg.DNSCacheTTL > 0 {
+		solanaClient.SetResolver(solana.NewResolver(cfg.DNSMaxLookups, cfg.DNSCacheTTL))
+		log.Log(fmt.Sprintf("DNS settings - Max concurrent lookups: %d, Cache TTL: %v", cfg.DNSMaxLookups, cfg.DNSCacheTTL))
+	}
+
+	// Trust a private CA for RPC and SMTP TLS when configured
+	rootCAs, err := loadRootCAs(cfg.TLSCAFile)
+	if err != nil {
+		log.LogError("Failed to load TLS CA bundle", err)
+		os.Exit(1)
+	}
+	if rootCAs != nil {
+		solanaClient.SetRootCAs(rootCAs)
+		log.Log(fmt.Sprintf("Using TLS CA bundle %s", cfg.TLSCAFile))
+	}
+
+	// Select the balance source; RPC is the default
+	var balanceFetcher solana.BalanceFetcher = solanaClient
+	if cfg.BalanceSource == "graphql" {
+		query := cfg.GraphQLQuery
+		if query == "" {
+			query = graphql.DefaultQuery
+		}
+		graphqlClient := graphql.New(cfg.GraphQLURL, query, cfg.GraphQLBalanceField,
+			cfg.TokenMintAddress, cfg.RPCTimeout, cfg.MaxRetries, log)
+		graphqlClient.OnResult = onResult
+		graphqlClient.RetryLogEvery = cfg.RetryLogEvery
+		graphqlClient.MaxResponseBytes = cfg.MaxResponseBytes
+		if rootCAs != nil {
+			graphqlClient.SetRootCAs(rootCAs)
+		}
+		balanceFetcher = graphqlClient
+		log.Log(fmt.Sprintf("Using GraphQL indexer balance source: %s", maskString(cfg.GraphQLURL)))
+	}
+
+	rounder := rounding.Rounder{Places: cfg.BalanceRoundPlaces, Mode: cfg.BalanceRoundMode}
+	csvDir := cfg.CSVDirPath
+	if cfg.SkipCSV {
+		csvDir = "" // Nothing is written to disk
+	}
+	var csvWriter *csvwriter.CSVWriter
+	err = retryInit("CSV writer", cfg.InitMaxRetries, log, func() error {
+		var err error
+		csvWriter, err = csvwriter.New(csvDir, rounder, log)
+		return err
+	})
 	if err != nil {
 		log.LogError("Failed to initialize CSV writer", err)
 		os.Exit(1)
 	}
-	mailClient := mailer.New(
-		cfg.SMTPServer,
-		cfg.SMTPPort,
-		cfg.SMTPUsername,
-		cfg.SMTPPassword,
-		cfg.EmailFrom,
-		cfg.EmailTo,
-		cfg.MaxRetries,
-		log,
-	)
+	csvWriter.UseCRLF = cfg.CSVCRLF
+	csvWriter.FallbackDir = cfg.CSVFallbackDirPath
+	csvWriter.IncludeSolColumn = cfg.FetchMode == "both"
+	csvWriter.IncludeStatus = cfg.IncludeStatus
+	csvWriter.IncludeTokenAccount = cfg.IncludeTokenAccount
+	csvWriter.IncludeRaw = cfg.IncludeRaw
+	csvWriter.IncludeAttempts = cfg.IncludeAttempts
+	csvWriter.IncludeAccountType = cfg.IncludeAccountType
+	csvWriter.IncludePrevious = cfg.IncludePrevious
+	csvWriter.IncludeChange = cfg.WithDeltas
+	csvWriter.Fsync = cfg.CSVFsync
+	csvWriter.Compress = cfg.CompressCSV
+	csvWriter.SortBy = cfg.CSVSort
 
-	// Setup ticker for periodic execution
-	ticker := time.NewTicker(time.Duration(cfg.FetchIntervalMinutes) * time.Minute)
-	defer ticker.Stop()
+	// The JSON summary is optional; a nil writer skips it
+	var jsonWriter *jsonwriter.JSONWriter
+	if cfg.SummaryJSON {
+		err = retryInit("JSON writer", cfg.InitMaxRetries, log, func() error {
+			var err error
+			jsonWriter, err = jsonwriter.New(cfg.JSONDirPath, log)
+			return err
+		})
+		if err != nil {
+			log.LogError("Failed to initialize JSON writer", err)
+			os.Exit(1)
+		}
+		jsonWriter.Compress = cfg.CompressJSON
+	}
+
+	mailClient, err := newMailer(cfg, log)
+	if err != nil {
+		log.LogError("Failed to initialize mailer", err)
+		os.Exit(1)
+	}
+
+	// Announce runs on chat channels as well as, or instead of, email
+	var notifiers []notifier.Notifier
+	if cfg.NotifySlack {
+		notifiers = append(notifiers, notifier.NewSlack(cfg.SlackWebhookURL, cfg.RPCTimeout))
+	}
+
+	// Open the history database; the reporter keeps working without it unless the
+	// addresses are read from it
+	db, err := database.Open(cfg.DBPath, cfg.DBBusyTimeout)
+	if err != nil && cfg.AddressSource == "db" {
+		log.LogError("Failed to open database for ADDRESS_SOURCE=db", err)
+		os.Exit(1)
+	} else if err != nil {
+		log.LogError("Failed to open database, balance history is disabled", err)
+		db = nil
+	} else {
+		defer db.Close()
+		lastRun := db.GetLastRun()
+		if lastRun != nil {
+			message := fmt.Sprintf("Previous report: run %s sent at %s",
+				lastRun.RunTimestamp.Format(time.RFC3339), lastRun.SentAt.Format(time.RFC3339))
+			if lastRun.CSVPath != "" {
+				message += " with " + lastRun.CSVPath
+			}
+			log.Log(message)
+		} else {
+			log.Log("No previous report recorded")
+		}
+
+		// Tell recipients about reports missed while the reporter was down
+		if cfg.CatchUp {
+			interval := time.Duration(cfg.FetchIntervalMinutes) * time.Minute
+			deferred, err := loadDeferredReports(deferredReportsPath(cfg.CheckpointPath))
+			if err != nil {
+				log.LogError("Failed to load deferred reports", err)
+			}
+			if section, missed := catchUpSection(lastRun, len(deferred), time.Now(), interval); missed > 0 {
+				log.Warn(fmt.Sprintf("%d scheduled reports were missed since the last run, noting it in the next report", missed))
+				catchUpNote = &section
+			}
+		}
+
+		if cfg.AddressSource == "db" {
+			addressReader.Source = db.AddressTable(cfg.AddressQuery)
+		}
+	}
+
+	// Publish metrics to the configured backend
+	metricsSink, err = metrics.New(cfg.MetricsBackend, cfg.MetricsFile, cfg.StatsdAddr)
+	if err != nil {
+		log.LogError("Failed to initialize metrics, continuing without them", err)
+		metricsSink = metrics.Nop{}
+	} else if cfg.MetricsBackend != "none" {
+		log.Log(fmt.Sprintf("Publishing metrics via %s", cfg.MetricsBackend))
+	}
+
+	// Serve health checks and metrics for container orchestrators. A run is due every
+	// fetch interval, so the reporter is unhealthy after two intervals without success.
+	if cfg.HealthPort > 0 {
+		scraped, ok := metricsSink.(*metrics.Prometheus)
+		if !ok {
+			scraped = metrics.NewPrometheus("")
+			metricsSink = metrics.Tee{metricsSink, scraped}
+		}
+		interval := time.Duration(cfg.FetchIntervalMinutes) * time.Minute
+		healthServer = health.New(fmt.Sprintf(":%d", cfg.HealthPort), 2*interval, scraped, log)
+		if err := healthServer.Start(); err != nil {
+			log.LogError("Failed to start health server, continuing without it", err)
+			healthServer = nil
+		} else {
+			log.Log(fmt.Sprintf("Serving /healthz and /metrics on port %d", cfg.HealthPort))
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := healthServer.Shutdown(ctx); err != nil {
+					log.LogError("Failed to stop health server", err)
+				}
+			}()
+		}
+	}
+
+	// Publish reports to a message queue instead of email
+	if cfg.MailerBackend == "queue" {
+		reportPublisher, err = queue.New(cfg.QueueURL, cfg.RPCTimeout)
+		if err != nil {
+			log.LogError("Failed to initialize queue publisher", err)
+			os.Exit(1)
+		}
+		log.Log(fmt.Sprintf("Publishing reports to topic %s at %s", cfg.QueueTopic, maskString(cfg.QueueURL)))
+	}
 
 	// Setup signal handling for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// Give dependencies (RPC proxy, DNS) time to settle before the first cycle
+	if !waitStartupDelay(cfg.StartupDelay, time.After, sigChan, log) {
+		return
+	}
+
+	// Leave scheduling to cron: a single cycle whose outcome is the exit status
+	if cfg.RunOnce {
+		if err := runFetchAndReport(addressReader, solanaClient, balanceFetcher, csvWriter, jsonWriter, mailClient, notifiers, db, rounder, cfg, log); err != nil {
+			log.LogError("Run failed", err)
+			exitCode = 1
+		}
+		return
+	}
+
+	// Setup ticker for periodic execution
+	ticker := time.NewTicker(time.Duration(cfg.FetchIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
 	// Run once immediately
-	runFetchAndReport(addressReader, solanaClient, csvWriter, mailClient, cfg, log)
+	runFetchAndReport(addressReader, solanaClient, balanceFetcher, csvWriter, jsonWriter, mailClient, notifiers, db, rounder, cfg, log)
 
 	// Main loop
 	for {
 		select {
 		case <-ticker.C:
-			runFetchAndReport(addressReader, solanaClient, csvWriter, mailClient, cfg, log)
+			runFetchAndReport(addressReader, solanaClient, balanceFetcher, csvWriter, jsonWriter, mailClient, notifiers, db, rounder, cfg, log)
 		case sig := <-sigChan:
 			log.Log(fmt.Sprintf("Received signal %s, shutting down...", sig))
 			return
@@ -87,6 +396,157 @@ func main() {
 	}
 }
 
+// waitStartupDelay waits delay before the first cycle, using after as the clock, and
+// reports whether to go on; a signal received while waiting shuts the reporter down
+func waitStartupDelay(delay time.Duration, after func(time.Duration) <-chan time.Time, sigChan <-chan os.Signal, log *logger.Logger) bool {
+	if delay <= 0 {
+		return true
+	}
+
+	log.Log(fmt.Sprintf("Waiting %v before the first cycle", delay))
+	select {
+	case <-after(delay):
+		return true
+	case sig := <-sigChan:
+		log.Log(fmt.Sprintf("Received signal %s, shutting down...", sig))
+		return false
+	}
+}
+
+// newMailer creates the mailer from the configured relays and recipients
+func newMailer(cfg *config.Config, log *logger.Logger) (*mailer.Mailer, error) {
+	smtpServers := make([]mailer.SMTPServer, 0, len(cfg.SMTPServers))
+	for _, server := range cfg.SMTPServers {
+		smtpServers = append(smtpServers, mailer.SMTPServer{
+			Host:     server.Host,
+			Port:     server.Port,
+			Username: server.Username,
+			Password: server.Password,
+		})
+	}
+
+	mailClient := mailer.New(
+		smtpServers,
+		cfg.EmailFrom,
+		cfg.EmailTo,
+		cfg.MailMaxRetries,
+		log,
+	)
+	mailClient.BuildVersion = buildVersion()
+	mailClient.CC = cfg.EmailCC
+	mailClient.BCC = cfg.EmailBCC
+	mailClient.Concurrency = cfg.EmailConcurrency
+	mailClient.MaxRecipients = cfg.MaxRcptPerMessage
+	mailClient.Environment = cfg.AppEnv
+	mailClient.Banner = cfg.EnvBanner
+	mailClient.TokenLabel = cfg.TokenLabel
+	mailClient.DefaultLocation = cfg.ReportLocation
+	mailClient.RecipientLocations = cfg.RecipientLocations
+	if err := mailClient.SetFooter(cfg.EmailFooter); err != nil {
+		return nil, err
+	}
+	if err := mailClient.SetSubjectTemplate(cfg.EmailSubjectTemplate); err != nil {
+		return nil, err
+	}
+	if err := mailClient.SetBodyTemplate(cfg.EmailBodyTemplate); err != nil {
+		return nil, err
+	}
+	mailClient.TokenMint = cfg.TokenMintAddress
+	mailClient.DryRun = cfg.DryRun
+	mailClient.QRCode = cfg.EmailQR
+
+	rootCAs, err := loadRootCAs(cfg.TLSCAFile)
+	if err != nil {
+		return nil, err
+	}
+	mailClient.RootCAs = rootCAs
+	mailClient.StatusURL = cfg.DeliveryStatusURL
+	mailClient.Format = cfg.EmailFormat
+	mailClient.HTMLTopN = cfg.EmailTopN
+	mailClient.CompressAttachment = cfg.CompressAttachment
+	mailClient.MaxBodyBytes = cfg.MaxEmailBodyBytes
+	mailClient.Rounder = rounding.Rounder{Places: cfg.BalanceRoundPlaces, Mode: cfg.BalanceRoundMode}
+
+	return mailClient, nil
+}
+
+// initBackoff is the wait before the first retry of a component initializer; it doubles per retry
+var initBackoff = time.Second
+
+// retryInit runs a component initializer, retrying with exponential backoff so a volume
+// that mounts slowly at boot does not stop the reporter
+func retryInit(name string, maxRetries int, log *logger.Logger, init func() error) error {
+	delay := initBackoff
+	for attempt := 0; ; attempt++ {
+		err := init()
+		if err == nil || attempt >= maxRetries {
+			return err
+		}
+
+		log.LogError(fmt.Sprintf("Failed to initialize %s, retrying in %v (attempt %d/%d)",
+			name, delay, attempt+1, maxRetries), err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// loadRootCAs reads a PEM CA bundle into a pool used instead of the system roots.
+// An empty path returns a nil pool, meaning the system roots.
+func loadRootCAs(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS_CA_FILE: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// runCaptureBaseline stores the latest recorded balances as a named baseline
+func runCaptureBaseline(cfg *config.Config, name string) (database.Baseline, error) {
+	if name == "" {
+		return database.Baseline{}, fmt.Errorf("usage: capture-baseline <name>")
+	}
+
+	db, err := database.Open(cfg.DBPath, cfg.DBBusyTimeout)
+	if err != nil {
+		return database.Baseline{}, err
+	}
+	defer db.Close()
+
+	return db.CaptureBaseline(name, time.Now())
+}
+
+// runTestEmail sends a test email to the configured recipients and reports the outcome
+func runTestEmail(cfg *config.Config, log *logger.Logger) error {
+	mailClient, err := newMailer(cfg, log)
+	if err != nil {
+		return err
+	}
+
+	if cfg.EmailToFile != "" {
+		fileRecipients, err := reader.ReadRecipients(cfg.EmailToFile, log)
+		if err != nil {
+			return err
+		}
+		mailClient.SetRecipients(mergeRecipients(cfg.EmailTo, fileRecipients))
+	}
+
+	return mailClient.SendTestEmail()
+}
+
+// buildVersion formats the injected build information
+func buildVersion() string {
+	return fmt.Sprintf("%s (commit %s)", version, commit)
+}
+
 // getRunTimestamp generates a consistent timestamp for the current run
 func getRunTimestamp() string {
 	timeFormatLock.Lock()
@@ -98,6 +558,168 @@ func getRunTimestamp() string {
 	return currentRunTimestamp
 }
 
+// getRunTime returns the current run timestamp as a time
+func getRunTime() time.Time {
+	t, err := time.Parse("2006-01-02_15_04_05", getRunTimestamp())
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return t
+}
+
+// setRunTimestamp overrides the timestamp of the current run, e.g. when resuming a cycle
+func setRunTimestamp(timestamp string) {
+	timeFormatLock.Lock()
+	defer timeFormatLock.Unlock()
+	currentRunTimestamp = timestamp
+}
+
+// pruneOldFiles deletes CSV reports and activity logs older than RETENTION_DAYS
+func pruneOldFiles(cfg *config.Config, log *logger.Logger) {
+	cutoff := time.Now().UTC().AddDate(0, 0, -cfg.RetentionDays)
+
+	csvRemoved := 0
+	for _, dir := range []string{cfg.CSVDirPath, cfg.CSVFallbackDirPath} {
+		if dir == "" {
+			continue
+		}
+		removed, err := retention.Clean(dir, "balance_", ".csv", cutoff)
+		if err != nil {
+			log.LogError("Failed to prune old CSV files", err)
+		}
+		csvRemoved += removed
+	}
+	logsRemoved, err := retention.Clean(cfg.LogsDirPath, "activity_", ".log", cutoff)
+	if err != nil {
+		log.LogError("Failed to prune old log files", err)
+	}
+
+	log.Log(fmt.Sprintf("Removed %d CSV and %d log files older than %d days", csvRemoved, logsRemoved, cfg.RetentionDays))
+}
+
+// setActiveJournal sets the checkpoint journal that receives completed fetches
+func setActiveJournal(journal *checkpoint.Journal) {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+	activeJournal = journal
+}
+
+// recordCheckpoint stores a completed fetch in the active checkpoint journal, if any
+func recordCheckpoint(balance *solana.TokenBalance, log *logger.Logger) {
+	journalLock.Lock()
+	defer journalLock.Unlock()
+
+	if activeJournal == nil {
+		return
+	}
+	if err := activeJournal.Record(balance); err != nil {
+		log.LogError("Failed to record cycle checkpoint", err)
+	}
+}
+
+// setActiveHistory sets the history writer that fetched balances are queued on
+func setActiveHistory(writer *database.Writer) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	activeHistory = writer
+}
+
+// setHistorySkipFailed controls whether failed fetches are held back from history
+func setHistorySkipFailed(skip bool) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+	historySkipFailed = skip
+}
+
+// recordHistory queues a fetched balance on the active history writer, if any
+func recordHistory(balance *solana.TokenBalance) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	if activeHistory == nil {
+		return
+	}
+	if historySkipFailed && fetchFailed(balance) {
+		return
+	}
+	activeHistory.Add(balance)
+}
+
+// setActiveStream sets the streamer that fetched balances are posted through
+func setActiveStream(streamer *stream.Streamer) {
+	streamLock.Lock()
+	defer streamLock.Unlock()
+	activeStream = streamer
+}
+
+// recordStream queues a fetched balance on the active streamer, if any
+func recordStream(balance *solana.TokenBalance) {
+	streamLock.Lock()
+	defer streamLock.Unlock()
+
+	if activeStream != nil {
+		activeStream.Add(balance)
+	}
+}
+
+// fetchFailed reports whether any part of a wallet's fetch failed
+func fetchFailed(balance *solana.TokenBalance) bool {
+	return balance.FetchError != nil || balance.SolanaError != nil
+}
+
+// retryFailedWallets waits RETRY_PASS_DELAY on the after clock and refetches the wallets
+// whose fetch failed, replacing their results. Failed results held back from history during
+// the first pass are recorded here once they are final.
+func retryFailedWallets(ctx context.Context, fetcher solana.BalanceFetcher, balances []*solana.TokenBalance,
+	errors []error, cfg *config.Config, after func(time.Duration) <-chan time.Time, log *logger.Logger) ([]*solana.TokenBalance, []error) {
+	setHistorySkipFailed(false)
+
+	// Positions of each failed address; with ALLOW_DUPLICATE_ADDRESSES an address can
+	// fail at several positions and every one is retried
+	index := make(map[string][]int)
+	failed := []string{}
+	for i, balance := range balances {
+		if fetchFailed(balance) {
+			index[balance.WalletAddress] = append(index[balance.WalletAddress], i)
+			failed = append(failed, balance.WalletAddress)
+		}
+	}
+	if len(failed) == 0 {
+		return balances, errors
+	}
+
+	log.Log(fmt.Sprintf("Retrying %d failed wallets after %v", len(failed), cfg.RetryPassDelay))
+	select {
+	case <-ctx.Done():
+		log.Log("Cycle deadline reached before the retry pass, keeping first pass results")
+		for _, positions := range index {
+			for _, i := range positions {
+				recordHistory(balances[i])
+			}
+		}
+		return balances, errors
+	case <-after(cfg.RetryPassDelay):
+	}
+
+	retried, retryErrors := fetcher.FetchTokenBalances(ctx, failed, cfg.ConcurrencyLimit)
+	recovered := 0
+	for _, balance := range retried {
+		positions := index[balance.WalletAddress]
+		if len(positions) == 0 {
+			continue
+		}
+		balances[positions[0]] = balance
+		index[balance.WalletAddress] = positions[1:]
+		if !fetchFailed(balance) {
+			recovered++
+		}
+	}
+	log.Log(fmt.Sprintf("Retry pass recovered %d of %d failed wallets", recovered, len(failed)))
+
+	// Every first pass error belongs to a retried wallet, so only the retry errors remain
+	return balances, retryErrors
+}
+
 // resetRunTimestamp clears the timestamp to prepare for the next run
 func resetRunTimestamp() {
 	timeFormatLock.Lock()
@@ -105,6 +727,18 @@ func resetRunTimestamp() {
 	currentRunTimestamp = ""
 }
 
+// newRequestID generates a random UUID (version 4) identifying a cycle
+func newRequestID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	id[6] = (id[6] & 0x0f) | 0x40 // Version 4
+	id[8] = (id[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]), nil
+}
+
 // maskString masks sensitive data like API keys and tokens
 func maskString(input string) string {
 	if len(input) <= 10 {
@@ -115,35 +749,372 @@ func maskString(input string) string {
 	return input[:10] + "***"
 }
 
-// runFetchAndReport fetches balances and sends a report
+// mergeRecipients returns the union of the recipient lists, deduplicated case-insensitively
+// while preserving first-seen order
+func mergeRecipients(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	merged := []string{}
+	for _, list := range lists {
+		for _, recipient := range list {
+			key := strings.ToLower(recipient)
+			if recipient == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged = append(merged, recipient)
+		}
+	}
+	return merged
+}
+
+// recordChecksums appends the checksums of produced to the manifest. With per-run
+// directories the manifest covers only this run and sits next to its first file.
+// Returns the manifest path.
+func recordChecksums(manifestFile string, runDirs bool, produced []string, log *logger.Logger) string {
+	manifestPath := manifestFile
+	if runDirs {
+		manifestPath = filepath.Join(filepath.Dir(produced[0]), filepath.Base(manifestFile))
+	}
+	if err := manifest.Append(manifestPath, produced); err != nil {
+		log.LogError("Failed to update checksum manifest", err)
+	} else {
+		log.Log(fmt.Sprintf("Recorded %d checksums in %s", len(produced), manifestPath))
+	}
+	return manifestPath
+}
+
+// produceCSV writes the balances CSV and returns its uncompressed content for the email
+// together with the written path. With skip set nothing is written and the path is empty.
+func produceCSV(csvWriter *csvwriter.CSVWriter, balances []*solana.TokenBalance, filename string, skip, compressed bool) ([]byte, string, error) {
+	var content []byte
+	if skip || compressed {
+		rendered, err := csvWriter.Render(balances)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to render balances as CSV: %w", err)
+		}
+		content = rendered
+	}
+	if skip {
+		return content, "", nil
+	}
+
+	path, err := csvWriter.WriteBalancesWithFilename(balances, filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to write balances to CSV: %w", err)
+	}
+	if content == nil {
+		content, err = os.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read CSV report: %w", err)
+		}
+	}
+	return content, path, nil
+}
+
+// checkRunBudget reports whether a cycle that started at start ran past RUN_BUDGET, in
+// which case it is logged and counted in run_budget_exceeded_total. A budget of 0 is unbounded.
+func checkRunBudget(start time.Time, budget time.Duration, log *logger.Logger) bool {
+	elapsed := time.Since(start)
+	if budget <= 0 || elapsed <= budget {
+		return false
+	}
+	log.Warn(fmt.Sprintf("cycle took %v, over RUN_BUDGET of %v", elapsed.Round(time.Second), budget))
+	metricsSink.Count("run_budget_exceeded_total", 1)
+	return true
+}
+
+// publishReport publishes the report summary to the queue topic. Once it is published
+// the run is recorded and the alerts it carried start their cooldown, as after an email.
+func publishReport(publisher queue.Publisher, balances []*solana.TokenBalance, csvPath string, cfg *config.Config, db *database.DB, alerts *alertGate, log *logger.Logger) error {
+	payload, err := jsonwriter.EncodeSummary(report.Summarize(balances, getRunTime(), cfg.SummaryTopN))
+	if err != nil {
+		return fmt.Errorf("failed to encode report for queue: %w", err)
+	}
+	if err := publisher.Publish(cfg.QueueTopic, payload); err != nil {
+		return err
+	}
+	log.Log(fmt.Sprintf("Published report (%d bytes) to topic %s", len(payload), cfg.QueueTopic))
+
+	if db != nil {
+		if err := db.UpdateLastRun(getRunTime(), csvPath); err != nil {
+			log.LogError("Failed to record last run", err)
+		}
+	}
+	if err := alerts.commit(); err != nil {
+		log.LogError("Failed to record sent alerts", err)
+	}
+	return nil
+}
+
+// runFetchAndReport fetches balances and sends a report. It returns errCycleFailed when
+// the cycle ended before its report went out; the cause has already been logged. A report
+// deferred during quiet hours is not an error, but neither is the cycle counted as delivered.
 func runFetchAndReport(
 	addressReader *reader.AddressReader,
 	solanaClient *solana.Client,
+	balanceFetcher solana.BalanceFetcher,
 	csvWriter *csvwriter.CSVWriter,
+	jsonWriter *jsonwriter.JSONWriter,
 	mailClient *mailer.Mailer,
+	notifiers []notifier.Notifier,
+	db *database.DB,
+	rounder rounding.Rounder,
 	cfg *config.Config,
 	log *logger.Logger,
-) {
+) (runErr error) {
+	cycleStart := time.Now()
+
+	// Bound the whole cycle by RUN_BUDGET: the fetch is cut short at the deadline and
+	// email sends stop retrying once it passes
+	var runDeadline time.Time
+	if cfg.RunBudget > 0 {
+		runDeadline = cycleStart.Add(cfg.RunBudget)
+	}
+
+	// Publish cycle metrics however the cycle ends; cycleOK is set once a report is out.
+	// A report deferred by quiet hours is not a failure.
+	cycleOK, reportDeferred := false, false
+	defer func() {
+		if healthServer != nil {
+			healthServer.RecordRun(cycleOK || reportDeferred)
+		}
+		if !cycleOK && !reportDeferred {
+			runErr = errCycleFailed
+		}
+		checkRunBudget(cycleStart, cfg.RunBudget, log)
+		metricsSink.Count("cycles_total", 1)
+		metricsSink.Gauge("cycle_duration_seconds", time.Since(cycleStart).Seconds())
+		metricsSink.Gauge("last_cycle_timestamp_seconds", float64(time.Now().Unix()))
+		if err := metricsSink.Flush(); err != nil {
+			log.LogError("Failed to publish metrics", err)
+		}
+	}()
+
 	// Reset the timestamp for a new run
 	resetRunTimestamp()
 
+	// Pick up an interrupted cycle, reusing its run timestamp so outputs line up
+	var completed map[string]*solana.TokenBalance
+	var checkpointErr error
+	resuming := false
+	if cfg.ResumeCycles {
+		var runID string
+		runID, completed, checkpointErr = checkpoint.Load(cfg.CheckpointPath)
+		if checkpointErr == nil && runID != "" {
+			setRunTimestamp(runID)
+			resuming = true
+		}
+	}
+
 	// Create a new log file for this iteration
 	if err := log.SetFilename(fmt.Sprintf("activity_%s.log", getRunTimestamp())); err != nil {
 		fmt.Printf("Failed to set log filename: %v\n", err)
 		return
 	}
 
+	// Tag every log line and the email of this cycle with a fresh request id
+	requestID := ""
+	if cfg.LogRequestID {
+		var err error
+		requestID, err = newRequestID()
+		if err != nil {
+			log.LogError("Failed to generate request id", err)
+		}
+		log.SetRequestID(requestID)
+	}
+
+	// Keep a machine-readable record of the cycle in the audit file; errors logged
+	// during the cycle are collected into it
+	var cycleAudit *audit.Record
+	if cfg.AuditFile != "" {
+		auditID := requestID
+		if auditID == "" {
+			auditID = getRunTimestamp()
+		}
+		cycleAudit = audit.NewRecord(auditID, cycleStart)
+		log.OnError = cycleAudit.AddError
+		defer func() {
+			log.OnError = nil
+			cycleAudit.AddMessageIDs(mailClient.TakeMessageIDs())
+			if err := audit.Append(cfg.AuditFile, cycleAudit, time.Now()); err != nil {
+				log.LogError("Failed to write audit record", err)
+			}
+		}()
+	}
+
+	// Prune old reports and logs once the cycle is over, however it ended
+	if cfg.RetentionDays > 0 {
+		defer pruneOldFiles(cfg, log)
+	}
+
 	log.Log("Starting balance fetch cycle")
+	if checkpointErr != nil {
+		log.LogError("Failed to load cycle checkpoint, starting a fresh cycle", checkpointErr)
+	}
+	if resuming {
+		log.Log(fmt.Sprintf("Resuming interrupted cycle %s with %d wallets already fetched",
+			getRunTimestamp(), len(completed)))
+	}
 
 	// Read wallet addresses
-	addresses, err := addressReader.ReadAddresses()
+	entries, invalid, err := addressReader.ReadEntries()
+	metricsSink.Gauge("invalid_addresses", float64(len(invalid)))
 	if err != nil {
 		log.LogError("Failed to read addresses", err)
 		return
 	}
 
+	addresses := make([]string, 0, len(entries))
+	skipSol := []string{}
+	accountTypes := make(map[string]solana.AccountType)
+	expectations := make(map[string][]reader.Expectation)
+	for _, entry := range entries {
+		addresses = append(addresses, entry.Address)
+		if entry.SkipSol {
+			skipSol = append(skipSol, entry.Address)
+		}
+		if entry.AccountType != solana.AccountWallet {
+			accountTypes[entry.Address] = entry.AccountType
+		}
+		if len(entry.Expectations) > 0 {
+			expectations[entry.Address] = entry.Expectations
+		}
+	}
+	solanaClient.SetSkipSol(skipSol)
+	solanaClient.SetAccountTypes(accountTypes)
+	if len(accountTypes) > 0 && cfg.BalanceSource != "rpc" {
+		log.Warn(fmt.Sprintf("%d vote and stake accounts are fetched as wallets with BALANCE_SOURCE=%s",
+			len(accountTypes), cfg.BalanceSource))
+	}
+
+	// Pin the cycle to a single slot so all wallets reflect the same snapshot
+	if cfg.PinSlot && cfg.BalanceSource == "rpc" {
+		slot, err := solanaClient.PinSlot()
+		if err != nil {
+			log.LogError("Failed to pin slot, fetching unpinned", err)
+		} else {
+			log.Log(fmt.Sprintf("Pinned cycle to minimum context slot %d", slot))
+		}
+	}
+
+	// Optionally catch program, mint and token accounts listed as wallets
+	if cfg.ValidateAccountType != "" {
+		addresses = solanaClient.ValidateAccounts(addresses, cfg.ConcurrencyLimit, cfg.ValidateAccountType == "skip")
+	}
+
+	// Only fetch wallets the interrupted cycle did not complete
+	pending := addresses
+	if len(completed) > 0 {
+		pending = make([]string, 0, len(addresses))
+		for _, address := range addresses {
+			if _, done := completed[address]; !done {
+				pending = append(pending, address)
+			}
+		}
+	}
+
+	// Journal completed wallets so a crash can resume this cycle
+	if cfg.ResumeCycles {
+		journal, err := checkpoint.Open(cfg.CheckpointPath, getRunTimestamp(), resuming)
+		if err != nil {
+			log.LogError("Failed to open cycle checkpoint, continuing without resume support", err)
+		} else {
+			setActiveJournal(journal)
+			defer func() {
+				setActiveJournal(nil)
+				if err := journal.Complete(); err != nil {
+					log.LogError("Failed to clear cycle checkpoint", err)
+				}
+			}()
+		}
+	}
+
+	// Load the previous run's balances before this run starts recording
+	var previous map[string]database.BalanceRecord
+	var history *database.Writer
+	if db != nil {
+		if cfg.TopMovers > 0 || cfg.IncludePrevious || cfg.WithDeltas {
+			previous, err = db.LatestBalances(getRunTime())
+			if err != nil {
+				log.LogError("Failed to load previous balances, skipping comparisons", err)
+				previous = nil
+			}
+		}
+
+		// Persist balances in batches while the rest are still being fetched
+		history = db.NewWriter(getRunTime(), cfg.DBBatchSize, cfg.DBQueueSize)
+		setActiveHistory(history)
+	}
+
+	// Post balances to the live dashboard webhook as they are fetched
+	var streamer *stream.Streamer
+	if cfg.StreamWebhookURL != "" {
+		streamer = stream.New(cfg.StreamWebhookURL, getRunTime(), cfg.StreamBatchSize, cfg.StreamBufferSize,
+			cfg.StreamConcurrency, cfg.RPCTimeout, log)
+		setActiveStream(streamer)
+	}
+
+	// Bound the fetch so a cycle never overruns MAX_CYCLE_DURATION or RUN_BUDGET
+	fetchDeadline, fetchLimit := runDeadline, fmt.Sprintf("RUN_BUDGET (%v)", cfg.RunBudget)
+	if cfg.MaxCycleDuration > 0 {
+		cycleDeadline := cycleStart.Add(cfg.MaxCycleDuration)
+		if fetchDeadline.IsZero() || cycleDeadline.Before(fetchDeadline) {
+			fetchDeadline, fetchLimit = cycleDeadline, fmt.Sprintf("MAX_CYCLE_DURATION (%v)", cfg.MaxCycleDuration)
+		}
+	}
+	fetchCtx, cancelFetch := context.WithCancel(context.Background())
+	if !fetchDeadline.IsZero() {
+		fetchCtx, cancelFetch = context.WithDeadline(context.Background(), fetchDeadline)
+	}
+	defer cancelFetch()
+
 	// Fetch token balances
-	balances, errors := solanaClient.FetchTokenBalances(addresses, cfg.ConcurrencyLimit)
+	setHistorySkipFailed(cfg.RetryPassDelay > 0)
+	balances, errors := balanceFetcher.FetchTokenBalances(fetchCtx, pending, cfg.ConcurrencyLimit)
+
+	// Give failed wallets a second pass once the provider has had time to recover
+	if cfg.RetryPassDelay > 0 {
+		balances, errors = retryFailedWallets(fetchCtx, balanceFetcher, balances, errors, cfg, time.After, log)
+	}
+
+	// Report whatever completed if the deadline cut the fetch short
+	partialReason := ""
+	if fetchCtx.Err() == context.DeadlineExceeded {
+		unfetched := 0
+		for _, balance := range balances {
+			if balance.FetchError != nil {
+				unfetched++
+			}
+		}
+		partialReason = fmt.Sprintf("the cycle reached %s; %d wallets have no balance", fetchLimit, unfetched)
+		log.Log("Partial report: " + partialReason)
+	}
+
+	for _, address := range addresses {
+		if balance, done := completed[address]; done {
+			balances = append(balances, balance)
+			recordHistory(balance)
+		}
+	}
+
+	// Post the last balances to the stream webhook
+	if streamer != nil {
+		setActiveStream(nil)
+		posted, dropped, failed := streamer.Close()
+		log.Log(fmt.Sprintf("Streamed %d balances (%d dropped, %d failed)", posted, dropped, failed))
+		metricsSink.Count("stream_dropped_total", float64(dropped))
+	}
+
+	// Flush the remaining history records
+	if history != nil {
+		setActiveHistory(nil)
+		batches, err := history.Close()
+		if err != nil {
+			log.LogError("Failed to record balance history", err)
+		} else {
+			log.Log(fmt.Sprintf("Recorded balance history in %d batches", batches))
+		}
+	}
 
 	// Log errors
 	if len(errors) > 0 {
@@ -153,25 +1124,296 @@ func runFetchAndReport(
 		}
 	}
 
+	failedCount := 0
+	for _, balance := range balances {
+		if balance.FetchError != nil {
+			failedCount++
+		}
+	}
+	cycleAudit.SetCounts(len(balances), failedCount)
+	metricsSink.Gauge("wallets", float64(len(balances)))
+	metricsSink.Gauge("wallets_failed", float64(failedCount))
+	metricsSink.Count("fetch_errors_total", float64(len(errors)))
+	metricsSink.Count("addresses_processed_total", float64(len(balances)))
+
 	// If we have no balances, don't proceed
 	if len(balances) == 0 {
 		log.Log("No balances fetched, skipping report")
 		return
 	}
 
-	// Write balances to CSV with the same timestamp as the log file
+	// Fill the prev_balance and token_change columns from the last recorded run
+	if cfg.IncludePrevious || cfg.WithDeltas {
+		prevBalances := make(map[string]float64, len(previous))
+		for wallet, record := range previous {
+			prevBalances[wallet] = record.TokenBalance
+		}
+		csvWriter.SetPrevious(prevBalances)
+	}
+	if cfg.WithDeltas {
+		increased, decreased, unchanged, added := 0, 0, 0, 0
+		for _, delta := range database.ComputeDeltas(previous, balances) {
+			switch {
+			case delta.PreviousToken == nil:
+				added++
+			case delta.TokenChange > 0:
+				increased++
+			case delta.TokenChange < 0:
+				decreased++
+			default:
+				unchanged++
+			}
+		}
+		log.Log(fmt.Sprintf("Changes since the previous run - Increased: %d, Decreased: %d, Unchanged: %d, New: %d",
+			increased, decreased, unchanged, added))
+	}
+
+	// Write balances to CSV with the same timestamp as the log file, or only
+	// render it in memory for the email when SKIP_CSV is set. The email always
+	// attaches the uncompressed CSV, even when the file is gzipped.
 	csvFilename := fmt.Sprintf("balance_%s.csv", getRunTimestamp())
-	csvPath, err := csvWriter.WriteBalancesWithFilename(balances, csvFilename)
+	if cfg.RunDirs {
+		runDir := fmt.Sprintf("run_%s", getRunTimestamp())
+		csvWriter.SetSubdir(runDir)
+		if jsonWriter != nil {
+			jsonWriter.SetSubdir(runDir)
+		}
+	}
+	var produced []string
+	csvContent, csvPath, err := produceCSV(csvWriter, balances, csvFilename, cfg.SkipCSV, cfg.CompressCSV)
 	if err != nil {
-		log.LogError("Failed to write balances to CSV", err)
+		log.LogError("Failed to produce the CSV report", err)
+		return
+	}
+	if csvPath != "" {
+		produced = append(produced, csvPath)
+	}
+	csvReport := mailer.Attachment{Filename: csvFilename, Content: csvContent}
+	cycleAudit.SetCSV(csvContent)
+
+	// Write the JSON summary alongside the CSV and attach it to the email
+	var summary *mailer.Attachment
+	if jsonWriter != nil {
+		summaryFilename := fmt.Sprintf("summary_%s.json", getRunTimestamp())
+		balanceSummary := report.Summarize(balances, getRunTime(), cfg.SummaryTopN)
+		summaryPath, err := jsonWriter.WriteSummaryJSON(balanceSummary, summaryFilename)
+		if err != nil {
+			log.LogError("Failed to write balance summary", err)
+		} else if content, err := jsonwriter.EncodeSummary(balanceSummary); err == nil {
+			summary = &mailer.Attachment{Filename: summaryFilename, Content: content}
+			produced = append(produced, summaryPath)
+		}
+	}
+
+	// Record a checksum of every file this cycle produced
+	if cfg.ChecksumManifest != "" && len(produced) > 0 {
+		recordChecksums(cfg.ChecksumManifest, cfg.RunDirs, produced, log)
+	}
+
+	// Leave static wallets out of the change sections; the CSV still lists them
+	changed, stale := withoutStale(balances, db, cfg.StaleAfter)
+	if stale > 0 {
+		log.Log(fmt.Sprintf("Excluding %d wallets unchanged for %d runs from change sections", stale, cfg.StaleAfter))
+	}
+
+	// Compare against the previous run
+	var sections []mailer.Section
+	if previous != nil && cfg.TopMovers > 0 {
+		sections = append(sections, moversSections(changed, previous, cfg.TopMovers, rounder)...)
+	}
+
+	// Compare against the configured baseline snapshot
+	if cfg.Baseline != "" && db != nil {
+		if baseline, ok := db.GetBaseline(cfg.Baseline); ok {
+			n := cfg.TopMovers
+			if n <= 0 {
+				n = 5
+			}
+			sections = append(sections, baselineSection(balances, changed, baseline, n, rounder))
+		} else {
+			log.Warn(fmt.Sprintf("baseline %q not found, run capture-baseline first", cfg.Baseline))
+		}
+	}
+
+	// Segment wallets by balance tier, listing them in their own attachment
+	var tiersReport *mailer.Attachment
+	if len(cfg.Tiers) > 0 {
+		tiers := report.BucketByTier(balances, cfg.Tiers)
+		sections = append(sections, tiersSection(tiers, rounder))
+		if content, err := csvWriter.RenderTiers(tiers); err != nil {
+			log.LogError("Failed to render balance tiers", err)
+		} else {
+			tiersReport = &mailer.Attachment{Filename: fmt.Sprintf("tiers_%s.csv", getRunTimestamp()), Content: content}
+		}
+	}
+
+	// Alert on wallets breaking their expected-balance annotations
+	alerts := newAlertGate(db, cfg.AlertCooldown, cfg.AlertWalletCooldown)
+	if len(expectations) > 0 {
+		section, violations := expectationSection(balances, expectations, rounder, alerts)
+		if violations > 0 {
+			log.Warn(fmt.Sprintf("%d balance assertion violations", violations))
+		}
+		// Alerts lead the email so they are not missed below other sections
+		sections = append([]mailer.Section{section}, sections...)
+	}
+
+	// Check the sum of balances against the expected allocation
+	if cfg.ExpectedTotalToken != nil {
+		section, mismatch := expectedTotalSection(balances, *cfg.ExpectedTotalToken, cfg.ExpectedTotalTol, rounder)
+		if mismatch {
+			log.Warn("total token balance does not match EXPECTED_TOTAL_TOKEN")
+			sections = append([]mailer.Section{section}, sections...)
+		} else {
+			sections = append(sections, section)
+		}
+	}
+
+	// Flag wallets at risk of falling below the rent-exempt minimum
+	if cfg.FetchMode == "both" && (cfg.MinSolBalance > 0 || cfg.MinSolBalanceAuto) {
+		minSol := cfg.MinSolBalance
+		var rentErr error
+		if cfg.MinSolBalanceAuto {
+			minSol, rentErr = solanaClient.MinimumBalanceForRentExemption(context.Background(), 0)
+			if rentErr != nil {
+				log.LogError("Failed to fetch rent-exempt minimum, skipping low SOL check", rentErr)
+			}
+		}
+		if rentErr == nil {
+			sections = append(sections, lowSolSection(balances, minSol, rounder, alerts))
+		}
+	}
+
+	// The downtime note leads the first report after a restart
+	if catchUpNote != nil {
+		sections = append([]mailer.Section{*catchUpNote}, sections...)
+	}
+
+	// Refresh recipients from the roster file so changes apply without a restart
+	if cfg.EmailToFile != "" {
+		fileRecipients, err := reader.ReadRecipients(cfg.EmailToFile, log)
+		if err != nil {
+			log.LogError("Failed to read recipients file, using EMAIL_TO only", err)
+		}
+		recipients := mergeRecipients(cfg.EmailTo, fileRecipients)
+		log.Log(fmt.Sprintf("Loaded %d recipients (%d from %s)", len(recipients), len(fileRecipients), cfg.EmailToFile))
+		mailClient.SetRecipients(recipients)
+	}
+
+	// Post the run summary to the chat channels, which quiet hours do not hold back
+	if len(notifiers) > 0 {
+		notifyRun(notifiers, balances, csvPath, partialReason, cfg, log)
+	}
+
+	// Hand the report to the message queue instead of email
+	if reportPublisher != nil {
+		if err := publishReport(reportPublisher, balances, csvPath, cfg, db, alerts, log); err != nil {
+			log.LogError("Failed to publish report to queue", err)
+			metricsSink.Count("queue_failures_total", 1)
+			return
+		}
+		metricsSink.Count("queue_published_total", 1)
+		log.Log("Balance fetch cycle completed successfully")
+		cycleOK = true
 		return
 	}
 
-	// Send email report
-	if err := mailClient.SendReport(csvPath, balances); err != nil {
+	if !cfg.NotifyEmail {
+		if db != nil {
+			if err := db.UpdateLastRun(getRunTime(), csvPath); err != nil {
+				log.LogError("Failed to record last run", err)
+			}
+		}
+		log.Log("Balance fetch cycle completed successfully (email disabled by NOTIFY_CHANNELS)")
+		cycleOK = true
+		return
+	}
+
+	// Hold the email back during quiet hours; the CSV is already written. The cycle is
+	// not counted as delivered until the consolidated report goes out.
+	deferredPath := deferredReportsPath(cfg.CheckpointPath)
+	if cfg.QuietHours != nil && cfg.QuietHours.Contains(time.Now().In(cfg.ReportLocation)) {
+		pending, err := deferReport(deferredPath, newDeferredReport(csvReport, balances))
+		if err == nil {
+			log.Log(fmt.Sprintf("Quiet hours (%s), deferring email report (%d pending)", cfg.QuietHours, pending))
+			reportDeferred = true
+			return
+		}
+		log.LogError("Failed to defer email report, sending it now", err)
+	}
+
+	var attachments []mailer.Attachment
+	if summary != nil {
+		attachments = append(attachments, *summary)
+	}
+	if tiersReport != nil {
+		attachments = append(attachments, *tiersReport)
+	}
+
+	// Consolidate reports deferred during quiet hours into this one
+	deferredReports, err := loadDeferredReports(deferredPath)
+	if err != nil {
+		log.LogError("Failed to load deferred reports", err)
+	}
+	if len(deferredReports) > 0 {
+		sections = append(sections, deferredSection(deferredReports))
+		for _, deferred := range deferredReports {
+			attachments = append(attachments, deferred.Attachment)
+		}
+	}
+
+	// Send email report; its messages to the recipient groups go out EMAIL_CONCURRENCY at a time
+	err = mailClient.SendReports([]mailer.Report{{
+		Attachment: csvReport,
+		Balances:   balances,
+		Sections:   sections,
+		Options: mailer.SendOptions{
+			RequestID:        requestID,
+			Partial:          partialReason,
+			ExtraAttachments: attachments,
+			Deadline:         runDeadline,
+		},
+	}})[0]
+	deliveries := mailClient.TakeDeliveries()
+	if err != nil {
 		log.LogError("Failed to send email report", err)
+		metricsSink.Count("email_failures_total", 1)
 		return
 	}
+	if cfg.DryRun {
+		// Nothing went out, so the run and alert cooldowns are not recorded
+		log.Log("Balance fetch cycle completed (dry run, no email sent)")
+		cycleOK = true
+		return
+	}
+	metricsSink.Count("emails_sent_total", 1)
+
+	// Confirm the relay (and its status API, if configured) actually delivered the reports
+	if cfg.VerifyDelivery {
+		if failed := verifyDeliveries(cfg, mailClient, deliveries, db, log); failed > 0 {
+			metricsSink.Count("delivery_verification_failures_total", float64(failed))
+		}
+	}
+
+	// Remember the run so a restart knows when the last report went out
+	if db != nil {
+		if err := db.UpdateLastRun(getRunTime(), csvPath); err != nil {
+			log.LogError("Failed to record last run", err)
+		}
+	}
+
+	// Start the cooldown of the alerts that just went out
+	if err := alerts.commit(); err != nil {
+		log.LogError("Failed to record sent alerts", err)
+	}
+	catchUpNote = nil
+	if len(deferredReports) > 0 {
+		if err := clearDeferredReports(deferredPath); err != nil {
+			log.LogError("Failed to clear deferred reports", err)
+		}
+	}
 
+	cycleOK = true
 	log.Log("Balance fetch cycle completed successfully")
+	return nil
 }
@@ -0,0 +1,833 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/config"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/csvwriter"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/database"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/health"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/jsonwriter"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/mailer"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/metrics"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/reader"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/report"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/schedule"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// testLogger returns a logger writing to a temporary directory
+func testLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log
+}
+
+func TestWaitStartupDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		delay     time.Duration
+		fire      bool
+		signal    bool
+		want      bool
+		wantTimer bool
+	}{
+		{name: "no delay", want: true},
+		{name: "delay elapses", delay: 30 * time.Second, fire: true, want: true, wantTimer: true},
+		{name: "signal while waiting", delay: 30 * time.Second, signal: true, want: false, wantTimer: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The fake clock fires at once instead of after the delay
+			var waited []time.Duration
+			after := func(d time.Duration) <-chan time.Time {
+				waited = append(waited, d)
+				fired := make(chan time.Time, 1)
+				if tt.fire {
+					fired <- time.Time{}.Add(d)
+				}
+				return fired
+			}
+			sigChan := make(chan os.Signal, 1)
+			if tt.signal {
+				sigChan <- syscall.SIGTERM
+			}
+
+			if got := waitStartupDelay(tt.delay, after, sigChan, testLogger(t)); got != tt.want {
+				t.Errorf("waitStartupDelay = %v, want %v", got, tt.want)
+			}
+			if tt.wantTimer && (len(waited) != 1 || waited[0] != tt.delay) {
+				t.Errorf("waited %v, want one wait of %v", waited, tt.delay)
+			}
+			if !tt.wantTimer && len(waited) != 0 {
+				t.Errorf("waited %v without a delay", waited)
+			}
+		})
+	}
+}
+
+func TestRecipientsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recipients.txt")
+	emailTo := []string{"ops@example.com"}
+
+	tests := []struct {
+		name     string
+		contents string
+		want     []string
+	}{
+		{
+			name:     "duplicates of EMAIL_TO and within the file are dropped",
+			contents: "# finance team\nOps@Example.com\nAlice <alice@example.com>\n\nalice@example.com\nnot an address\n",
+			want:     []string{"ops@example.com", "alice@example.com"},
+		},
+		{
+			name:     "an edited file applies to the next run",
+			contents: "bob@example.com\n",
+			want:     []string{"ops@example.com", "bob@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fileRecipients, err := reader.ReadRecipients(path, testLogger(t))
+			if err != nil {
+				t.Fatalf("ReadRecipients: %v", err)
+			}
+			got := mergeRecipients(emailTo, fileRecipients)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("recipients = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeferReport(t *testing.T) {
+	path := deferredReportsPath(filepath.Join(t.TempDir(), "data", "cycle_checkpoint.jsonl"))
+
+	reports := []deferredReport{
+		{Attachment: mailer.Attachment{Filename: "balance_2026-03-01_23_00_00.csv", Content: []byte("wallet_address,balance\na,1.00\n")}, Total: 1},
+		{Attachment: mailer.Attachment{Filename: "balance_2026-03-02_00_00_00.csv", Content: []byte("wallet_address,balance\na,N/A\n")}, Total: 1, Failed: 1},
+	}
+	for i, report := range reports {
+		pending, err := deferReport(path, report)
+		if err != nil {
+			t.Fatalf("deferReport: %v", err)
+		}
+		if pending != i+1 {
+			t.Errorf("deferReport left %d reports pending, want %d", pending, i+1)
+		}
+	}
+
+	// A restarted process finds the reports deferred before it
+	loaded, err := loadDeferredReports(path)
+	if err != nil {
+		t.Fatalf("loadDeferredReports: %v", err)
+	}
+	if len(loaded) != len(reports) {
+		t.Fatalf("loaded %d deferred reports, want %d", len(loaded), len(reports))
+	}
+	for i := range reports {
+		if loaded[i].Attachment.Filename != reports[i].Attachment.Filename ||
+			string(loaded[i].Attachment.Content) != string(reports[i].Attachment.Content) ||
+			loaded[i].Total != reports[i].Total || loaded[i].Failed != reports[i].Failed {
+			t.Errorf("deferred report %d = %+v, want %+v", i, loaded[i], reports[i])
+		}
+	}
+
+	// Once the consolidated report is sent nothing is pending
+	if err := clearDeferredReports(path); err != nil {
+		t.Fatalf("clearDeferredReports: %v", err)
+	}
+	if loaded, err := loadDeferredReports(path); err != nil || len(loaded) != 0 {
+		t.Errorf("loadDeferredReports after clearing = %+v, %v; want none", loaded, err)
+	}
+	if err := clearDeferredReports(path); err != nil {
+		t.Errorf("clearing without deferred reports: %v", err)
+	}
+}
+
+func TestProduceCSV(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 1.5},
+		{WalletAddress: "b", FetchError: errors.New("rpc timeout")},
+	}
+	const wantCSV = "wallet_address,balance\na,1.50\nb,N/A\n"
+
+	tests := []struct {
+		name     string
+		skip     bool
+		wantFile bool
+	}{
+		{name: "written", wantFile: true},
+		{name: "SKIP_CSV", skip: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := testLogger(t)
+			csvDir := t.TempDir()
+			if tt.skip {
+				csvDir = "" // as main sets up the writer for SKIP_CSV
+			}
+			csvWriter, err := csvwriter.New(csvDir, rounding.Rounder{Places: 2, Mode: rounding.HalfUp}, log)
+			if err != nil {
+				t.Fatalf("csvwriter.New: %v", err)
+			}
+
+			content, path, err := produceCSV(csvWriter, balances, "balance_2026-03-01_14_00_00.csv", tt.skip, false)
+			if err != nil {
+				t.Fatalf("produceCSV: %v", err)
+			}
+			if string(content) != wantCSV {
+				t.Errorf("CSV content = %q, want %q", content, wantCSV)
+			}
+			if (path != "") != tt.wantFile {
+				t.Fatalf("produceCSV path = %q, want a file %v", path, tt.wantFile)
+			}
+			if _, err := os.Stat("balance_2026-03-01_14_00_00.csv"); !os.IsNotExist(err) {
+				os.Remove("balance_2026-03-01_14_00_00.csv")
+				t.Error("the CSV was written to the working directory")
+			}
+
+			// History is recorded from the balances, not from the CSV
+			db, err := database.Open(filepath.Join(t.TempDir(), "reporter.db"), time.Second)
+			if err != nil {
+				t.Fatalf("database.Open: %v", err)
+			}
+			defer db.Close()
+			runTime := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+			if err := db.InsertBalances(runTime, balances); err != nil {
+				t.Fatalf("InsertBalances: %v", err)
+			}
+			latest, err := db.LatestBalances(runTime.Add(time.Hour))
+			if err != nil || latest["a"].TokenBalance != 1.5 {
+				t.Errorf("LatestBalances = %+v, %v; want a at 1.5", latest, err)
+			}
+			if history, _ := db.GetBalanceHistory("b", runTime); len(history) != 1 || history[0].TokenError == "" {
+				t.Errorf("history of b = %+v, want the failed fetch", history)
+			}
+		})
+	}
+}
+
+func TestRunDirs(t *testing.T) {
+	balances := []*solana.TokenBalance{{WalletAddress: "a", Balance: 1.5}}
+	const runDir = "run_2026-03-01_14_00_00"
+
+	tests := []struct {
+		name      string
+		runDirs   bool
+		wantNames []string // Files listed in the manifest, relative to it
+	}{
+		{
+			name:      "per-run directories",
+			runDirs:   true,
+			wantNames: []string{"balance.csv", filepath.Join("..", "..", "json", runDir, "summary.json")},
+		},
+		{
+			name:      "shared directories",
+			wantNames: []string{filepath.Join("csv", "balance.csv"), filepath.Join("json", "summary.json")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := testLogger(t)
+			root := t.TempDir()
+			csvWriter, err := csvwriter.New(filepath.Join(root, "csv"), rounding.Rounder{Places: 2, Mode: rounding.HalfUp}, log)
+			if err != nil {
+				t.Fatalf("csvwriter.New: %v", err)
+			}
+			jsonWriter, err := jsonwriter.New(filepath.Join(root, "json"), log)
+			if err != nil {
+				t.Fatalf("jsonwriter.New: %v", err)
+			}
+			if tt.runDirs {
+				csvWriter.SetSubdir(runDir)
+				jsonWriter.SetSubdir(runDir)
+			}
+
+			_, csvPath, err := produceCSV(csvWriter, balances, "balance.csv", false, false)
+			if err != nil {
+				t.Fatalf("produceCSV: %v", err)
+			}
+			summaryPath, err := jsonWriter.WriteSummaryJSON(report.Summarize(balances, time.Now(), 0), "summary.json")
+			if err != nil {
+				t.Fatalf("WriteSummaryJSON: %v", err)
+			}
+			manifestPath := recordChecksums(filepath.Join(root, "SHA256SUMS"), tt.runDirs, []string{csvPath, summaryPath}, log)
+
+			// The cycle's CSV and manifest share the run directory
+			wantDir := root
+			if tt.runDirs {
+				wantDir = filepath.Join(root, "csv", runDir)
+			}
+			if filepath.Dir(manifestPath) != wantDir || (tt.runDirs && filepath.Dir(csvPath) != wantDir) {
+				t.Errorf("CSV at %s and manifest at %s, want the manifest in %s", csvPath, manifestPath, wantDir)
+			}
+
+			content, err := os.ReadFile(manifestPath)
+			if err != nil {
+				t.Fatalf("reading the manifest: %v", err)
+			}
+			var names []string
+			for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+				_, name, _ := strings.Cut(line, "  ")
+				names = append(names, name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("manifest lists %q, want %q", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestLoadRootCAs(t *testing.T) {
+	// The test server's certificate is signed by a CA outside the system pool
+	node := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"context":{"slot":1},"value":2000000000}}`))
+	}))
+	defer node.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: node.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+		wantTLS bool
+	}{
+		{name: "custom CA validates the server", path: caFile, wantTLS: true},
+		{name: "system roots reject the server", path: ""},
+		{name: "missing file", path: filepath.Join(dir, "missing.pem"), wantErr: true},
+		{name: "no certificates in the file", path: garbage, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := loadRootCAs(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadRootCAs error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			client := solana.New(node.URL, "Mint", "", 5*time.Second, 0, testLogger(t))
+			if pool != nil {
+				client.SetRootCAs(pool)
+			}
+			sol, err := client.FetchSolanaBalance(context.Background(), "wallet1")
+			if tt.wantTLS && (err != nil || sol != 2) {
+				t.Errorf("FetchSolanaBalance = %v, %v; want 2 SOL over verified TLS", sol, err)
+			}
+			if !tt.wantTLS && err == nil {
+				t.Error("FetchSolanaBalance verified a certificate from an untrusted CA")
+			}
+		})
+	}
+}
+
+// fakeFetcher answers each pass with the balances of fetch and records the addresses
+// asked for in every pass
+type fakeFetcher struct {
+	fetch  func(address string) *solana.TokenBalance
+	passes [][]string
+}
+
+func (f *fakeFetcher) FetchTokenBalances(ctx context.Context, addresses []string, concurrencyLimit int) ([]*solana.TokenBalance, []error) {
+	f.passes = append(f.passes, addresses)
+	var balances []*solana.TokenBalance
+	var errs []error
+	for _, address := range addresses {
+		balance := f.fetch(address)
+		balances = append(balances, balance)
+		if balance.FetchError != nil {
+			errs = append(errs, balance.FetchError)
+		}
+	}
+	return balances, errs
+}
+
+func TestRetryPassDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		fire       bool
+		wantPasses int
+		wantB      float64
+	}{
+		{name: "delay elapses before the retry pass", fire: true, wantPasses: 1, wantB: 2},
+		{name: "deadline reached during the delay", wantPasses: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The fake clock fires only when the test allows it; otherwise the cycle's
+			// deadline passes while waiting
+			fired := false
+			var waited []time.Duration
+			after := func(d time.Duration) <-chan time.Time {
+				waited = append(waited, d)
+				ch := make(chan time.Time, 1)
+				if tt.fire {
+					fired = true
+					ch <- time.Time{}.Add(d)
+				} else {
+					cancel()
+				}
+				return ch
+			}
+			fetcher := &fakeFetcher{fetch: func(address string) *solana.TokenBalance {
+				if !fired {
+					t.Errorf("retry pass for %s started before the delay elapsed", address)
+				}
+				return &solana.TokenBalance{WalletAddress: address, Balance: 2}
+			}}
+
+			balances := []*solana.TokenBalance{
+				{WalletAddress: "a", Balance: 1},
+				{WalletAddress: "b", FetchError: errors.New("rpc timeout")},
+			}
+			cfg := &config.Config{RetryPassDelay: 30 * time.Second, ConcurrencyLimit: 1}
+			got, errs := retryFailedWallets(ctx, fetcher, balances, []error{balances[1].FetchError}, cfg, after, testLogger(t))
+
+			if len(waited) != 1 || waited[0] != cfg.RetryPassDelay {
+				t.Errorf("waited %v, want one wait of %v", waited, cfg.RetryPassDelay)
+			}
+			if len(fetcher.passes) != tt.wantPasses {
+				t.Fatalf("ran %d retry passes, want %d", len(fetcher.passes), tt.wantPasses)
+			}
+			if tt.wantPasses > 0 && strings.Join(fetcher.passes[0], ",") != "b" {
+				t.Errorf("retry pass fetched %v, want only the failed wallet b", fetcher.passes[0])
+			}
+			if got[0].Balance != 1 || got[1].Balance != tt.wantB {
+				t.Errorf("balances after the retry pass = %v, %v; want 1, %v", got[0].Balance, got[1].Balance, tt.wantB)
+			}
+			if wantErrs := 1 - tt.wantPasses; len(errs) != wantErrs {
+				t.Errorf("got %d errors, want %d", len(errs), wantErrs)
+			}
+		})
+	}
+}
+
+func TestRetryDuplicateAddresses(t *testing.T) {
+	// With ALLOW_DUPLICATE_ADDRESSES the same wallet can fail at several positions
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "b", FetchError: errors.New("rpc timeout")},
+		{WalletAddress: "a", Balance: 1},
+		{WalletAddress: "b", FetchError: errors.New("rpc timeout")},
+	}
+	fetcher := &fakeFetcher{fetch: func(address string) *solana.TokenBalance {
+		return &solana.TokenBalance{WalletAddress: address, Balance: 2}
+	}}
+	after := func(d time.Duration) <-chan time.Time {
+		ch := make(chan time.Time, 1)
+		ch <- time.Time{}.Add(d)
+		return ch
+	}
+
+	cfg := &config.Config{ConcurrencyLimit: 1}
+	errs := []error{balances[0].FetchError, balances[2].FetchError}
+	got, errs := retryFailedWallets(context.Background(), fetcher, balances, errs, cfg, after, testLogger(t))
+
+	if len(fetcher.passes) != 1 || strings.Join(fetcher.passes[0], ",") != "b,b" {
+		t.Fatalf("retry passes = %v, want one pass over both b positions", fetcher.passes)
+	}
+	for i, want := range []float64{2, 1, 2} {
+		if got[i].FetchError != nil || got[i].Balance != want {
+			t.Errorf("position %d = %v, %v; want %v", i, got[i].Balance, got[i].FetchError, want)
+		}
+	}
+	if len(errs) != 0 {
+		t.Errorf("got errors %v after every wallet recovered", errs)
+	}
+}
+
+func TestRetryInit(t *testing.T) {
+	defer func(backoff time.Duration) { initBackoff = backoff }(initBackoff)
+	initBackoff = time.Millisecond
+
+	tests := []struct {
+		name         string
+		maxRetries   int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "succeeds on the second attempt", maxRetries: 3, wantAttempts: 2},
+		{name: "no retries allowed", maxRetries: 0, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The CSV volume is not mounted yet on the first attempt: a file sits where
+			// the directory goes until the mount replaces it
+			root := t.TempDir()
+			csvDir := filepath.Join(root, "csv")
+			if err := os.WriteFile(csvDir, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			log := testLogger(t)
+			attempts := 0
+			var csvWriter *csvwriter.CSVWriter
+			err := retryInit("CSV writer", tt.maxRetries, log, func() error {
+				attempts++
+				var err error
+				csvWriter, err = csvwriter.New(csvDir, rounding.Rounder{Places: 2}, log)
+				if err != nil && attempts == 1 {
+					os.Remove(csvDir) // the volume mounts
+				}
+				return err
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retryInit error = %v, want error %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if !tt.wantErr && csvWriter == nil {
+				t.Error("retryInit succeeded without a CSV writer")
+			}
+		})
+	}
+}
+
+// fakePublisher records what was published and fails with err when set
+type fakePublisher struct {
+	err      error
+	topic    string
+	payloads [][]byte
+}
+
+func (p *fakePublisher) Publish(topic string, payload []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.topic = topic
+	p.payloads = append(p.payloads, payload)
+	return nil
+}
+
+func TestPublishReport(t *testing.T) {
+	tests := []struct {
+		name        string
+		publishErr  error
+		wantErr     bool
+		wantLastRun bool
+	}{
+		{name: "published", wantLastRun: true},
+		{name: "publish fails", publishErr: errors.New("nats unavailable"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := database.Open(filepath.Join(t.TempDir(), "reporter.db"), time.Second)
+			if err != nil {
+				t.Fatalf("database.Open: %v", err)
+			}
+			defer db.Close()
+
+			alerts := newAlertGate(db, time.Hour, 0)
+			if !alerts.allow("a", "expect:a") {
+				t.Fatal("first alert was suppressed")
+			}
+
+			publisher := &fakePublisher{err: tt.publishErr}
+			cfg := &config.Config{QueueTopic: "balances", SummaryTopN: 5}
+			balances := []*solana.TokenBalance{{WalletAddress: "a", Balance: 3}}
+
+			err = publishReport(publisher, balances, "data/balances.csv", cfg, db, alerts, testLogger(t))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("publishReport error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (publisher.topic != "balances" || len(publisher.payloads) != 1) {
+				t.Errorf("published %d payloads to %q, want 1 to balances", len(publisher.payloads), publisher.topic)
+			}
+
+			lastRun := db.GetLastRun()
+			if (lastRun != nil) != tt.wantLastRun {
+				t.Errorf("last run = %+v, want recorded %v", lastRun, tt.wantLastRun)
+			} else if lastRun != nil && lastRun.CSVPath != "data/balances.csv" {
+				t.Errorf("last run CSV = %q, want data/balances.csv", lastRun.CSVPath)
+			}
+			if _, ok := db.LastAlert("expect:a"); ok != tt.wantLastRun {
+				t.Errorf("alert cooldown recorded = %v, want %v", ok, tt.wantLastRun)
+			}
+		})
+	}
+}
+
+func TestRunBudget(t *testing.T) {
+	// A relay that accepts connections but never greets, standing in for a slow email stage
+	relay, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting stalled relay: %v", err)
+	}
+	defer relay.Close()
+	go func() {
+		for {
+			conn, err := relay.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	port := relay.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name         string
+		budget       time.Duration
+		wantExceeded bool
+	}{
+		{name: "slow email trips the budget", budget: 200 * time.Millisecond, wantExceeded: true},
+		{name: "within the budget", budget: time.Hour},
+		{name: "no budget", budget: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := metrics.NewPrometheus("")
+			previous := metricsSink
+			metricsSink = sink
+			defer func() { metricsSink = previous }()
+
+			log := testLogger(t)
+			start := time.Now()
+			if tt.wantExceeded {
+				m := mailer.New([]mailer.SMTPServer{{Host: "127.0.0.1", Port: port}}, "reporter@example.com", []string{"ops@example.com"}, 2, log)
+				err := m.SendReports([]mailer.Report{{
+					Attachment: mailer.Attachment{Filename: "balance.csv", Content: []byte("wallet_address,balance\n")},
+					Options:    mailer.SendOptions{Deadline: start.Add(tt.budget)},
+				}})[0]
+				if err == nil {
+					t.Fatal("email went out through a relay that never answers")
+				}
+				if elapsed := time.Since(start); elapsed > 5*tt.budget {
+					t.Errorf("send gave up after %v, want about the %v budget", elapsed, tt.budget)
+				}
+			}
+
+			if got := checkRunBudget(start, tt.budget, log); got != tt.wantExceeded {
+				t.Errorf("checkRunBudget = %v, want %v", got, tt.wantExceeded)
+			}
+			recorded := strings.Contains(sink.Render(), "run_budget_exceeded_total 1\n")
+			if recorded != tt.wantExceeded {
+				t.Errorf("over-budget metric recorded = %v, want %v:\n%s", recorded, tt.wantExceeded, sink.Render())
+			}
+		})
+	}
+}
+
+func TestRunOnceExitStatus(t *testing.T) {
+	const wallet = "So11111111111111111111111111111111111111112"
+
+	tests := []struct {
+		name      string
+		addresses string // Contents of the addresses file; empty leaves it missing
+		wantErr   error
+	}{
+		{name: "report produced", addresses: wallet + "\n"},
+		{name: "addresses file missing", wantErr: errCycleFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			log := testLogger(t)
+			path := filepath.Join(dir, "addresses.txt")
+			if tt.addresses != "" {
+				if err := os.WriteFile(path, []byte(tt.addresses), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rounder := rounding.Rounder{Places: 2, Mode: rounding.HalfUp}
+			csvWriter, err := csvwriter.New(filepath.Join(dir, "csv"), rounder, log)
+			if err != nil {
+				t.Fatalf("csvwriter.New: %v", err)
+			}
+			fetcher := &fakeFetcher{fetch: func(address string) *solana.TokenBalance {
+				return &solana.TokenBalance{WalletAddress: address, Balance: 1, Status: solana.StatusOK}
+			}}
+			mailClient := mailer.New(nil, "reporter@example.com", []string{"ops@example.com"}, 0, log)
+			cfg := &config.Config{DryRun: true, BalanceSource: "rpc", FetchMode: "token", ConcurrencyLimit: 1, SummaryTopN: 5}
+
+			err = runFetchAndReport(reader.New(path, log), solana.New("http://127.0.0.1:0", "", "", time.Second, 0, log),
+				fetcher, csvWriter, nil, mailClient, nil, nil, rounder, cfg, log)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("runFetchAndReport = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthAfterCycle(t *testing.T) {
+	const wallet = "So11111111111111111111111111111111111111112"
+
+	// Quiet hours from an hour ago to an hour from now
+	now := time.Now().UTC()
+	minute := now.Hour()*60 + now.Minute()
+	quiet := &schedule.QuietHours{Start: (minute + 1380) % 1440, End: (minute + 60) % 1440}
+
+	tests := []struct {
+		name      string
+		addresses string // Contents of the addresses file; empty leaves it missing
+		quiet     *schedule.QuietHours
+		wantErr   error
+		wantRun   string
+	}{
+		{name: "report deferred by quiet hours", addresses: wallet + "\n", quiet: quiet, wantRun: "(ok=true)"},
+		{name: "addresses file missing", wantErr: errCycleFailed, wantRun: "(ok=false)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			log := testLogger(t)
+			path := filepath.Join(dir, "addresses.txt")
+			if tt.addresses != "" {
+				if err := os.WriteFile(path, []byte(tt.addresses), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			scraped := metrics.NewPrometheus("")
+			previousSink, previousHealth := metricsSink, healthServer
+			metricsSink, healthServer = scraped, health.New("127.0.0.1:0", time.Hour, scraped, log)
+			defer func() { metricsSink, healthServer = previousSink, previousHealth }()
+
+			rounder := rounding.Rounder{Places: 2, Mode: rounding.HalfUp}
+			csvWriter, err := csvwriter.New(filepath.Join(dir, "csv"), rounder, log)
+			if err != nil {
+				t.Fatalf("csvwriter.New: %v", err)
+			}
+			fetcher := &fakeFetcher{fetch: func(address string) *solana.TokenBalance {
+				return &solana.TokenBalance{WalletAddress: address, Balance: 1, Status: solana.StatusOK}
+			}}
+			mailClient := mailer.New(nil, "reporter@example.com", []string{"ops@example.com"}, 0, log)
+			cfg := &config.Config{
+				BalanceSource: "rpc", FetchMode: "token", ConcurrencyLimit: 1, SummaryTopN: 5, NotifyEmail: true,
+				QuietHours: tt.quiet, ReportLocation: time.UTC, CheckpointPath: filepath.Join(dir, "checkpoint.json"),
+			}
+
+			err = runFetchAndReport(reader.New(path, log), solana.New("http://127.0.0.1:0", "", "", time.Second, 0, log),
+				fetcher, csvWriter, nil, mailClient, nil, nil, rounder, cfg, log)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("runFetchAndReport = %v, want %v", err, tt.wantErr)
+			}
+			if deferred, _ := loadDeferredReports(deferredReportsPath(cfg.CheckpointPath)); (len(deferred) == 1) != (tt.quiet != nil) {
+				t.Errorf("%d reports deferred, want one only during quiet hours", len(deferred))
+			}
+
+			server := httptest.NewServer(healthServer.Handler())
+			defer server.Close()
+			resp, err := http.Get(server.URL + "/healthz")
+			if err != nil {
+				t.Fatalf("GET /healthz: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), tt.wantRun) {
+				t.Errorf("/healthz = %d %q, want 200 with %s", resp.StatusCode, body, tt.wantRun)
+			}
+			if tt.wantErr == nil && strings.Contains(scraped.Render(), "_failures_total") {
+				t.Errorf("deferred cycle recorded failures:\n%s", scraped.Render())
+			}
+		})
+	}
+}
+
+func TestOutputDirs(t *testing.T) {
+	balances := []*solana.TokenBalance{{WalletAddress: "wallet1", Balance: 1.5}}
+
+	tests := []struct {
+		name    string
+		csvDir  string // Relative to the test's directory
+		jsonDir string
+	}{
+		{name: "separate directories", csvDir: "out/csv", jsonDir: "out/json"},
+		{name: "nested directories created on demand", csvDir: "reports/csv/daily", jsonDir: "summaries"},
+		{name: "shared directory", csvDir: "out", jsonDir: "out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			csvDir, jsonDir := filepath.Join(root, tt.csvDir), filepath.Join(root, tt.jsonDir)
+			t.Setenv("CSV_DIR", csvDir)
+			t.Setenv("JSON_DIR", jsonDir)
+			cfg, err := config.LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+
+			log := testLogger(t)
+			csvWriter, err := csvwriter.New(cfg.CSVDirPath, rounding.Rounder{Places: 2, Mode: rounding.HalfUp}, log)
+			if err != nil {
+				t.Fatalf("csvwriter.New: %v", err)
+			}
+			jsonWriter, err := jsonwriter.New(cfg.JSONDirPath, log)
+			if err != nil {
+				t.Fatalf("jsonwriter.New: %v", err)
+			}
+
+			csvPath, err := csvWriter.WriteBalancesWithFilename(balances, "balance.csv")
+			if err != nil {
+				t.Fatalf("WriteBalancesWithFilename: %v", err)
+			}
+			jsonPath, err := jsonWriter.WriteSummaryJSON(report.Summarize(balances, time.Now(), 1), "summary.json")
+			if err != nil {
+				t.Fatalf("WriteSummaryJSON: %v", err)
+			}
+
+			for _, written := range []struct{ path, want string }{
+				{csvPath, filepath.Join(csvDir, "balance.csv")},
+				{jsonPath, filepath.Join(jsonDir, "summary.json")},
+			} {
+				if written.path != written.want {
+					t.Errorf("wrote %s, want %s", written.path, written.want)
+				}
+				if _, err := os.Stat(written.want); err != nil {
+					t.Errorf("output missing: %v", err)
+				}
+			}
+		})
+	}
+}
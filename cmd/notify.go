@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/config"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/notifier"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// notifyRun posts the cycle's summary to every configured notifier. A failed channel is
+// logged and counted without affecting the others or the email.
+func notifyRun(notifiers []notifier.Notifier, balances []*solana.TokenBalance, csvPath, partialReason string, cfg *config.Config, log *logger.Logger) {
+	summary := notifier.Report{
+		RunTime:     getRunTime(),
+		Total:       len(balances),
+		CSVPath:     csvPath,
+		Partial:     partialReason,
+		Environment: cfg.EnvBanner,
+	}
+	for _, balance := range balances {
+		if balance.FetchError == nil {
+			summary.Success++
+		} else {
+			summary.Failed++
+		}
+	}
+
+	if cfg.DryRun {
+		log.Log(fmt.Sprintf("dry run: would notify %d chat channels", len(notifiers)))
+		return
+	}
+
+	sent := 0
+	for _, n := range notifiers {
+		if err := n.Notify(summary); err != nil {
+			log.LogError("Failed to send run notification", err)
+			metricsSink.Count("notification_failures_total", 1)
+			continue
+		}
+		sent++
+	}
+	metricsSink.Count("notifications_sent_total", float64(sent))
+	log.Log(fmt.Sprintf("Sent run notification to %d of %d chat channels", sent, len(notifiers)))
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/database"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/mailer"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/reader"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/report"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// deferredSection lists the reports deferred during quiet hours, whose CSVs are also attached
+func deferredSection(reports []deferredReport) mailer.Section {
+	lines := make([]string, 0, len(reports))
+	for _, deferred := range reports {
+		lines = append(lines, fmt.Sprintf("%s: %d addresses, %d failed",
+			deferred.Attachment.Filename, deferred.Total, deferred.Failed))
+	}
+	return mailer.Section{Title: "Reports deferred during quiet hours (attached)", Lines: lines}
+}
+
+// catchUpSection notes the gap since the last run when at least one scheduled report
+// was missed, returning how many were. Nothing was missed before the first run, and the
+// deferred cycles held back by quiet hours ran, so they are not counted as missed.
+func catchUpSection(lastRun *database.LastRun, deferred int, now time.Time, interval time.Duration) (mailer.Section, int) {
+	if lastRun == nil || interval <= 0 {
+		return mailer.Section{}, 0
+	}
+
+	gap := now.Sub(lastRun.RunTimestamp)
+	missed := int(gap/interval) - 1 - deferred
+	if missed <= 0 {
+		return mailer.Section{}, 0
+	}
+
+	lines := []string{
+		fmt.Sprintf("The previous report was for the run at %s, %s ago", lastRun.RunTimestamp.UTC().Format(time.RFC3339), gap.Truncate(time.Minute)),
+		fmt.Sprintf("%d scheduled reports were missed while the reporter was down", missed),
+		"This report shows current balances only; changes during the gap are not itemised",
+	}
+	return mailer.Section{Title: "Catch-up after downtime", Lines: lines}, missed
+}
+
+// withoutStale drops wallets whose balance has not changed in the last staleAfter recorded
+// runs, so static wallets do not crowd the change sections
+func withoutStale(balances []*solana.TokenBalance, db *database.DB, staleAfter int) ([]*solana.TokenBalance, int) {
+	if db == nil || staleAfter <= 0 {
+		return balances, 0
+	}
+
+	unchanged := db.UnchangedRuns()
+	active := make([]*solana.TokenBalance, 0, len(balances))
+	for _, balance := range balances {
+		if unchanged[balance.WalletAddress] >= staleAfter {
+			continue
+		}
+		active = append(active, balance)
+	}
+	return active, len(balances) - len(active)
+}
+
+// baselineSection compares balances with a named baseline: the total change and the
+// n largest increases and decreases among changed since the baseline was captured
+func baselineSection(balances, changed []*solana.TokenBalance, baseline database.Baseline, n int, rounder rounding.Rounder) mailer.Section {
+	baselineTotal, currentTotal := 0.0, 0.0
+	for _, balance := range balances {
+		if balance.FetchError != nil {
+			continue
+		}
+		if previous, ok := baseline.Balances[balance.WalletAddress]; ok {
+			baselineTotal += previous
+			currentTotal += balance.Balance
+		}
+	}
+
+	lines := []string{fmt.Sprintf("Total of wallets in the baseline: %s -> %s (%s)",
+		rounder.Format(baselineTotal), rounder.Format(currentTotal), signed(currentTotal-baselineTotal, rounder))}
+
+	increases, decreases := report.TopMovers(changed, baseline.Balances, n)
+	for _, line := range moverLines(increases, rounder) {
+		lines = append(lines, "Increase: "+line)
+	}
+	for _, line := range moverLines(decreases, rounder) {
+		lines = append(lines, "Decrease: "+line)
+	}
+
+	return mailer.Section{
+		Title: fmt.Sprintf("Change since baseline %q (captured %s)", baseline.Name, baseline.CapturedAt.Format("2006-01-02 15:04 MST")),
+		Lines: lines,
+	}
+}
+
+// signed formats a change with an explicit + for increases
+func signed(change float64, rounder rounding.Rounder) string {
+	if change > 0 {
+		return "+" + rounder.Format(change)
+	}
+	return rounder.Format(change)
+}
+
+// moversSections renders the largest increases and decreases since the previous run
+func moversSections(balances []*solana.TokenBalance, previous map[string]database.BalanceRecord, n int, rounder rounding.Rounder) []mailer.Section {
+	prevBalances := make(map[string]float64, len(previous))
+	for wallet, record := range previous {
+		prevBalances[wallet] = record.TokenBalance
+	}
+
+	increases, decreases := report.TopMovers(balances, prevBalances, n)
+
+	return []mailer.Section{
+		{Title: fmt.Sprintf("Top %d increases since last run", n), Lines: moverLines(increases, rounder)},
+		{Title: fmt.Sprintf("Top %d decreases since last run", n), Lines: moverLines(decreases, rounder)},
+	}
+}
+
+// moverLines formats movers as "address: previous -> current (change, percent)"
+func moverLines(movers []report.Mover, rounder rounding.Rounder) []string {
+	if len(movers) == 0 {
+		return []string{"None"}
+	}
+
+	lines := make([]string, 0, len(movers))
+	for _, mover := range movers {
+		percent := "n/a"
+		if mover.PreviousBalance != 0 {
+			percent = fmt.Sprintf("%+.2f%%", mover.PercentChange)
+		}
+
+		lines = append(lines, fmt.Sprintf("%s: %s -> %s (%s, %s)",
+			mover.WalletAddress,
+			rounder.Format(mover.PreviousBalance),
+			rounder.Format(mover.CurrentBalance),
+			signed(mover.Change, rounder),
+			percent))
+	}
+	return lines
+}
+
+// tiersSection counts the wallets and sums the balances in each balance tier
+func tiersSection(tiers []report.Tier, rounder rounding.Rounder) mailer.Section {
+	lines := make([]string, 0, len(tiers))
+	for _, tier := range tiers {
+		if tier.Label == report.UnknownTier {
+			lines = append(lines, fmt.Sprintf("%s: %d wallets", tier.Label, len(tier.Wallets)))
+			continue
+		}
+
+		total := 0.0
+		for _, balance := range tier.Wallets {
+			total += balance.Balance
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d wallets, total %s", tier.Label, len(tier.Wallets), rounder.Format(total)))
+	}
+	return mailer.Section{Title: "Balance tiers (wallets listed in the attached tiers CSV)", Lines: lines}
+}
+
+// lowSolSection lists wallets whose SOL balance is below minSol, smallest first
+func lowSolSection(balances []*solana.TokenBalance, minSol float64, rounder rounding.Rounder, gate *alertGate) mailer.Section {
+	low := []*solana.TokenBalance{}
+	suppressed := 0
+	for _, balance := range balances {
+		if balance.SolanaFetched && balance.SolanaError == nil && balance.SolanaBalance < minSol {
+			if !gate.allow(balance.WalletAddress, fmt.Sprintf("low_sol:%s:%g", balance.WalletAddress, minSol)) {
+				suppressed++
+				continue
+			}
+			low = append(low, balance)
+		}
+	}
+	sort.SliceStable(low, func(i, j int) bool {
+		return low[i].SolanaBalance < low[j].SolanaBalance
+	})
+
+	lines := make([]string, 0, len(low))
+	for _, balance := range low {
+		lines = append(lines, fmt.Sprintf("%s: %s SOL", balance.WalletAddress, rounder.Format(balance.SolanaBalance)))
+	}
+	if suppressed > 0 {
+		lines = append(lines, suppressedLine(suppressed))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "None")
+	}
+
+	return mailer.Section{
+		Title: fmt.Sprintf("Wallets below %s SOL (rent-exempt risk)", rounder.Format(minSol)),
+		Lines: lines,
+	}
+}
+
+// expectedTotalSection compares the sum of token balances with the expected total and
+// reports whether the difference is beyond the tolerance. Failed fetches are left out
+// of the sum, so they are counted separately as a likely cause of a mismatch.
+func expectedTotalSection(balances []*solana.TokenBalance, expected, tolerance float64, rounder rounding.Rounder) (mailer.Section, bool) {
+	actual := 0.0
+	failed := 0
+	for _, balance := range balances {
+		if balance.FetchError != nil {
+			failed++
+			continue
+		}
+		actual += balance.Balance
+	}
+
+	difference := actual - expected
+	mismatch := math.Abs(difference) > tolerance
+
+	lines := []string{
+		fmt.Sprintf("Actual total: %s", rounder.Format(actual)),
+		fmt.Sprintf("Expected total: %s", rounder.Format(expected)),
+		fmt.Sprintf("Difference: %s", signed(difference, rounder)),
+	}
+	if mismatch {
+		lines = append(lines, fmt.Sprintf("MISMATCH: difference exceeds the tolerance of %s", rounder.Format(tolerance)))
+	} else {
+		lines = append(lines, fmt.Sprintf("Within the tolerance of %s", rounder.Format(tolerance)))
+	}
+	if failed > 0 {
+		lines = append(lines, fmt.Sprintf("%d wallets failed to fetch and are not included", failed))
+	}
+
+	title := "Total vs expected"
+	if mismatch {
+		title = "ALERT: Total does not match expected"
+	}
+	return mailer.Section{Title: title, Lines: lines}, mismatch
+}
+
+// expectationSection lists wallets whose token balance breaks an expect>=/expect<= annotation.
+// Wallets whose fetch failed are listed too, since their assertion could not be checked.
+func expectationSection(balances []*solana.TokenBalance, expectations map[string][]reader.Expectation, rounder rounding.Rounder, gate *alertGate) (mailer.Section, int) {
+	lines := []string{}
+	suppressed := 0
+	for _, balance := range balances {
+		for _, expectation := range expectations[balance.WalletAddress] {
+			violated := balance.FetchError != nil || !expectation.Holds(balance.Balance)
+			if violated && !gate.allow(balance.WalletAddress, fmt.Sprintf("expect:%s:%s", balance.WalletAddress, expectation)) {
+				suppressed++
+				continue
+			}
+
+			if balance.FetchError != nil {
+				lines = append(lines, fmt.Sprintf("%s: expected %s, balance unavailable (%v)",
+					balance.WalletAddress, expectation, balance.FetchError))
+			} else if !expectation.Holds(balance.Balance) {
+				lines = append(lines, fmt.Sprintf("%s: expected %s, got %s",
+					balance.WalletAddress, expectation, rounder.Format(balance.Balance)))
+			}
+		}
+	}
+
+	violations := len(lines)
+	if suppressed > 0 {
+		lines = append(lines, suppressedLine(suppressed))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "None")
+	}
+	return mailer.Section{Title: fmt.Sprintf("ALERT: balance assertion violations (%d)", violations), Lines: lines}, violations
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/database"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/reader"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+func TestLowSolSection(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "healthy", SolanaBalance: 1, SolanaFetched: true},
+		{WalletAddress: "low", SolanaBalance: 0.0005, SolanaFetched: true},
+		{WalletAddress: "lowest", SolanaBalance: 0.0001, SolanaFetched: true},
+		{WalletAddress: "failed", SolanaError: errors.New("rpc timeout"), SolanaFetched: true},
+		{WalletAddress: "token-only"},
+	}
+	rounder := rounding.Rounder{Places: 6, Mode: rounding.HalfUp}
+
+	tests := []struct {
+		name   string
+		minSol float64
+		want   []string
+	}{
+		{name: "rent-exempt minimum", minSol: 0.00089088, want: []string{"lowest: 0.000100 SOL", "low: 0.000500 SOL"}},
+		{name: "lower threshold", minSol: 0.0003, want: []string{"lowest: 0.000100 SOL"}},
+		{name: "nobody below", minSol: 0.00001, want: []string{"None"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section := lowSolSection(balances, tt.minSol, rounder, nil)
+			if strings.Join(section.Lines, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("lines = %q, want %q", section.Lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectationSection(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "vesting", Balance: 999.5},
+		{WalletAddress: "funded", Balance: 1500},
+		{WalletAddress: "capped", Balance: 3},
+		{WalletAddress: "failed", FetchError: errors.New("rpc timeout")},
+		{WalletAddress: "unannotated", Balance: 0},
+	}
+	expectations := map[string][]reader.Expectation{
+		"vesting": {{Op: ">=", Value: 1000}},
+		"funded":  {{Op: ">=", Value: 1000}},
+		"capped":  {{Op: "<=", Value: 5}},
+		"failed":  {{Op: ">=", Value: 1}},
+	}
+
+	section, violations := expectationSection(balances, expectations, rounding.Rounder{Places: 2, Mode: rounding.HalfUp}, nil)
+	want := []string{
+		"vesting: expected >=1000, got 999.50",
+		"failed: expected >=1, balance unavailable (rpc timeout)",
+	}
+	if violations != len(want) || strings.Join(section.Lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("section = %d violations %q, want %q", violations, section.Lines, want)
+	}
+	if section.Title != "ALERT: balance assertion violations (2)" {
+		t.Errorf("title = %q", section.Title)
+	}
+}
+
+func TestExpectedTotalSection(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 600},
+		{WalletAddress: "b", Balance: 395},
+		{WalletAddress: "failed", FetchError: errors.New("rpc timeout")},
+	}
+	rounder := rounding.Rounder{Places: 2, Mode: rounding.HalfUp}
+
+	tests := []struct {
+		name         string
+		expected     float64
+		tolerance    float64
+		wantMismatch bool
+		wantLine     string
+	}{
+		{name: "within tolerance", expected: 1000, tolerance: 5, wantLine: "Within the tolerance of 5.00"},
+		{name: "beyond tolerance", expected: 1000, tolerance: 1, wantMismatch: true, wantLine: "MISMATCH: difference exceeds the tolerance of 1.00"},
+		{name: "extra balance", expected: 900, tolerance: 1, wantMismatch: true, wantLine: "Difference: +95.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section, mismatch := expectedTotalSection(balances, tt.expected, tt.tolerance, rounder)
+			if mismatch != tt.wantMismatch {
+				t.Errorf("mismatch = %v, want %v", mismatch, tt.wantMismatch)
+			}
+			if strings.HasPrefix(section.Title, "ALERT") != tt.wantMismatch {
+				t.Errorf("title = %q", section.Title)
+			}
+			lines := strings.Join(section.Lines, "\n")
+			for _, want := range []string{"Actual total: 995.00", tt.wantLine, "1 wallets failed to fetch"} {
+				if !strings.Contains(lines, want) {
+					t.Errorf("lines %q missing %q", section.Lines, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCatchUpSection(t *testing.T) {
+	lastRun := &database.LastRun{RunTimestamp: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name       string
+		lastRun    *database.LastRun
+		deferred   int
+		now        time.Time
+		wantMissed int
+		wantLines  []string
+	}{
+		{name: "first run", now: time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)},
+		{name: "next run on time", lastRun: lastRun, now: time.Date(2026, 3, 1, 10, 0, 5, 0, time.UTC)},
+		{name: "restart within the interval", lastRun: lastRun, now: time.Date(2026, 3, 1, 10, 45, 0, 0, time.UTC)},
+		{
+			name:       "stale last run",
+			lastRun:    lastRun,
+			now:        time.Date(2026, 3, 1, 14, 10, 0, 0, time.UTC),
+			wantMissed: 4,
+			wantLines: []string{
+				"The previous report was for the run at 2026-03-01T09:00:00Z, 5h10m0s ago",
+				"4 scheduled reports were missed while the reporter was down",
+			},
+		},
+		{
+			name:       "quiet hours deferrals are not missed",
+			lastRun:    lastRun,
+			deferred:   3,
+			now:        time.Date(2026, 3, 1, 14, 10, 0, 0, time.UTC),
+			wantMissed: 1,
+			wantLines:  []string{"1 scheduled reports were missed while the reporter was down"},
+		},
+		{
+			name:     "every cycle since the last run deferred",
+			lastRun:  lastRun,
+			deferred: 4,
+			now:      time.Date(2026, 3, 1, 14, 10, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section, missed := catchUpSection(tt.lastRun, tt.deferred, tt.now, time.Hour)
+			if missed != tt.wantMissed {
+				t.Errorf("missed = %d, want %d", missed, tt.wantMissed)
+			}
+			if missed == 0 && section.Title != "" {
+				t.Errorf("section %q returned with nothing missed", section.Title)
+			}
+			lines := strings.Join(section.Lines, "\n")
+			for _, want := range tt.wantLines {
+				if !strings.Contains(lines, want) {
+					t.Errorf("lines %q missing %q", section.Lines, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStaleWalletsLeaveMovers(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "reporter.db"), time.Second)
+	if err != nil {
+		t.Fatalf("database.Open: %v", err)
+	}
+	defer db.Close()
+
+	// The static wallet held 100 for four runs; the active one moved every run
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		if err := db.InsertBalances(start.Add(time.Duration(i)*time.Hour), []*solana.TokenBalance{
+			{WalletAddress: "static", Balance: 100},
+			{WalletAddress: "active", Balance: float64(10 * (i + 1))},
+		}); err != nil {
+			t.Fatalf("InsertBalances: %v", err)
+		}
+	}
+	now := start.Add(4 * time.Hour)
+	previous, err := db.LatestBalances(now)
+	if err != nil {
+		t.Fatalf("LatestBalances: %v", err)
+	}
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "static", Balance: 100.5},
+		{WalletAddress: "active", Balance: 50},
+	}
+
+	tests := []struct {
+		name       string
+		staleAfter int
+		wantStale  int
+		wantLines  string
+	}{
+		{name: "disabled", staleAfter: 0, wantLines: "active: 40.00 -> 50.00 (+10.00, +25.00%)\nstatic: 100.00 -> 100.50 (+0.50, +0.50%)"},
+		{name: "unchanged beyond the threshold", staleAfter: 3, wantStale: 1, wantLines: "active: 40.00 -> 50.00 (+10.00, +25.00%)"},
+		{name: "unchanged for fewer runs", staleAfter: 4, wantLines: "active: 40.00 -> 50.00 (+10.00, +25.00%)\nstatic: 100.00 -> 100.50 (+0.50, +0.50%)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, stale := withoutStale(balances, db, tt.staleAfter)
+			if stale != tt.wantStale {
+				t.Errorf("excluded %d wallets, want %d", stale, tt.wantStale)
+			}
+			sections := moversSections(changed, previous, 5, rounding.Rounder{Places: 2, Mode: rounding.HalfUp})
+			if got := strings.Join(sections[0].Lines, "\n"); got != tt.wantLines {
+				t.Errorf("increases =\n%s\nwant\n%s", got, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestBaselineSection(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "reporter.db"), time.Second)
+	if err != nil {
+		t.Fatalf("database.Open: %v", err)
+	}
+	defer db.Close()
+
+	// Capture the baseline after the quarter's first run, then record a later run
+	first := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := db.InsertBalances(first, []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 100},
+		{WalletAddress: "b", Balance: 50},
+		{WalletAddress: "c", Balance: 10},
+	}); err != nil {
+		t.Fatalf("InsertBalances: %v", err)
+	}
+	if _, err := db.CaptureBaseline("q1", first); err != nil {
+		t.Fatalf("CaptureBaseline: %v", err)
+	}
+	if err := db.InsertBalances(first.Add(24*time.Hour), []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 500},
+		{WalletAddress: "b", Balance: 5},
+		{WalletAddress: "c", Balance: 10},
+	}); err != nil {
+		t.Fatalf("InsertBalances: %v", err)
+	}
+
+	// The current cycle is compared with the baseline, not with the previous run
+	baseline, ok := db.GetBaseline("q1")
+	if !ok {
+		t.Fatal("baseline q1 was not captured")
+	}
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 120},
+		{WalletAddress: "b", Balance: 40},
+		{WalletAddress: "c", Balance: 10},
+		{WalletAddress: "new", Balance: 7},
+	}
+	section := baselineSection(balances, balances, baseline, 5, rounding.Rounder{Places: 2, Mode: rounding.HalfUp})
+
+	want := []string{
+		"Total of wallets in the baseline: 160.00 -> 170.00 (+10.00)",
+		"Increase: a: 100.00 -> 120.00 (+20.00, +20.00%)",
+		"Decrease: b: 50.00 -> 40.00 (-10.00, -20.00%)",
+	}
+	if strings.Join(section.Lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines =\n%s\nwant\n%s", strings.Join(section.Lines, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.HasPrefix(section.Title, `Change since baseline "q1" (captured 2026-01-01`) {
+		t.Errorf("title = %q", section.Title)
+	}
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MaxErrors caps the error messages kept per record; ErrorCount still counts them all
+const MaxErrors = 100
+
+// Record is the audit entry of one cycle, written as a single JSON line
+type Record struct {
+	ID         string    `json:"id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Total      int       `json:"total"`
+	Succeeded  int       `json:"succeeded"`
+	Failed     int       `json:"failed"`
+	CSVSHA256  string    `json:"csv_sha256,omitempty"`
+	MessageIDs []string  `json:"message_ids"`
+	Errors     []string  `json:"errors"`
+	ErrorCount int       `json:"error_count"`
+
+	mu sync.Mutex
+}
+
+// NewRecord starts the audit record of a cycle
+func NewRecord(id string, start time.Time) *Record {
+	return &Record{
+		ID:         id,
+		Start:      start.UTC(),
+		MessageIDs: []string{},
+		Errors:     []string{},
+	}
+}
+
+// AddError records an error of the cycle; it is safe for concurrent use.
+// The methods of a nil Record do nothing, so callers need not check whether auditing is on.
+func (r *Record) AddError(message string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ErrorCount++
+	if len(r.Errors) < MaxErrors {
+		r.Errors = append(r.Errors, message)
+	}
+}
+
+// SetCounts records the number of wallets fetched and how many of them failed
+func (r *Record) SetCounts(total, failed int) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Total = total
+	r.Succeeded = total - failed
+	r.Failed = failed
+}
+
+// SetCSV records the SHA-256 of the CSV report
+func (r *Record) SetCSV(content []byte) {
+	if r == nil {
+		return
+	}
+
+	sum := sha256.Sum256(content)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.CSVSHA256 = hex.EncodeToString(sum[:])
+}
+
+// AddMessageIDs records the Message-IDs of emails sent in the cycle
+func (r *Record) AddMessageIDs(ids []string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.MessageIDs = append(r.MessageIDs, ids...)
+}
+
+// Append finishes the record at end and appends it as one JSON line to the audit file at path
+func Append(path string, record *Record, end time.Time) error {
+	record.mu.Lock()
+	record.End = end.UTC()
+	line, err := json.Marshal(record)
+	record.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "cycles.jsonl")
+	start := time.Date(2026, 3, 1, 14, 0, 0, 0, time.FixedZone("CET", 3600))
+
+	// A completed cycle and one that failed before its email went out
+	tests := []struct {
+		id         string
+		total      int
+		failed     int
+		csv        []byte
+		messageIDs []string
+		errors     int
+	}{
+		{id: "cycle-1", total: 3, failed: 1, csv: []byte("wallet_address,balance\na,1.00\n"), messageIDs: []string{"<1@example.com>", "<2@example.com>"}, errors: 1},
+		{id: "cycle-2", errors: MaxErrors + 5},
+	}
+	for _, tt := range tests {
+		record := NewRecord(tt.id, start)
+		record.SetCounts(tt.total, tt.failed)
+		if tt.csv != nil {
+			record.SetCSV(tt.csv)
+		}
+		record.AddMessageIDs(tt.messageIDs)
+		for i := 0; i < tt.errors; i++ {
+			record.AddError(fmt.Sprintf("error %d", i))
+		}
+		if err := Append(path, record, start.Add(time.Minute)); err != nil {
+			t.Fatalf("Append %s: %v", tt.id, err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v\n%s", len(records)+1, err, scanner.Text())
+		}
+		records = append(records, record)
+	}
+	if len(records) != len(tests) {
+		t.Fatalf("audit file has %d records, want %d", len(records), len(tests))
+	}
+
+	for i, tt := range tests {
+		record := records[i]
+		if record["id"] != tt.id || record["start"] != "2026-03-01T13:00:00Z" || record["end"] != "2026-03-01T13:01:00Z" {
+			t.Errorf("record %d = id %v from %v to %v", i+1, record["id"], record["start"], record["end"])
+		}
+		if record["total"] != float64(tt.total) || record["failed"] != float64(tt.failed) || record["succeeded"] != float64(tt.total-tt.failed) {
+			t.Errorf("record %d counts = %v total, %v succeeded, %v failed", i+1, record["total"], record["succeeded"], record["failed"])
+		}
+		if _, hashed := record["csv_sha256"]; hashed != (tt.csv != nil) {
+			t.Errorf("record %d csv_sha256 = %v", i+1, record["csv_sha256"])
+		}
+		if ids, _ := record["message_ids"].([]interface{}); len(ids) != len(tt.messageIDs) {
+			t.Errorf("record %d message_ids = %v, want %v", i+1, record["message_ids"], tt.messageIDs)
+		}
+		wantKept := tt.errors
+		if wantKept > MaxErrors {
+			wantKept = MaxErrors
+		}
+		if errs, _ := record["errors"].([]interface{}); len(errs) != wantKept || record["error_count"] != float64(tt.errors) {
+			t.Errorf("record %d keeps %d of %v errors, want %d of %d", i+1, len(errs), record["error_count"], wantKept, tt.errors)
+		}
+	}
+}
+
+func TestNilRecord(t *testing.T) {
+	// Auditing is off: every method must be a no-op
+	var record *Record
+	record.AddError("ignored")
+	record.SetCounts(1, 0)
+	record.SetCSV([]byte("ignored"))
+	record.AddMessageIDs([]string{"<1@example.com>"})
+}
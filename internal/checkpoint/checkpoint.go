@@ -0,0 +1,168 @@
+package checkpoint
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// header is the first line of a checkpoint journal and identifies the run
+type header struct {
+	RunID string `json:"run_id"`
+}
+
+// record is a completed wallet fetch as stored in the journal
+type record struct {
+	WalletAddress string             `json:"wallet_address"`
+	Balance       float64            `json:"balance"`
+	Status        solana.QueryStatus `json:"status"`
+	SolanaBalance float64            `json:"sol_balance"`
+	SolanaFetched bool               `json:"sol_fetched"`
+	TokenAccounts []string           `json:"token_accounts,omitempty"`
+	SolLamports   uint64             `json:"sol_lamports"`
+	TokenRaw      string             `json:"token_raw_amount,omitempty"`
+	Timestamp     time.Time          `json:"timestamp"`
+}
+
+// Journal records completed wallet fetches of a cycle so an interrupted cycle can be resumed.
+// It is an append-only file: a header line with the run id followed by one line per wallet.
+type Journal struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+// Load reads an existing journal and returns its run id and completed balances keyed by wallet.
+// An empty run id means there is no interrupted cycle to resume.
+func Load(path string) (string, map[string]*solana.TokenBalance, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return "", nil, scanner.Err()
+	}
+
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil || h.RunID == "" {
+		return "", nil, fmt.Errorf("invalid checkpoint header in %s", path)
+	}
+
+	completed := make(map[string]*solana.TokenBalance)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A torn final line from a crash mid-write is expected; stop there
+			break
+		}
+		completed[r.WalletAddress] = &solana.TokenBalance{
+			WalletAddress:  r.WalletAddress,
+			Balance:        r.Balance,
+			Timestamp:      r.Timestamp,
+			Status:         r.Status,
+			SolanaBalance:  r.SolanaBalance,
+			SolanaFetched:  r.SolanaFetched,
+			TokenAccounts:  r.TokenAccounts,
+			SolanaLamports: r.SolLamports,
+			TokenRawAmount: r.TokenRaw,
+		}
+	}
+
+	return h.RunID, completed, scanner.Err()
+}
+
+// Open starts a journal for the given run. When resume is set the existing journal is
+// appended to, otherwise any previous journal is replaced.
+func Open(path, runID string, resume bool) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	if resume {
+		// Drop a torn final line so the records appended next are not lost behind it
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+		}
+		if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+			if err := os.Truncate(path, int64(end)); err != nil {
+				return nil, fmt.Errorf("failed to repair checkpoint: %w", err)
+			}
+		}
+
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+		}
+		return &Journal{path: path, file: file}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+
+	journal := &Journal{path: path, file: file}
+	if err := journal.writeLine(header{RunID: runID}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return journal, nil
+}
+
+// Record stores a completed wallet. Failed fetches are not recorded so they are retried on resume.
+func (j *Journal) Record(balance *solana.TokenBalance) error {
+	if balance.FetchError != nil || balance.SolanaError != nil {
+		return nil
+	}
+
+	return j.writeLine(record{
+		WalletAddress: balance.WalletAddress,
+		Balance:       balance.Balance,
+		Status:        balance.Status,
+		SolanaBalance: balance.SolanaBalance,
+		SolanaFetched: balance.SolanaFetched,
+		TokenAccounts: balance.TokenAccounts,
+		SolLamports:   balance.SolanaLamports,
+		TokenRaw:      balance.TokenRawAmount,
+		Timestamp:     balance.Timestamp,
+	})
+}
+
+// writeLine appends a JSON line to the journal
+func (j *Journal) writeLine(v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint entry: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Complete closes the journal and removes it, marking the cycle as finished
+func (j *Journal) Complete() error {
+	j.file.Close()
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+func TestResumeInterruptedCycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "checkpoint.jsonl")
+
+	journal, err := Open(path, "2026-03-01_14-00-00", false)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, balance := range []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 1.5, Status: solana.StatusOK, TokenRawAmount: "1500000"},
+		{WalletAddress: "b", FetchError: errors.New("rpc timeout"), Status: solana.StatusError},
+		{WalletAddress: "c", Balance: 2, SolanaError: errors.New("rpc timeout")},
+	} {
+		if err := journal.Record(balance); err != nil {
+			t.Fatalf("Record(%s): %v", balance.WalletAddress, err)
+		}
+	}
+
+	// The process dies halfway through writing the next line
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"wallet_address":"d","bal`)
+	file.Close()
+
+	runID, completed, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if runID != "2026-03-01_14-00-00" {
+		t.Errorf("run id = %q, want the interrupted run", runID)
+	}
+	if len(completed) != 1 || completed["a"] == nil {
+		t.Fatalf("completed = %v, want only wallet a; failed fetches are retried", completed)
+	}
+	if got := completed["a"]; got.Balance != 1.5 || got.TokenRawAmount != "1500000" || got.Status != solana.StatusOK {
+		t.Errorf("resumed balance = %+v", got)
+	}
+
+	// The resumed cycle appends to the journal and removes it once complete
+	journal, err = Open(path, runID, true)
+	if err != nil {
+		t.Fatalf("Open to resume: %v", err)
+	}
+	if err := journal.Record(&solana.TokenBalance{WalletAddress: "d", Balance: 4}); err != nil {
+		t.Fatalf("Record(d): %v", err)
+	}
+	if _, completed, _ := Load(path); len(completed) != 2 || completed["d"] == nil {
+		t.Errorf("completed after resuming = %v, want wallets a and d", completed)
+	}
+	if err := journal.Complete(); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if runID, _, err := Load(path); runID != "" || err != nil {
+		t.Errorf("Load after Complete = %q, %v; want no cycle to resume", runID, err)
+	}
+}
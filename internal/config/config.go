@@ -1,14 +1,28 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/schedule"
 )
 
+// SMTPServerConfig holds the connection details for a single SMTP relay
+type SMTPServerConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
 // Config holds all configuration for the application
 type Config struct {
 	SolanaRPCURL         string
@@ -18,14 +32,127 @@ type Config struct {
 	SMTPPort             int
 	SMTPUsername         string
 	SMTPPassword         string
+	SMTPServers          []SMTPServerConfig
 	EmailFrom            string
 	EmailTo              []string
+	EmailCC              []string
+	EmailBCC             []string
+	EmailToFile          string
 	RPCTimeout           time.Duration
 	MaxRetries           int
+	MailMaxRetries       int
 	ConcurrencyLimit     int
 	AddressesFilePath    string
 	CSVDirPath           string
+	CSVFallbackDirPath   string
 	LogsDirPath          string
+	CheckpointPath       string
+	DBPath               string
+	BalanceRoundPlaces   int
+	BalanceRoundMode     rounding.Mode
+	ValidateAccountType  string
+	CSVCRLF              bool
+	BalanceSource        string
+	GraphQLURL           string
+	GraphQLQuery         string
+	GraphQLBalanceField  string
+	PinSlot              bool
+	FetchMode            string
+	StartupDelay         time.Duration
+	IncludeStatus        bool
+	EmailConcurrency     int
+	ResumeCycles         bool
+	TopMovers            int
+	CSVSort              string
+	AppEnv               string
+	EmailFooter          string
+	LogRequestID         bool
+	ReportLocation       *time.Location
+	RecipientLocations   map[string]*time.Location
+	MaxCycleDuration     time.Duration
+	IncludeTokenAccount  bool
+	DBBatchSize          int
+	DBQueueSize          int
+	QuietHours           *schedule.QuietHours
+	SkipCSV              bool
+	RetryLogEvery        int
+	TLSCAFile            string
+	EnvBanner            string
+	RetryPassDelay       time.Duration
+	JSONDirPath          string
+	SummaryJSON          bool
+	SummaryTopN          int
+	ZeroBalanceRPCCodes  []int
+	IncludeRaw           bool
+	IncludePrevious      bool
+	CSVFsync             bool
+	MinSolBalance        float64
+	MinSolBalanceAuto    bool
+	ChecksumManifest     string
+	MaxResponseBytes     int64
+	InitMaxRetries       int
+	MetricsBackend       string
+	MetricsFile          string
+	StatsdAddr           string
+	AlertCooldown        time.Duration
+	Baseline             string
+	DNSMaxLookups        int
+	DNSCacheTTL          time.Duration
+	MailerBackend        string
+	QueueURL             string
+	QueueTopic           string
+	ExpectedTotalToken   *float64
+	ExpectedTotalTol     float64
+	CompressCSV          bool
+	CompressJSON         bool
+	AlertWalletCooldown  time.Duration
+	Commitment           string
+	BulkMode             bool
+	MaxRcptPerMessage    int
+	StaleAfter           int
+	AuditFile            string
+	RunBudget            time.Duration
+	NormalizeAddresses   bool
+	WithDeltas           bool // Set from the --with-deltas flag
+	RunOnce              bool // Set from RUN_ONCE or the --once flag
+	PreferUIString       bool
+	StrictAddresses      bool
+	RunDirs              bool
+	AllowDuplicates      bool
+	VerifyDelivery       bool
+	DeliveryStatusURL    string
+	DeliveryTimeout      time.Duration
+	DeliveryFailAction   string
+	Tiers                []float64
+	LogLevel             logger.Level
+	LogMaxSizeMB         int
+	LogMaxBackups        int
+	StreamWebhookURL     string
+	StreamBatchSize      int
+	StreamBufferSize     int
+	StreamConcurrency    int
+	RetentionDays        int
+	RetryOn500           bool
+	EmailFormat          string
+	EmailTopN            int
+	IncludeAttempts      bool
+	CompressAttachment   bool
+	EmailSubjectTemplate string
+	EmailBodyTemplate    string
+	DryRun               bool
+	EmailQR              bool
+	SlackWebhookURL      string
+	NotifyEmail          bool
+	NotifySlack          bool
+	HealthPort           int
+	MaxEmailBodyBytes    int
+	DBBusyTimeout        time.Duration
+	AddressSource        string
+	AddressQuery         string
+	TokenLabel           string
+	CatchUp              bool
+	SolanaRPCURLs        []string
+	IncludeAccountType   bool
 }
 
 // LoadConfig loads configuration from environment variables
@@ -35,8 +162,35 @@ func LoadConfig() (*Config, error) {
 
 	// Set default paths
 	addressesPath := "addresses.txt"
+	if val, exists := os.LookupEnv("ADDRESSES_FILE"); exists && val != "" {
+		addressesPath = val
+	}
 	csvDirPath := "csv"
+	if val, exists := os.LookupEnv("CSV_DIR"); exists && val != "" {
+		csvDirPath = val
+	}
+	jsonDirPath := "json"
+	if val, exists := os.LookupEnv("JSON_DIR"); exists && val != "" {
+		jsonDirPath = val
+	}
 	logsDirPath := "logs"
+	checkpointPath := "data/cycle_checkpoint.jsonl"
+
+	// Parse database path with a default of data/reporter.db
+	dbPath := "data/reporter.db"
+	if val, exists := os.LookupEnv("DB_PATH"); exists && val != "" {
+		dbPath = val
+	}
+
+	// Parse how long database statements wait for a lock with a default of 5s
+	dbBusyTimeout := 5 * time.Second
+	if val, exists := os.LookupEnv("DB_BUSY_TIMEOUT"); exists && val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid DB_BUSY_TIMEOUT %q: expected a duration like 5s", val)
+		}
+		dbBusyTimeout = parsed
+	}
 
 	// Parse fetch interval with a default of 60 minutes
 	fetchInterval := 60
@@ -70,6 +224,14 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	// Parse mailer retries, defaulting to the shared max retries
+	mailMaxRetries := maxRetries
+	if val, exists := os.LookupEnv("MAIL_MAX_RETRIES"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			mailMaxRetries = parsed
+		}
+	}
+
 	// Parse concurrency limit with a default of 20
 	concurrencyLimit := 20
 	if val, exists := os.LookupEnv("CONCURRENCY_LIMIT"); exists {
@@ -78,6 +240,23 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	// Parse the RPC endpoints, tried in order with failover, with a default of
+	// SOLANA_RPC_URL alone. SolanaRPCURL is set to the primary endpoint.
+	solanaRPCURL := os.Getenv("SOLANA_RPC_URL")
+	solanaRPCURLs := []string{}
+	if val, exists := os.LookupEnv("SOLANA_RPC_URLS"); exists {
+		for _, rpcURL := range strings.Split(val, ",") {
+			if rpcURL = strings.TrimSpace(rpcURL); rpcURL != "" {
+				solanaRPCURLs = append(solanaRPCURLs, rpcURL)
+			}
+		}
+	}
+	if len(solanaRPCURLs) > 0 {
+		solanaRPCURL = solanaRPCURLs[0]
+	} else if solanaRPCURL != "" {
+		solanaRPCURLs = []string{solanaRPCURL}
+	}
+
 	// Parse email recipients
 	emailTo := []string{}
 	if val, exists := os.LookupEnv("EMAIL_TO"); exists && val != "" {
@@ -88,21 +267,1047 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	// Parse carbon copy and blind carbon copy recipients
+	emailCC := []string{}
+	if val, exists := os.LookupEnv("EMAIL_CC"); exists && val != "" {
+		for _, recipient := range strings.Split(val, ",") {
+			emailCC = append(emailCC, strings.TrimSpace(recipient))
+		}
+	}
+	emailBCC := []string{}
+	if val, exists := os.LookupEnv("EMAIL_BCC"); exists && val != "" {
+		for _, recipient := range strings.Split(val, ",") {
+			emailBCC = append(emailBCC, strings.TrimSpace(recipient))
+		}
+	}
+
+	// Parse balance rounding; negative places keep the default formatting
+	balanceRoundPlaces := -1
+	if val, exists := os.LookupEnv("BALANCE_ROUND_PLACES"); exists && val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid BALANCE_ROUND_PLACES %q", val)
+		}
+		balanceRoundPlaces = parsed
+	}
+
+	balanceRoundMode := rounding.HalfUp
+	if val, exists := os.LookupEnv("BALANCE_ROUND_MODE"); exists && val != "" {
+		parsed, err := rounding.ParseMode(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BALANCE_ROUND_MODE: %w", err)
+		}
+		balanceRoundMode = parsed
+	}
+
+	// Parse account type validation: off (default), warn or skip
+	validateAccountType := ""
+	if val, exists := os.LookupEnv("VALIDATE_ACCOUNT_TYPE"); exists && val != "" {
+		switch mode := strings.ToLower(strings.TrimSpace(val)); mode {
+		case "off":
+		case "warn", "skip":
+			validateAccountType = mode
+		default:
+			return nil, fmt.Errorf("invalid VALIDATE_ACCOUNT_TYPE %q: must be off, warn or skip", val)
+		}
+	}
+
+	// Parse CSV line ending style
+	csvCRLF := false
+	if val, exists := os.LookupEnv("CSV_CRLF"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			csvCRLF = parsed
+		}
+	}
+
+	// Parse address source: file (default) or db, a query on the history database
+	addressSource := "file"
+	if val, exists := os.LookupEnv("ADDRESS_SOURCE"); exists && val != "" {
+		addressSource = strings.ToLower(strings.TrimSpace(val))
+	}
+	if addressSource != "file" && addressSource != "db" {
+		return nil, fmt.Errorf("invalid ADDRESS_SOURCE %q: must be file or db", addressSource)
+	}
+	addressQuery := "SELECT address FROM addresses"
+	if val, exists := os.LookupEnv("ADDRESS_QUERY"); exists && strings.TrimSpace(val) != "" {
+		addressQuery = val
+	}
+
+	// Parse balance source: rpc (default) or graphql
+	balanceSource := "rpc"
+	if val, exists := os.LookupEnv("BALANCE_SOURCE"); exists && val != "" {
+		balanceSource = strings.ToLower(strings.TrimSpace(val))
+	}
+	graphQLURL := os.Getenv("GRAPHQL_URL")
+	switch balanceSource {
+	case "rpc":
+	case "graphql":
+		if graphQLURL == "" {
+			return nil, fmt.Errorf("GRAPHQL_URL is required when BALANCE_SOURCE=graphql")
+		}
+	default:
+		return nil, fmt.Errorf("invalid BALANCE_SOURCE %q: must be rpc or graphql", balanceSource)
+	}
+
+	graphQLQuery := os.Getenv("GRAPHQL_QUERY")
+	graphQLBalanceField := "balance"
+	if val, exists := os.LookupEnv("GRAPHQL_BALANCE_FIELD"); exists && val != "" {
+		graphQLBalanceField = val
+	}
+
+	// Parse slot pinning for consistent per-cycle snapshots
+	pinSlot := false
+	if val, exists := os.LookupEnv("PIN_SLOT"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			pinSlot = parsed
+		}
+	}
+
+	// Parse fetch mode: token (default) or both to also fetch SOL balances
+	fetchMode := "token"
+	if val, exists := os.LookupEnv("FETCH_MODE"); exists && val != "" {
+		fetchMode = strings.ToLower(strings.TrimSpace(val))
+	}
+	switch fetchMode {
+	case "token":
+	case "both":
+		if balanceSource != "rpc" {
+			return nil, fmt.Errorf("FETCH_MODE=both requires BALANCE_SOURCE=rpc")
+		}
+	default:
+		return nil, fmt.Errorf("invalid FETCH_MODE %q: must be token or both", fetchMode)
+	}
+
+	// Parse startup delay with a default of no delay
+	startupDelay := time.Duration(0)
+	if val, exists := os.LookupEnv("STARTUP_DELAY_SECONDS"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			startupDelay = time.Duration(parsed) * time.Second
+		}
+	}
+
+	// Parse inclusion of the per-wallet query status column
+	includeStatus := false
+	if val, exists := os.LookupEnv("INCLUDE_STATUS"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			includeStatus = parsed
+		}
+	}
+
+	// Parse inclusion of the token account (ATA) address column
+	includeTokenAccount := false
+	if val, exists := os.LookupEnv("INCLUDE_TOKEN_ACCOUNT"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			includeTokenAccount = parsed
+		}
+	}
+
+	// Parse inclusion of exact integer lamport and raw token amount columns
+	includeRaw := false
+	if val, exists := os.LookupEnv("INCLUDE_RAW"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			includeRaw = parsed
+		}
+	}
+
+	// Parse inclusion of the previous run's balance from history
+	includePrevious := false
+	if val, exists := os.LookupEnv("INCLUDE_PREVIOUS"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			includePrevious = parsed
+		}
+	}
+
+	// Parse whether CSV files are fsynced before they are emailed
+	csvFsync := false
+	if val, exists := os.LookupEnv("CSV_FSYNC"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			csvFsync = parsed
+		}
+	}
+
+	// Parse bulk mode with a default of false
+	bulkMode := false
+	if val, exists := os.LookupEnv("BULK_MODE"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			bulkMode = parsed
+		}
+	}
+
+	// Parse address normalization with a default of true
+	normalizeAddresses := true
+	if val, exists := os.LookupEnv("NORMALIZE_ADDRESSES"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			normalizeAddresses = parsed
+		}
+	}
+
+	// Parse whether token balances are read from uiAmountString with a default of false
+	preferUIString := false
+	if val, exists := os.LookupEnv("PREFER_UI_STRING"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			preferUIString = parsed
+		}
+	}
+
+	// Parse strict address validation with a default of false
+	strictAddresses := false
+	if val, exists := os.LookupEnv("STRICT_ADDRESSES"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			strictAddresses = parsed
+		}
+	}
+
+	// Parse per-run output directories with a default of false
+	runDirs := false
+	if val, exists := os.LookupEnv("RUN_DIRS"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			runDirs = parsed
+		}
+	}
+
+	// Parse duplicate address handling with a default of false
+	allowDuplicates := false
+	if val, exists := os.LookupEnv("ALLOW_DUPLICATE_ADDRESSES"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			allowDuplicates = parsed
+		}
+	}
+
+	// Parse retrying of HTTP 500 RPC responses with a default of false
+	retryOn500 := false
+	if val, exists := os.LookupEnv("RETRY_ON_500"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			retryOn500 = parsed
+		}
+	}
+
+	// Parse email send concurrency with a default of 1
+	emailConcurrency := 1
+	if val, exists := os.LookupEnv("EMAIL_CONCURRENCY"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			emailConcurrency = parsed
+		}
+	}
+
+	// Parse resumption of interrupted cycles
+	resumeCycles := false
+	if val, exists := os.LookupEnv("RESUME_CYCLES"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			resumeCycles = parsed
+		}
+	}
+
+	// Parse the number of top movers shown in the email (0 disables the section)
+	topMovers := 0
+	if val, exists := os.LookupEnv("TOP_MOVERS"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			topMovers = parsed
+		}
+	}
+
+	// Parse CSV row ordering: none (default), balance or address
+	csvSort := ""
+	if val, exists := os.LookupEnv("CSV_SORT"); exists && val != "" {
+		switch mode := strings.ToLower(strings.TrimSpace(val)); mode {
+		case "none":
+		case "balance", "address":
+			csvSort = mode
+		default:
+			return nil, fmt.Errorf("invalid CSV_SORT %q: must be none, balance or address", val)
+		}
+	}
+
+	// Parse deployment environment with a default of prod
+	appEnv := "prod"
+	if val, exists := os.LookupEnv("APP_ENV"); exists && val != "" {
+		appEnv = strings.TrimSpace(val)
+	}
+
+	// Parse the environment banner shown on reports; outside prod it defaults to the
+	// upper-cased environment name and an explicitly empty ENV_BANNER disables it
+	envBanner := ""
+	if !strings.EqualFold(appEnv, "prod") {
+		envBanner = strings.ToUpper(appEnv)
+	}
+	if val, exists := os.LookupEnv("ENV_BANNER"); exists {
+		envBanner = strings.TrimSpace(val)
+	}
+
+	// Parse the token name used in report emails with a default of JINGLE
+	tokenLabel := "JINGLE"
+	if val, exists := os.LookupEnv("TOKEN_LABEL"); exists {
+		tokenLabel = strings.TrimSpace(val)
+	}
+
+	// Parse per-cycle request id logging
+	logRequestID := false
+	if val, exists := os.LookupEnv("LOG_REQUEST_ID"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			logRequestID = parsed
+		}
+	}
+
+	// Parse the minimum log level with a default of info
+	logLevel := logger.LevelInfo
+	if val, exists := os.LookupEnv("LOG_LEVEL"); exists && val != "" {
+		parsed, err := logger.ParseLevel(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q: expected debug, info, warn or error", val)
+		}
+		logLevel = parsed
+	}
+
+	// Parse the log size rotation threshold with a default of 0 (disabled)
+	logMaxSizeMB := 0
+	if val, exists := os.LookupEnv("LOG_MAX_SIZE_MB"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			logMaxSizeMB = parsed
+		}
+	}
+
+	// Parse the number of size-rotated log backups with a default of 5
+	logMaxBackups := 5
+	if val, exists := os.LookupEnv("LOG_MAX_BACKUPS"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			logMaxBackups = parsed
+		}
+	}
+
+	// Parse the default report time zone with a default of UTC
+	reportLocation := time.UTC
+	if val, exists := os.LookupEnv("REPORT_TIMEZONE"); exists && val != "" {
+		loc, err := time.LoadLocation(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("invalid REPORT_TIMEZONE %q: %w", val, err)
+		}
+		reportLocation = loc
+	}
+
+	// Parse per-recipient time zones as comma-separated email=Zone pairs
+	recipientLocations := make(map[string]*time.Location)
+	if val, exists := os.LookupEnv("EMAIL_TIMEZONES"); exists && val != "" {
+		for _, pair := range strings.Split(val, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			recipient, zone, found := strings.Cut(pair, "=")
+			if !found {
+				return nil, fmt.Errorf("invalid EMAIL_TIMEZONES entry %q: expected email=Zone", pair)
+			}
+			loc, err := time.LoadLocation(strings.TrimSpace(zone))
+			if err != nil {
+				return nil, fmt.Errorf("invalid time zone for %s: %w", recipient, err)
+			}
+			recipientLocations[strings.ToLower(strings.TrimSpace(recipient))] = loc
+		}
+	}
+
+	// Parse the hard cap on fetching time per cycle (0 disables it)
+	maxCycleDuration := time.Duration(0)
+	if val, exists := os.LookupEnv("MAX_CYCLE_DURATION"); exists && val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid MAX_CYCLE_DURATION %q: expected a duration like 10m", val)
+		}
+		maxCycleDuration = parsed
+	}
+
+	// Parse the bound on a whole cycle (fetch, write and email) (0 disables it)
+	runBudget := time.Duration(0)
+	if val, exists := os.LookupEnv("RUN_BUDGET"); exists && val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid RUN_BUDGET %q: expected a duration like 15m", val)
+		}
+		runBudget = parsed
+	}
+
+	// Parse the number of balance records per database write with a default of 500
+	dbBatchSize := 500
+	if val, exists := os.LookupEnv("DB_BATCH_SIZE"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			dbBatchSize = parsed
+		}
+	}
+
+	// Parse the bound on balances waiting to be written with a default of 1000
+	dbQueueSize := 1000
+	if val, exists := os.LookupEnv("DB_QUEUE_SIZE"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			dbQueueSize = parsed
+		}
+	}
+
+	// Parse the number of balances per stream webhook request with a default of 50
+	streamBatchSize := 50
+	if val, exists := os.LookupEnv("STREAM_BATCH_SIZE"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			streamBatchSize = parsed
+		}
+	}
+
+	// Parse the bound on balances waiting to be streamed with a default of 1000
+	streamBufferSize := 1000
+	if val, exists := os.LookupEnv("STREAM_BUFFER_SIZE"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			streamBufferSize = parsed
+		}
+	}
+
+	// Parse the concurrent stream webhook requests with a default of 2
+	streamConcurrency := 2
+	if val, exists := os.LookupEnv("STREAM_CONCURRENCY"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			streamConcurrency = parsed
+		}
+	}
+
+	// Parse the CSV and log retention in days with a default of 0 (keep everything)
+	retentionDays := 0
+	if val, exists := os.LookupEnv("RETENTION_DAYS"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			retentionDays = parsed
+		}
+	}
+
+	// Parse the quiet hours window, in the report time zone, during which emails are deferred
+	var quietHours *schedule.QuietHours
+	if val, exists := os.LookupEnv("QUIET_HOURS"); exists && val != "" {
+		parsed, err := schedule.ParseQuietHours(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUIET_HOURS: %w", err)
+		}
+		quietHours = parsed
+	}
+
+	// Parse whether to skip writing CSV files and keep balances only in the database
+	skipCSV := false
+	if val, exists := os.LookupEnv("SKIP_CSV"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			skipCSV = parsed
+		}
+	}
+
+	// Parse how often retry attempts are logged with a default of 1 (every attempt);
+	// 0 logs only the first and last attempt
+	retryLogEvery := 1
+	if val, exists := os.LookupEnv("RETRY_LOG_EVERY"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			retryLogEvery = parsed
+		}
+	}
+
+	// Parse the optional CA bundle used for SMTP and RPC TLS instead of the system roots
+	tlsCAFile := strings.TrimSpace(os.Getenv("TLS_CA_FILE"))
+
+	// Parse the wait before a second pass over failed wallets (0 disables the pass)
+	retryPassDelay := time.Duration(0)
+	if val, exists := os.LookupEnv("RETRY_PASS_DELAY"); exists && val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid RETRY_PASS_DELAY %q: expected a duration like 30s", val)
+		}
+		retryPassDelay = parsed
+	}
+
+	// Parse whether to write and attach a JSON summary of each run
+	summaryJSON := false
+	if val, exists := os.LookupEnv("SUMMARY_JSON"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			summaryJSON = parsed
+		}
+	}
+
+	// Parse the number of largest and smallest wallets in the summary with a default of 5
+	summaryTopN := 5
+	if val, exists := os.LookupEnv("SUMMARY_TOP_N"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			summaryTopN = parsed
+		}
+	}
+
+	// Parse JSON-RPC error codes that mean a zero balance rather than a failed fetch
+	zeroBalanceRPCCodes := []int{}
+	if val, exists := os.LookupEnv("ZERO_BALANCE_RPC_CODES"); exists && val != "" {
+		for _, part := range strings.Split(val, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("invalid ZERO_BALANCE_RPC_CODES entry %q: %w", part, err)
+			}
+			zeroBalanceRPCCodes = append(zeroBalanceRPCCodes, code)
+		}
+	}
+
+	// Parse the SOL balance below which wallets are flagged; "auto" uses the
+	// rent-exempt minimum reported by the RPC node
+	minSolBalance := 0.0
+	minSolBalanceAuto := false
+	if val, exists := os.LookupEnv("MIN_SOL_BALANCE"); exists && val != "" {
+		if strings.EqualFold(strings.TrimSpace(val), "auto") {
+			minSolBalanceAuto = true
+		} else {
+			parsed, err := strconv.ParseFloat(val, 64)
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("invalid MIN_SOL_BALANCE %q: expected a SOL amount or auto", val)
+			}
+			minSolBalance = parsed
+		}
+	}
+
+	// Parse the optional SHA256SUMS manifest that records a checksum of every produced file
+	checksumManifest := strings.TrimSpace(os.Getenv("CHECKSUM_MANIFEST"))
+
+	// Parse the cap on RPC response body size with a default of 10 MiB
+	maxResponseBytes := int64(10 << 20)
+	if val, exists := os.LookupEnv("MAX_RESPONSE_BYTES"); exists {
+		if parsed, err := strconv.ParseInt(val, 10, 64); err == nil && parsed > 0 {
+			maxResponseBytes = parsed
+		}
+	}
+
+	// Parse retries of component initialization at startup with a default of 3
+	initMaxRetries := 3
+	if val, exists := os.LookupEnv("INIT_MAX_RETRIES"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			initMaxRetries = parsed
+		}
+	}
+
+	// Parse the metrics backend: none, prometheus (text file) or statsd
+	metricsBackend := "none"
+	if val, exists := os.LookupEnv("METRICS_BACKEND"); exists && val != "" {
+		metricsBackend = strings.ToLower(strings.TrimSpace(val))
+		if metricsBackend != "none" && metricsBackend != "prometheus" && metricsBackend != "statsd" {
+			return nil, fmt.Errorf("invalid METRICS_BACKEND %q: expected none, prometheus or statsd", val)
+		}
+	}
+
+	// Parse the Prometheus metrics file with a default of data/metrics.prom
+	metricsFile := "data/metrics.prom"
+	if val, exists := os.LookupEnv("METRICS_FILE"); exists && val != "" {
+		metricsFile = val
+	}
+
+	// Parse the statsd daemon address with a default of 127.0.0.1:8125
+	statsdAddr := "127.0.0.1:8125"
+	if val, exists := os.LookupEnv("STATSD_ADDR"); exists && val != "" {
+		statsdAddr = val
+	}
+
+	// Parse the minimum time between repeats of the same alert (0 repeats every cycle)
+	alertCooldown := time.Duration(0)
+	if val, exists := os.LookupEnv("ALERT_COOLDOWN"); exists && val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid ALERT_COOLDOWN %q: expected a duration like 6h", val)
+		}
+		alertCooldown = parsed
+	}
+
+	// Parse the minimum time between alerts of any type for the same wallet (0 disables)
+	alertWalletCooldown := time.Duration(0)
+	if val, exists := os.LookupEnv("ALERT_WALLET_COOLDOWN"); exists && val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid ALERT_WALLET_COOLDOWN %q: expected a duration like 24h", val)
+		}
+		alertWalletCooldown = parsed
+	}
+
+	// Parse the name of the baseline snapshot reports are compared against
+	baseline := strings.TrimSpace(os.Getenv("BASELINE"))
+
+	// Parse the limit on concurrent DNS lookups of the RPC host with a default of 0 (unlimited)
+	dnsMaxLookups := 0
+	if val, exists := os.LookupEnv("DNS_MAX_LOOKUPS"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			dnsMaxLookups = parsed
+		}
+	}
+
+	// Parse how long resolved RPC host addresses are reused with a default of 1m (0 disables caching)
+	dnsCacheTTL := time.Minute
+	if val, exists := os.LookupEnv("DNS_CACHE_TTL"); exists && val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid DNS_CACHE_TTL %q: expected a duration like 1m", val)
+		}
+		dnsCacheTTL = parsed
+	}
+
+	// Parse the report delivery backend: smtp (email) or queue (message queue)
+	mailerBackend := "smtp"
+	if val, exists := os.LookupEnv("MAILER_BACKEND"); exists && val != "" {
+		mailerBackend = strings.ToLower(strings.TrimSpace(val))
+		if mailerBackend != "smtp" && mailerBackend != "queue" {
+			return nil, fmt.Errorf("invalid MAILER_BACKEND %q: expected smtp or queue", val)
+		}
+	}
+
+	// Parse the message queue URL, required when MAILER_BACKEND=queue
+	queueURL := os.Getenv("QUEUE_URL")
+	if mailerBackend == "queue" && queueURL == "" {
+		return nil, fmt.Errorf("QUEUE_URL is required when MAILER_BACKEND=queue")
+	}
+
+	// Parse the queue topic with a default of solana.balance.report
+	queueTopic := "solana.balance.report"
+	if val, exists := os.LookupEnv("QUEUE_TOPIC"); exists && val != "" {
+		queueTopic = val
+	}
+
+	// Parse post-send delivery verification with a default of false
+	verifyDelivery := false
+	if val, exists := os.LookupEnv("VERIFY_DELIVERY"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			verifyDelivery = parsed
+		}
+	}
+
+	// Parse the delivery verification timeout with a default of 2m
+	deliveryTimeout := 2 * time.Minute
+	if val, exists := os.LookupEnv("DELIVERY_VERIFY_TIMEOUT"); exists && val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid DELIVERY_VERIFY_TIMEOUT %q: expected a positive duration like 2m", val)
+		}
+		deliveryTimeout = parsed
+	}
+
+	// Parse the action on a failed delivery verification with a default of alert
+	deliveryFailAction := "alert"
+	if val, exists := os.LookupEnv("DELIVERY_FAIL_ACTION"); exists && val != "" {
+		deliveryFailAction = strings.ToLower(strings.TrimSpace(val))
+		if deliveryFailAction != "alert" && deliveryFailAction != "retry" {
+			return nil, fmt.Errorf("invalid DELIVERY_FAIL_ACTION %q: expected alert or retry", val)
+		}
+	}
+
+	// Parse the ascending balance tier boundaries, unset by default
+	var tiers []float64
+	if val, exists := os.LookupEnv("TIERS"); exists && val != "" {
+		for _, field := range strings.Split(val, ",") {
+			bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TIERS %q: expected comma-separated balances like 0,100,10000", val)
+			}
+			if len(tiers) > 0 && bound <= tiers[len(tiers)-1] {
+				return nil, fmt.Errorf("invalid TIERS %q: boundaries must be in ascending order", val)
+			}
+			tiers = append(tiers, bound)
+		}
+	}
+
+	// Parse the email body format with a default of both
+	emailFormat := "both"
+	if val, exists := os.LookupEnv("EMAIL_FORMAT"); exists && val != "" {
+		emailFormat = strings.ToLower(strings.TrimSpace(val))
+		if emailFormat != "text" && emailFormat != "html" && emailFormat != "both" {
+			return nil, fmt.Errorf("invalid EMAIL_FORMAT %q: expected text, html or both", val)
+		}
+	}
+
+	// Parse the number of wallets tabled in the HTML email with a default of 10
+	emailTopN := 10
+	if val, exists := os.LookupEnv("EMAIL_TOP_N"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			emailTopN = parsed
+		}
+	}
+
+	// Parse inclusion of each wallet's fetch attempt count
+	includeAttempts := false
+	if val, exists := os.LookupEnv("INCLUDE_ATTEMPTS"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			includeAttempts = parsed
+		}
+	}
+
+	// Parse gzip compression of the emailed CSV attachment
+	compressAttachment := false
+	if val, exists := os.LookupEnv("COMPRESS_ATTACHMENT"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			compressAttachment = parsed
+		}
+	}
+
+	// Parse the email body size cap with a default of 0 (no cap)
+	maxEmailBodyBytes := 0
+	if val, exists := os.LookupEnv("MAX_EMAIL_BODY_BYTES"); exists && val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid MAX_EMAIL_BODY_BYTES %q: expected a non-negative number of bytes", val)
+		}
+		maxEmailBodyBytes = parsed
+	}
+
+	// Parse the report subject and body templates, read from a file when only the
+	// _FILE variant is set; unset keeps the default subject and body
+	emailSubjectTemplate, err := templateSetting("EMAIL_SUBJECT_TEMPLATE")
+	if err != nil {
+		return nil, err
+	}
+	emailBodyTemplate, err := templateSetting("EMAIL_BODY_TEMPLATE")
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse dry run mode, which logs the report emails instead of sending them
+	dryRun := false
+	if val, exists := os.LookupEnv("DRY_RUN"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			dryRun = parsed
+		}
+	}
+
+	// Parse embedding of a QR code of the report hash in the HTML email
+	emailQR := false
+	if val, exists := os.LookupEnv("EMAIL_QR"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			emailQR = parsed
+		}
+	}
+
+	// Parse run-once mode, which runs a single cycle and exits instead of looping
+	runOnce := false
+	if val, exists := os.LookupEnv("RUN_ONCE"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			runOnce = parsed
+		}
+	}
+
+	// Parse catch-up mode, which notes missed reports after downtime, with a default of false
+	catchUp := false
+	if val, exists := os.LookupEnv("CATCH_UP"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			catchUp = parsed
+		}
+	}
+
+	// Parse the health check and metrics server port with a default of 0 (disabled)
+	healthPort := 0
+	if val, exists := os.LookupEnv("HEALTH_PORT"); exists && val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 0 || parsed > 65535 {
+			return nil, fmt.Errorf("invalid HEALTH_PORT %q: expected a port number", val)
+		}
+		healthPort = parsed
+	}
+
+	// Parse the channels reports go out on: a list of email and slack, defaulting to
+	// email plus Slack when a webhook is configured
+	slackWebhookURL := strings.TrimSpace(os.Getenv("SLACK_WEBHOOK_URL"))
+	notifyEmail, notifySlack := true, slackWebhookURL != ""
+	if val, exists := os.LookupEnv("NOTIFY_CHANNELS"); exists && val != "" {
+		notifyEmail, notifySlack = false, false
+		for _, part := range strings.Split(val, ",") {
+			switch strings.ToLower(strings.TrimSpace(part)) {
+			case "email":
+				notifyEmail = true
+			case "slack":
+				notifySlack = true
+			default:
+				return nil, fmt.Errorf("invalid NOTIFY_CHANNELS entry %q: expected email or slack", part)
+			}
+		}
+		if notifySlack && slackWebhookURL == "" {
+			return nil, fmt.Errorf("NOTIFY_CHANNELS includes slack but SLACK_WEBHOOK_URL is not set")
+		}
+	}
+
+	// Parse the expected sum of all token balances, unset by default
+	var expectedTotalToken *float64
+	if val, exists := os.LookupEnv("EXPECTED_TOTAL_TOKEN"); exists && val != "" {
+		parsed, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EXPECTED_TOTAL_TOKEN %q: expected a token amount", val)
+		}
+		expectedTotalToken = &parsed
+	}
+
+	// Parse the tolerated difference from the expected total with a default of 0
+	expectedTotalTol := 0.0
+	if val, exists := os.LookupEnv("EXPECTED_TOTAL_TOLERANCE"); exists && val != "" {
+		parsed, err := strconv.ParseFloat(val, 64)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid EXPECTED_TOTAL_TOLERANCE %q: expected a non-negative token amount", val)
+		}
+		expectedTotalTol = parsed
+	}
+
+	// Parse the output formats written gzip-compressed: a list of csv and json, or true for both
+	compressCSV, compressJSON := false, false
+	if val, exists := os.LookupEnv("COMPRESS_OUTPUTS"); exists && val != "" {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			compressCSV, compressJSON = parsed, parsed
+		} else {
+			for _, part := range strings.Split(val, ",") {
+				switch strings.ToLower(strings.TrimSpace(part)) {
+				case "csv":
+					compressCSV = true
+				case "json":
+					compressJSON = true
+				default:
+					return nil, fmt.Errorf("invalid COMPRESS_OUTPUTS entry %q: expected csv or json", part)
+				}
+			}
+		}
+	}
+
+	// Parse the RPC commitment level with a default of confirmed
+	commitment := "confirmed"
+	if val, exists := os.LookupEnv("RPC_COMMITMENT"); exists && val != "" {
+		commitment = strings.ToLower(strings.TrimSpace(val))
+		if commitment != "processed" && commitment != "confirmed" && commitment != "finalized" {
+			return nil, fmt.Errorf("invalid RPC_COMMITMENT %q: expected processed, confirmed or finalized", val)
+		}
+	}
+
+	// Parse the maximum recipients per email with a default of 0 (no cap)
+	maxRcptPerMessage := 0
+	if val, exists := os.LookupEnv("MAX_RCPT_PER_MESSAGE"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			maxRcptPerMessage = parsed
+		}
+	}
+
+	// Parse the number of unchanged runs after which a wallet is left out of change
+	// sections with a default of 0 (never)
+	staleAfter := 0
+	if val, exists := os.LookupEnv("STALE_AFTER"); exists {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			staleAfter = parsed
+		}
+	}
+
+	// Parse the JSONL audit file, one record per cycle; empty disables auditing
+	auditFile := os.Getenv("AUDIT_FILE")
+
+	// Parse SMTP relays, falling back to the single SMTP_SERVER settings
+	smtpUsername := os.Getenv("SMTP_USERNAME")
+	smtpPassword := os.Getenv("SMTP_PASSWORD")
+	smtpServers := []SMTPServerConfig{}
+	if val, exists := os.LookupEnv("SMTP_SERVERS"); exists && val != "" {
+		for _, entry := range strings.Split(val, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			server, err := parseSMTPServer(entry, smtpPort, smtpUsername, smtpPassword)
+			if err != nil {
+				return nil, err
+			}
+			smtpServers = append(smtpServers, server)
+		}
+	} else if val := os.Getenv("SMTP_SERVER"); val != "" {
+		smtpServers = append(smtpServers, SMTPServerConfig{
+			Host:     val,
+			Port:     smtpPort,
+			Username: smtpUsername,
+			Password: smtpPassword,
+		})
+	}
+
+	// Parse inclusion of the account type and stake columns with a default of false
+	includeAccountType := false
+	if val, exists := os.LookupEnv("INCLUDE_ACCOUNT_TYPE"); exists {
+		if parsed, err := strconv.ParseBool(val); err == nil {
+			includeAccountType = parsed
+		}
+	}
+
 	return &Config{
-		SolanaRPCURL:         os.Getenv("SOLANA_RPC_URL"),
+		SolanaRPCURL:         solanaRPCURL,
 		TokenMintAddress:     os.Getenv("TOKEN_MINT_ADDRESS"),
 		FetchIntervalMinutes: fetchInterval,
 		SMTPServer:           os.Getenv("SMTP_SERVER"),
 		SMTPPort:             smtpPort,
-		SMTPUsername:         os.Getenv("SMTP_USERNAME"),
-		SMTPPassword:         os.Getenv("SMTP_PASSWORD"),
+		SMTPUsername:         smtpUsername,
+		SMTPPassword:         smtpPassword,
+		SMTPServers:          smtpServers,
 		EmailFrom:            os.Getenv("EMAIL_FROM"),
 		EmailTo:              emailTo,
+		EmailCC:              emailCC,
+		EmailBCC:             emailBCC,
+		EmailToFile:          os.Getenv("EMAIL_TO_FILE"),
 		RPCTimeout:           rpcTimeout,
 		MaxRetries:           maxRetries,
+		MailMaxRetries:       mailMaxRetries,
 		ConcurrencyLimit:     concurrencyLimit,
 		AddressesFilePath:    addressesPath,
 		CSVDirPath:           csvDirPath,
+		CSVFallbackDirPath:   os.Getenv("CSV_FALLBACK_DIR"),
 		LogsDirPath:          logsDirPath,
+		CheckpointPath:       checkpointPath,
+		DBPath:               dbPath,
+		BalanceRoundPlaces:   balanceRoundPlaces,
+		BalanceRoundMode:     balanceRoundMode,
+		ValidateAccountType:  validateAccountType,
+		CSVCRLF:              csvCRLF,
+		BalanceSource:        balanceSource,
+		GraphQLURL:           graphQLURL,
+		GraphQLQuery:         graphQLQuery,
+		GraphQLBalanceField:  graphQLBalanceField,
+		PinSlot:              pinSlot,
+		FetchMode:            fetchMode,
+		StartupDelay:         startupDelay,
+		IncludeStatus:        includeStatus,
+		EmailConcurrency:     emailConcurrency,
+		ResumeCycles:         resumeCycles,
+		TopMovers:            topMovers,
+		CSVSort:              csvSort,
+		AppEnv:               appEnv,
+		LogRequestID:         logRequestID,
+		ReportLocation:       reportLocation,
+		RecipientLocations:   recipientLocations,
+		MaxCycleDuration:     maxCycleDuration,
+		IncludeTokenAccount:  includeTokenAccount,
+		DBBatchSize:          dbBatchSize,
+		DBQueueSize:          dbQueueSize,
+		QuietHours:           quietHours,
+		SkipCSV:              skipCSV,
+		RetryLogEvery:        retryLogEvery,
+		TLSCAFile:            tlsCAFile,
+		EnvBanner:            envBanner,
+		RetryPassDelay:       retryPassDelay,
+		JSONDirPath:          jsonDirPath,
+		SummaryJSON:          summaryJSON,
+		SummaryTopN:          summaryTopN,
+		ZeroBalanceRPCCodes:  zeroBalanceRPCCodes,
+		IncludeRaw:           includeRaw,
+		IncludePrevious:      includePrevious,
+		CSVFsync:             csvFsync,
+		MinSolBalance:        minSolBalance,
+		MinSolBalanceAuto:    minSolBalanceAuto,
+		ChecksumManifest:     checksumManifest,
+		MaxResponseBytes:     maxResponseBytes,
+		InitMaxRetries:       initMaxRetries,
+		MetricsBackend:       metricsBackend,
+		MetricsFile:          metricsFile,
+		StatsdAddr:           statsdAddr,
+		AlertCooldown:        alertCooldown,
+		Baseline:             baseline,
+		DNSMaxLookups:        dnsMaxLookups,
+		DNSCacheTTL:          dnsCacheTTL,
+		MailerBackend:        mailerBackend,
+		QueueURL:             queueURL,
+		QueueTopic:           queueTopic,
+		ExpectedTotalToken:   expectedTotalToken,
+		ExpectedTotalTol:     expectedTotalTol,
+		CompressCSV:          compressCSV,
+		CompressJSON:         compressJSON,
+		AlertWalletCooldown:  alertWalletCooldown,
+		Commitment:           commitment,
+		BulkMode:             bulkMode,
+		MaxRcptPerMessage:    maxRcptPerMessage,
+		StaleAfter:           staleAfter,
+		AuditFile:            auditFile,
+		RunBudget:            runBudget,
+		NormalizeAddresses:   normalizeAddresses,
+		PreferUIString:       preferUIString,
+		StrictAddresses:      strictAddresses,
+		RunDirs:              runDirs,
+		AllowDuplicates:      allowDuplicates,
+		VerifyDelivery:       verifyDelivery,
+		DeliveryStatusURL:    os.Getenv("DELIVERY_STATUS_URL"),
+		DeliveryTimeout:      deliveryTimeout,
+		DeliveryFailAction:   deliveryFailAction,
+		Tiers:                tiers,
+		LogLevel:             logLevel,
+		LogMaxSizeMB:         logMaxSizeMB,
+		LogMaxBackups:        logMaxBackups,
+		StreamWebhookURL:     os.Getenv("STREAM_WEBHOOK_URL"),
+		StreamBatchSize:      streamBatchSize,
+		StreamBufferSize:     streamBufferSize,
+		StreamConcurrency:    streamConcurrency,
+		RetentionDays:        retentionDays,
+		RetryOn500:           retryOn500,
+		EmailFormat:          emailFormat,
+		EmailTopN:            emailTopN,
+		IncludeAttempts:      includeAttempts,
+		CompressAttachment:   compressAttachment,
+		EmailSubjectTemplate: emailSubjectTemplate,
+		EmailBodyTemplate:    emailBodyTemplate,
+		DryRun:               dryRun,
+		EmailQR:              emailQR,
+		SlackWebhookURL:      slackWebhookURL,
+		NotifyEmail:          notifyEmail,
+		NotifySlack:          notifySlack,
+		HealthPort:           healthPort,
+		RunOnce:              runOnce,
+		MaxEmailBodyBytes:    maxEmailBodyBytes,
+		DBBusyTimeout:        dbBusyTimeout,
+		AddressSource:        addressSource,
+		AddressQuery:         addressQuery,
+		EmailFooter:          strings.ReplaceAll(os.Getenv("EMAIL_FOOTER"), `\n`, "\n"),
+		TokenLabel:           tokenLabel,
+		CatchUp:              catchUp,
+		SolanaRPCURLs:        solanaRPCURLs,
+		IncludeAccountType:   includeAccountType,
 	}, nil
 }
+
+// templateSetting returns the template in the named variable, with \n as a line break,
+// or else the contents of the file named by the variable with a _FILE suffix
+func templateSetting(name string) (string, error) {
+	if val := os.Getenv(name); val != "" {
+		return strings.ReplaceAll(val, `\n`, "\n"), nil
+	}
+
+	path := strings.TrimSpace(os.Getenv(name + "_FILE"))
+	if path == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+	}
+	return string(content), nil
+}
+
+// parseSMTPServer parses a relay entry of the form [username:password@]host[:port] as the
+// authority of an smtp:// URL, so credentials containing a comma or other reserved
+// characters can be URL-encoded (e.g. p%2Cass). Missing credentials and port fall back
+// to the shared SMTP settings.
+func parseSMTPServer(entry string, defaultPort int, defaultUsername, defaultPassword string) (SMTPServerConfig, error) {
+	server := SMTPServerConfig{
+		Port:     defaultPort,
+		Username: defaultUsername,
+		Password: defaultPassword,
+	}
+
+	u, err := url.Parse("smtp://" + entry)
+	if err != nil {
+		// The parse error quotes the whole entry, so leave it out to keep passwords out of logs
+		return server, fmt.Errorf("invalid SMTP server entry: %v", errors.Unwrap(err))
+	}
+	redacted := strings.TrimPrefix(u.Redacted(), "smtp://")
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return server, fmt.Errorf("invalid SMTP server entry %q: expected [username:password@]host[:port]", redacted)
+	}
+
+	if u.User != nil {
+		password, found := u.User.Password()
+		if !found {
+			return server, fmt.Errorf("invalid SMTP server entry %q: credentials must be username:password", redacted)
+		}
+		server.Username = u.User.Username()
+		server.Password = password
+	}
+
+	if port := u.Port(); port != "" {
+		parsed, err := strconv.Atoi(port)
+		if err != nil || parsed <= 0 {
+			return server, fmt.Errorf("invalid SMTP server entry %q: bad port %q", redacted, port)
+		}
+		server.Port = parsed
+	}
+	server.Host = u.Hostname()
+	if server.Host == "" {
+		return server, fmt.Errorf("invalid SMTP server entry %q: missing host", redacted)
+	}
+
+	return server, nil
+}
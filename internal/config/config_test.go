@@ -0,0 +1,258 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadWith loads the configuration with the given environment variables set for the test
+func loadWith(t *testing.T, env map[string]string) (*Config, error) {
+	t.Helper()
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	return LoadConfig()
+}
+
+func TestOutputDirs(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantCSV  string
+		wantJSON string
+	}{
+		{name: "defaults", wantCSV: "csv", wantJSON: "json"},
+		{name: "separate directories", env: map[string]string{"CSV_DIR": "out/csv", "JSON_DIR": "out/json"}, wantCSV: "out/csv", wantJSON: "out/json"},
+		{name: "empty values keep the defaults", env: map[string]string{"CSV_DIR": "", "JSON_DIR": ""}, wantCSV: "csv", wantJSON: "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadWith(t, tt.env)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if cfg.CSVDirPath != tt.wantCSV || cfg.JSONDirPath != tt.wantJSON {
+				t.Errorf("CSV and JSON directories = %q, %q; want %q, %q", cfg.CSVDirPath, cfg.JSONDirPath, tt.wantCSV, tt.wantJSON)
+			}
+		})
+	}
+}
+
+func TestParseSMTPServer(t *testing.T) {
+	defaults := SMTPServerConfig{Port: 587, Username: "shared", Password: "shared-secret"}
+
+	tests := []struct {
+		entry   string
+		want    SMTPServerConfig
+		wantErr bool
+	}{
+		{entry: "smtp.example.com", want: SMTPServerConfig{Host: "smtp.example.com", Port: 587, Username: "shared", Password: "shared-secret"}},
+		{entry: "smtp.example.com:465", want: SMTPServerConfig{Host: "smtp.example.com", Port: 465, Username: "shared", Password: "shared-secret"}},
+		{entry: "user:pass@smtp.example.com:2525", want: SMTPServerConfig{Host: "smtp.example.com", Port: 2525, Username: "user", Password: "pass"}},
+		{entry: "user%40corp:p%2Cass%3Aword@smtp.example.com", want: SMTPServerConfig{Host: "smtp.example.com", Port: 587, Username: "user@corp", Password: "p,ass:word"}},
+		{entry: "user:p@ss@smtp.example.com", want: SMTPServerConfig{Host: "smtp.example.com", Port: 587, Username: "user", Password: "p@ss"}},
+		{entry: "[::1]:2525", want: SMTPServerConfig{Host: "::1", Port: 2525, Username: "shared", Password: "shared-secret"}},
+		{entry: "user@smtp.example.com", wantErr: true},
+		{entry: "user:s3cret@smtp.example.com:abc", wantErr: true},
+		{entry: "smtp.example.com:0", wantErr: true},
+		{entry: "user:s3cret@", wantErr: true},
+		{entry: "user:s3cret@smtp.example.com/path", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSMTPServer(tt.entry, defaults.Port, defaults.Username, defaults.Password)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSMTPServer(%q) error = %v, want error %v", tt.entry, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			if strings.Contains(err.Error(), "s3cret") {
+				t.Errorf("parseSMTPServer(%q) error shows the password: %v", tt.entry, err)
+			}
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSMTPServer(%q) = %+v, want %+v", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestSMTPServersAndMailRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantServers []string
+		wantRetries int
+	}{
+		{
+			name:        "encoded comma does not split an entry",
+			env:         map[string]string{"SMTP_SERVERS": "a:p%2Cw@relay1.example.com, relay2.example.com:465", "MAX_RETRIES": "4"},
+			wantServers: []string{"relay1.example.com", "relay2.example.com"},
+			wantRetries: 4,
+		},
+		{
+			name:        "mailer retries override the shared retries",
+			env:         map[string]string{"SMTP_SERVER": "smtp.example.com", "MAX_RETRIES": "4", "MAIL_MAX_RETRIES": "0"},
+			wantServers: []string{"smtp.example.com"},
+			wantRetries: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadWith(t, tt.env)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			var hosts []string
+			for _, server := range cfg.SMTPServers {
+				hosts = append(hosts, server.Host)
+			}
+			if strings.Join(hosts, ",") != strings.Join(tt.wantServers, ",") {
+				t.Errorf("SMTP servers = %v, want %v", hosts, tt.wantServers)
+			}
+			if cfg.MailMaxRetries != tt.wantRetries {
+				t.Errorf("MailMaxRetries = %d, want %d", cfg.MailMaxRetries, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestTokenLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{name: "default", env: map[string]string{}, want: "JINGLE"},
+		{name: "configured", env: map[string]string{"TOKEN_LABEL": " USDC "}, want: "USDC"},
+		{name: "explicitly empty", env: map[string]string{"TOKEN_LABEL": ""}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadWith(t, tt.env)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if cfg.TokenLabel != tt.want {
+				t.Errorf("TokenLabel = %q, want %q", cfg.TokenLabel, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitment(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", env: map[string]string{}, want: "confirmed"},
+		{name: "finalized", env: map[string]string{"RPC_COMMITMENT": "finalized"}, want: "finalized"},
+		{name: "case and spaces", env: map[string]string{"RPC_COMMITMENT": " Processed "}, want: "processed"},
+		{name: "unknown", env: map[string]string{"RPC_COMMITMENT": "max"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadWith(t, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Commitment != tt.want {
+				t.Errorf("Commitment = %q, want %q", cfg.Commitment, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{name: "default", env: map[string]string{}, want: false},
+		{name: "enabled", env: map[string]string{"CATCH_UP": "true"}, want: true},
+		{name: "invalid keeps default", env: map[string]string{"CATCH_UP": "sometimes"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadWith(t, tt.env)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if cfg.CatchUp != tt.want {
+				t.Errorf("CatchUp = %v, want %v", cfg.CatchUp, tt.want)
+			}
+		})
+	}
+}
+
+func TestSolanaRPCURLs(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantPrimary string
+		wantURLs    []string
+	}{
+		{name: "single URL", env: map[string]string{"SOLANA_RPC_URL": "https://a"}, wantPrimary: "https://a", wantURLs: []string{"https://a"}},
+		{name: "failover list", env: map[string]string{"SOLANA_RPC_URLS": " https://paid , ,https://public "}, wantPrimary: "https://paid", wantURLs: []string{"https://paid", "https://public"}},
+		{name: "list overrides single", env: map[string]string{"SOLANA_RPC_URL": "https://a", "SOLANA_RPC_URLS": "https://b,https://c"}, wantPrimary: "https://b", wantURLs: []string{"https://b", "https://c"}},
+		{name: "empty list", env: map[string]string{"SOLANA_RPC_URL": "https://a", "SOLANA_RPC_URLS": ""}, wantPrimary: "https://a", wantURLs: []string{"https://a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadWith(t, tt.env)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if cfg.SolanaRPCURL != tt.wantPrimary || strings.Join(cfg.SolanaRPCURLs, ",") != strings.Join(tt.wantURLs, ",") {
+				t.Errorf("RPC URLs = %q %q, want %q %q", cfg.SolanaRPCURL, cfg.SolanaRPCURLs, tt.wantPrimary, tt.wantURLs)
+			}
+		})
+	}
+}
+
+func TestEmailTemplates(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "body.tmpl")
+	if err := os.WriteFile(file, []byte("{{.SuccessCount}} fetched\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantSubject string
+		wantBody    string
+		wantErr     bool
+	}{
+		{name: "unset keeps the defaults"},
+		{name: "inline with escaped newlines", env: map[string]string{"EMAIL_BODY_TEMPLATE": `Total: {{.TotalAddresses}}\nFailed: {{.FailedCount}}`}, wantBody: "Total: {{.TotalAddresses}}\nFailed: {{.FailedCount}}"},
+		{name: "from a file", env: map[string]string{"EMAIL_SUBJECT_TEMPLATE": "{{.Date}}", "EMAIL_BODY_TEMPLATE_FILE": file}, wantSubject: "{{.Date}}", wantBody: "{{.SuccessCount}} fetched\n"},
+		{name: "inline wins over the file", env: map[string]string{"EMAIL_BODY_TEMPLATE": "inline", "EMAIL_BODY_TEMPLATE_FILE": file}, wantBody: "inline"},
+		{name: "missing file", env: map[string]string{"EMAIL_SUBJECT_TEMPLATE_FILE": filepath.Join(t.TempDir(), "missing.tmpl")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadWith(t, tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if cfg.EmailSubjectTemplate != tt.wantSubject || cfg.EmailBodyTemplate != tt.wantBody {
+				t.Errorf("templates = %q, %q; want %q, %q", cfg.EmailSubjectTemplate, cfg.EmailBodyTemplate, tt.wantSubject, tt.wantBody)
+			}
+		})
+	}
+}
@@ -1,36 +1,123 @@
 package csvwriter
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/report"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
 	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
 )
 
 // CSVWriter handles writing token balances to CSV files
 type CSVWriter struct {
-	csvDir string
-	logger *logger.Logger
+	csvDir  string
+	rounder rounding.Rounder
+	logger  *logger.Logger
+
+	// UseCRLF writes \r\n line endings for Windows-based importers
+	UseCRLF bool
+
+	// IncludeSolColumn adds a sol_balance column and names the token column token_balance
+	// to tell the two apart. SOL is left empty for wallets whose SOL was not fetched.
+	IncludeSolColumn bool
+
+	// IncludeStatus adds a status column (ok, no_account or error) from the token query
+	IncludeStatus bool
+
+	// IncludeTokenAccount adds a token_account column; wallets with several
+	// token accounts for the mint list them separated by semicolons
+	IncludeTokenAccount bool
+
+	// IncludeRaw adds exact integer sol_lamports and token_raw_amount columns for reconciliation
+	IncludeRaw bool
+
+	// Fsync flushes the CSV file to stable storage before WriteBalancesWithFilename returns
+	Fsync bool
+
+	// Compress gzips the CSV file and adds a .gz suffix to its name
+	Compress bool
+
+	// IncludePrevious adds a prev_balance column from the balances passed to SetPrevious
+	IncludePrevious bool
+
+	// FallbackDir is used when csvDir is not writable at write time
+	FallbackDir string
+
+	// SortBy orders the rows: "balance" (largest first, failed fetches last),
+	// "address", or empty to keep the fetch order
+	SortBy string
+
+	// IncludeChange adds a token_change column with the signed change since the balances
+	// passed to SetPrevious
+	IncludeChange bool
+
+	// IncludeAttempts adds an attempts column with the requests each token fetch took
+	IncludeAttempts bool
+
+	// IncludeAccountType adds an account_type column (wallet, vote or stake) and a stake
+	// column with the stake in SOL of vote and stake accounts
+	IncludeAccountType bool
+
+	// previous holds each wallet's balance from the previous run
+	previous map[string]float64
+
+	// subdir, when set, is created under the CSV directory and receives the files
+	subdir string
+
+	// create opens a CSV file for writing; tests replace it to observe syncs
+	create func(path string) (syncer, error)
+}
+
+// syncer is an open CSV file: written, optionally synced to stable storage, then closed
+type syncer interface {
+	io.WriteCloser
+	Sync() error
+}
+
+// createFile creates a CSV file on disk
+func createFile(path string) (syncer, error) {
+	return os.Create(path)
 }
 
-// New creates a new CSVWriter
-func New(csvDir string, logger *logger.Logger) (*CSVWriter, error) {
+// New creates a new CSVWriter. An empty csvDir creates a writer that can only Render.
+func New(csvDir string, rounder rounding.Rounder, logger *logger.Logger) (*CSVWriter, error) {
 	// Ensure CSV directory exists
-	if err := os.MkdirAll(csvDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create CSV directory: %w", err)
+	if csvDir != "" {
+		if err := os.MkdirAll(csvDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create CSV directory: %w", err)
+		}
 	}
 
 	return &CSVWriter{
-		csvDir: csvDir,
-		logger: logger,
+		csvDir:  csvDir,
+		rounder: rounder,
+		logger:  logger,
+		create:  createFile,
 	}, nil
 }
 
+// SetPrevious sets the previous run's balances by wallet for the prev_balance and
+// token_change columns. Wallets without an entry get empty cells.
+func (w *CSVWriter) SetPrevious(previous map[string]float64) {
+	w.previous = previous
+}
+
+// SetSubdir writes the following files into a subdirectory of the CSV directory, such
+// as a per-run directory; empty writes to the CSV directory itself
+func (w *CSVWriter) SetSubdir(subdir string) {
+	w.subdir = subdir
+}
+
 // WriteBalances writes token balances to a CSV file with an auto-generated filename
 func (w *CSVWriter) WriteBalances(balances []*solana.TokenBalance) (string, error) {
 	// Create filename based on current time with seconds precision
@@ -40,30 +127,190 @@ func (w *CSVWriter) WriteBalances(balances []*solana.TokenBalance) (string, erro
 	return w.WriteBalancesWithFilename(balances, filename)
 }
 
+// writableDir returns the CSV directory, or the fallback directory if the primary
+// one cannot be written to (e.g. a volume lost write permission mid-run)
+func (w *CSVWriter) writableDir() (string, error) {
+	err := probeWritable(w.csvDir)
+	if err == nil {
+		return w.csvDir, nil
+	}
+	if w.FallbackDir == "" {
+		return "", fmt.Errorf("CSV directory %s is not writable: %w", w.csvDir, err)
+	}
+
+	w.logger.LogError(fmt.Sprintf("CSV directory %s is not writable, falling back to %s", w.csvDir, w.FallbackDir), err)
+
+	if err := os.MkdirAll(w.FallbackDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create CSV fallback directory: %w", err)
+	}
+	if err := probeWritable(w.FallbackDir); err != nil {
+		return "", fmt.Errorf("CSV fallback directory %s is not writable: %w", w.FallbackDir, err)
+	}
+	return w.FallbackDir, nil
+}
+
+// probeWritable checks that a file can be created in dir
+func probeWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	probe, err := os.CreateTemp(dir, ".write_probe_*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
 // WriteBalancesWithFilename writes token balances to a CSV file with the specified filename
-func (w *CSVWriter) WriteBalancesWithFilename(balances []*solana.TokenBalance, filename string) (string, error) {
+func (w *CSVWriter) WriteBalancesWithFilename(balances []*solana.TokenBalance, filename string) (_ string, err error) {
 	if len(balances) == 0 {
 		return "", fmt.Errorf("no balances to write")
 	}
 
-	filepath := filepath.Join(w.csvDir, filename)
+	dir, err := w.writableDir()
+	if err != nil {
+		return "", err
+	}
+	if w.Compress {
+		filename += ".gz"
+	}
+	if w.subdir != "" {
+		dir = filepath.Join(dir, w.subdir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create CSV run directory: %w", err)
+		}
+	}
+	filepath := filepath.Join(dir, filename)
 
 	w.logger.Log(fmt.Sprintf("Writing %d balances to %s", len(balances), filepath))
 
 	// Create the CSV file
-	file, err := os.Create(filepath)
+	file, err := w.create(filepath)
 	if err != nil {
 		return "", fmt.Errorf("failed to create CSV file: %w", err)
 	}
-	defer file.Close()
+	// A failed close can lose buffered data, so it fails the write
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close CSV file: %w", closeErr)
+		}
+	}()
+
+	var out io.Writer = file
+	var gz *gzip.Writer
+	if w.Compress {
+		gz = gzip.NewWriter(file)
+		out = gz
+	}
+
+	successCount, failedCount, err := w.encode(out, balances)
+	if err != nil {
+		return "", err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return "", fmt.Errorf("failed to compress CSV file: %w", err)
+		}
+	}
 
+	// Make sure the report survives a crash right after the write
+	if w.Fsync {
+		if err := file.Sync(); err != nil {
+			return "", fmt.Errorf("failed to sync CSV file: %w", err)
+		}
+	}
+
+	w.logger.Log(fmt.Sprintf("Successfully wrote %d balances to %s (Success: %d, Failed: %d)",
+		len(balances), filepath, successCount, failedCount))
+	return filepath, nil
+}
+
+// Render encodes token balances as CSV in memory, for deployments that keep no files on disk
+func (w *CSVWriter) Render(balances []*solana.TokenBalance) ([]byte, error) {
+	if len(balances) == 0 {
+		return nil, fmt.Errorf("no balances to write")
+	}
+
+	var buf bytes.Buffer
+	if _, _, err := w.encode(&buf, balances); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderTiers encodes balance tiers as CSV in memory, one tier,wallet_address,balance
+// row per wallet; failed fetches show N/A as the balance
+func (w *CSVWriter) RenderTiers(tiers []report.Tier) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.UseCRLF = w.UseCRLF
+
+	if err := writer.Write([]string{"tier", "wallet_address", "balance"}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	for _, tier := range tiers {
+		for _, balance := range tier.Wallets {
+			balanceStr := "N/A"
+			if balance.FetchError == nil {
+				balanceStr = w.rounder.FormatExact(balance.Balance, balance.TokenUIAmount)
+			}
+			if err := writer.Write([]string{tier.Label, balance.WalletAddress, balanceStr}); err != nil {
+				return nil, fmt.Errorf("failed to write CSV row: %w", err)
+			}
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encode writes the header and one row per balance, returning the success and failure counts
+func (w *CSVWriter) encode(out io.Writer, balances []*solana.TokenBalance) (int, int, error) {
 	// Create CSV writer
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	writer := csv.NewWriter(out)
+	writer.UseCRLF = w.UseCRLF
 
 	// Write header - removed timestamp column as requested
-	if err := writer.Write([]string{"wallet_address", "balance"}); err != nil {
-		return "", fmt.Errorf("failed to write CSV header: %w", err)
+	header := []string{"wallet_address", "balance"}
+	if w.IncludeSolColumn {
+		header = []string{"wallet_address", "token_balance", "sol_balance"}
+	}
+	if w.IncludeStatus {
+		header = append(header, "status")
+	}
+	if w.IncludeTokenAccount {
+		header = append(header, "token_account")
+	}
+	if w.IncludeRaw {
+		header = append(header, "sol_lamports", "token_raw_amount")
+	}
+	if w.IncludePrevious {
+		header = append(header, "prev_balance")
+	}
+	if w.IncludeChange {
+		header = append(header, "token_change")
+	}
+	if w.IncludeAttempts {
+		header = append(header, "attempts")
+	}
+	if w.IncludeAccountType {
+		header = append(header, "account_type", "stake")
+	}
+	if err := writer.Write(header); err != nil {
+		return 0, 0, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	// Order rows numerically rather than by their formatted strings
+	switch w.SortBy {
+	case "balance":
+		balances = report.SortByBalance(balances)
+	case "address":
+		balances = report.SortByAddress(balances)
 	}
 
 	// Count of successful and failed entries
@@ -76,7 +323,7 @@ func (w *CSVWriter) WriteBalancesWithFilename(balances []*solana.TokenBalance, f
 
 		// Only use numeric value if fetch was successful
 		if balance.FetchError == nil {
-			balanceStr = strconv.FormatFloat(balance.Balance, 'f', -1, 64)
+			balanceStr = w.rounder.FormatExact(balance.Balance, balance.TokenUIAmount)
 			successCount++
 		} else {
 			failedCount++
@@ -88,12 +335,72 @@ func (w *CSVWriter) WriteBalancesWithFilename(balances []*solana.TokenBalance, f
 			balanceStr,
 		}
 
+		if w.IncludeSolColumn {
+			solStr := ""
+			if balance.SolanaError != nil {
+				solStr = "N/A"
+			} else if balance.SolanaFetched {
+				solStr = w.rounder.Format(balance.SolanaBalance)
+			}
+			row = append(row, solStr)
+		}
+
+		if w.IncludeStatus {
+			row = append(row, string(balance.Status))
+		}
+
+		if w.IncludeTokenAccount {
+			row = append(row, strings.Join(balance.TokenAccounts, ";"))
+		}
+
+		if w.IncludeRaw {
+			lamports := ""
+			if balance.SolanaFetched && balance.SolanaError == nil {
+				lamports = strconv.FormatUint(balance.SolanaLamports, 10)
+			}
+			rawAmount := balance.TokenRawAmount
+			if balance.FetchError != nil {
+				rawAmount = "N/A"
+			}
+			row = append(row, lamports, rawAmount)
+		}
+
+		if w.IncludePrevious {
+			prevStr := ""
+			if prev, ok := w.previous[balance.WalletAddress]; ok {
+				prevStr = w.rounder.Format(prev)
+			}
+			row = append(row, prevStr)
+		}
+
+		if w.IncludeChange {
+			changeStr := ""
+			if prev, ok := w.previous[balance.WalletAddress]; ok && balance.FetchError == nil {
+				changeStr = w.rounder.Format(balance.Balance - prev)
+			}
+			row = append(row, changeStr)
+		}
+
+		if w.IncludeAttempts {
+			row = append(row, strconv.Itoa(balance.Attempts))
+		}
+
+		if w.IncludeAccountType {
+			stakeStr := ""
+			if balance.AccountType != solana.AccountWallet && balance.FetchError == nil {
+				stakeStr = w.rounder.Format(balance.Stake)
+			}
+			row = append(row, balance.AccountType.String(), stakeStr)
+		}
+
 		if err := writer.Write(row); err != nil {
-			return "", fmt.Errorf("failed to write CSV row: %w", err)
+			return 0, 0, fmt.Errorf("failed to write CSV row: %w", err)
 		}
 	}
 
-	w.logger.Log(fmt.Sprintf("Successfully wrote %d balances to %s (Success: %d, Failed: %d)",
-		len(balances), filepath, successCount, failedCount))
-	return filepath, nil
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return successCount, failedCount, nil
 }
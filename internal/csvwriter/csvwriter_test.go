@@ -0,0 +1,473 @@
+package csvwriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/database"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// testWriter returns a writer with two decimal places writing into a temporary directory
+func testWriter(t *testing.T) *CSVWriter {
+	t.Helper()
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	w, err := New(t.TempDir(), rounding.Rounder{Places: 2, Mode: rounding.HalfUp}, log)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return w
+}
+
+func TestNewlineStyle(t *testing.T) {
+	balances := []*solana.TokenBalance{{WalletAddress: "wallet1", Balance: 1.5}}
+
+	tests := []struct {
+		name    string
+		useCRLF bool
+		want    string
+	}{
+		{name: "LF", want: "wallet_address,balance\nwallet1,1.50\n"},
+		{name: "CRLF", useCRLF: true, want: "wallet_address,balance\r\nwallet1,1.50\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWriter(t)
+			w.UseCRLF = tt.useCRLF
+			got, err := w.Render(balances)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	// As strings these would order 9.5 above 100 and 10
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "c", Balance: 9.5},
+		{WalletAddress: "failed", FetchError: errors.New("rpc timeout")},
+		{WalletAddress: "a", Balance: 100},
+		{WalletAddress: "d", Balance: 10},
+		{WalletAddress: "b", Balance: 10},
+	}
+
+	tests := []struct {
+		sortBy string
+		want   []string
+	}{
+		{sortBy: "", want: []string{"c", "failed", "a", "d", "b"}},
+		{sortBy: "balance", want: []string{"a", "b", "d", "c", "failed"}},
+		{sortBy: "address", want: []string{"a", "b", "c", "d", "failed"}},
+	}
+
+	for _, tt := range tests {
+		w := testWriter(t)
+		w.SortBy = tt.sortBy
+		got, err := w.Render(balances)
+		if err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+
+		var wallets []string
+		for _, row := range strings.Split(strings.TrimSpace(string(got)), "\n")[1:] {
+			wallets = append(wallets, strings.SplitN(row, ",", 2)[0])
+		}
+		if strings.Join(wallets, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("SortBy %q orders %v, want %v", tt.sortBy, wallets, tt.want)
+		}
+	}
+}
+
+func TestFallbackDir(t *testing.T) {
+	balances := []*solana.TokenBalance{{WalletAddress: "wallet1", Balance: 1.5}}
+
+	tests := []struct {
+		name     string
+		fallback bool
+		wantErr  bool
+	}{
+		{name: "falls back to the fallback directory", fallback: true},
+		{name: "fails without a fallback directory", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWriter(t)
+			fallbackDir := filepath.Join(t.TempDir(), "fallback")
+			if tt.fallback {
+				w.FallbackDir = fallbackDir
+			}
+
+			// The volume goes away mid-run: the directory is replaced by a file.
+			// Permissions would not do, as tests may run as root.
+			if err := os.RemoveAll(w.csvDir); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(w.csvDir, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			path, err := w.WriteBalancesWithFilename(balances, "balance_2026-03-01_14_00_00.csv")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteBalancesWithFilename error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if filepath.Dir(path) != fallbackDir {
+				t.Errorf("wrote %s, want a file in %s", path, fallbackDir)
+			}
+			if content, err := os.ReadFile(path); err != nil || string(content) != "wallet_address,balance\nwallet1,1.50\n" {
+				t.Errorf("fallback file = %q, %v", content, err)
+			}
+		})
+	}
+}
+
+func TestTokenAccountColumn(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "single", Balance: 1, TokenAccounts: []string{"Ata1"}},
+		{WalletAddress: "several", Balance: 2.5, TokenAccounts: []string{"Ata2", "Ata3"}},
+		{WalletAddress: "empty"},
+	}
+
+	w := testWriter(t)
+	w.IncludeTokenAccount = true
+	got, err := w.Render(balances)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "wallet_address,balance,token_account\nsingle,1.00,Ata1\nseveral,2.50,Ata2;Ata3\nempty,0.00,\n"
+	if string(got) != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
+
+func TestAccountTypeColumn(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "wallet", Balance: 2},
+		{WalletAddress: "vote", AccountType: solana.AccountVote, Stake: 1234.5},
+		{WalletAddress: "stake", AccountType: solana.AccountStake, FetchError: errors.New("rpc timeout")},
+	}
+
+	tests := []struct {
+		name               string
+		includeAccountType bool
+		want               string
+	}{
+		{
+			name: "off by default",
+			want: "wallet_address,balance\nwallet,2.00\nvote,0.00\nstake,N/A\n",
+		},
+		{
+			name:               "opted in",
+			includeAccountType: true,
+			want: "wallet_address,balance,account_type,stake\n" +
+				"wallet,2.00,wallet,\n" +
+				"vote,0.00,vote,1234.50\n" +
+				"stake,N/A,stake,\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWriter(t)
+			w.IncludeAccountType = tt.includeAccountType
+			got, err := w.Render(balances)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Render = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSolColumn(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "both", Balance: 10, SolanaBalance: 0.5, SolanaFetched: true},
+		{WalletAddress: "token-failed", FetchError: errors.New("rpc timeout"), SolanaBalance: 0.25, SolanaFetched: true},
+		{WalletAddress: "sol-failed", Balance: 7, SolanaError: errors.New("rpc timeout"), SolanaFetched: true},
+	}
+
+	tests := []struct {
+		name             string
+		includeSolColumn bool
+		want             string
+	}{
+		{
+			name: "token only",
+			want: "wallet_address,balance\n" +
+				"both,10.00\n" +
+				"token-failed,N/A\n" +
+				"sol-failed,7.00\n",
+		},
+		{
+			name:             "with SOL column",
+			includeSolColumn: true,
+			want: "wallet_address,token_balance,sol_balance\n" +
+				"both,10.00,0.50\n" +
+				"token-failed,N/A,0.25\n" +
+				"sol-failed,7.00,N/A\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWriter(t)
+			w.IncludeSolColumn = tt.includeSolColumn
+			path, err := w.WriteBalancesWithFilename(balances, "balances.csv")
+			if err != nil {
+				t.Fatalf("WriteBalancesWithFilename: %v", err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("CSV = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompress(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 10},
+		{WalletAddress: "b", FetchError: errors.New("rpc timeout")},
+	}
+
+	tests := []struct {
+		name     string
+		compress bool
+		wantName string
+	}{
+		{name: "plain", wantName: "balances.csv"},
+		{name: "gzip", compress: true, wantName: "balances.csv.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWriter(t)
+			w.Compress = tt.compress
+			path, err := w.WriteBalancesWithFilename(balances, "balances.csv")
+			if err != nil {
+				t.Fatalf("WriteBalancesWithFilename: %v", err)
+			}
+			if filepath.Base(path) != tt.wantName {
+				t.Errorf("wrote %s, want %s", filepath.Base(path), tt.wantName)
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			var content io.Reader = file
+			if tt.compress {
+				gz, err := gzip.NewReader(file)
+				if err != nil {
+					t.Fatalf("gzip.NewReader: %v", err)
+				}
+				content = gz
+			}
+			got, err := io.ReadAll(content)
+			if err != nil {
+				t.Fatalf("reading %s: %v", path, err)
+			}
+
+			// The file decompresses to exactly what is attached to the email
+			want, err := w.Render(balances)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("file content = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRawColumns(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 123456789012.345678901, TokenRawAmount: "123456789012345678901",
+			SolanaBalance: 9007199.254740993, SolanaLamports: 9007199254740993, SolanaFetched: true},
+		{WalletAddress: "b", TokenRawAmount: "0", SolanaError: errors.New("rpc timeout"), SolanaFetched: true},
+		{WalletAddress: "c", FetchError: errors.New("rpc timeout")},
+	}
+
+	w := testWriter(t)
+	w.IncludeSolColumn = true
+	w.IncludeRaw = true
+	got, err := w.Render(balances)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "wallet_address,token_balance,sol_balance,sol_lamports,token_raw_amount\n" +
+		"a,123456789012.35,9007199.25,9007199254740993,123456789012345678901\n" +
+		"b,0.00,N/A,,0\n" +
+		"c,N/A,,,N/A\n"
+	if string(got) != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
+
+func TestPreviousBalanceColumn(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "reporter.db"), time.Second)
+	if err != nil {
+		t.Fatalf("database.Open: %v", err)
+	}
+	defer db.Close()
+
+	// Seed a prior run; its failed wallet has no previous balance to show
+	prior := time.Date(2026, 3, 1, 13, 0, 0, 0, time.UTC)
+	if err := db.InsertBalances(prior, []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 10},
+		{WalletAddress: "b", FetchError: errors.New("rpc timeout")},
+	}); err != nil {
+		t.Fatalf("InsertBalances: %v", err)
+	}
+
+	latest, err := db.LatestBalances(prior.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("LatestBalances: %v", err)
+	}
+	previous := make(map[string]float64, len(latest))
+	for wallet, record := range latest {
+		previous[wallet] = record.TokenBalance
+	}
+
+	w := testWriter(t)
+	w.IncludePrevious = true
+	w.SetPrevious(previous)
+	got, err := w.Render([]*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 12.5},
+		{WalletAddress: "b", Balance: 1},
+		{WalletAddress: "new", Balance: 3},
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "wallet_address,balance,prev_balance\na,12.50,10.00\nb,1.00,\nnew,3.00,\n"
+	if string(got) != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
+
+func TestChangeColumn(t *testing.T) {
+	w := testWriter(t)
+	w.IncludeChange = true
+	w.SetPrevious(map[string]float64{"up": 10, "down": 10, "same": 10, "failed": 10})
+
+	// New wallets and failed fetches have no change to show
+	got, err := w.Render([]*solana.TokenBalance{
+		{WalletAddress: "up", Balance: 12.5},
+		{WalletAddress: "down", Balance: 4},
+		{WalletAddress: "same", Balance: 10},
+		{WalletAddress: "failed", FetchError: errors.New("rpc timeout")},
+		{WalletAddress: "new", Balance: 3},
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "wallet_address,balance,token_change\nup,12.50,2.50\ndown,4.00,-6.00\nsame,10.00,0.00\nfailed,N/A,\nnew,3.00,\n"
+	if string(got) != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
+
+func TestAttemptsColumn(t *testing.T) {
+	w := testWriter(t)
+	w.IncludeAttempts = true
+	got, err := w.Render([]*solana.TokenBalance{
+		{WalletAddress: "steady", Balance: 1, Attempts: 1},
+		{WalletAddress: "flaky", Balance: 2, Attempts: 2},
+		{WalletAddress: "failed", FetchError: errors.New("rpc timeout"), Attempts: 4},
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	want := "wallet_address,balance,attempts\nsteady,1.00,1\nflaky,2.00,2\nfailed,N/A,4\n"
+	if string(got) != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
+
+// fakeFile records what WriteBalancesWithFilename does with the file it creates
+type fakeFile struct {
+	bytes.Buffer
+	synced, closed bool
+	closeErr       error
+}
+
+func (f *fakeFile) Sync() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.synced = true
+	return nil
+}
+
+func (f *fakeFile) Close() error {
+	f.closed = true
+	return f.closeErr
+}
+
+func TestFsync(t *testing.T) {
+	tests := []struct {
+		name       string
+		fsync      bool
+		closeErr   error
+		wantSynced bool
+		wantErr    bool
+	}{
+		{name: "CSV_FSYNC set", fsync: true, wantSynced: true},
+		{name: "CSV_FSYNC unset", fsync: false},
+		{name: "close fails", fsync: true, closeErr: errors.New("disk quota exceeded"), wantSynced: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &fakeFile{closeErr: tt.closeErr}
+			w := testWriter(t)
+			w.Fsync = tt.fsync
+			w.create = func(path string) (syncer, error) {
+				return file, nil
+			}
+
+			_, err := w.WriteBalancesWithFilename([]*solana.TokenBalance{{WalletAddress: "a", Balance: 1}}, "balance.csv")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteBalancesWithFilename error = %v, want error %v", err, tt.wantErr)
+			}
+			if file.synced != tt.wantSynced {
+				t.Errorf("synced = %v, want %v", file.synced, tt.wantSynced)
+			}
+			if !file.closed {
+				t.Error("file was not closed")
+			}
+			if file.String() != "wallet_address,balance\na,1.00\n" {
+				t.Errorf("wrote %q", file.String())
+			}
+		})
+	}
+}
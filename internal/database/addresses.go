@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddressTable reads the address roster from the database with a query. The query
+// returns the address in its first column and, optionally, the wallet's annotations
+// (such as "skip_sol expect>=1000") in a second one, in the order to report them.
+type AddressTable struct {
+	db    *DB
+	query string
+}
+
+// AddressTable returns the roster read by query, on the database's own connection
+func (db *DB) AddressTable(query string) *AddressTable {
+	return &AddressTable{db: db, query: query}
+}
+
+// String names the roster in logs
+func (t *AddressTable) String() string {
+	return "database query"
+}
+
+// AddressLines runs the query and renders each row as an addresses file line
+func (t *AddressTable) AddressLines() ([]string, error) {
+	rows, err := t.db.conn.Query(t.query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) < 1 || len(columns) > 2 {
+		return nil, fmt.Errorf("query returns %d columns: expected the address and optional annotations", len(columns))
+	}
+
+	var lines []string
+	for rows.Next() {
+		// NULL annotations read as empty
+		var address string
+		var annotations *string
+		targets := []interface{}{&address}
+		if len(columns) == 2 {
+			targets = append(targets, &annotations)
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+
+		line := address
+		if annotations != nil && strings.TrimSpace(*annotations) != "" {
+			line += " " + *annotations
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
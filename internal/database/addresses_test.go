@@ -0,0 +1,93 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/reader"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+func TestReadAddressesFromTable(t *testing.T) {
+	db, _ := openTemp(t)
+
+	_, err := db.conn.Exec(`
+		CREATE TABLE roster (id INTEGER PRIMARY KEY, address TEXT, annotations TEXT, active INTEGER);
+		INSERT INTO roster (id, address, annotations, active) VALUES
+			(1, 'So11111111111111111111111111111111111111112', NULL, 1),
+			(2, 'Vote111111111111111111111111111111111111111', 'type=vote skip_sol', 1),
+			(3, 'TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA', 'expect>=5', 0),
+			(4, 'not-an-address', '', 1),
+			(5, 'So11111111111111111111111111111111111111112', '', 1);
+		CREATE TABLE addresses (address TEXT);
+		INSERT INTO addresses VALUES ('Stake11111111111111111111111111111111111111');`)
+	if err != nil {
+		t.Fatalf("seeding roster: %v", err)
+	}
+
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	defer log.Close()
+
+	tests := []struct {
+		name        string
+		query       string
+		want        []reader.Entry
+		wantInvalid int
+	}{
+		{
+			name:  "default table",
+			query: "SELECT address FROM addresses",
+			want:  []reader.Entry{{Address: "Stake11111111111111111111111111111111111111"}},
+		},
+		{
+			name:  "query with annotations",
+			query: "SELECT address, annotations FROM roster WHERE active ORDER BY id",
+			want: []reader.Entry{
+				{Address: "So11111111111111111111111111111111111111112"},
+				{Address: "Vote111111111111111111111111111111111111111", AccountType: solana.AccountVote, SkipSol: true},
+			},
+			wantInvalid: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addressReader := reader.New("", log)
+			addressReader.Source = db.AddressTable(tt.query)
+
+			entries, invalid, err := addressReader.ReadEntries()
+			if err != nil {
+				t.Fatalf("ReadEntries: %v", err)
+			}
+			if len(invalid) != tt.wantInvalid {
+				t.Errorf("got %d invalid addresses, want %d", len(invalid), tt.wantInvalid)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("ReadEntries = %+v, want %+v", entries, tt.want)
+			}
+			for i, entry := range entries {
+				want := tt.want[i]
+				if entry.Address != want.Address || entry.AccountType != want.AccountType ||
+					entry.SkipSol != want.SkipSol || entry.Source != "database query" {
+					t.Errorf("entry %d = %+v, want %+v from the database query", i, entry, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddressTableRejectsBadQueries(t *testing.T) {
+	db, _ := openTemp(t)
+
+	for _, query := range []string{
+		"SELECT address FROM missing_table",
+		"SELECT 'a', 'b', 'c'",
+	} {
+		if _, err := db.AddressTable(query).AddressLines(); err == nil {
+			t.Errorf("AddressLines(%q) succeeded, want an error", query)
+		}
+	}
+}
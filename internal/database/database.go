@@ -0,0 +1,594 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+
+	// The pure Go driver registers as "sqlite", so builds need no cgo
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// busyRetries bounds how often a write is retried after SQLite gave up waiting for a
+// lock held by another process, such as capture-baseline running beside the service
+const busyRetries = 3
+
+// busyBackoff is the wait before the first retry of a locked write; it doubles per retry
+var busyBackoff = 500 * time.Millisecond
+
+// timeLayout stores timestamps as fixed-width UTC text, which sorts chronologically
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// schema creates the tables on first open. Balances are written in batches while a run
+// is fetching, so a run's balances are only read back once the run is marked completed;
+// a run cut short by a crash never becomes the previous run.
+const schema = `
+CREATE TABLE IF NOT EXISTS runs (
+	run_timestamp TEXT PRIMARY KEY,
+	completed     INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS balances (
+	run_timestamp  TEXT NOT NULL,
+	wallet_address TEXT NOT NULL,
+	token_balance  REAL NOT NULL,
+	sol_balance    REAL NOT NULL,
+	token_error    TEXT NOT NULL DEFAULT '',
+	sol_error      TEXT NOT NULL DEFAULT '',
+	sol_fetched    INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (run_timestamp, wallet_address)
+);
+CREATE INDEX IF NOT EXISTS balances_wallet ON balances (wallet_address, run_timestamp);
+
+CREATE TABLE IF NOT EXISTS alerts (
+	key     TEXT PRIMARY KEY,
+	sent_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS baselines (
+	name        TEXT PRIMARY KEY,
+	captured_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS baseline_balances (
+	name           TEXT NOT NULL,
+	wallet_address TEXT NOT NULL,
+	token_balance  REAL NOT NULL,
+	PRIMARY KEY (name, wallet_address)
+);
+
+CREATE TABLE IF NOT EXISTS last_run (
+	id            INTEGER PRIMARY KEY CHECK (id = 1),
+	run_timestamp TEXT NOT NULL,
+	csv_path      TEXT NOT NULL,
+	sent_at       TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS deliveries (
+	run_timestamp TEXT NOT NULL,
+	message_id    TEXT NOT NULL,
+	server        TEXT NOT NULL,
+	smtp_code     INTEGER NOT NULL,
+	smtp_response TEXT NOT NULL,
+	verified      INTEGER NOT NULL,
+	error         TEXT NOT NULL,
+	checked_at    TEXT NOT NULL
+);
+`
+
+// BalanceRecord is a wallet's balance as recorded for a run
+type BalanceRecord struct {
+	RunTimestamp  time.Time `json:"run_timestamp"`
+	WalletAddress string    `json:"wallet_address"`
+	TokenBalance  float64   `json:"token_balance"`
+	SolBalance    float64   `json:"sol_balance"`
+	TokenError    string    `json:"token_error,omitempty"`
+	SolError      string    `json:"sol_error,omitempty"`
+	SolFetched    bool      `json:"sol_fetched"`
+}
+
+// Baseline is a named snapshot of token balances that later runs are compared against
+type Baseline struct {
+	Name       string             `json:"name"`
+	CapturedAt time.Time          `json:"captured_at"`
+	Balances   map[string]float64 `json:"balances"`
+}
+
+// LastRun describes the most recent run whose report was sent
+type LastRun struct {
+	RunTimestamp time.Time `json:"run_timestamp"`
+	CSVPath      string    `json:"csv_path"`
+	SentAt       time.Time `json:"sent_at"`
+}
+
+// DeliveryRecord is the outcome of verifying that a report email was delivered
+type DeliveryRecord struct {
+	RunTimestamp time.Time `json:"run_timestamp"`
+	MessageID    string    `json:"message_id"`
+	Server       string    `json:"server"`
+	SMTPCode     int       `json:"smtp_code"`
+	SMTPResponse string    `json:"smtp_response,omitempty"`
+	Verified     bool      `json:"verified"`
+	Error        string    `json:"error,omitempty"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// DB is the SQLite store of run history
+type DB struct {
+	conn *sql.DB
+}
+
+// Open opens or creates the SQLite database file and its tables. Statements wait up to
+// busyTimeout for locks held by other connections before failing as busy.
+func Open(path string, busyTimeout time.Duration) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	// Pragmas in the name apply to every connection the pool opens
+	pragma := fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds())
+	conn, err := sql.Open("sqlite", path+"?_pragma="+url.QueryEscape(pragma))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// A single connection serializes the history writer with the run loop's writes
+	conn.SetMaxOpenConns(1)
+
+	db := &DB{conn: conn}
+	err = db.retryBusy(func() error {
+		_, err := conn.Exec(schema)
+		return err
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to initialize database %s: %w", path, err)
+	}
+
+	return db, nil
+}
+
+// Close closes the database
+func (db *DB) Close() error {
+	return db.conn.Close()
+}
+
+// formatTime converts a timestamp to its stored form
+func formatTime(ts time.Time) string {
+	return ts.UTC().Format(timeLayout)
+}
+
+// parseTime converts a stored timestamp back to a time
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(timeLayout, value)
+}
+
+// isBusy reports whether err is SQLite failing to get a lock on the database
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// Extended result codes keep the primary code in the low byte
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// retryBusy runs op, retrying it with exponential backoff while the database is locked
+func (db *DB) retryBusy(op func() error) error {
+	delay := busyBackoff
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || !isBusy(err) || attempt == busyRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// inTx runs fn in a transaction, committing when it succeeds. The whole transaction is
+// retried when the database is locked.
+func (db *DB) inTx(fn func(tx *sql.Tx) error) error {
+	return db.retryBusy(func() error {
+		return db.runTx(fn)
+	})
+}
+
+// runTx runs fn in a transaction once
+func (db *DB) runTx(fn func(tx *sql.Tx) error) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// newBalanceRecord converts a fetched balance into its stored form
+func newBalanceRecord(ts time.Time, balance *solana.TokenBalance) BalanceRecord {
+	record := BalanceRecord{
+		RunTimestamp:  ts.UTC(),
+		WalletAddress: balance.WalletAddress,
+		TokenBalance:  balance.Balance,
+		SolBalance:    balance.SolanaBalance,
+		SolFetched:    balance.SolanaFetched,
+	}
+	if balance.FetchError != nil {
+		record.TokenError = balance.FetchError.Error()
+	}
+	if balance.SolanaError != nil {
+		record.SolError = balance.SolanaError.Error()
+	}
+	return record
+}
+
+// insertRecords writes a batch of balance records in one transaction, leaving their
+// runs incomplete
+func (db *DB) insertRecords(records []BalanceRecord) error {
+	return db.inTx(func(tx *sql.Tx) error {
+		return writeRecords(tx, records)
+	})
+}
+
+// writeRecords writes balance records and registers their runs. A wallet recorded twice
+// for the same run, as when a resumed cycle replays its checkpoint, keeps the last record.
+func writeRecords(tx *sql.Tx, records []BalanceRecord) error {
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO balances
+		(run_timestamp, wallet_address, token_balance, sol_balance, token_error, sol_error, sol_fetched)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to record balances: %w", err)
+	}
+	defer stmt.Close()
+
+	runs := make(map[string]bool)
+	for _, record := range records {
+		runTimestamp := formatTime(record.RunTimestamp)
+		if !runs[runTimestamp] {
+			runs[runTimestamp] = true
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO runs (run_timestamp) VALUES (?)`, runTimestamp); err != nil {
+				return fmt.Errorf("failed to record run %s: %w", runTimestamp, err)
+			}
+		}
+
+		_, err := stmt.Exec(runTimestamp, record.WalletAddress,
+			record.TokenBalance, record.SolBalance, record.TokenError, record.SolError, record.SolFetched)
+		if err != nil {
+			return fmt.Errorf("failed to record balance of %s: %w", record.WalletAddress, err)
+		}
+	}
+	return nil
+}
+
+// markCompleted marks the run at ts as fully recorded
+func markCompleted(tx *sql.Tx, ts time.Time) error {
+	_, err := tx.Exec(`INSERT INTO runs (run_timestamp, completed) VALUES (?, 1)
+		ON CONFLICT (run_timestamp) DO UPDATE SET completed = 1`, formatTime(ts))
+	if err != nil {
+		return fmt.Errorf("failed to complete run: %w", err)
+	}
+	return nil
+}
+
+// InsertBalances records every balance fetched in a run and marks the run completed,
+// all in a single transaction
+func (db *DB) InsertBalances(ts time.Time, balances []*solana.TokenBalance) error {
+	records := make([]BalanceRecord, 0, len(balances))
+	for _, balance := range balances {
+		records = append(records, newBalanceRecord(ts, balance))
+	}
+	return db.inTx(func(tx *sql.Tx) error {
+		if err := writeRecords(tx, records); err != nil {
+			return err
+		}
+		return markCompleted(tx, ts)
+	})
+}
+
+// completeRun marks the run at ts as fully recorded, once a Writer has written all of
+// its balances
+func (db *DB) completeRun(ts time.Time) error {
+	return db.inTx(func(tx *sql.Tx) error {
+		return markCompleted(tx, ts)
+	})
+}
+
+// queryBalances returns the balance records selected by query, whose columns must be
+// the balances table's in schema order
+func (db *DB) queryBalances(query string, args ...interface{}) ([]BalanceRecord, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balances: %w", err)
+	}
+	defer rows.Close()
+
+	var records []BalanceRecord
+	for rows.Next() {
+		var record BalanceRecord
+		var runTimestamp string
+		err := rows.Scan(&runTimestamp, &record.WalletAddress, &record.TokenBalance,
+			&record.SolBalance, &record.TokenError, &record.SolError, &record.SolFetched)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read balances: %w", err)
+		}
+		if record.RunTimestamp, err = parseTime(runTimestamp); err != nil {
+			return nil, fmt.Errorf("invalid run timestamp %q: %w", runTimestamp, err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read balances: %w", err)
+	}
+	return records, nil
+}
+
+// LatestBalances returns the most recent successful balance per wallet recorded by a
+// completed run before ts
+func (db *DB) LatestBalances(before time.Time) (map[string]BalanceRecord, error) {
+	return db.latestBalances("AND run_timestamp < ?", formatTime(before))
+}
+
+// latestBalances returns the most recent successful balance per wallet among the
+// balances matching the extra condition
+func (db *DB) latestBalances(condition string, args ...interface{}) (map[string]BalanceRecord, error) {
+	// SQLite takes the other columns from the row holding the MAX
+	records, err := db.queryBalances(`SELECT MAX(run_timestamp), wallet_address, token_balance,
+			sol_balance, token_error, sol_error, sol_fetched
+		FROM balances JOIN runs USING (run_timestamp)
+		WHERE completed = 1 AND token_error = '' `+condition+`
+		GROUP BY wallet_address`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]BalanceRecord, len(records))
+	for _, record := range records {
+		latest[record.WalletAddress] = record
+	}
+	return latest, nil
+}
+
+// GetBalanceHistory returns every balance recorded for wallet in completed runs at or
+// after since, failed fetches included, ordered by run timestamp
+func (db *DB) GetBalanceHistory(wallet string, since time.Time) ([]BalanceRecord, error) {
+	return db.queryBalances(`SELECT run_timestamp, wallet_address, token_balance,
+			sol_balance, token_error, sol_error, sol_fetched
+		FROM balances JOIN runs USING (run_timestamp)
+		WHERE completed = 1 AND wallet_address = ? AND run_timestamp >= ?
+		ORDER BY run_timestamp`, wallet, formatTime(since))
+}
+
+// LastAlert returns when the alert with key was last emailed
+func (db *DB) LastAlert(key string) (time.Time, bool) {
+	var sentAt string
+	if err := db.conn.QueryRow(`SELECT sent_at FROM alerts WHERE key = ?`, key).Scan(&sentAt); err != nil {
+		return time.Time{}, false
+	}
+	ts, err := parseTime(sentAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return ts, true
+}
+
+// RecordAlerts notes that the alerts with keys were emailed at ts
+func (db *DB) RecordAlerts(keys []string, ts time.Time) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return db.inTx(func(tx *sql.Tx) error {
+		for _, key := range keys {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO alerts (key, sent_at) VALUES (?, ?)`,
+				key, formatTime(ts)); err != nil {
+				return fmt.Errorf("failed to record alert %s: %w", key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// CaptureBaseline stores the latest successful balance of every wallet as a named
+// baseline, replacing any earlier baseline with the same name
+func (db *DB) CaptureBaseline(name string, ts time.Time) (Baseline, error) {
+	latest, err := db.latestBalances("")
+	if err != nil {
+		return Baseline{}, err
+	}
+
+	baseline := Baseline{
+		Name:       name,
+		CapturedAt: ts.UTC(),
+		Balances:   make(map[string]float64, len(latest)),
+	}
+	for wallet, record := range latest {
+		baseline.Balances[wallet] = record.TokenBalance
+	}
+
+	err = db.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM baseline_balances WHERE name = ?`, name); err != nil {
+			return fmt.Errorf("failed to replace baseline %s: %w", name, err)
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO baselines (name, captured_at) VALUES (?, ?)`,
+			name, formatTime(baseline.CapturedAt)); err != nil {
+			return fmt.Errorf("failed to record baseline %s: %w", name, err)
+		}
+		for wallet, balance := range baseline.Balances {
+			if _, err := tx.Exec(`INSERT INTO baseline_balances (name, wallet_address, token_balance)
+				VALUES (?, ?, ?)`, name, wallet, balance); err != nil {
+				return fmt.Errorf("failed to record baseline %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Baseline{}, err
+	}
+	return baseline, nil
+}
+
+// GetBaseline returns the baseline captured under name
+func (db *DB) GetBaseline(name string) (Baseline, bool) {
+	var capturedAt string
+	if err := db.conn.QueryRow(`SELECT captured_at FROM baselines WHERE name = ?`, name).Scan(&capturedAt); err != nil {
+		return Baseline{}, false
+	}
+	baseline := Baseline{Name: name, Balances: make(map[string]float64)}
+	var err error
+	if baseline.CapturedAt, err = parseTime(capturedAt); err != nil {
+		return Baseline{}, false
+	}
+
+	rows, err := db.conn.Query(`SELECT wallet_address, token_balance FROM baseline_balances WHERE name = ?`, name)
+	if err != nil {
+		return Baseline{}, false
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wallet string
+		var balance float64
+		if err := rows.Scan(&wallet, &balance); err != nil {
+			return Baseline{}, false
+		}
+		baseline.Balances[wallet] = balance
+	}
+	if rows.Err() != nil {
+		return Baseline{}, false
+	}
+	return baseline, true
+}
+
+// UnchangedRuns returns, per wallet, how many consecutive runs up to its latest recorded
+// the same balance as the run before them. Wallets that changed in their latest run are
+// left out.
+func (db *DB) UnchangedRuns() map[string]int {
+	// changes counts the balances differing from the latest one, newest run first, so
+	// the rows before the first change are the ones where it is still zero
+	rows, err := db.conn.Query(`SELECT wallet_address, COUNT(*) - 1 FROM (
+			SELECT wallet_address, SUM(token_balance != latest) OVER (PARTITION BY wallet_address
+				ORDER BY run_timestamp DESC ROWS UNBOUNDED PRECEDING) AS changes
+			FROM (
+				SELECT wallet_address, run_timestamp, token_balance, FIRST_VALUE(token_balance)
+					OVER (PARTITION BY wallet_address ORDER BY run_timestamp DESC) AS latest
+				FROM balances JOIN runs USING (run_timestamp)
+				WHERE completed = 1 AND token_error = ''
+			)
+		)
+		WHERE changes = 0
+		GROUP BY wallet_address
+		HAVING COUNT(*) > 1`)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	unchanged := make(map[string]int)
+	for rows.Next() {
+		var wallet string
+		var runs int
+		if err := rows.Scan(&wallet, &runs); err != nil {
+			return nil
+		}
+		unchanged[wallet] = runs
+	}
+	if rows.Err() != nil {
+		return nil
+	}
+	return unchanged
+}
+
+// UpdateLastRun records a run whose report was sent. csvPath is empty when the
+// CSV was not written to disk.
+func (db *DB) UpdateLastRun(runTimestamp time.Time, csvPath string) error {
+	return db.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO last_run (id, run_timestamp, csv_path, sent_at)
+			VALUES (1, ?, ?, ?)`, formatTime(runTimestamp), csvPath, formatTime(time.Now()))
+		if err != nil {
+			return fmt.Errorf("failed to record last run: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetLastRun returns the most recent run whose report was sent, or nil before the first one
+func (db *DB) GetLastRun() *LastRun {
+	var runTimestamp, sentAt string
+	var lastRun LastRun
+	err := db.conn.QueryRow(`SELECT run_timestamp, csv_path, sent_at FROM last_run WHERE id = 1`).
+		Scan(&runTimestamp, &lastRun.CSVPath, &sentAt)
+	if err != nil {
+		return nil
+	}
+	if lastRun.RunTimestamp, err = parseTime(runTimestamp); err != nil {
+		return nil
+	}
+	if lastRun.SentAt, err = parseTime(sentAt); err != nil {
+		return nil
+	}
+	return &lastRun
+}
+
+// RecordDelivery stores the outcome of a delivery verification
+func (db *DB) RecordDelivery(record DeliveryRecord) error {
+	return db.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO deliveries
+			(run_timestamp, message_id, server, smtp_code, smtp_response, verified, error, checked_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			formatTime(record.RunTimestamp), record.MessageID, record.Server, record.SMTPCode,
+			record.SMTPResponse, record.Verified, record.Error, formatTime(record.CheckedAt))
+		if err != nil {
+			return fmt.Errorf("failed to record delivery: %w", err)
+		}
+		return nil
+	})
+}
+
+// Delta is a wallet's change since its previous recorded balance. The previous values
+// are nil for wallets seen for the first time, and PreviousSol also when either run
+// has no SOL balance for the wallet.
+type Delta struct {
+	WalletAddress string
+	PreviousToken *float64
+	PreviousSol   *float64
+	TokenChange   float64
+	SolChange     float64
+}
+
+// ComputeDeltas compares the current balances with the previous run's, as returned by
+// LatestBalances. Wallets whose current fetch failed are left out.
+func ComputeDeltas(previous map[string]BalanceRecord, current []*solana.TokenBalance) map[string]Delta {
+	deltas := make(map[string]Delta, len(current))
+	for _, balance := range current {
+		if balance.FetchError != nil {
+			continue
+		}
+
+		delta := Delta{WalletAddress: balance.WalletAddress}
+		if record, ok := previous[balance.WalletAddress]; ok {
+			prevToken := record.TokenBalance
+			delta.PreviousToken = &prevToken
+			delta.TokenChange = balance.Balance - prevToken
+
+			if balance.SolanaFetched && balance.SolanaError == nil && record.SolFetched && record.SolError == "" {
+				prevSol := record.SolBalance
+				delta.PreviousSol = &prevSol
+				delta.SolChange = balance.SolanaBalance - prevSol
+			}
+		}
+		deltas[balance.WalletAddress] = delta
+	}
+	return deltas
+}
@@ -0,0 +1,407 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// openTemp opens a database in a temporary directory, closed when the test ends
+func openTemp(t *testing.T) (*DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data", "reporter.db")
+	db, err := Open(path, time.Second)
+	if err != nil {
+		t.Fatalf("Open(%s): %v", path, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+// balances builds successfully fetched balances, ordered by wallet
+func balances(tokens map[string]float64) []*solana.TokenBalance {
+	wallets := make([]string, 0, len(tokens))
+	for wallet := range tokens {
+		wallets = append(wallets, wallet)
+	}
+	sort.Strings(wallets)
+
+	result := make([]*solana.TokenBalance, 0, len(wallets))
+	for _, wallet := range wallets {
+		result = append(result, &solana.TokenBalance{WalletAddress: wallet, Balance: tokens[wallet]})
+	}
+	return result
+}
+
+func TestLastRunSurvivesReopen(t *testing.T) {
+	db, path := openTemp(t)
+
+	if lastRun := db.GetLastRun(); lastRun != nil {
+		t.Fatalf("GetLastRun on a new database = %+v, want nil", lastRun)
+	}
+
+	runTime := time.Date(2026, 3, 1, 14, 0, 0, 0, time.FixedZone("CET", 3600))
+	if err := db.UpdateLastRun(runTime, "csv/balance_2026-03-01_14-00-00.csv"); err != nil {
+		t.Fatalf("UpdateLastRun: %v", err)
+	}
+	later := runTime.Add(time.Hour)
+	if err := db.UpdateLastRun(later, ""); err != nil {
+		t.Fatalf("UpdateLastRun: %v", err)
+	}
+	db.Close()
+
+	reopened, err := Open(path, time.Second)
+	if err != nil {
+		t.Fatalf("reopening %s: %v", path, err)
+	}
+	defer reopened.Close()
+
+	lastRun := reopened.GetLastRun()
+	if lastRun == nil {
+		t.Fatal("GetLastRun after reopening = nil")
+	}
+	if !lastRun.RunTimestamp.Equal(later) || lastRun.CSVPath != "" {
+		t.Errorf("GetLastRun = %+v, want run %v without a CSV path", lastRun, later)
+	}
+	if lastRun.SentAt.IsZero() {
+		t.Error("GetLastRun has no sent time")
+	}
+}
+
+func TestAlertsAndBaselines(t *testing.T) {
+	db, _ := openTemp(t)
+
+	sentAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := db.RecordAlerts([]string{"expect:a", "expect:b"}, sentAt); err != nil {
+		t.Fatalf("RecordAlerts: %v", err)
+	}
+	if got, ok := db.LastAlert("expect:a"); !ok || !got.Equal(sentAt) {
+		t.Errorf("LastAlert(expect:a) = %v, %v; want %v, true", got, ok, sentAt)
+	}
+	if _, ok := db.LastAlert("expect:c"); ok {
+		t.Error("LastAlert(expect:c) found an alert that was never sent")
+	}
+
+	if err := db.InsertBalances(sentAt, balances(map[string]float64{"a": 1, "b": 2})); err != nil {
+		t.Fatalf("InsertBalances: %v", err)
+	}
+	if _, err := db.CaptureBaseline("q1", sentAt); err != nil {
+		t.Fatalf("CaptureBaseline: %v", err)
+	}
+	baseline, ok := db.GetBaseline("q1")
+	if !ok || len(baseline.Balances) != 2 || baseline.Balances["b"] != 2 {
+		t.Errorf("GetBaseline(q1) = %+v, %v", baseline, ok)
+	}
+	if _, ok := db.GetBaseline("q2"); ok {
+		t.Error("GetBaseline(q2) found a baseline that was never captured")
+	}
+}
+
+func TestGetBalanceHistory(t *testing.T) {
+	db, _ := openTemp(t)
+
+	first := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	failed := &solana.TokenBalance{WalletAddress: "a", SolanaBalance: 0.5, FetchError: errors.New("rpc timeout")}
+
+	// Insert the later run first: history is ordered by run, not by insertion
+	if err := db.InsertBalances(second, []*solana.TokenBalance{failed, {WalletAddress: "b", Balance: 7}}); err != nil {
+		t.Fatalf("InsertBalances(second): %v", err)
+	}
+	if err := db.InsertBalances(first, balances(map[string]float64{"a": 10, "b": 5})); err != nil {
+		t.Fatalf("InsertBalances(first): %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		wallet string
+		since  time.Time
+		want   []BalanceRecord
+	}{
+		{
+			name:   "both runs including the failed fetch",
+			wallet: "a",
+			since:  first,
+			want: []BalanceRecord{
+				{RunTimestamp: first, WalletAddress: "a", TokenBalance: 10},
+				{RunTimestamp: second, WalletAddress: "a", SolBalance: 0.5, TokenError: "rpc timeout"},
+			},
+		},
+		{
+			name:   "since excludes the first run",
+			wallet: "b",
+			since:  first.Add(time.Minute),
+			want:   []BalanceRecord{{RunTimestamp: second, WalletAddress: "b", TokenBalance: 7}},
+		},
+		{
+			name:   "unknown wallet",
+			wallet: "c",
+			since:  first,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetBalanceHistory(tt.wallet, tt.since)
+			if err != nil {
+				t.Fatalf("GetBalanceHistory: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetBalanceHistory = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].RunTimestamp.Equal(tt.want[i].RunTimestamp) {
+					t.Errorf("record %d run = %v, want %v", i, got[i].RunTimestamp, tt.want[i].RunTimestamp)
+				}
+				got[i].RunTimestamp = tt.want[i].RunTimestamp
+				if got[i] != tt.want[i] {
+					t.Errorf("record %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestIncompleteRunIsIgnored(t *testing.T) {
+	db, _ := openTemp(t)
+
+	first := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := db.InsertBalances(first, balances(map[string]float64{"a": 10})); err != nil {
+		t.Fatalf("InsertBalances: %v", err)
+	}
+
+	// A run that crashed after writing one batch never completes
+	second := first.Add(time.Hour)
+	if err := db.insertRecords([]BalanceRecord{newBalanceRecord(second, balances(map[string]float64{"a": 99})[0])}); err != nil {
+		t.Fatalf("insertRecords: %v", err)
+	}
+
+	latest, err := db.LatestBalances(second.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("LatestBalances: %v", err)
+	}
+	if got := latest["a"]; got.TokenBalance != 10 || !got.RunTimestamp.Equal(first) {
+		t.Errorf("LatestBalances[a] = %+v, want the completed first run's 10", got)
+	}
+	if history, _ := db.GetBalanceHistory("a", first); len(history) != 1 {
+		t.Errorf("GetBalanceHistory = %+v, want only the completed run", history)
+	}
+
+	// The writer completes the run once every batch is written
+	writer := db.NewWriter(second, 1, 1)
+	writer.Add(balances(map[string]float64{"a": 99})[0])
+	if _, err := writer.Close(); err != nil {
+		t.Fatalf("Writer.Close: %v", err)
+	}
+	latest, err = db.LatestBalances(second.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("LatestBalances: %v", err)
+	}
+	if got := latest["a"]; got.TokenBalance != 99 {
+		t.Errorf("LatestBalances[a] after completing = %+v, want 99", got)
+	}
+}
+
+func TestBusyWriteIsRetried(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reporter.db")
+	db, err := Open(path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	defer func(backoff time.Duration) { busyBackoff = backoff }(busyBackoff)
+	busyBackoff = 50 * time.Millisecond
+
+	// Another process holds the write lock for longer than the busy timeout
+	other, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("opening a second connection: %v", err)
+	}
+	defer other.Close()
+	lock, err := other.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if _, err := lock.Exec(`INSERT INTO alerts (key, sent_at) VALUES ('lock', '')`); err != nil {
+		t.Fatalf("taking the write lock: %v", err)
+	}
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(120 * time.Millisecond)
+		lock.Rollback()
+		close(released)
+	}()
+
+	// A single attempt fails while the lock is held
+	if err := db.runTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO alerts (key, sent_at) VALUES ('probe', '')`)
+		return err
+	}); !isBusy(err) {
+		t.Fatalf("write under lock returned %v, want a busy error", err)
+	}
+
+	if err := db.RecordAlerts([]string{"expect:a"}, time.Now()); err != nil {
+		t.Fatalf("RecordAlerts was not retried past the lock: %v", err)
+	}
+	<-released
+	if _, ok := db.LastAlert("expect:a"); !ok {
+		t.Error("retried alert was not recorded")
+	}
+}
+
+func TestWriterBatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		wallets     int
+		batchSize   int
+		queueSize   int
+		wantBatches int
+	}{
+		{name: "partial last batch", wallets: 1050, batchSize: 100, queueSize: 10, wantBatches: 11},
+		{name: "exact batches", wallets: 600, batchSize: 200, queueSize: 1, wantBatches: 3},
+		{name: "one batch", wallets: 40, batchSize: 500, queueSize: 64, wantBatches: 1},
+		{name: "nothing to write", wallets: 0, batchSize: 100, queueSize: 10, wantBatches: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := openTemp(t)
+			ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+			writer := db.NewWriter(ts, tt.batchSize, tt.queueSize)
+			for i := 0; i < tt.wallets; i++ {
+				writer.Add(&solana.TokenBalance{WalletAddress: fmt.Sprintf("wallet%04d", i), Balance: float64(i)})
+			}
+			batches, err := writer.Close()
+			if err != nil {
+				t.Fatalf("Writer.Close: %v", err)
+			}
+			if batches != tt.wantBatches {
+				t.Errorf("wrote %d batches, want %d", batches, tt.wantBatches)
+			}
+
+			latest, err := db.LatestBalances(ts.Add(time.Hour))
+			if err != nil {
+				t.Fatalf("LatestBalances: %v", err)
+			}
+			if len(latest) != tt.wallets {
+				t.Errorf("persisted %d wallets, want %d", len(latest), tt.wallets)
+			}
+			if tt.wallets > 0 && latest["wallet0007"].TokenBalance != 7 {
+				t.Errorf("wallet0007 = %+v, want balance 7", latest["wallet0007"])
+			}
+		})
+	}
+}
+
+func TestComputeDeltas(t *testing.T) {
+	db, _ := openTemp(t)
+
+	first := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	previousRun := []*solana.TokenBalance{
+		{WalletAddress: "increased", Balance: 10, SolanaBalance: 1, SolanaFetched: true},
+		{WalletAddress: "decreased", Balance: 10, SolanaBalance: 1, SolanaFetched: true},
+		{WalletAddress: "unchanged", Balance: 10, SolanaBalance: 1, SolanaFetched: true},
+		{WalletAddress: "sol-failed", Balance: 10, SolanaBalance: 1, SolanaFetched: true},
+		{WalletAddress: "sol-skipped", Balance: 10},
+		{WalletAddress: "now-failing", Balance: 10},
+	}
+	if err := db.InsertBalances(first, previousRun); err != nil {
+		t.Fatalf("InsertBalances: %v", err)
+	}
+	second := first.Add(time.Hour)
+	previous, err := db.LatestBalances(second)
+	if err != nil {
+		t.Fatalf("LatestBalances: %v", err)
+	}
+
+	tests := []struct {
+		current      *solana.TokenBalance
+		wantIncluded bool
+		wantPrevious bool
+		tokenChange  float64
+		wantPrevSol  bool
+		solChange    float64
+	}{
+		{current: &solana.TokenBalance{WalletAddress: "new", Balance: 5, SolanaBalance: 1, SolanaFetched: true}, wantIncluded: true},
+		{current: &solana.TokenBalance{WalletAddress: "increased", Balance: 12.5, SolanaBalance: 1.5, SolanaFetched: true},
+			wantIncluded: true, wantPrevious: true, tokenChange: 2.5, wantPrevSol: true, solChange: 0.5},
+		{current: &solana.TokenBalance{WalletAddress: "decreased", Balance: 4, SolanaBalance: 0.25, SolanaFetched: true},
+			wantIncluded: true, wantPrevious: true, tokenChange: -6, wantPrevSol: true, solChange: -0.75},
+		{current: &solana.TokenBalance{WalletAddress: "unchanged", Balance: 10, SolanaBalance: 1, SolanaFetched: true},
+			wantIncluded: true, wantPrevious: true, wantPrevSol: true},
+		{current: &solana.TokenBalance{WalletAddress: "sol-failed", Balance: 11, SolanaFetched: true, SolanaError: errors.New("rpc down")},
+			wantIncluded: true, wantPrevious: true, tokenChange: 1},
+		{current: &solana.TokenBalance{WalletAddress: "sol-skipped", Balance: 10, SolanaBalance: 2, SolanaFetched: true},
+			wantIncluded: true, wantPrevious: true},
+		{current: &solana.TokenBalance{WalletAddress: "now-failing", FetchError: errors.New("rpc down")}},
+	}
+
+	current := make([]*solana.TokenBalance, 0, len(tests))
+	for _, tt := range tests {
+		current = append(current, tt.current)
+	}
+	deltas := ComputeDeltas(previous, current)
+
+	for _, tt := range tests {
+		wallet := tt.current.WalletAddress
+		delta, ok := deltas[wallet]
+		if ok != tt.wantIncluded {
+			t.Errorf("%s: included = %v, want %v", wallet, ok, tt.wantIncluded)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if (delta.PreviousToken != nil) != tt.wantPrevious || delta.TokenChange != tt.tokenChange {
+			t.Errorf("%s: previous token %v, change %v, want previous %v and change %v",
+				wallet, delta.PreviousToken, delta.TokenChange, tt.wantPrevious, tt.tokenChange)
+		}
+		if (delta.PreviousSol != nil) != tt.wantPrevSol || delta.SolChange != tt.solChange {
+			t.Errorf("%s: previous SOL %v, change %v, want previous %v and change %v",
+				wallet, delta.PreviousSol, delta.SolChange, tt.wantPrevSol, tt.solChange)
+		}
+	}
+}
+
+func TestUnchangedRuns(t *testing.T) {
+	db, _ := openTemp(t)
+
+	// Oldest run first; a failed fetch does not break or extend a wallet's streak
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	runs := [][]*solana.TokenBalance{
+		{{WalletAddress: "static", Balance: 5}, {WalletAddress: "settled", Balance: 1}, {WalletAddress: "moving", Balance: 1}},
+		{{WalletAddress: "static", Balance: 5}, {WalletAddress: "settled", Balance: 2}, {WalletAddress: "moving", Balance: 2}},
+		{{WalletAddress: "static", Balance: 5}, {WalletAddress: "settled", Balance: 2}, {WalletAddress: "moving", Balance: 3}},
+		{{WalletAddress: "static", FetchError: errors.New("rpc down")}, {WalletAddress: "settled", Balance: 2}, {WalletAddress: "new", Balance: 9}},
+	}
+	for i, run := range runs {
+		if err := db.InsertBalances(start.Add(time.Duration(i)*time.Hour), run); err != nil {
+			t.Fatalf("InsertBalances(run %d): %v", i, err)
+		}
+	}
+
+	got := db.UnchangedRuns()
+	tests := []struct {
+		wallet string
+		want   int
+	}{
+		{wallet: "static", want: 2},
+		{wallet: "settled", want: 2},
+		{wallet: "moving", want: 0},
+		{wallet: "new", want: 0},
+		{wallet: "unknown", want: 0},
+	}
+	for _, tt := range tests {
+		if got[tt.wallet] != tt.want {
+			t.Errorf("%s: %d unchanged runs, want %d", tt.wallet, got[tt.wallet], tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// Writer persists a run's balances in batches while they are still being fetched.
+// Balances are queued on a bounded channel, so Add blocks once the queue is full
+// rather than buffering an unbounded number of results in memory.
+type Writer struct {
+	db        *DB
+	ts        time.Time
+	batchSize int
+	queue     chan *solana.TokenBalance
+	done      chan struct{}
+
+	// Set by the writer goroutine and read after done is closed
+	batches int
+	err     error
+}
+
+// NewWriter starts a writer recording balances for the run at ts.
+// batchSize is the number of records per write and queueSize bounds pending balances.
+func (db *DB) NewWriter(ts time.Time, batchSize, queueSize int) *Writer {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	w := &Writer{
+		db:        db,
+		ts:        ts,
+		batchSize: batchSize,
+		queue:     make(chan *solana.TokenBalance, queueSize),
+		done:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Add queues a balance for writing, blocking while the queue is full
+func (w *Writer) Add(balance *solana.TokenBalance) {
+	w.queue <- balance
+}
+
+// Close flushes the remaining balances and returns the number of batches written.
+// The run is marked completed only when every batch was written; otherwise the first
+// write error is returned, as later batches are still attempted.
+func (w *Writer) Close() (int, error) {
+	close(w.queue)
+	<-w.done
+	if w.err != nil {
+		return w.batches, w.err
+	}
+	return w.batches, w.db.completeRun(w.ts)
+}
+
+// run drains the queue, writing a batch whenever batchSize records are pending
+func (w *Writer) run() {
+	defer close(w.done)
+
+	batch := make([]BalanceRecord, 0, w.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.db.insertRecords(batch); err != nil && w.err == nil {
+			w.err = err
+		}
+		w.batches++
+		batch = make([]BalanceRecord, 0, w.batchSize)
+	}
+
+	for balance := range w.queue {
+		batch = append(batch, newBalanceRecord(w.ts, balance))
+		if len(batch) >= w.batchSize {
+			flush()
+		}
+	}
+	flush()
+}
@@ -0,0 +1,296 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// DefaultQuery asks the indexer for a single wallet's balance of the configured mint
+const DefaultQuery = `query TokenBalance($owner: String!, $mint: String!) {
+  balance: tokenBalance(owner: $owner, mint: $mint)
+}`
+
+// Client fetches token balances from a GraphQL indexer
+type Client struct {
+	endpoint     string
+	query        string
+	balanceField string
+	tokenMint    string
+	httpClient   *http.Client
+	logger       *logger.Logger
+	maxRetries   int
+	retryDelay   time.Duration
+
+	// OnResult, when set, is called for each wallet as soon as its fetch completes
+	OnResult func(*solana.TokenBalance)
+
+	// RetryLogEvery limits retry log lines, see solana.ShouldLogRetry
+	RetryLogEvery int
+
+	// MaxResponseBytes caps the size of a response body; larger responses fail and are retried
+	MaxResponseBytes int64
+}
+
+// New creates a new GraphQL indexer client.
+// The query receives $owner and $mint variables and must return the balance under balanceField in data.
+func New(endpoint, query, balanceField, tokenMint string, timeout time.Duration, maxRetries int, logger *logger.Logger) *Client {
+	return &Client{
+		endpoint:     endpoint,
+		query:        query,
+		balanceField: balanceField,
+		tokenMint:    tokenMint,
+		httpClient:   &http.Client{Timeout: timeout},
+		logger:       logger,
+		maxRetries:   maxRetries,
+		retryDelay:   500 * time.Millisecond,
+
+		RetryLogEvery:    1,
+		MaxResponseBytes: solana.DefaultMaxResponseBytes,
+	}
+}
+
+// SetRootCAs verifies TLS connections against pool instead of the system roots
+func (c *Client) SetRootCAs(pool *x509.CertPool) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	c.httpClient.Transport = transport
+}
+
+// FetchTokenBalance fetches the token balance for a wallet address
+func (c *Client) FetchTokenBalance(ctx context.Context, walletAddress string) (*solana.TokenBalance, error) {
+	requestJSON, err := json.Marshal(map[string]interface{}{
+		"query": c.query,
+		"variables": map[string]string{
+			"owner": walletAddress,
+			"mint":  c.tokenMint,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Summarise retry attempts that were not logged individually
+	suppressed := 0
+	defer func() {
+		if suppressed > 0 {
+			c.logger.Log(fmt.Sprintf("Suppressed %d retry log lines for GraphQL fetch of %s", suppressed, walletAddress))
+		}
+	}()
+
+	var body []byte
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if attempt > 0 {
+			// Calculate exponential backoff
+			backoff := time.Duration(math.Pow(2, float64(attempt-1))) * c.retryDelay
+			if solana.ShouldLogRetry(attempt, c.maxRetries, c.RetryLogEvery) {
+				c.logger.Log(fmt.Sprintf("Retrying GraphQL fetch for %s (attempt %d/%d) after %v",
+					walletAddress, attempt, c.maxRetries, backoff))
+			} else {
+				suppressed++
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+				// Continue with retry
+			}
+		}
+
+		solana.RecordAttempt(ctx)
+		body, err = c.post(ctx, requestJSON)
+		if err == nil {
+			break
+		}
+
+		// Stop early on cancellation and on transport errors a retry cannot fix
+		var statusErr *statusError
+		if !errors.As(err, &statusErr) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !solana.IsRetriableError(err) {
+				return nil, fmt.Errorf("failed to fetch token balance: %w", err)
+			}
+		}
+
+		// If this was the last attempt, return the error
+		if attempt == c.maxRetries {
+			return nil, fmt.Errorf("failed to fetch token balance after %d attempts: %w", c.maxRetries+1, err)
+		}
+	}
+
+	// Parse the response
+	var response struct {
+		Data   map[string]json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(response.Errors) > 0 {
+		messages := make([]string, 0, len(response.Errors))
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return nil, fmt.Errorf("GraphQL error: %s", strings.Join(messages, "; "))
+	}
+
+	raw, ok := response.Data[c.balanceField]
+	if !ok {
+		return nil, fmt.Errorf("GraphQL response has no %q field", c.balanceField)
+	}
+
+	balance, err := parseBalance(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// The indexer reports null for wallets without a token account
+	status := solana.StatusOK
+	if string(raw) == "null" {
+		status = solana.StatusNoAccount
+	}
+
+	return &solana.TokenBalance{
+		WalletAddress: walletAddress,
+		Balance:       balance,
+		Timestamp:     time.Now().UTC(),
+		FetchError:    nil,
+		Status:        status,
+	}, nil
+}
+
+// post sends a single GraphQL request and returns the response body
+func (c *Client) post(ctx context.Context, requestJSON []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(requestJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{code: resp.StatusCode}
+	}
+
+	body, err := solana.ReadBody(resp.Body, c.MaxResponseBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return body, nil
+}
+
+// statusError is a non-200 HTTP response from the indexer; these are always retried
+type statusError struct {
+	code int
+}
+
+// Error implements the error interface
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status code %d", e.code)
+}
+
+// parseBalance accepts a balance encoded as a JSON number, a numeric string or null
+func parseBalance(raw json.RawMessage) (float64, error) {
+	if string(raw) == "null" {
+		return 0, nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err != nil {
+		return 0, fmt.Errorf("failed to parse balance %s: %w", raw, err)
+	}
+
+	balance, err := strconv.ParseFloat(number.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse balance %s: %w", raw, err)
+	}
+	return balance, nil
+}
+
+// FetchTokenBalances fetches token balances for multiple wallet addresses concurrently.
+// When ctx is cancelled, wallets not yet fetched are returned with the context error.
+func (c *Client) FetchTokenBalances(ctx context.Context, addresses []string, concurrencyLimit int) ([]*solana.TokenBalance, []error) {
+	balances := make([]*solana.TokenBalance, len(addresses))
+	errs := make([]error, len(addresses))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.logger.Log(fmt.Sprintf("Starting to fetch balances from GraphQL indexer for %d addresses with concurrency limit %d",
+		len(addresses), concurrencyLimit))
+
+	// Create a semaphore channel to limit concurrency
+	sem := make(chan struct{}, concurrencyLimit)
+	done := make(chan int, len(addresses))
+
+	for i, address := range addresses {
+		sem <- struct{}{} // Acquire semaphore
+
+		go func(i int, address string) {
+			defer func() {
+				<-sem // Release semaphore
+				done <- i
+			}()
+
+			tokenCtx, attempts := solana.CountAttempts(ctx)
+			balance, err := c.FetchTokenBalance(tokenCtx, address)
+			if err != nil {
+				errs[i] = err
+				balance = &solana.TokenBalance{
+					WalletAddress: address,
+					Balance:       0,
+					Timestamp:     time.Now().UTC(),
+					FetchError:    err,
+					Status:        solana.StatusError,
+				}
+			}
+			balance.Attempts = *attempts
+			balances[i] = balance
+		}(i, address)
+	}
+
+	for range addresses {
+		i := <-done
+		if c.OnResult != nil {
+			c.OnResult(balances[i])
+		}
+	}
+
+	// Collect errors in address order
+	errors := make([]error, 0)
+	for i, err := range errs {
+		if err != nil {
+			errors = append(errors, fmt.Errorf("error fetching balance for address %s: %w", addresses[i], err))
+			c.logger.LogError(fmt.Sprintf("Failed to fetch balance for address %s", addresses[i]), err)
+		}
+	}
+
+	c.logger.Log(fmt.Sprintf("Completed fetching balances. Success: %d, Errors: %d",
+		len(addresses)-len(errors), len(errors)))
+
+	return balances, errors
+}
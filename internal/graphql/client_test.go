@@ -0,0 +1,92 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+func TestFetchTokenBalances(t *testing.T) {
+	const mint = "Mint1111111111111111111111111111111111111111"
+
+	// The mock indexer answers by owner; the failing wallet always gets a 503
+	responses := map[string]string{
+		"number":   `{"data":{"balance":12.5}}`,
+		"string":   `{"data":{"balance":"7.25"}}`,
+		"none":     `{"data":{"balance":null}}`,
+		"rejected": `{"errors":[{"message":"unknown owner"}]}`,
+	}
+	indexer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string            `json:"query"`
+			Variables map[string]string `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Query != DefaultQuery {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if request.Variables["mint"] != mint {
+			t.Errorf("request for mint %q, want %q", request.Variables["mint"], mint)
+		}
+		body, ok := responses[request.Variables["owner"]]
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer indexer.Close()
+
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	defer log.Close()
+
+	c := New(indexer.URL, DefaultQuery, "balance", mint, time.Second, 1, log)
+	c.retryDelay = time.Millisecond
+
+	tests := []struct {
+		owner      string
+		wantErr    bool
+		want       float64
+		wantStatus solana.QueryStatus
+	}{
+		{owner: "number", want: 12.5, wantStatus: solana.StatusOK},
+		{owner: "string", want: 7.25, wantStatus: solana.StatusOK},
+		{owner: "none", want: 0, wantStatus: solana.StatusNoAccount},
+		{owner: "rejected", wantErr: true, wantStatus: solana.StatusError},
+		{owner: "unavailable", wantErr: true, wantStatus: solana.StatusError},
+	}
+
+	addresses := make([]string, len(tests))
+	for i, tt := range tests {
+		addresses[i] = tt.owner
+	}
+	balances, errs := c.FetchTokenBalances(context.Background(), addresses, 2)
+	if len(errs) != 2 {
+		t.Errorf("FetchTokenBalances returned %d errors, want 2: %v", len(errs), errs)
+	}
+
+	for i, tt := range tests {
+		got := balances[i]
+		if got.WalletAddress != tt.owner {
+			t.Fatalf("balance %d is for %s, want %s", i, got.WalletAddress, tt.owner)
+		}
+		if (got.FetchError != nil) != tt.wantErr || got.Balance != tt.want || got.Status != tt.wantStatus {
+			t.Errorf("%s: balance %v, status %s, error %v; want %v, %s, error %v",
+				tt.owner, got.Balance, got.Status, got.FetchError, tt.want, tt.wantStatus, tt.wantErr)
+		}
+	}
+
+	// The unavailable wallet is retried once, the GraphQL error is not a transport failure
+	if got := balances[4].Attempts; got != 2 {
+		t.Errorf("unavailable wallet took %d attempts, want 2", got)
+	}
+}
@@ -0,0 +1,110 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/metrics"
+)
+
+// Server answers container health checks on /healthz and Prometheus scrapes on /metrics
+type Server struct {
+	server  *http.Server
+	maxAge  time.Duration
+	metrics *metrics.Prometheus
+	logger  *logger.Logger
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastRun     time.Time
+	lastOK      bool
+}
+
+// New creates a server listening on addr. /healthz reports healthy while the last
+// successful run is at most maxAge old; the server's start counts as a success so a
+// slow first run is not reported unhealthy. /metrics renders the values in metrics.
+func New(addr string, maxAge time.Duration, metrics *metrics.Prometheus, logger *logger.Logger) *Server {
+	s := &Server{
+		maxAge:      maxAge,
+		metrics:     metrics,
+		logger:      logger,
+		lastSuccess: time.Now(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	s.server = &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// Start listens on the server's address and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.LogError("Health server stopped", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for those in progress until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Handler returns the handler serving /healthz and /metrics
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// RecordRun records the end of a cycle; ok is false when it failed before reporting
+func (s *Server) RecordRun(ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastRun = time.Now()
+	s.lastOK = ok
+	if ok {
+		s.lastSuccess = s.lastRun
+	}
+}
+
+// handleHealth answers 200 while a run succeeded within maxAge, and 503 otherwise
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	age := time.Since(s.lastSuccess)
+	lastRun, lastOK := s.lastRun, s.lastOK
+	s.mu.Unlock()
+
+	status := "ok"
+	code := http.StatusOK
+	if age > s.maxAge {
+		status = fmt.Sprintf("no successful run for %v", age.Round(time.Second))
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	fmt.Fprintln(w, status)
+	if !lastRun.IsZero() {
+		fmt.Fprintf(w, "last run: %s (ok=%t)\n", lastRun.UTC().Format(time.RFC3339), lastOK)
+	}
+}
+
+// handleMetrics renders the metrics in the Prometheus text exposition format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprint(w, s.metrics.Render())
+}
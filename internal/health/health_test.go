@@ -0,0 +1,109 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/metrics"
+)
+
+// get requests path from the server's handler
+func get(t *testing.T, s *Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestHealthz(t *testing.T) {
+	tests := []struct {
+		name     string
+		run      func(s *Server) // Simulated cycles before the check
+		wantCode int
+		want     string
+	}{
+		{
+			name:     "no run yet",
+			run:      func(s *Server) {},
+			wantCode: http.StatusOK,
+			want:     "ok\n",
+		},
+		{
+			name:     "successful run",
+			run:      func(s *Server) { s.RecordRun(true) },
+			wantCode: http.StatusOK,
+			want:     "(ok=true)",
+		},
+		{
+			name:     "recent success, then a failed run",
+			run:      func(s *Server) { s.RecordRun(true); s.RecordRun(false) },
+			wantCode: http.StatusOK,
+			want:     "(ok=false)",
+		},
+		{
+			name: "no success within twice the interval",
+			run: func(s *Server) {
+				s.RecordRun(false)
+				s.lastSuccess = time.Now().Add(-3 * time.Minute)
+			},
+			wantCode: http.StatusServiceUnavailable,
+			want:     "no successful run for 3m0s",
+		},
+	}
+
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New("127.0.0.1:0", 2*time.Minute, metrics.NewPrometheus(""), log)
+			tt.run(s)
+
+			rec := get(t, s, "/healthz")
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, tt.want) {
+				t.Errorf("body = %q, want it to contain %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scraped := metrics.NewPrometheus("")
+	s := New("127.0.0.1:0", time.Minute, scraped, log)
+
+	// Two cycles as main records them
+	for i := 0; i < 2; i++ {
+		scraped.Count("cycles_total", 1)
+		scraped.Count("addresses_processed_total", 50)
+		scraped.Count("fetch_errors_total", 2)
+		scraped.Gauge("last_cycle_timestamp_seconds", 1700000000)
+		s.RecordRun(true)
+	}
+
+	rec := get(t, s, "/metrics")
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+	for _, want := range []string{
+		"# TYPE solana_balance_reporter_cycles_total counter\nsolana_balance_reporter_cycles_total 2\n",
+		"solana_balance_reporter_addresses_processed_total 100\n",
+		"solana_balance_reporter_fetch_errors_total 4\n",
+		"# TYPE solana_balance_reporter_last_cycle_timestamp_seconds gauge\nsolana_balance_reporter_last_cycle_timestamp_seconds 1.7e+09\n",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics missing %q in\n%s", want, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package jsonwriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/report"
+)
+
+// JSONWriter handles writing JSON report documents
+type JSONWriter struct {
+	jsonDir string
+	logger  *logger.Logger
+
+	// Compress gzips JSON files and adds a .gz suffix to their names
+	Compress bool
+
+	// subdir, when set, is created under the JSON directory and receives the files
+	subdir string
+}
+
+// SetSubdir writes the following files into a subdirectory of the JSON directory, such
+// as a per-run directory; empty writes to the JSON directory itself
+func (w *JSONWriter) SetSubdir(subdir string) {
+	w.subdir = subdir
+}
+
+// New creates a new JSONWriter
+func New(jsonDir string, logger *logger.Logger) (*JSONWriter, error) {
+	// Ensure JSON directory exists
+	if err := os.MkdirAll(jsonDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create JSON directory: %w", err)
+	}
+
+	return &JSONWriter{
+		jsonDir: jsonDir,
+		logger:  logger,
+	}, nil
+}
+
+// EncodeSummary renders a summary as indented JSON
+func EncodeSummary(summary report.Summary) ([]byte, error) {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode summary: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// WriteSummaryJSON writes a summary document to the JSON directory and returns its path
+func (w *JSONWriter) WriteSummaryJSON(summary report.Summary, filename string) (string, error) {
+	data, err := EncodeSummary(summary)
+	if err != nil {
+		return "", err
+	}
+
+	if w.Compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return "", fmt.Errorf("failed to compress summary JSON: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return "", fmt.Errorf("failed to compress summary JSON: %w", err)
+		}
+		data = buf.Bytes()
+		filename += ".gz"
+	}
+
+	dir := filepath.Join(w.jsonDir, w.subdir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create JSON directory: %w", err)
+	}
+
+	path := filepath.Join(dir, filename)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write summary JSON: %w", err)
+	}
+
+	w.logger.Log(fmt.Sprintf("Wrote balance summary to %s", path))
+	return path, nil
+}
@@ -0,0 +1,133 @@
+package jsonwriter
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/report"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// testWriter returns a writer into a temporary directory
+func testWriter(t *testing.T) *JSONWriter {
+	t.Helper()
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	w, err := New(t.TempDir(), log)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return w
+}
+
+func TestWriteSummaryJSON(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 10, SolanaBalance: 1, SolanaFetched: true},
+		{WalletAddress: "b", Balance: 2.5, SolanaBalance: 0.5, SolanaFetched: true},
+		{WalletAddress: "c", FetchError: errors.New("rpc timeout")},
+		{WalletAddress: "d", Balance: 40},
+	}
+	ts := time.Date(2026, 3, 1, 14, 0, 0, 0, time.FixedZone("CET", 3600))
+	summary := report.Summarize(balances, ts, 2)
+
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{name: "plain"},
+		{name: "gzip", compress: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := testWriter(t)
+			w.Compress = tt.compress
+			w.SetSubdir("run_2026-03-01_13_00_00")
+
+			path, err := w.WriteSummaryJSON(summary, "summary.json")
+			if err != nil {
+				t.Fatalf("WriteSummaryJSON: %v", err)
+			}
+			want := filepath.Join("run_2026-03-01_13_00_00", "summary.json")
+			if tt.compress {
+				want += ".gz"
+			}
+			if !strings.HasSuffix(path, want) {
+				t.Errorf("path = %s, want it to end in %s", path, want)
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			var content io.Reader = file
+			if tt.compress {
+				if content, err = gzip.NewReader(file); err != nil {
+					t.Fatalf("gzip.NewReader: %v", err)
+				}
+			}
+
+			var got struct {
+				Timestamp       string          `json:"timestamp"`
+				TotalAddresses  int             `json:"total_addresses"`
+				Successful      int             `json:"successful"`
+				Failed          int             `json:"failed"`
+				TotalBalance    float64         `json:"total_balance"`
+				TotalSolBalance *float64        `json:"total_sol_balance"`
+				TopWallets      []walletBalance `json:"top_wallets"`
+				BottomWallets   []walletBalance `json:"bottom_wallets"`
+			}
+			if err := json.NewDecoder(content).Decode(&got); err != nil {
+				t.Fatalf("decoding the summary: %v", err)
+			}
+
+			if got.Timestamp != "2026-03-01T13:00:00Z" {
+				t.Errorf("timestamp = %s, want the run time in UTC", got.Timestamp)
+			}
+			if got.TotalAddresses != 4 || got.Successful != 3 || got.Failed != 1 {
+				t.Errorf("counts = %d total, %d successful, %d failed; want 4, 3, 1", got.TotalAddresses, got.Successful, got.Failed)
+			}
+			if got.TotalBalance != 52.5 {
+				t.Errorf("total_balance = %v, want 52.5", got.TotalBalance)
+			}
+			if got.TotalSolBalance == nil || *got.TotalSolBalance != 1.5 {
+				t.Errorf("total_sol_balance = %v, want 1.5", got.TotalSolBalance)
+			}
+			checkWallets(t, "top_wallets", got.TopWallets, []walletBalance{{"d", 40}, {"a", 10}})
+			checkWallets(t, "bottom_wallets", got.BottomWallets, []walletBalance{{"b", 2.5}, {"a", 10}})
+		})
+	}
+}
+
+// walletBalance is a wallet entry as decoded from a summary document
+type walletBalance struct {
+	WalletAddress string  `json:"wallet_address"`
+	Balance       float64 `json:"balance"`
+}
+
+func checkWallets(t *testing.T, field string, got, want []walletBalance) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s = %+v, want %+v", field, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s = %+v, want %+v", field, got, want)
+			return
+		}
+	}
+}
@@ -4,13 +4,61 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Level is the severity of a log message
+type Level int
+
+// Log levels, from most to least verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// ParseLevel parses a level name (debug, info, warn or error), case-insensitively
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
 // Logger represents a simple file logger
 type Logger struct {
-	logDir string
-	file   *os.File
+	logDir    string
+	file      *os.File
+	requestID string
+	mu        sync.Mutex
+
+	// OnError, when set, is called with every message logged through LogError.
+	// It may be called concurrently.
+	OnError func(message string)
+
+	// MinLevel drops messages below it; the zero value writes everything
+	MinLevel Level
+
+	// MaxLogSizeMB rotates the active file once a write would take it past this size,
+	// renaming it with a .1 suffix and older files to .2, .3 and so on (0 disables)
+	MaxLogSizeMB int
+
+	// MaxLogBackups is the number of size-rotated files kept per log file; older ones
+	// are deleted
+	MaxLogBackups int
+
+	// size is the current size of the active file
+	size int64
 }
 
 // New creates a new logger with the given log directory
@@ -47,6 +95,9 @@ func (l *Logger) rotateLogFile() error {
 
 // SetFilename sets a specific log filename and opens that file
 func (l *Logger) SetFilename(filename string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	// Close existing file if open
 	if l.file != nil {
 		l.file.Close()
@@ -65,12 +116,71 @@ func (l *Logger) openLogFile(filename string) error {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
 	l.file = file
+	l.size = info.Size()
 	return nil
 }
 
+// rotateBySize moves the active file to a .1 backup, shifting older backups up and
+// dropping those beyond MaxLogBackups, and reopens the file empty. If the rename fails
+// the active file is reopened as it was. The caller must hold the lock.
+func (l *Logger) rotateBySize() error {
+	path := l.file.Name()
+	l.file.Close()
+	l.file = nil
+	if err := l.shiftBackups(path); err != nil {
+		if reopenErr := l.openLogFile(filepath.Base(path)); reopenErr != nil {
+			return reopenErr
+		}
+		return err
+	}
+	return l.openLogFile(filepath.Base(path))
+}
+
+// shiftBackups renames path to path.1 and path.N to path.N+1, deleting the oldest backup
+func (l *Logger) shiftBackups(path string) error {
+	// Without backups the file is simply started over
+	if l.MaxLogBackups <= 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove rotated log file: %w", err)
+		}
+		return nil
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", path, l.MaxLogBackups))
+	for n := l.MaxLogBackups - 1; n >= 1; n-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, n), fmt.Sprintf("%s.%d", path, n+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	return nil
+}
+
+// SetRequestID sets the id included in every following log line; empty disables it
+func (l *Logger) SetRequestID(requestID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requestID = requestID
+}
+
 // CheckRotation rotates the log file if needed
 func (l *Logger) CheckRotation() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.checkRotation()
+}
+
+// checkRotation rotates the log file if needed; the caller must hold the lock
+func (l *Logger) checkRotation() error {
 	// If file is nil, create a new one
 	if l.file == nil {
 		return l.rotateLogFile()
@@ -87,27 +197,72 @@ func (l *Logger) CheckRotation() error {
 	return nil
 }
 
-// Log writes a log entry with timestamp
+// Log writes an informational log entry with timestamp
 func (l *Logger) Log(message string) error {
-	if err := l.CheckRotation(); err != nil {
+	return l.write(LevelInfo, message)
+}
+
+// Debug writes a log entry for detail that is only useful when troubleshooting
+func (l *Logger) Debug(message string) error {
+	return l.write(LevelDebug, "DEBUG: "+message)
+}
+
+// Warn writes a log entry for a problem that does not stop the current operation
+func (l *Logger) Warn(message string) error {
+	return l.write(LevelWarn, "WARNING: "+message)
+}
+
+// write writes a log entry with timestamp if level is at least MinLevel
+func (l *Logger) write(level Level, message string) error {
+	if level < l.MinLevel {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.checkRotation(); err != nil {
 		return err
 	}
 
 	timestamp := time.Now().UTC().Format("2006-01-02 15:04:05")
 	logEntry := fmt.Sprintf("[%s] %s\n", timestamp, message)
+	if l.requestID != "" {
+		logEntry = fmt.Sprintf("[%s] [%s] %s\n", timestamp, l.requestID, message)
+	}
+
+	// Rotate before the write so the entry lands whole in the fresh file. A failed
+	// rotation still writes the entry when the active file could be reopened.
+	var rotateErr error
+	if l.MaxLogSizeMB > 0 && l.size > 0 && l.size+int64(len(logEntry)) > int64(l.MaxLogSizeMB)<<20 {
+		rotateErr = l.rotateBySize()
+		if l.file == nil {
+			return rotateErr
+		}
+	}
 
-	_, err := l.file.WriteString(logEntry)
-	return err
+	n, err := l.file.WriteString(logEntry)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return rotateErr
 }
 
 // LogError logs an error with timestamp
 func (l *Logger) LogError(message string, err error) error {
 	errMsg := fmt.Sprintf("%s: %v", message, err)
-	return l.Log(errMsg)
+	if l.OnError != nil {
+		l.OnError(errMsg)
+	}
+	return l.write(LevelError, errMsg)
 }
 
 // Close closes the log file
 func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if l.file != nil {
 		return l.file.Close()
 	}
@@ -0,0 +1,178 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newTestLogger returns a logger writing to a temporary directory, and the directory
+func newTestLogger(t *testing.T) (*Logger, string) {
+	t.Helper()
+	dir := t.TempDir()
+	l, err := New(dir)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, dir
+}
+
+// logLines returns the lines of every log file in dir, without their timestamps. All
+// files are read since the logger may start a new file at the top of the hour.
+func logLines(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			if _, message, ok := strings.Cut(line, "] "); ok {
+				lines = append(lines, message)
+			}
+		}
+	}
+	return lines
+}
+
+func TestRequestID(t *testing.T) {
+	l, dir := newTestLogger(t)
+
+	l.Log("before the cycle")
+	l.SetRequestID("4f1c2a9e-0b7d-4e51-9a3c-2d8e6f7a1b90")
+	l.Log("fetching balances")
+	l.Warn("slow response")
+	l.SetRequestID("")
+	l.Log("after the cycle")
+
+	want := []string{
+		"before the cycle",
+		"[4f1c2a9e-0b7d-4e51-9a3c-2d8e6f7a1b90] fetching balances",
+		"[4f1c2a9e-0b7d-4e51-9a3c-2d8e6f7a1b90] WARNING: slow response",
+		"after the cycle",
+	}
+	got := logLines(t, dir)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("log lines = %q, want %q", got, want)
+	}
+}
+
+func TestMinLevel(t *testing.T) {
+	tests := []struct {
+		level string
+		want  []string
+	}{
+		{level: "debug", want: []string{"DEBUG: fetched wallet1", "cycle started", "WARNING: slow response", "send failed: timeout"}},
+		{level: "info", want: []string{"cycle started", "WARNING: slow response", "send failed: timeout"}},
+		{level: "WARN", want: []string{"WARNING: slow response", "send failed: timeout"}},
+		{level: "error", want: []string{"send failed: timeout"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			level, err := ParseLevel(tt.level)
+			if err != nil {
+				t.Fatalf("ParseLevel(%q): %v", tt.level, err)
+			}
+			l, dir := newTestLogger(t)
+			l.MinLevel = level
+
+			l.Debug("fetched wallet1")
+			l.Log("cycle started")
+			l.Warn("slow response")
+			l.LogError("send failed", errors.New("timeout"))
+
+			got := logLines(t, dir)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("log lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel accepted an unknown level")
+	}
+}
+
+func TestSizeRotation(t *testing.T) {
+	tests := []struct {
+		backups   int
+		wantFiles []string
+	}{
+		{backups: 3, wantFiles: []string{"activity.log", "activity.log.1", "activity.log.2"}},
+		{backups: 1, wantFiles: []string{"activity.log", "activity.log.1"}},
+		{backups: 0, wantFiles: []string{"activity.log"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d backups", tt.backups), func(t *testing.T) {
+			l, dir := newTestLogger(t)
+			l.MaxLogSizeMB = 1
+			l.MaxLogBackups = tt.backups
+			if err := l.SetFilename("activity.log"); err != nil {
+				t.Fatalf("SetFilename: %v", err)
+			}
+			matches, _ := filepath.Glob(filepath.Join(dir, "activity_*.log"))
+			for _, path := range matches {
+				os.Remove(path) // The file New opened before SetFilename
+			}
+
+			// 25 entries of 100KB fill the 1MB file twice, so it rotates twice
+			padding := strings.Repeat("x", 100<<10)
+			for i := 0; i < 25; i++ {
+				if err := l.Log(fmt.Sprintf("entry %02d %s", i, padding)); err != nil {
+					t.Fatalf("Log entry %d: %v", i, err)
+				}
+			}
+
+			paths, _ := filepath.Glob(filepath.Join(dir, "*"))
+			var names []string
+			for _, path := range paths {
+				names = append(names, filepath.Base(path))
+			}
+			sort.Strings(names)
+			if strings.Join(names, ",") != strings.Join(tt.wantFiles, ",") {
+				t.Fatalf("log files = %v, want %v", names, tt.wantFiles)
+			}
+
+			// Each file holds whole entries, newest in the active file and oldest in the
+			// highest backup, with none lost in between what was kept
+			next := -1
+			for i := len(tt.wantFiles) - 1; i >= 0; i-- {
+				content, err := os.ReadFile(filepath.Join(dir, tt.wantFiles[i]))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(content) > 1<<20 {
+					t.Errorf("%s is %d bytes, over the 1MB limit", tt.wantFiles[i], len(content))
+				}
+				for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+					var entry int
+					_, message, _ := strings.Cut(line, "] ")
+					if _, err := fmt.Sscanf(message, "entry %d ", &entry); err != nil || !strings.HasSuffix(line, padding) {
+						t.Fatalf("%s has a partial entry: %.40q", tt.wantFiles[i], line)
+					}
+					if next >= 0 && entry != next {
+						t.Fatalf("%s has entry %d, want %d", tt.wantFiles[i], entry, next)
+					}
+					next = entry + 1
+				}
+			}
+			if next != 25 {
+				t.Errorf("last entry written is %d, want 24", next-1)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/report"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// htmlReport holds the values rendered into the HTML body of a report
+type htmlReport struct {
+	Banner      string
+	Window      string
+	Partial     string
+	Total       int
+	Success     int
+	Failed      int
+	TopN        int
+	Wallets     []htmlWallet
+	Sections    []Section
+	ReportHash  string
+	QRCode      bool // Show the report hash as the QR code image attached as qrImageName
+	QRImage     template.URL
+	GeneratedAt string
+	Version     string
+	Footer      string
+}
+
+// htmlWallet is a row of the top wallets table
+type htmlWallet struct {
+	Address string
+	Balance string
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Arial, sans-serif; font-size: 14px;">
+{{if .Banner}}<p style="color: #b00; font-weight: bold;">*** {{.Banner}} REPORT - NOT PRODUCTION DATA ***</p>
+{{end}}<h2>Token Balance Report for {{.Window}}</h2>
+{{if .Partial}}<p style="color: #b00;"><strong>PARTIAL REPORT:</strong> {{.Partial}}</p>
+{{end}}<table cellpadding="4" style="border-collapse: collapse;">
+<tr><td>Total addresses processed</td><td align="right">{{.Total}}</td></tr>
+<tr><td>Successfully fetched</td><td align="right">{{.Success}}</td></tr>
+<tr><td>Failed to fetch</td><td align="right">{{.Failed}}</td></tr>
+</table>
+{{if .ReportHash}}<p>Report SHA-256: <code>{{.ReportHash}}</code>{{if .QRImage}}<br>
+<img src="{{.QRImage}}" width="200" height="200" alt="QR code of the report SHA-256">{{end}}</p>
+{{end}}{{if .Wallets}}<h3>Top {{.TopN}} wallets by balance</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse;">
+<tr><th align="left">Wallet</th><th align="right">Balance</th></tr>
+{{range .Wallets}}<tr><td style="font-family: monospace;">{{.Address}}</td><td align="right">{{.Balance}}</td></tr>
+{{end}}</table>
+{{end}}{{range .Sections}}<h3>{{.Title}}</h3>
+<ul>
+{{range .Lines}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}<p>The full report is attached as CSV; failed addresses are marked as "N/A".</p>
+<p style="color: #666;">Generated at {{.GeneratedAt}}{{if .Version}}<br>Reporter version: {{.Version}}{{end}}</p>
+{{if .Footer}}<p style="color: #666; white-space: pre-line;">{{.Footer}}</p>
+{{end}}</body>
+</html>
+`))
+
+// renderHTML renders the HTML body of a report, listing the n largest balances and,
+// when QRCode is set, the QR code image of the report hash
+func renderHTML(data htmlReport, balances []*solana.TokenBalance, n int, rounder rounding.Rounder) (string, error) {
+	for _, balance := range report.SortByBalance(balances) {
+		if len(data.Wallets) >= n || balance.FetchError != nil {
+			break
+		}
+		data.Wallets = append(data.Wallets, htmlWallet{
+			Address: balance.WalletAddress,
+			Balance: rounder.FormatExact(balance.Balance, balance.TokenUIAmount),
+		})
+	}
+	data.TopN = len(data.Wallets)
+
+	// html/template only passes safe URL schemes; cid: refers to the inline image part
+	if data.ReportHash != "" && data.QRCode {
+		data.QRImage = template.URL("cid:" + qrImageName)
+	}
+
+	var html strings.Builder
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return "", err
+	}
+	return html.String(), nil
+}
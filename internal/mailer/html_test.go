@@ -0,0 +1,219 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// mimePart is a leaf part of a MIME message, with the content types of the multiparts
+// enclosing it
+type mimePart struct {
+	Path        []string // e.g. [multipart/mixed multipart/alternative]
+	ContentType string
+	Filename    string
+	Body        string
+}
+
+// mimeParts returns the leaf parts of a raw message in order
+func mimeParts(t *testing.T, message string) []mimePart {
+	t.Helper()
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(message)))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("reading message headers: %v", err)
+	}
+	return collectParts(t, nil, header.Get("Content-Type"), "", reader.R)
+}
+
+// collectParts returns the leaf parts of a body with the given content type
+func collectParts(t *testing.T, path []string, contentType, filename string, body io.Reader) []mimePart {
+	t.Helper()
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("parsing content type %q: %v", contentType, err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		content, _ := io.ReadAll(body)
+		return []mimePart{{Path: path, ContentType: mediaType, Filename: filename, Body: string(content)}}
+	}
+
+	var parts []mimePart
+	inner := append(append([]string{}, path...), mediaType)
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("reading %s part: %v", mediaType, err)
+		}
+		parts = append(parts, collectParts(t, inner, part.Header.Get("Content-Type"), part.FileName(), part)...)
+	}
+}
+
+func TestHTMLReport(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "small", Balance: 1},
+		{WalletAddress: "whale", Balance: 5000},
+		{WalletAddress: "failed", FetchError: errors.New("rpc timeout")},
+		{WalletAddress: "mid", Balance: 250.5},
+	}
+
+	tests := []struct {
+		format    string
+		wantTypes []string // Body and attachment parts, as path/type
+	}{
+		{format: "", wantTypes: []string{"multipart/mixed/text/plain", "multipart/mixed/text/csv"}},
+		{format: "text", wantTypes: []string{"multipart/mixed/text/plain", "multipart/mixed/text/csv"}},
+		{format: "html", wantTypes: []string{"multipart/mixed/text/html", "multipart/mixed/text/csv"}},
+		{format: "both", wantTypes: []string{
+			"multipart/mixed/multipart/alternative/text/plain",
+			"multipart/mixed/multipart/alternative/text/html",
+			"multipart/mixed/text/csv",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run("format="+tt.format, func(t *testing.T) {
+			relay := newFakeSMTP(t)
+			m := testMailer(t, []string{"ops@example.com"}, relay.server)
+			m.Format = tt.format
+			m.HTMLTopN = 2
+			m.Rounder = rounding.Rounder{Places: 2, Mode: rounding.HalfUp}
+			if err := m.SendReportAttachment(testReport(), balances, SendOptions{}); err != nil {
+				t.Fatalf("SendReportAttachment: %v", err)
+			}
+			messages := relay.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("relay accepted %d messages, want 1", len(messages))
+			}
+
+			parts := mimeParts(t, messages[0].Data)
+			var types []string
+			for _, part := range parts {
+				types = append(types, strings.Join(append(part.Path, part.ContentType), "/"))
+			}
+			if strings.Join(types, "\n") != strings.Join(tt.wantTypes, "\n") {
+				t.Fatalf("message parts = %q, want %q", types, tt.wantTypes)
+			}
+
+			for _, part := range parts {
+				if part.ContentType != "text/html" {
+					continue
+				}
+				// The two largest balances are tabled, largest first, with the counts
+				whale, mid := strings.Index(part.Body, "whale"), strings.Index(part.Body, "mid")
+				if whale < 0 || mid < whale || strings.Contains(part.Body, "small") || !strings.Contains(part.Body, "5000.00") {
+					t.Errorf("HTML body does not table whale then mid only:\n%s", part.Body)
+				}
+				for _, count := range []string{"4", "3", "1"} {
+					if !strings.Contains(part.Body, ">"+count+"<") {
+						t.Errorf("HTML body missing count %s:\n%s", count, part.Body)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReportHashQR(t *testing.T) {
+	report := testReport()
+	sum := sha256.Sum256(report.Content)
+	wantHash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		format string
+		qr     bool
+		wantQR bool
+	}{
+		{format: "html", qr: true, wantQR: true},
+		{format: "both", qr: true, wantQR: true},
+		{format: "both"},
+		{format: "text", qr: true}, // No HTML body to show it in
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s qr=%v", tt.format, tt.qr), func(t *testing.T) {
+			relay := newFakeSMTP(t)
+			m := testMailer(t, []string{"ops@example.com"}, relay.server)
+			m.Format = tt.format
+			m.QRCode = tt.qr
+			if err := m.SendReportAttachment(report, nil, SendOptions{}); err != nil {
+				t.Fatalf("SendReportAttachment: %v", err)
+			}
+			messages := relay.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("relay accepted %d messages, want 1", len(messages))
+			}
+
+			var image, html *mimePart
+			parts := mimeParts(t, messages[0].Data)
+			for i := range parts {
+				switch {
+				case parts[i].ContentType == "image/png":
+					image = &parts[i]
+				case parts[i].ContentType == "text/html":
+					html = &parts[i]
+				}
+			}
+			if (image != nil) != tt.wantQR {
+				t.Fatalf("QR image part present = %v, want %v", image != nil, tt.wantQR)
+			}
+			if !tt.wantQR {
+				return
+			}
+
+			// The image is inline, next to the HTML that refers to it by Content-ID
+			if got := strings.Join(image.Path, "/"); !strings.HasSuffix(got, "multipart/related") {
+				t.Errorf("QR image is in %s, want a multipart/related part", got)
+			}
+			if html == nil || !strings.Contains(html.Body, "cid:"+qrImageName) || !strings.Contains(html.Body, wantHash) {
+				t.Errorf("HTML body does not show the QR code and hash %s", wantHash)
+			}
+
+			// The PNG holds the same modules as a QR code of the report's SHA-256
+			content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(image.Body, "\n", ""))
+			if err != nil {
+				t.Fatalf("decoding the image part: %v", err)
+			}
+			got, err := png.Decode(bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("the image part is not a PNG: %v", err)
+			}
+			code, err := qrcode.New(wantHash, qrcode.Medium)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := code.Image(qrImageSize)
+			if got.Bounds() != want.Bounds() {
+				t.Fatalf("QR image is %v, want %v", got.Bounds(), want.Bounds())
+			}
+			for y := want.Bounds().Min.Y; y < want.Bounds().Max.Y; y++ {
+				for x := want.Bounds().Min.X; x < want.Bounds().Max.X; x++ {
+					gr, _, _, _ := got.At(x, y).RGBA()
+					wr, _, _, _ := want.At(x, y).RGBA()
+					if gr != wr {
+						t.Fatalf("QR image differs from the code of %s at (%d, %d)", wantHash, x, y)
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,78 +1,553 @@
 package mailer
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"net"
 	"net/smtp"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
 	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
 )
 
+// SMTPServer holds the connection details for a single SMTP relay
+type SMTPServer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
 // Mailer handles sending emails with CSV attachments
 type Mailer struct {
-	smtpServer   string
-	smtpPort     int
-	smtpUsername string
-	smtpPassword string
-	emailFrom    string
-	emailTo      []string
-	logger       *logger.Logger
-	maxRetries   int
-	retryDelay   time.Duration
-}
-
-// New creates a new Mailer
-func New(smtpServer string, smtpPort int, smtpUsername, smtpPassword, emailFrom string, emailTo []string, maxRetries int, logger *logger.Logger) *Mailer {
+	smtpServers []SMTPServer
+	emailFrom   string
+	emailTo     []string
+	logger      *logger.Logger
+	maxRetries  int
+	retryDelay  time.Duration
+
+	// BuildVersion is shown in the email footer when set
+	BuildVersion string
+
+	// Concurrency bounds how many reports SendReports sends at once (minimum 1)
+	Concurrency int
+
+	// Environment names the deployment (e.g. prod, staging) for templates
+	Environment string
+
+	// Banner, when set, prefixes the subject as [Banner] and opens the body with a notice
+	// so non-production reports are not mistaken for real data
+	Banner string
+
+	// DefaultLocation is the time zone reports are rendered in (UTC when nil)
+	DefaultLocation *time.Location
+
+	// RecipientLocations overrides the time zone per recipient, keyed by lowercase address
+	RecipientLocations map[string]*time.Location
+
+	// MaxRecipients caps the recipients of a single message; larger lists are split into
+	// several sends with the same content (0 for no cap)
+	MaxRecipients int
+
+	// RootCAs verifies SMTP server certificates instead of the system roots when set
+	RootCAs *x509.CertPool
+
+	// Format is the report body format: text, html, or both as a multipart/alternative
+	// message that mail clients show as HTML when they can (empty means text)
+	Format string
+
+	// HTMLTopN is the number of largest balances tabled in the HTML body
+	HTMLTopN int
+
+	// Rounder formats balances in the HTML body
+	Rounder rounding.Rounder
+
+	// QRCode embeds a QR code of the report CSV's SHA-256 in the HTML body, so a printed
+	// report can be checked against the file
+	QRCode bool
+
+	// DryRun renders the reports, and the test email, and logs their subject and recipient
+	// count instead of connecting to any SMTP server
+	DryRun bool
+
+	// TokenMint is the reported token's mint address, available to the templates
+	TokenMint string
+
+	// TokenLabel names the token in the default body, e.g. "USDC token balances"
+	TokenLabel string
+
+	// CC recipients are listed in the Cc header and BCC recipients in no header at all.
+	// Both receive each report once, with the first group of To recipients.
+	CC  []string
+	BCC []string
+
+	// CompressAttachment gzips the report CSV attachment and adds a .gz suffix to its
+	// name, for relays that reject large messages
+	CompressAttachment bool
+
+	// MaxBodyBytes caps the size of the message body, its MIME parts and inline QR code
+	// included but not the attachments. Inline content (the QR code, the HTML top wallets
+	// table and report sections) is cut to fit; the attachments keep the full data (0 for no cap)
+	MaxBodyBytes int
+
+	// StatusURL is a delivery status endpoint polled by VerifyDelivery, for relays with an
+	// HTTP API; it is queried with ?message_id=<id> and returns {"status": "delivered"}
+	StatusURL string
+
+	// footer is appended to the end of every report body
+	footer *template.Template
+
+	// subjectTemplate and bodyTemplate replace the default report subject and body when set
+	subjectTemplate *template.Template
+	bodyTemplate    *template.Template
+
+	// sentMessageIDs are the Message-ID headers of reports sent since TakeMessageIDs
+	sentMessageIDs []string
+	sentLock       sync.Mutex
+
+	// deliveries are the reports accepted by a relay since TakeDeliveries
+	deliveries []Delivery
+}
+
+// Delivery is a report message accepted by an SMTP relay, with the relay's final reply
+type Delivery struct {
+	MessageID  string
+	Recipients []string
+	Server     string
+	Code       int
+	Response   string
+
+	// message is the sent MIME message, kept so it can be resent as is
+	message []byte
+	// deadline bounded the original send and also bounds a resend
+	deadline time.Time
+}
+
+// smtpReply is the reply of the relay that accepted a message
+type smtpReply struct {
+	server   string
+	code     int
+	response string
+}
+
+// FooterData holds the values available to the email footer template
+type FooterData struct {
+	Timestamp   string
+	Environment string
+}
+
+// ReportData holds the values available to the report subject and body templates
+type ReportData struct {
+	Date           string // Day of the report window, e.g. 2 January 2006
+	StartTime      string // Start of the report window, e.g. 14:00
+	EndTime        string // End of the report window, e.g. 15:00
+	Zone           string // Time zone of the window, e.g. UTC
+	TotalAddresses int
+	SuccessCount   int
+	FailedCount    int
+	TokenMint      string
+	GeneratedAt    string // Exact send time with zone
+	Partial        string // Reason the report is partial, empty when complete
+	Sections       string // Additional report sections as text
+	Version        string
+	Environment    string
+}
+
+// TestEmailSubject is the fixed subject of messages sent by SendTestEmail
+const TestEmailSubject = "Solana Balance Reporter test email"
+
+// Section is an additional titled block of lines rendered in the report body
+type Section struct {
+	Title string
+	Lines []string
+}
+
+// Report is a CSV report and the balances it was written from
+type Report struct {
+	CSVPath    string     // Read when Attachment is empty
+	Attachment Attachment // The CSV already in memory
+	Balances   []*solana.TokenBalance
+	Sections   []Section
+	Options    SendOptions
+}
+
+// SendOptions are the settings of a single report send. They travel with the report
+// rather than living on the Mailer, so concurrent sends never see each other's.
+type SendOptions struct {
+	// RequestID is sent as the X-Request-ID header to correlate emails with logs
+	RequestID string
+
+	// Partial marks the report as partial, explaining why in the body, when non-empty
+	Partial string
+
+	// ExtraAttachments are files attached after the main CSV, such as reports deferred
+	// during quiet hours or a JSON summary
+	ExtraAttachments []Attachment
+
+	// Deadline bounds sending, including retries, when non-zero
+	Deadline time.Time
+}
+
+// headers returns the additional headers of the send's messages
+func (o SendOptions) headers() []string {
+	if o.RequestID == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf("X-Request-ID: %s", o.RequestID)}
+}
+
+// Attachment is a file attached to a report email
+type Attachment struct {
+	Filename string
+	Content  []byte
+}
+
+// contentType derives the MIME type from the filename, defaulting to CSV
+func (a Attachment) contentType() string {
+	if strings.HasSuffix(a.Filename, ".gz") {
+		return "application/gzip"
+	}
+	if strings.HasSuffix(a.Filename, ".json") {
+		return "application/json"
+	}
+	if strings.HasSuffix(a.Filename, ".png") {
+		return "image/png"
+	}
+	return "text/csv"
+}
+
+// New creates a new Mailer. Relays are tried in the given order until one accepts the message.
+func New(smtpServers []SMTPServer, emailFrom string, emailTo []string, maxRetries int, logger *logger.Logger) *Mailer {
 	return &Mailer{
-		smtpServer:   smtpServer,
-		smtpPort:     smtpPort,
-		smtpUsername: smtpUsername,
-		smtpPassword: smtpPassword,
-		emailFrom:    emailFrom,
-		emailTo:      emailTo,
-		logger:       logger,
-		maxRetries:   maxRetries,
-		retryDelay:   500 * time.Millisecond,
+		smtpServers: smtpServers,
+		emailFrom:   emailFrom,
+		emailTo:     emailTo,
+		logger:      logger,
+		maxRetries:  maxRetries,
+		retryDelay:  500 * time.Millisecond,
 	}
 }
 
-// SendReport sends an email with the CSV report attached
-func (m *Mailer) SendReport(csvFilePath string, balances []*solana.TokenBalance) error {
-	if len(m.emailTo) == 0 {
-		return fmt.Errorf("no recipients configured")
+// SetRecipients replaces the recipient list used for following sends
+func (m *Mailer) SetRecipients(emailTo []string) {
+	m.emailTo = emailTo
+}
+
+// SetFooter parses the footer template appended to every report body.
+// The template can use {{.Timestamp}} and {{.Environment}}; an empty text disables the footer.
+func (m *Mailer) SetFooter(text string) error {
+	if text == "" {
+		m.footer = nil
+		return nil
+	}
+
+	footer, err := template.New("footer").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid email footer template: %w", err)
+	}
+	m.footer = footer
+	return nil
+}
+
+// SetSubjectTemplate parses a text/template replacing the default report subject; an empty
+// text restores the default. The template is tried against empty ReportData so a bad
+// field reference fails here rather than at send time.
+func (m *Mailer) SetSubjectTemplate(text string) error {
+	subject, err := parseReportTemplate("subject", text)
+	if err != nil {
+		return err
+	}
+	m.subjectTemplate = subject
+	return nil
+}
+
+// SetBodyTemplate parses a text/template replacing the default plain text report body,
+// checked like SetSubjectTemplate; an empty text restores the default. The banner notice
+// and footer are still added around it.
+func (m *Mailer) SetBodyTemplate(text string) error {
+	body, err := parseReportTemplate("body", text)
+	if err != nil {
+		return err
+	}
+	m.bodyTemplate = body
+	return nil
+}
+
+// parseReportTemplate parses and trial-renders a report template, returning nil for an empty text
+func parseReportTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email %s template: %w", name, err)
+	}
+	if err := tmpl.Execute(io.Discard, ReportData{}); err != nil {
+		return nil, fmt.Errorf("invalid email %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// renderReportTemplate executes a report template
+func renderReportTemplate(tmpl *template.Template, data ReportData) (string, error) {
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render email %s: %w", tmpl.Name(), err)
+	}
+	return out.String(), nil
+}
+
+// renderFooter executes the footer template, returning an empty string when unset
+func (m *Mailer) renderFooter(timestamp string) (string, error) {
+	if m.footer == nil {
+		return "", nil
+	}
+
+	var footer strings.Builder
+	err := m.footer.Execute(&footer, FooterData{
+		Timestamp:   timestamp,
+		Environment: m.Environment,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render email footer: %w", err)
+	}
+	return "\n" + footer.String() + "\n", nil
+}
+
+// ErrDeadline is returned when the send deadline passes before a report could be sent
+var ErrDeadline = errors.New("email send deadline exceeded")
+
+// dial connects to an SMTP server, applying the send deadline to the connection
+func (m *Mailer) dial(addr string, tlsConfig *tls.Config, deadline time.Time) (net.Conn, error) {
+	dialer := &net.Dialer{Deadline: deadline}
+
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
 	}
 
+	if !deadline.IsZero() {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// newMessageID generates a unique Message-ID header value in the sender's domain
+func newMessageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimSuffix(from[at+1:], ">")
+	}
+
+	var id [12]byte
+	rand.Read(id[:])
+	return fmt.Sprintf("<%d.%x@%s>", time.Now().UnixNano(), id, domain)
+}
+
+// TakeMessageIDs returns the Message-IDs of the reports sent since the last call and resets them
+func (m *Mailer) TakeMessageIDs() []string {
+	m.sentLock.Lock()
+	defer m.sentLock.Unlock()
+
+	ids := m.sentMessageIDs
+	m.sentMessageIDs = nil
+	return ids
+}
+
+// TakeDeliveries returns the reports accepted by a relay since the last call and resets them
+func (m *Mailer) TakeDeliveries() []Delivery {
+	m.sentLock.Lock()
+	defer m.sentLock.Unlock()
+
+	deliveries := m.deliveries
+	m.deliveries = nil
+	return deliveries
+}
+
+// recipientGroup is a set of recipients that receive the report rendered in the same time zone
+type recipientGroup struct {
+	location   *time.Location
+	recipients []string
+	cc         []string
+	bcc        []string
+}
+
+// envelope returns every recipient of the group's message, including blind copies
+func (g recipientGroup) envelope() []string {
+	envelope := append([]string{}, g.recipients...)
+	envelope = append(envelope, g.cc...)
+	return append(envelope, g.bcc...)
+}
+
+// headers returns the group's Cc header, if any; blind copies are never listed
+func (g recipientGroup) headers() []string {
+	if len(g.cc) == 0 {
+		return nil
+	}
+	return []string{"Cc: " + strings.Join(g.cc, ", ")}
+}
+
+// hasRecipients reports whether any To, CC or BCC recipient is configured
+func (m *Mailer) hasRecipients() bool {
+	return len(m.emailTo)+len(m.CC)+len(m.BCC) > 0
+}
+
+// withCopies adds the CC and BCC recipients to the first group, or to a group of their
+// own in location when there are no To recipients
+func (m *Mailer) withCopies(groups []recipientGroup, location *time.Location) []recipientGroup {
+	if len(m.CC) == 0 && len(m.BCC) == 0 {
+		return groups
+	}
+	if len(groups) == 0 {
+		groups = append(groups, recipientGroup{location: location})
+	}
+	groups[0].cc = m.CC
+	groups[0].bcc = m.BCC
+	return groups
+}
+
+// recipientGroups splits the recipients by their configured time zone, preserving order,
+// and splits each zone further so no group exceeds MaxRecipients
+func (m *Mailer) recipientGroups() []recipientGroup {
+	defaultLocation := m.DefaultLocation
+	if defaultLocation == nil {
+		defaultLocation = time.UTC
+	}
+
+	var groups []recipientGroup
+	index := make(map[string]int)
+	for _, recipient := range m.emailTo {
+		location := defaultLocation
+		if loc, ok := m.RecipientLocations[strings.ToLower(recipient)]; ok {
+			location = loc
+		}
+
+		key := location.String()
+		if i, ok := index[key]; ok {
+			groups[i].recipients = append(groups[i].recipients, recipient)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, recipientGroup{location: location, recipients: []string{recipient}})
+	}
+
+	var capped []recipientGroup
+	for _, group := range groups {
+		for _, recipients := range m.recipientBatches(group.recipients) {
+			capped = append(capped, recipientGroup{location: group.location, recipients: recipients})
+		}
+	}
+	return m.withCopies(capped, defaultLocation)
+}
+
+// recipientBatches splits recipients into consecutive batches of at most MaxRecipients
+func (m *Mailer) recipientBatches(recipients []string) [][]string {
+	if m.MaxRecipients <= 0 || len(recipients) <= m.MaxRecipients {
+		return [][]string{recipients}
+	}
+
+	var batches [][]string
+	for start := 0; start < len(recipients); start += m.MaxRecipients {
+		end := start + m.MaxRecipients
+		if end > len(recipients) {
+			end = len(recipients)
+		}
+		batches = append(batches, recipients[start:end])
+	}
+	return batches
+}
+
+// zoneLabel names a time zone for display, e.g. "UTC" or "CET"
+func zoneLabel(t time.Time) string {
+	if t.Location() == time.UTC {
+		return "UTC"
+	}
+	return t.Format("MST")
+}
+
+// SendReport sends an email with the CSV report attached, followed by any extra sections.
+// Recipients with a configured time zone get the report window rendered in that zone.
+func (m *Mailer) SendReport(csvFilePath string, balances []*solana.TokenBalance, opts SendOptions, sections ...Section) error {
+	return m.SendReports([]Report{{CSVPath: csvFilePath, Balances: balances, Sections: sections, Options: opts}})[0]
+}
+
+// SendReportAttachment sends a report whose CSV is already in memory.
+// The report window is taken from the attachment's balance_<timestamp>.csv filename.
+func (m *Mailer) SendReportAttachment(report Attachment, balances []*solana.TokenBalance, opts SendOptions, sections ...Section) error {
+	return m.SendReports([]Report{{Attachment: report, Balances: balances, Sections: sections, Options: opts}})[0]
+}
+
+// reportMessage is a report email rendered for one recipient group
+type reportMessage struct {
+	subject   string
+	messageID string
+	envelope  []string
+	content   []byte
+}
+
+// renderReport renders a report's email for each of its recipient groups
+func (m *Mailer) renderReport(r Report) ([]reportMessage, error) {
+	if !m.hasRecipients() {
+		return nil, fmt.Errorf("no recipients configured")
+	}
+	if len(m.smtpServers) == 0 && !m.DryRun {
+		return nil, fmt.Errorf("no SMTP servers configured")
+	}
+
+	report := r.Attachment
+	if report.Filename == "" {
+		csvContent, err := readFile(r.CSVPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV file: %w", err)
+		}
+		report = Attachment{Filename: filepath.Base(r.CSVPath), Content: csvContent}
+	}
+	balances, sections, opts := r.Balances, r.Sections, r.Options
+
 	m.logger.Log(fmt.Sprintf("Preparing to send email report with attachment %s to %d recipients",
-		csvFilePath, len(m.emailTo)))
+		report.Filename, len(m.emailTo)+len(m.CC)+len(m.BCC)))
 
 	// Get current exact timestamp
 	now := time.Now().UTC()
-	exactTimestamp := now.Format("2006-01-02 15:04:05 UTC")
 
 	// Extract the time information from the filename
-	filename := filepath.Base(csvFilePath)
-	timeStr := strings.TrimPrefix(strings.TrimSuffix(filename, ".csv"), "balance_")
+	filename := report.Filename
+	timeStr := strings.TrimPrefix(strings.TrimSuffix(strings.TrimSuffix(filename, ".gz"), ".csv"), "balance_")
 	t, err := time.Parse("2006-01-02_15_04_05", timeStr)
 	if err != nil {
 		// Try the old format if new format fails
 		t, err = time.Parse("2006-01-02_15", timeStr)
 		if err != nil {
-			return fmt.Errorf("failed to parse time from filename: %w", err)
+			// A renamed file should not block the report; date it by the send time instead
+			m.logger.Warn(fmt.Sprintf("cannot parse report time from filename %s, using the current time", filename))
+			t = now
 		}
 	}
 
-	// Create formatted time strings for the email
-	dateStr := t.Format("2 January 2006")
-	hourStr := t.Format("15:00")
-	nextHourStr := t.Add(time.Hour).Format("15:00")
-
 	// Count successful and failed fetches
 	totalAddresses := len(balances)
 	successCount := 0
@@ -86,56 +561,291 @@ func (m *Mailer) SendReport(csvFilePath string, balances []*solana.TokenBalance)
 		}
 	}
 
-	// Format subject and body
-	subject := fmt.Sprintf("Token Balance Report for %s, %s - %s UTC", dateStr, hourStr, nextHourStr)
-	body := fmt.Sprintf(`Hello,
+	// Hash the CSV as written, before any compression of the attachment
+	var reportHash string
+	var images []Attachment
+	if m.QRCode && (m.Format == "html" || m.Format == "both") {
+		hash, image, err := reportHashQR(report.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create report hash QR code: %w", err)
+		}
+		reportHash = hash
+		images = append(images, image)
+	}
+
+	if m.CompressAttachment && !strings.HasSuffix(report.Filename, ".gz") {
+		compressed, err := gzipBytes(report.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress CSV attachment: %w", err)
+		}
+		m.logger.Log(fmt.Sprintf("Compressed CSV attachment from %d to %d bytes", len(report.Content), len(compressed)))
+		report = Attachment{Filename: report.Filename + ".gz", Content: compressed}
+	}
 
-Attached is the token balance report for %s, %s - %s UTC.
+	attachments := append([]Attachment{report}, opts.ExtraAttachments...)
+
+	bannerNotice := ""
+	if m.Banner != "" {
+		bannerNotice = fmt.Sprintf("*** %s REPORT - NOT PRODUCTION DATA ***\n\n", m.Banner)
+	}
+	partialNotice := ""
+	if opts.Partial != "" {
+		partialNotice = fmt.Sprintf("\nPARTIAL REPORT: %s\n", opts.Partial)
+	}
+	sectionsText := renderSections(sections)
+	tokenLabel := ""
+	if m.TokenLabel != "" {
+		tokenLabel = m.TokenLabel + " "
+	}
+	versionLine := ""
+	if m.BuildVersion != "" {
+		versionLine = fmt.Sprintf("Reporter version: %s\n", m.BuildVersion)
+	}
 
-This report contains wallet addresses and their JINGLE token balances.
+	var messages []reportMessage
+	for _, group := range m.recipientGroups() {
+		// Create formatted time strings for the email in the group's time zone
+		start := t.Truncate(time.Hour).In(group.location)
+		zone := zoneLabel(start)
+		dateStr := start.Format("2 January 2006")
+		hourStr := start.Format("15:04")
+		nextHourStr := start.Add(time.Hour).Format("15:04")
+		exactTimestamp := now.In(group.location).Format("2006-01-02 15:04:05 ") + zoneLabel(now.In(group.location))
+
+		footer, err := m.renderFooter(exactTimestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		data := ReportData{
+			Date:           dateStr,
+			StartTime:      hourStr,
+			EndTime:        nextHourStr,
+			Zone:           zone,
+			TotalAddresses: totalAddresses,
+			SuccessCount:   successCount,
+			FailedCount:    failedCount,
+			TokenMint:      m.TokenMint,
+			GeneratedAt:    exactTimestamp,
+			Partial:        opts.Partial,
+			Sections:       sectionsText,
+			Version:        m.BuildVersion,
+			Environment:    m.Environment,
+		}
+
+		// Format subject and body
+		subject := fmt.Sprintf("Token Balance Report for %s, %s - %s %s", dateStr, hourStr, nextHourStr, zone)
+		if m.subjectTemplate != nil {
+			subject, err = renderReportTemplate(m.subjectTemplate, data)
+			if err != nil {
+				return nil, err
+			}
+			// A header must stay on one line
+			subject = strings.Join(strings.Fields(subject), " ")
+		}
+		if opts.Partial != "" {
+			subject = "[PARTIAL] " + subject
+		}
+		if m.Banner != "" {
+			subject = fmt.Sprintf("[%s] %s", m.Banner, subject)
+		}
+		// Render the message with the given inline content, so it can be cut to fit; the
+		// body is measured on its own by rendering it without the attachments
+		messageID := newMessageID(m.emailFrom)
+		render := func(inline inlineContent, attached []Attachment) ([]byte, error) {
+			body := fmt.Sprintf(`%sHello,
+
+Attached is the token balance report for %s, %s - %s %s.
+%s
+This report contains wallet addresses and their %stoken balances.
 
 Summary:
 - Total addresses processed: %d
 - Successfully fetched: %d
 - Failed to fetch: %d
 - Failed addresses are marked as "N/A" in the balance column
-
+%s
 This report was generated at exactly: %s
 
 Best regards,
 Solana Balance Reporter
-`, dateStr, hourStr, nextHourStr, totalAddresses, successCount, failedCount, exactTimestamp)
+%s%s`, bannerNotice, dateStr, hourStr, nextHourStr, zone, partialNotice, tokenLabel, totalAddresses, successCount, failedCount, renderSections(inline.sections), exactTimestamp, versionLine, footer)
+			if m.bodyTemplate != nil {
+				data := data
+				data.Sections = renderSections(inline.sections)
+				custom, err := renderReportTemplate(m.bodyTemplate, data)
+				if err != nil {
+					return nil, err
+				}
+				body = bannerNotice + custom + footer
+			}
+
+			// Render the HTML alternative with a table of the largest balances
+			htmlBody := ""
+			if m.Format == "html" || m.Format == "both" {
+				var err error
+				htmlBody, err = renderHTML(htmlReport{
+					Banner:      m.Banner,
+					Window:      fmt.Sprintf("%s, %s - %s %s", dateStr, hourStr, nextHourStr, zone),
+					Partial:     opts.Partial,
+					Total:       totalAddresses,
+					Success:     successCount,
+					Failed:      failedCount,
+					Sections:    inline.sections,
+					ReportHash:  reportHash,
+					QRCode:      len(inline.images) > 0,
+					GeneratedAt: exactTimestamp,
+					Version:     m.BuildVersion,
+					Footer:      strings.TrimSpace(footer),
+				}, balances, inline.topN, m.Rounder)
+				if err != nil {
+					return nil, fmt.Errorf("failed to render HTML report: %w", err)
+				}
+				if m.Format == "html" {
+					body = ""
+				}
+			}
+
+			// Create the MIME message with attachment
+			return createMimeMessage(
+				m.emailFrom,
+				group.recipients,
+				subject,
+				body,
+				htmlBody,
+				inline.images,
+				attached,
+				"solanaReportBoundary",
+				append(append(opts.headers(), group.headers()...), "Message-ID: "+messageID),
+			), nil
+		}
+
+		inline := inlineContent{sections: sections, topN: m.HTMLTopN, images: images}
+		if m.MaxBodyBytes > 0 {
+			bodyBytes, err := render(inline, nil)
+			if err != nil {
+				return nil, err
+			}
+			if len(bodyBytes) > m.MaxBodyBytes {
+				inline = m.fitBody(func(inline inlineContent) ([]byte, error) { return render(inline, nil) }, inline)
+			}
+		}
+		mimeMsgBytes, err := render(inline, attachments)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, reportMessage{
+			subject:   subject,
+			messageID: messageID,
+			envelope:  group.envelope(),
+			content:   mimeMsgBytes,
+		})
+	}
+
+	return messages, nil
+}
 
-	// Read the CSV file content
-	csvContent, err := readFile(csvFilePath)
+// sendMessage sends a rendered report email with retries and records its delivery
+func (m *Mailer) sendMessage(message reportMessage, deadline time.Time) error {
+	if m.DryRun {
+		m.logger.Log(fmt.Sprintf("dry run: would send %q to %d recipients", message.subject, len(message.envelope)))
+		return nil
+	}
+
+	reply, err := m.sendWithRetries(message.envelope, message.content, deadline)
 	if err != nil {
-		return fmt.Errorf("failed to read CSV file: %w", err)
-	}
-
-	// Create the MIME message with attachment
-	boundary := "solanaReportBoundary"
-	mimeMsgBytes := createMimeMessage(
-		m.emailFrom,
-		m.emailTo,
-		subject,
-		body,
-		filename,
-		csvContent,
-		boundary,
-	)
-
-	// Attempt to send the email with retries
+		m.logger.LogError(fmt.Sprintf("Failed to send email report to %s", strings.Join(message.envelope, ", ")), err)
+		return err
+	}
+
+	m.sentLock.Lock()
+	m.sentMessageIDs = append(m.sentMessageIDs, message.messageID)
+	m.deliveries = append(m.deliveries, Delivery{
+		MessageID:  message.messageID,
+		Recipients: message.envelope,
+		Server:     reply.server,
+		Code:       reply.code,
+		Response:   reply.response,
+		message:    message.content,
+		deadline:   deadline,
+	})
+	m.sentLock.Unlock()
+
+	m.logger.Log(fmt.Sprintf("Successfully sent email report to %s", strings.Join(message.envelope, ", ")))
+	return nil
+}
+
+// SendTestEmail sends a short message without attachment to verify SMTP settings end-to-end.
+// With DryRun it only logs what would be sent.
+func (m *Mailer) SendTestEmail() error {
+	if !m.hasRecipients() {
+		return fmt.Errorf("no recipients configured")
+	}
+	if len(m.smtpServers) == 0 && !m.DryRun {
+		return fmt.Errorf("no SMTP servers configured")
+	}
+
+	m.logger.Log(fmt.Sprintf("Sending test email to %d recipients", len(m.emailTo)+len(m.CC)+len(m.BCC)))
+
+	body := fmt.Sprintf(`Hello,
+
+This is a test email from Solana Balance Reporter sent at %s.
+If you received it, the SMTP settings are working.
+
+Best regards,
+Solana Balance Reporter
+`, time.Now().UTC().Format("2006-01-02 15:04:05 UTC"))
+
+	var groups []recipientGroup
+	for _, recipients := range m.recipientBatches(m.emailTo) {
+		if len(recipients) > 0 {
+			groups = append(groups, recipientGroup{location: time.UTC, recipients: recipients})
+		}
+	}
+	for _, group := range m.withCopies(groups, time.UTC) {
+		if m.DryRun {
+			m.logger.Log(fmt.Sprintf("dry run: would send %q to %d recipients", TestEmailSubject, len(group.envelope())))
+			continue
+		}
+		message := createTextMessage(m.emailFrom, group.recipients, TestEmailSubject, body, group.headers())
+		if _, err := m.sendWithRetries(group.envelope(), message, time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	if m.DryRun {
+		return nil
+	}
+	m.logger.Log(fmt.Sprintf("Successfully sent test email to %d recipients", len(m.emailTo)+len(m.CC)+len(m.BCC)))
+	return nil
+}
+
+// sendWithRetries sends a message to the recipients, retrying with exponential backoff
+// until deadline (when non-zero), and returns the reply of the relay that accepted it
+func (m *Mailer) sendWithRetries(recipients []string, mimeMsg []byte, deadline time.Time) (smtpReply, error) {
+	var reply smtpReply
 	var sendErr error
 	for attempt := 0; attempt <= m.maxRetries; attempt++ {
 		if attempt > 0 {
 			// Calculate exponential backoff
 			backoff := time.Duration(math.Pow(2, float64(attempt-1))) * m.retryDelay
+			if !deadline.IsZero() && time.Now().Add(backoff).After(deadline) {
+				return reply, fmt.Errorf("%w after %d attempts: %v", ErrDeadline, attempt, sendErr)
+			}
 			m.logger.Log(fmt.Sprintf("Retrying email send (attempt %d/%d) after %v",
 				attempt, m.maxRetries, backoff))
 			time.Sleep(backoff)
 		}
 
-		sendErr = m.sendEmail(mimeMsgBytes)
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			if sendErr == nil {
+				return reply, ErrDeadline
+			}
+			return reply, fmt.Errorf("%w after %d attempts: %v", ErrDeadline, attempt, sendErr)
+		}
+
+		reply, sendErr = m.sendEmail(recipients, mimeMsg, deadline)
 		if sendErr == nil {
 			break
 		}
@@ -144,93 +854,314 @@ Solana Balance Reporter
 	}
 
 	if sendErr != nil {
-		return fmt.Errorf("failed to send email after %d attempts: %w", m.maxRetries+1, sendErr)
+		return reply, fmt.Errorf("failed to send email after %d attempts: %w", m.maxRetries+1, sendErr)
 	}
+	return reply, nil
+}
 
-	m.logger.Log(fmt.Sprintf("Successfully sent email report to %s", strings.Join(m.emailTo, ", ")))
-	return nil
+// SendReports sends several reports concurrently, with at most Concurrency messages in
+// flight across all reports and their recipient groups. Each send keeps its own retries
+// and options; the returned errors are indexed like reports (nil on success), each the
+// first failure among the report's messages.
+func (m *Mailer) SendReports(reports []Report) []error {
+	limit := m.Concurrency
+	if limit < 1 {
+		limit = 1
+	}
+
+	errs := make([]error, len(reports))
+	rendered := make([][]reportMessage, len(reports))
+	total := 0
+	for i, report := range reports {
+		rendered[i], errs[i] = m.renderReport(report)
+		total += len(rendered[i])
+	}
+
+	if len(reports) > 1 || total > 1 {
+		m.logger.Log(fmt.Sprintf("Sending %d messages for %d reports with email concurrency %d", total, len(reports), limit))
+	}
+
+	// Create a semaphore channel to limit concurrency
+	sem := make(chan struct{}, limit)
+	var errLock sync.Mutex
+	var wg sync.WaitGroup
+
+	for i, messages := range rendered {
+		for _, message := range messages {
+			sem <- struct{}{} // Acquire semaphore
+			wg.Add(1)
+
+			// Continue with the other messages when one fails
+			go func(i int, message reportMessage) {
+				defer wg.Done()
+				defer func() { <-sem }() // Release semaphore
+
+				if err := m.sendMessage(message, reports[i].Options.Deadline); err != nil {
+					errLock.Lock()
+					if errs[i] == nil {
+						errs[i] = err
+					}
+					errLock.Unlock()
+				}
+			}(i, message)
+		}
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// sendEmail sends the email through the configured relays, failing over in order
+func (m *Mailer) sendEmail(recipients []string, mimeMsg []byte, deadline time.Time) (smtpReply, error) {
+	var lastErr error
+	for i, server := range m.smtpServers {
+		if i > 0 {
+			m.logger.Log(fmt.Sprintf("Failing over to SMTP server %s:%d (%d/%d)",
+				server.Host, server.Port, i+1, len(m.smtpServers)))
+		}
+
+		var reply smtpReply
+		reply, lastErr = m.sendViaServer(server, recipients, mimeMsg, deadline)
+		if lastErr == nil {
+			return reply, nil
+		}
+
+		m.logger.LogError(fmt.Sprintf("SMTP server %s:%d failed", server.Host, server.Port), lastErr)
+	}
+
+	return smtpReply{}, lastErr
 }
 
-// sendEmail sends the email using SMTP
-func (m *Mailer) sendEmail(mimeMsg []byte) error {
+// sendViaServer sends the email through a single SMTP relay
+func (m *Mailer) sendViaServer(server SMTPServer, recipients []string, mimeMsg []byte, deadline time.Time) (smtpReply, error) {
 	// Set up TLS config
 	tlsConfig := &tls.Config{
-		ServerName:         m.smtpServer,
+		ServerName:         server.Host,
 		InsecureSkipVerify: false, // Never skip verification in production
 		MinVersion:         tls.VersionTLS12,
+		RootCAs:            m.RootCAs,
 	}
 
 	// Connect to the SMTP server
-	addr := fmt.Sprintf("%s:%d", m.smtpServer, m.smtpPort)
+	addr := fmt.Sprintf("%s:%d", server.Host, server.Port)
 
 	// Try different email sending methods - sometimes AWS SES requires different approaches
-	err := m.sendWithStartTLS(addr, mimeMsg)
+	reply, err := m.sendWithStartTLS(server, addr, tlsConfig, recipients, mimeMsg, deadline)
 	if err != nil {
 		m.logger.LogError("Failed to send using StartTLS, trying direct TLS", err)
-		err = m.sendWithDirectTLS(addr, tlsConfig, mimeMsg)
+		reply, err = m.sendWithDirectTLS(server, addr, tlsConfig, recipients, mimeMsg, deadline)
 	}
+	reply.server = addr
 
-	return err
+	return reply, err
 }
 
 // sendWithStartTLS attempts to send email using SMTP StartTLS
-func (m *Mailer) sendWithStartTLS(addr string, mimeMsg []byte) error {
-	// Set up authentication
-	auth := smtp.PlainAuth("", m.smtpUsername, m.smtpPassword, m.smtpServer)
+func (m *Mailer) sendWithStartTLS(server SMTPServer, addr string, tlsConfig *tls.Config, recipients []string, mimeMsg []byte, deadline time.Time) (smtpReply, error) {
+	conn, err := m.dial(addr, nil, deadline)
+	if err != nil {
+		return smtpReply{}, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer conn.Close()
+
+	client, err := smtp.NewClient(conn, server.Host)
+	if err != nil {
+		return smtpReply{}, fmt.Errorf("failed to create SMTP client: %w", err)
+	}
+	defer client.Close()
 
-	return smtp.SendMail(addr, auth, m.emailFrom, m.emailTo, mimeMsg)
+	// Upgrade the connection using our TLS config so a custom CA bundle applies
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return smtpReply{}, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	return m.deliver(client, server, recipients, mimeMsg)
 }
 
 // sendWithDirectTLS attempts to send email using direct TLS connection
-func (m *Mailer) sendWithDirectTLS(addr string, tlsConfig *tls.Config, mimeMsg []byte) error {
+func (m *Mailer) sendWithDirectTLS(server SMTPServer, addr string, tlsConfig *tls.Config, recipients []string, mimeMsg []byte, deadline time.Time) (smtpReply, error) {
 	// Connect to the SMTP server
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
+	conn, err := m.dial(addr, tlsConfig, deadline)
 	if err != nil {
-		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+		return smtpReply{}, fmt.Errorf("failed to connect to SMTP server: %w", err)
 	}
 	defer conn.Close()
 
-	client, err := smtp.NewClient(conn, m.smtpServer)
+	client, err := smtp.NewClient(conn, server.Host)
 	if err != nil {
-		return fmt.Errorf("failed to create SMTP client: %w", err)
+		return smtpReply{}, fmt.Errorf("failed to create SMTP client: %w", err)
 	}
 	defer client.Close()
 
+	return m.deliver(client, server, recipients, mimeMsg)
+}
+
+// deliver authenticates on a connected SMTP client and sends the message, returning
+// the relay's reply to the message data
+func (m *Mailer) deliver(client *smtp.Client, server SMTPServer, recipients []string, mimeMsg []byte) (smtpReply, error) {
 	// Set up authentication
-	auth := smtp.PlainAuth("", m.smtpUsername, m.smtpPassword, m.smtpServer)
+	auth := smtp.PlainAuth("", server.Username, server.Password, server.Host)
 
 	// Authenticate
-	if err = client.Auth(auth); err != nil {
-		return fmt.Errorf("SMTP authentication failed: %w", err)
+	if err := client.Auth(auth); err != nil {
+		return smtpReply{}, fmt.Errorf("SMTP authentication failed: %w", err)
 	}
 
 	// Set the sender and recipients
-	if err = client.Mail(m.emailFrom); err != nil {
-		return fmt.Errorf("failed to set sender: %w", err)
+	if err := client.Mail(m.emailFrom); err != nil {
+		return smtpReply{}, fmt.Errorf("failed to set sender: %w", err)
 	}
 
-	for _, recipient := range m.emailTo {
-		if err = client.Rcpt(recipient); err != nil {
-			return fmt.Errorf("failed to set recipient %s: %w", recipient, err)
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return smtpReply{}, fmt.Errorf("failed to set recipient %s: %w", recipient, err)
 		}
 	}
 
-	// Send the message
-	w, err := client.Data()
+	// Send the message. DATA is issued by hand rather than with client.Data, which
+	// discards the final reply, so the relay's acceptance (often carrying its queue
+	// id) can be recorded for delivery verification.
+	id, err := client.Text.Cmd("DATA")
 	if err != nil {
-		return fmt.Errorf("failed to start mail data: %w", err)
+		return smtpReply{}, fmt.Errorf("failed to start mail data: %w", err)
 	}
-
-	_, err = w.Write(mimeMsg)
+	client.Text.StartResponse(id)
+	_, _, err = client.Text.ReadResponse(354)
+	client.Text.EndResponse(id)
 	if err != nil {
-		return fmt.Errorf("failed to write mail data: %w", err)
+		return smtpReply{}, fmt.Errorf("failed to start mail data: %w", err)
+	}
+
+	w := client.Text.DotWriter()
+	if _, err = w.Write(mimeMsg); err != nil {
+		return smtpReply{}, fmt.Errorf("failed to write mail data: %w", err)
 	}
 
 	if err = w.Close(); err != nil {
-		return fmt.Errorf("failed to close mail data: %w", err)
+		return smtpReply{}, fmt.Errorf("failed to close mail data: %w", err)
+	}
+
+	code, response, err := client.Text.ReadResponse(250)
+	if err != nil {
+		return smtpReply{}, fmt.Errorf("failed to close mail data: %w", err)
+	}
+
+	return smtpReply{code: code, response: response}, client.Quit()
+}
+
+// renderSections formats extra report sections as plain text, each preceded by a blank line
+func renderSections(sections []Section) string {
+	var text strings.Builder
+	for _, section := range sections {
+		text.WriteString(fmt.Sprintf("\n%s:\n", section.Title))
+		for _, line := range section.Lines {
+			text.WriteString(fmt.Sprintf("- %s\n", line))
+		}
+	}
+	return text.String()
+}
+
+// truncationNotice ends report sections that were cut to fit MaxBodyBytes
+const truncationNotice = "…truncated, see attachment"
+
+// inlineContent is what a report message shows besides its summary: report sections,
+// the rows of the HTML top wallets table and the images of the HTML body
+type inlineContent struct {
+	sections []Section
+	topN     int
+	images   []Attachment
+}
+
+// fitBody returns the inline content that keeps the message body, rendered without the
+// attachments, within MaxBodyBytes. Inline content is given up from the least to the most
+// useful: the QR code image, then rows of the top wallets table, then report section lines,
+// which then end with truncationNotice.
+func (m *Mailer) fitBody(render func(inlineContent) ([]byte, error), full inlineContent) inlineContent {
+	size := func(inline inlineContent) int {
+		body, err := render(inline)
+		if err != nil {
+			return math.MaxInt
+		}
+		return len(body)
+	}
+	fits := func(inline inlineContent) bool {
+		return size(inline) <= m.MaxBodyBytes
+	}
+	total := 0
+	for _, section := range full.sections {
+		total += len(section.Lines)
+	}
+
+	inline := full
+	if !fits(inline) {
+		inline.images = nil
+	}
+	if !fits(inline) && (m.Format == "html" || m.Format == "both") {
+		inline.topN = largestFitting(full.topN, func(n int) bool {
+			trial := inline
+			trial.topN = n
+			return fits(trial)
+		})
+	}
+	keep := total
+	if !fits(inline) {
+		keep = largestFitting(total, func(n int) bool {
+			trial := inline
+			trial.sections = truncateSections(full.sections, n)
+			return fits(trial)
+		})
+		inline.sections = truncateSections(full.sections, keep)
+	}
+
+	if bodySize := size(inline); bodySize > m.MaxBodyBytes {
+		m.logger.Warn(fmt.Sprintf("Report email body is %d bytes, over %d even without inline content", bodySize, m.MaxBodyBytes))
+	} else {
+		m.logger.Warn(fmt.Sprintf("Report email body exceeds %d bytes: kept %d of %d images, %d of %d top wallets and %d of %d report section lines",
+			m.MaxBodyBytes, len(inline.images), len(full.images), inline.topN, full.topN, keep, total))
+	}
+	return inline
+}
+
+// largestFitting returns the largest n up to max for which fits holds, assuming that
+// whatever fits stays fitting with a smaller n; 0 when nothing fits
+func largestFitting(max int, fits func(n int) bool) int {
+	return sort.Search(max, func(n int) bool { return !fits(n + 1) })
+}
+
+// truncateSections keeps the first keep lines of the sections, dropping sections left
+// empty, and appends truncationNotice to the last section kept. With keep covering every
+// line the sections are returned unchanged.
+func truncateSections(sections []Section, keep int) []Section {
+	total := 0
+	for _, section := range sections {
+		total += len(section.Lines)
+	}
+	if keep >= total {
+		return sections
+	}
+
+	var kept []Section
+	for _, section := range sections {
+		if keep <= 0 {
+			break
+		}
+		lines := section.Lines
+		if len(lines) > keep {
+			lines = lines[:keep]
+		}
+		keep -= len(lines)
+		kept = append(kept, Section{Title: section.Title, Lines: lines[:len(lines):len(lines)]})
 	}
 
-	return client.Quit()
+	// With no line kept, the notice goes under the first section's title
+	if len(kept) == 0 {
+		return []Section{{Title: sections[0].Title, Lines: []string{truncationNotice}}}
+	}
+	last := &kept[len(kept)-1]
+	last.Lines = append(last.Lines, truncationNotice)
+	return kept
 }
 
 // readFile reads a file's content
@@ -238,40 +1169,87 @@ func readFile(path string) ([]byte, error) {
 	return os.ReadFile(path)
 }
 
-// createMimeMessage creates a MIME message with an attachment
-func createMimeMessage(from string, to []string, subject, body, filename string, attachment []byte, boundary string) []byte {
+// gzipBytes compresses content with gzip
+func gzipBytes(content []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(content); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// toHeader formats the To header, naming undisclosed recipients when only copies are sent
+func toHeader(to []string) string {
+	if len(to) == 0 {
+		return "undisclosed-recipients:;"
+	}
+	return strings.Join(to, ", ")
+}
+
+// createTextMessage creates a plain text message without attachments
+func createTextMessage(from string, to []string, subject, body string, headers []string) []byte {
 	var message strings.Builder
 
 	// Add headers
 	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
-	message.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(to, ", ")))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", toHeader(to)))
 	message.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	for _, header := range headers {
+		message.WriteString(header + "\r\n")
+	}
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(body)
+
+	return []byte(message.String())
+}
+
+// createMimeMessage creates a MIME message with one or more CSV attachments. Images are
+// shown inline in the HTML body, which refers to them as cid:<filename>.
+func createMimeMessage(from string, to []string, subject, body, htmlBody string, images, attachments []Attachment, boundary string, headers []string) []byte {
+	var message strings.Builder
+
+	// Add headers
+	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", toHeader(to)))
+	message.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	for _, header := range headers {
+		message.WriteString(header + "\r\n")
+	}
 	message.WriteString(fmt.Sprintf("MIME-Version: 1.0\r\n"))
 	message.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%s\r\n\r\n", boundary))
 
-	// Add text part
+	// Add the body: plain text, HTML, or both as alternatives of one part
 	message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
-	message.WriteString(body)
+	switch {
+	case htmlBody == "":
+		message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		message.WriteString(body)
+	case body == "":
+		writeHTMLPart(&message, htmlBody, images, boundary)
+	default:
+		altBoundary := boundary + "Alt"
+		message.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=%s\r\n\r\n", altBoundary))
+		message.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
+		message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		message.WriteString(body)
+		message.WriteString(fmt.Sprintf("\r\n--%s\r\n", altBoundary))
+		writeHTMLPart(&message, htmlBody, images, boundary)
+		message.WriteString(fmt.Sprintf("\r\n--%s--", altBoundary))
+	}
 	message.WriteString("\r\n\r\n")
 
-	// Add attachment part
-	message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-	message.WriteString(fmt.Sprintf("Content-Type: text/csv; name=\"%s\"\r\n", filename))
-	message.WriteString("Content-Transfer-Encoding: base64\r\n")
-	message.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n\r\n", filename))
-
-	// Encode attachment as base64
-	encodedAttachment := base64.StdEncoding.EncodeToString(attachment)
-
-	// Add attachment content in chunks of 76 characters
-	chunkSize := 76
-	for i := 0; i < len(encodedAttachment); i += chunkSize {
-		end := i + chunkSize
-		if end > len(encodedAttachment) {
-			end = len(encodedAttachment)
-		}
-		message.WriteString(encodedAttachment[i:end] + "\r\n")
+	for _, file := range attachments {
+		// Add attachment part
+		message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+		message.WriteString(fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", file.contentType(), file.Filename))
+		message.WriteString("Content-Transfer-Encoding: base64\r\n")
+		message.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n\r\n", file.Filename))
+		writeBase64(&message, file.Content)
 	}
 
 	// Add closing boundary
@@ -279,3 +1257,42 @@ func createMimeMessage(from string, to []string, subject, body, filename string,
 
 	return []byte(message.String())
 }
+
+// writeHTMLPart writes the HTML body part, wrapped with its inline images in a
+// multipart/related part when there are any
+func writeHTMLPart(message *strings.Builder, htmlBody string, images []Attachment, boundary string) {
+	if len(images) == 0 {
+		message.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+		message.WriteString(htmlBody)
+		return
+	}
+
+	relBoundary := boundary + "Rel"
+	message.WriteString(fmt.Sprintf("Content-Type: multipart/related; boundary=%s\r\n\r\n", relBoundary))
+	message.WriteString(fmt.Sprintf("--%s\r\n", relBoundary))
+	message.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	message.WriteString(htmlBody)
+	for _, image := range images {
+		message.WriteString(fmt.Sprintf("\r\n--%s\r\n", relBoundary))
+		message.WriteString(fmt.Sprintf("Content-Type: %s\r\n", image.contentType()))
+		message.WriteString("Content-Transfer-Encoding: base64\r\n")
+		message.WriteString(fmt.Sprintf("Content-ID: <%s>\r\n", image.Filename))
+		message.WriteString(fmt.Sprintf("Content-Disposition: inline; filename=\"%s\"\r\n\r\n", image.Filename))
+		writeBase64(message, image.Content)
+	}
+	message.WriteString(fmt.Sprintf("\r\n--%s--", relBoundary))
+}
+
+// writeBase64 writes content base64-encoded in lines of 76 characters
+func writeBase64(message *strings.Builder, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+
+	chunkSize := 76
+	for i := 0; i < len(encoded); i += chunkSize {
+		end := i + chunkSize
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		message.WriteString(encoded[i:end] + "\r\n")
+	}
+}
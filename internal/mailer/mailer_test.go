@@ -0,0 +1,974 @@
+package mailer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/csvwriter"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// sendTestReport sends the test report to one recipient through a fake relay and
+// returns the message the relay accepted
+func sendTestReport(t *testing.T, configure func(m *Mailer), sections ...Section) string {
+	t.Helper()
+	relay := newFakeSMTP(t)
+	m := testMailer(t, []string{"ops@example.com"}, relay.server)
+	if configure != nil {
+		configure(m)
+	}
+	if err := m.SendReportAttachment(testReport(), nil, SendOptions{}, sections...); err != nil {
+		t.Fatalf("SendReportAttachment: %v", err)
+	}
+	messages := relay.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("relay accepted %d messages, want 1", len(messages))
+	}
+	return messages[0].Data
+}
+
+// textBody returns the plain text body of a message accepted by a fake relay
+func textBody(message string) string {
+	_, body, _ := strings.Cut(message, "Content-Type: text/plain; charset=utf-8\n\n")
+	body, _, _ = strings.Cut(body, "\n--solanaReportBoundary")
+	return strings.TrimRight(body, "\n")
+}
+
+func TestRelayFailover(t *testing.T) {
+	tests := []struct {
+		name        string
+		rejectFirst bool
+		downFirst   bool
+		rejectBoth  bool
+		wantErr     bool
+	}{
+		{name: "first relay rejects all mail", rejectFirst: true},
+		{name: "first relay is unreachable", downFirst: true},
+		{name: "every relay rejects", rejectFirst: true, rejectBoth: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second := newFakeSMTP(t), newFakeSMTP(t)
+			first.reject = tt.rejectFirst
+			second.reject = tt.rejectBoth
+			firstServer := first.server
+			if tt.downFirst {
+				firstServer = unusedServer(t)
+			}
+
+			m := testMailer(t, []string{"ops@example.com"}, firstServer, second.server)
+			err := m.SendReportAttachment(testReport(), nil, SendOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendReportAttachment error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(first.Messages()) != 0 {
+				t.Errorf("first relay accepted %d messages, want none", len(first.Messages()))
+			}
+			if tt.wantErr {
+				return
+			}
+
+			messages := second.Messages()
+			if len(messages) != 1 || messages[0].Recipients[0] != "ops@example.com" {
+				t.Fatalf("second relay accepted %+v, want one message to ops@example.com", messages)
+			}
+			deliveries := m.TakeDeliveries()
+			if len(deliveries) != 1 || deliveries[0].Server != second.String() {
+				t.Errorf("deliveries = %+v, want one via %s", deliveries, second)
+			}
+		})
+	}
+}
+
+func TestVersionInBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    bool
+	}{
+		{name: "version set", version: "v1.4.0 (abc1234)", want: true},
+		{name: "version unset"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := sendTestReport(t, func(m *Mailer) { m.BuildVersion = tt.version })
+			got := strings.Contains(message, "Reporter version: ")
+			if got != tt.want {
+				t.Errorf("body has a version line = %v, want %v:\n%s", got, tt.want, message)
+			}
+			if tt.want && !strings.Contains(message, "Reporter version: "+tt.version+"\n") {
+				t.Errorf("body does not show version %q:\n%s", tt.version, message)
+			}
+		})
+	}
+}
+
+func TestReportTimeFromFilename(t *testing.T) {
+	// Subject of a report dated by the start of its hour
+	subjectAt := func(at time.Time) string {
+		start := at.UTC().Truncate(time.Hour)
+		return fmt.Sprintf("Token Balance Report for %s, %s - %s",
+			start.Format("2 January 2006"), start.Format("15:04"), start.Add(time.Hour).Format("15:04"))
+	}
+	reportTime := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		filename string
+		wantNow  bool // Dated by the send time rather than the filename
+	}{
+		{filename: "balance_2026-03-01_14_00_00.csv"},
+		{filename: "balance_2026-03-01_14.csv"},
+		{filename: "balance_2026-03-01_14_00_00.csv.gz"},
+		{filename: "balances-renamed-by-hand.csv", wantNow: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			relay := newFakeSMTP(t)
+			m := testMailer(t, []string{"ops@example.com"}, relay.server)
+
+			before := time.Now()
+			report := testReport()
+			report.Filename = tt.filename
+			if err := m.SendReportAttachment(report, nil, SendOptions{}); err != nil {
+				t.Fatalf("SendReportAttachment: %v", err)
+			}
+			after := time.Now()
+
+			messages := relay.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("relay accepted %d messages, want 1", len(messages))
+			}
+			subject := headerValue(messages[0].Data, "Subject")
+			want := []string{subjectAt(reportTime)}
+			if tt.wantNow {
+				want = []string{subjectAt(before), subjectAt(after)}
+			}
+			if !strings.HasPrefix(subject, want[0]) && !strings.HasPrefix(subject, want[len(want)-1]) {
+				t.Errorf("Subject = %q, want %q", subject, want[0])
+			}
+		})
+	}
+}
+
+func TestReportTemplates(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "a", Balance: 1},
+		{WalletAddress: "b", FetchError: errors.New("rpc timeout")},
+	}
+
+	tests := []struct {
+		name        string
+		subject     string
+		body        string
+		wantErr     bool
+		wantSubject string
+		wantBody    string
+	}{
+		{
+			name:        "defaults",
+			wantSubject: "Token Balance Report for 1 March 2026, 14:00 - 15:00 UTC",
+			wantBody:    "Successfully fetched: 1",
+		},
+		{
+			name:        "custom",
+			subject:     "{{.TokenMint}}: {{.SuccessCount}}/{{.TotalAddresses}} on {{.Date}}",
+			body:        "{{.FailedCount}} failed between {{.StartTime}} and {{.EndTime}} {{.Zone}}",
+			wantSubject: "JiNGLE: 1/2 on 1 March 2026",
+			wantBody:    "1 failed between 14:00 and 15:00 UTC",
+		},
+		{name: "unknown field", subject: "{{.Mint}}", wantErr: true},
+		{name: "bad syntax", body: "{{if .FailedCount}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newFakeSMTP(t)
+			m := testMailer(t, []string{"ops@example.com"}, relay.server)
+			m.TokenMint = "JiNGLE"
+
+			// A bad template fails when it is set, at startup, not when a report is sent
+			subjectErr, bodyErr := m.SetSubjectTemplate(tt.subject), m.SetBodyTemplate(tt.body)
+			if (subjectErr != nil || bodyErr != nil) != tt.wantErr {
+				t.Fatalf("setting templates = %v, %v; want error %v", subjectErr, bodyErr, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if err := m.SendReportAttachment(testReport(), balances, SendOptions{}); err != nil {
+				t.Fatalf("SendReportAttachment: %v", err)
+			}
+			messages := relay.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("relay accepted %d messages, want 1", len(messages))
+			}
+			if got := headerValue(messages[0].Data, "Subject"); got != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", got, tt.wantSubject)
+			}
+			if body := textBody(messages[0].Data); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body missing %q:\n%s", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestSendReportsConcurrency(t *testing.T) {
+	tests := []struct {
+		name          string
+		reports       int
+		recipients    []string
+		maxRecipients int
+		wantMessages  int
+	}{
+		{name: "several reports", reports: 6, recipients: []string{"ops@example.com"}, wantMessages: 6},
+		{
+			name:          "one report split into recipient groups",
+			reports:       1,
+			recipients:    []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"},
+			maxRecipients: 1,
+			wantMessages:  4,
+		},
+	}
+
+	const concurrency = 2
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newFakeSMTP(t)
+			relay.delay = 30 * time.Millisecond
+			m := testMailer(t, tt.recipients, relay.server)
+			m.Concurrency = concurrency
+			m.MaxRecipients = tt.maxRecipients
+
+			// Every report has its own options, which must not leak into the others
+			reports := make([]Report, tt.reports)
+			for i := range reports {
+				reports[i] = Report{
+					Attachment: testReport(),
+					Options: SendOptions{
+						RequestID:        fmt.Sprintf("req-%d", i),
+						ExtraAttachments: []Attachment{{Filename: fmt.Sprintf("extra-%d.json", i), Content: []byte("{}")}},
+					},
+				}
+				if i%2 == 1 {
+					reports[i].Options.Partial = "the cycle reached RUN_BUDGET"
+				}
+			}
+
+			for i, err := range m.SendReports(reports) {
+				if err != nil {
+					t.Errorf("report %d: %v", i, err)
+				}
+			}
+
+			messages := relay.Messages()
+			if len(messages) != tt.wantMessages {
+				t.Fatalf("relay accepted %d messages, want %d", len(messages), tt.wantMessages)
+			}
+			if got := relay.MaxActive(); got > concurrency {
+				t.Errorf("%d messages were in flight at once, want at most %d", got, concurrency)
+			}
+			if got := relay.MaxActive(); got < 2 {
+				t.Errorf("at most %d message was in flight, want concurrent sends", got)
+			}
+
+			for _, message := range messages {
+				var i int
+				if _, err := fmt.Sscanf(headerValue(message.Data, "X-Request-ID"), "req-%d", &i); err != nil {
+					t.Fatalf("message without a request id: %v", err)
+				}
+				partial := strings.HasPrefix(headerValue(message.Data, "Subject"), "[PARTIAL]")
+				if partial != (i%2 == 1) {
+					t.Errorf("report %d has a partial subject = %v", i, partial)
+				}
+				for j := range reports {
+					attached := strings.Contains(message.Data, fmt.Sprintf(`filename="extra-%d.json"`, j))
+					if attached != (i == j) {
+						t.Errorf("report %d has extra-%d.json attached = %v", i, j, attached)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCopyRecipients(t *testing.T) {
+	tests := []struct {
+		name    string
+		to      []string
+		cc      []string
+		bcc     []string
+		wantCc  string
+		wantErr bool
+	}{
+		{name: "to, copy and blind copy", to: []string{"ops@example.com"}, cc: []string{"finance@example.com", "cfo@example.com"}, bcc: []string{"audit@example.com"}, wantCc: "finance@example.com, cfo@example.com"},
+		{name: "blind copy only", bcc: []string{"audit@example.com"}},
+		{name: "no recipients", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newFakeSMTP(t)
+			m := testMailer(t, tt.to, relay.server)
+			m.CC = tt.cc
+			m.BCC = tt.bcc
+
+			err := m.SendReportAttachment(testReport(), nil, SendOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendReportAttachment error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(relay.Messages()) != 0 {
+					t.Error("a message without recipients reached the relay")
+				}
+				return
+			}
+
+			messages := relay.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("relay accepted %d messages, want 1", len(messages))
+			}
+			message := messages[0]
+			want := append(append(append([]string{}, tt.to...), tt.cc...), tt.bcc...)
+			if strings.Join(message.Recipients, ",") != strings.Join(want, ",") {
+				t.Errorf("envelope = %v, want %v", message.Recipients, want)
+			}
+			if got := headerValue(message.Data, "Cc"); got != tt.wantCc {
+				t.Errorf("Cc header = %q, want %q", got, tt.wantCc)
+			}
+			if headerValue(message.Data, "Bcc") != "" || strings.Contains(message.Data, "audit@example.com") {
+				t.Errorf("message shows the blind copy:\n%s", message.Data)
+			}
+		})
+	}
+}
+
+func TestSendTestEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		to      []string
+		bcc     []string
+		reject  bool
+		wantErr bool
+	}{
+		{name: "to and blind copy", to: []string{"ops@example.com"}, bcc: []string{"audit@example.com"}},
+		{name: "relay rejects", to: []string{"ops@example.com"}, reject: true, wantErr: true},
+		{name: "no recipients", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newFakeSMTP(t)
+			relay.reject = tt.reject
+			m := testMailer(t, tt.to, relay.server)
+			m.BCC = tt.bcc
+
+			err := m.SendTestEmail()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SendTestEmail error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			messages := relay.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("relay accepted %d messages, want 1", len(messages))
+			}
+			message := messages[0]
+			if got := headerValue(message.Data, "Subject"); got != TestEmailSubject {
+				t.Errorf("subject = %q, want %q", got, TestEmailSubject)
+			}
+			if len(message.Recipients) != len(tt.to)+len(tt.bcc) {
+				t.Errorf("envelope = %v, want %v and %v", message.Recipients, tt.to, tt.bcc)
+			}
+			if strings.Contains(message.Data, "audit@example.com") || strings.Contains(message.Data, "attachment") {
+				t.Errorf("test email shows a blind copy or has an attachment:\n%s", message.Data)
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers bool
+		send    func(m *Mailer) error
+	}{
+		{name: "report", servers: true, send: func(m *Mailer) error { return m.SendReportAttachment(testReport(), nil, SendOptions{}) }},
+		{name: "report without a relay", send: func(m *Mailer) error { return m.SendReportAttachment(testReport(), nil, SendOptions{}) }},
+		{name: "test email", servers: true, send: (*Mailer).SendTestEmail},
+		{name: "test email without a relay", send: (*Mailer).SendTestEmail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newFakeSMTP(t)
+			m := testMailer(t, []string{"ops@example.com"}, SMTPServer{Host: "127.0.0.1", Port: 25}) // Never dialled
+			if tt.servers {
+				m = testMailer(t, []string{"ops@example.com"}, relay.server)
+			}
+			m.BCC = []string{"audit@example.com"}
+			m.DryRun = true
+
+			if err := tt.send(m); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			if len(m.TakeDeliveries()) != 0 {
+				t.Error("dry run recorded a delivery")
+			}
+			if sessions := relay.Sessions(); sessions != 0 {
+				t.Errorf("dry run opened %d SMTP sessions, want none", sessions)
+			}
+		})
+	}
+}
+
+func TestFooter(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{name: "static text", template: "Unsubscribe: reply STOP", want: "Reporter\n\nUnsubscribe: reply STOP"},
+		{name: "environment and send time", template: "Sent from {{.Environment}} at {{.Timestamp}}", want: "Sent from staging at 20"},
+		{name: "no footer", template: ""},
+		{name: "invalid template", template: "{{.Environment", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMailer(t, nil)
+			if err := m.SetFooter(tt.template); (err != nil) != tt.wantErr {
+				t.Fatalf("SetFooter error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			message := sendTestReport(t, func(m *Mailer) {
+				m.Environment = "staging"
+				m.SetFooter(tt.template)
+			})
+			body := textBody(message)
+			if tt.want != "" && !strings.Contains(body, tt.want) {
+				t.Errorf("body does not contain %q:\n%s", tt.want, body)
+			}
+			if tt.want == "" && !strings.HasSuffix(body, "Solana Balance Reporter") {
+				t.Errorf("body without a footer does not end with the signature:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestRecipientTimeZones(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+
+	relay := newFakeSMTP(t)
+	m := testMailer(t, []string{"ops@example.com", "NY@example.com", "tokyo@example.com"}, relay.server)
+	m.RecipientLocations = map[string]*time.Location{"ny@example.com": newYork, "tokyo@example.com": tokyo}
+	if err := m.SendReportAttachment(testReport(), nil, SendOptions{}); err != nil {
+		t.Fatalf("SendReportAttachment: %v", err)
+	}
+
+	// The report window is 14:00 - 15:00 UTC on 1 March 2026
+	want := map[string]string{
+		"ops@example.com":   "1 March 2026, 14:00 - 15:00 UTC",
+		"NY@example.com":    "1 March 2026, 09:00 - 10:00 EST",
+		"tokyo@example.com": "1 March 2026, 23:00 - 00:00 JST",
+	}
+	messages := relay.Messages()
+	if len(messages) != len(want) {
+		t.Fatalf("relay accepted %d messages, want one per time zone", len(messages))
+	}
+	for _, message := range messages {
+		if len(message.Recipients) != 1 {
+			t.Fatalf("message to %v mixes time zones", message.Recipients)
+		}
+		window, ok := want[message.Recipients[0]]
+		if !ok {
+			t.Fatalf("unexpected recipient %s", message.Recipients[0])
+		}
+		if got := headerValue(message.Data, "Subject"); got != "Token Balance Report for "+window {
+			t.Errorf("subject to %s = %q, want window %s", message.Recipients[0], got, window)
+		}
+		if body := textBody(message.Data); !strings.Contains(body, "report for "+window+".") {
+			t.Errorf("body to %s does not show window %s:\n%s", message.Recipients[0], window, body)
+		}
+	}
+}
+
+func TestBannerAndTokenLabel(t *testing.T) {
+	tests := []struct {
+		name        string
+		banner      string
+		tokenLabel  string
+		wantSubject string
+		wantBody    string
+	}{
+		{
+			name:        "staging banner",
+			banner:      "STAGING",
+			tokenLabel:  "USDC",
+			wantSubject: "[STAGING] Token Balance Report for ",
+			wantBody:    "*** STAGING REPORT - NOT PRODUCTION DATA ***",
+		},
+		{
+			name:        "production",
+			tokenLabel:  "USDC",
+			wantSubject: "Token Balance Report for ",
+			wantBody:    "their USDC token balances.",
+		},
+		{
+			name:        "no token label",
+			wantSubject: "Token Balance Report for ",
+			wantBody:    "their token balances.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := sendTestReport(t, func(m *Mailer) {
+				m.Banner = tt.banner
+				m.TokenLabel = tt.tokenLabel
+			})
+			if got := headerValue(message, "Subject"); !strings.HasPrefix(got, tt.wantSubject) {
+				t.Errorf("subject = %q, want prefix %q", got, tt.wantSubject)
+			}
+			body := textBody(message)
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body does not contain %q:\n%s", tt.wantBody, body)
+			}
+			if strings.Contains(body, "JINGLE") {
+				t.Errorf("body names a token other than the configured label:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestSendReportsIsolatesFailures(t *testing.T) {
+	relay := newFakeSMTP(t)
+	relay.delay = 30 * time.Millisecond
+	m := testMailer(t, []string{"ops@example.com"}, relay.server)
+	m.Concurrency = 2
+
+	// The first report's CSV is gone, which must not stop the others
+	reports := []Report{
+		{CSVPath: "/nonexistent/balance_2026-03-01_14_00_00.csv"},
+		{Attachment: testReport(), Options: SendOptions{RequestID: "second"}},
+		{Attachment: testReport(), Options: SendOptions{RequestID: "third"}},
+	}
+	errs := m.SendReports(reports)
+	if errs[0] == nil {
+		t.Error("report with a missing CSV was sent")
+	}
+	for i, err := range errs[1:] {
+		if err != nil {
+			t.Errorf("report %d: %v", i+1, err)
+		}
+	}
+
+	messages := relay.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("relay accepted %d messages, want the 2 intact reports", len(messages))
+	}
+	if got := relay.MaxActive(); got != 2 {
+		t.Errorf("%d messages were in flight at once, want the 2 reports sent concurrently", got)
+	}
+}
+
+func TestFailedTokenFetch(t *testing.T) {
+	tests := []struct {
+		name       string
+		balance    *solana.TokenBalance
+		wantRow    string
+		wantFailed int
+	}{
+		{
+			name:       "token error",
+			balance:    &solana.TokenBalance{WalletAddress: "wallet2", FetchError: errors.New("rpc timeout"), SolanaBalance: 1, SolanaFetched: true},
+			wantRow:    "wallet2,N/A,1.00",
+			wantFailed: 1,
+		},
+		{
+			name:    "SOL error only",
+			balance: &solana.TokenBalance{WalletAddress: "wallet2", Balance: 4, SolanaError: errors.New("rpc timeout"), SolanaFetched: true},
+			wantRow: "wallet2,4.00,N/A",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balances := []*solana.TokenBalance{{WalletAddress: "wallet1", Balance: 1.5, SolanaBalance: 2, SolanaFetched: true}, tt.balance}
+
+			w, err := csvwriter.New(t.TempDir(), rounding.Rounder{Places: 2, Mode: rounding.HalfUp}, testLogger(t))
+			if err != nil {
+				t.Fatalf("csvwriter.New: %v", err)
+			}
+			w.IncludeSolColumn = true
+			content, err := w.Render(balances)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if !strings.Contains(string(content), "\n"+tt.wantRow+"\n") {
+				t.Errorf("CSV %q has no row %q", content, tt.wantRow)
+			}
+
+			relay := newFakeSMTP(t)
+			m := testMailer(t, []string{"ops@example.com"}, relay.server)
+			report := Attachment{Filename: testReport().Filename, Content: content}
+			if err := m.SendReportAttachment(report, balances, SendOptions{}); err != nil {
+				t.Fatalf("SendReportAttachment: %v", err)
+			}
+			messages := relay.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("relay accepted %d messages, want 1", len(messages))
+			}
+			body := textBody(messages[0].Data)
+			for _, want := range []string{
+				"- Total addresses processed: 2",
+				fmt.Sprintf("- Successfully fetched: %d", 2-tt.wantFailed),
+				fmt.Sprintf("- Failed to fetch: %d", tt.wantFailed),
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("body missing %q:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestAttachmentContentType(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"balance_2026-03-01_14_00_00.csv", "text/csv"},
+		{"summary_2026-03-01_14_00_00.json", "application/json"},
+		{"balance_2026-03-01_14_00_00.csv.gz", "application/gzip"},
+		{"summary_2026-03-01_14_00_00.json.gz", "application/gzip"},
+	}
+
+	for _, tt := range tests {
+		if got := (Attachment{Filename: tt.filename}).contentType(); got != tt.want {
+			t.Errorf("content type of %s = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestCompressAttachment(t *testing.T) {
+	csvContent := "wallet_address,balance\n" + strings.Repeat("So11111111111111111111111111111111111111112,1.50\n", 200)
+
+	tests := []struct {
+		compress     bool
+		wantFilename string
+		wantType     string
+	}{
+		{compress: false, wantFilename: "balance_2026-03-01_14_00_00.csv", wantType: "text/csv"},
+		{compress: true, wantFilename: "balance_2026-03-01_14_00_00.csv.gz", wantType: "application/gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("compress=%v", tt.compress), func(t *testing.T) {
+			csvPath := filepath.Join(t.TempDir(), "balance_2026-03-01_14_00_00.csv")
+			if err := os.WriteFile(csvPath, []byte(csvContent), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			relay := newFakeSMTP(t)
+			m := testMailer(t, []string{"ops@example.com"}, relay.server)
+			m.CompressAttachment = tt.compress
+			if err := m.SendReport(csvPath, nil, SendOptions{}); err != nil {
+				t.Fatalf("SendReport: %v", err)
+			}
+			messages := relay.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("relay accepted %d messages, want 1", len(messages))
+			}
+
+			var attachment *mimePart
+			parts := mimeParts(t, messages[0].Data)
+			for i := range parts {
+				if parts[i].Filename != "" {
+					attachment = &parts[i]
+				}
+			}
+			if attachment == nil || attachment.Filename != tt.wantFilename || attachment.ContentType != tt.wantType {
+				t.Fatalf("attachment = %+v, want %s as %s", attachment, tt.wantFilename, tt.wantType)
+			}
+
+			content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(attachment.Body, "\n", ""))
+			if err != nil {
+				t.Fatalf("decoding the attachment: %v", err)
+			}
+			if tt.compress {
+				gz, err := gzip.NewReader(bytes.NewReader(content))
+				if err != nil {
+					t.Fatalf("gzip.NewReader: %v", err)
+				}
+				if content, err = io.ReadAll(gz); err != nil {
+					t.Fatalf("decompressing the attachment: %v", err)
+				}
+			}
+			if string(content) != csvContent {
+				t.Errorf("attachment decodes to %d bytes, want the %d byte CSV", len(content), len(csvContent))
+			}
+
+			// The CSV on disk stays uncompressed
+			if onDisk, _ := os.ReadFile(csvPath); string(onDisk) != csvContent {
+				t.Error("the CSV on disk was changed")
+			}
+		})
+	}
+}
+
+func TestMaxRecipients(t *testing.T) {
+	tests := []struct {
+		name          string
+		recipients    int
+		maxRecipients int
+		wantSends     []int // Envelope size of each send
+	}{
+		{name: "no cap", recipients: 120, wantSends: []int{120}},
+		{name: "under the cap", recipients: 40, maxRecipients: 50, wantSends: []int{40}},
+		{name: "split into three", recipients: 120, maxRecipients: 50, wantSends: []int{50, 50, 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipients := make([]string, tt.recipients)
+			for i := range recipients {
+				recipients[i] = fmt.Sprintf("user%03d@example.com", i)
+			}
+
+			relay := newFakeSMTP(t)
+			m := testMailer(t, recipients, relay.server)
+			m.MaxRecipients = tt.maxRecipients
+			if err := m.SendReportAttachment(testReport(), nil, SendOptions{}); err != nil {
+				t.Fatalf("SendReportAttachment: %v", err)
+			}
+
+			messages := relay.Messages()
+			if len(messages) != len(tt.wantSends) {
+				t.Fatalf("relay accepted %d messages, want %d", len(messages), len(tt.wantSends))
+			}
+			seen := make(map[string]int)
+			for i, message := range messages {
+				if len(message.Recipients) != tt.wantSends[i] {
+					t.Errorf("send %d went to %d recipients, want %d", i+1, len(message.Recipients), tt.wantSends[i])
+				}
+				for _, recipient := range message.Recipients {
+					seen[recipient]++
+				}
+				if textBody(message.Data) != textBody(messages[0].Data) || headerValue(message.Data, "Subject") != headerValue(messages[0].Data, "Subject") {
+					t.Errorf("send %d has different content from the first", i+1)
+				}
+			}
+			for _, recipient := range recipients {
+				if seen[recipient] != 1 {
+					t.Errorf("%s received %d copies, want 1", recipient, seen[recipient])
+				}
+			}
+		})
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	const topN, errorLines = 50, 300
+
+	// An oversized report: a large CSV, a long error section, a full top wallets table
+	// and the QR code image
+	var balances []*solana.TokenBalance
+	csv := []byte("wallet_address,balance\n")
+	for i := 0; i < 200; i++ {
+		address := fmt.Sprintf("Wallet%038d", i)
+		balances = append(balances, &solana.TokenBalance{WalletAddress: address, Balance: float64(i)})
+		csv = append(csv, fmt.Sprintf("%s,%d.00\n", address, i)...)
+	}
+	errorsSection := Section{Title: "Fetch errors"}
+	for i := 0; i < errorLines; i++ {
+		errorsSection.Lines = append(errorsSection.Lines, fmt.Sprintf("Wallet%038d: rpc timeout", i))
+	}
+	report := Attachment{Filename: testReport().Filename, Content: csv}
+
+	// shown is what a message kept inline, with the size of its body: the message as
+	// rendered without the attachment parts
+	type shown struct {
+		size, rows, lines int
+		qr, notice        bool
+	}
+	attachmentPart := "--solanaReportBoundary\r\nContent-Type: text/csv"
+	// render measures the message as rendered, since the SMTP transfer rewrites line endings
+	render := func(t *testing.T, maxBytes int) shown {
+		t.Helper()
+		m := testMailer(t, []string{"ops@example.com"}, SMTPServer{Host: "127.0.0.1", Port: 25}) // Never dialled
+		m.Format = "both"
+		m.QRCode = true
+		m.HTMLTopN = topN
+		m.MaxBodyBytes = maxBytes
+		messages, err := m.renderReport(Report{Attachment: report, Balances: balances, Sections: []Section{errorsSection}})
+		if err != nil {
+			t.Fatalf("renderReport: %v", err)
+		}
+		if len(messages) != 1 {
+			t.Fatalf("rendered %d messages, want 1", len(messages))
+		}
+		message := string(messages[0].content)
+
+		attachmentAt := strings.Index(message, attachmentPart)
+		if attachmentAt < 0 {
+			t.Fatal("message has no CSV attachment part")
+		}
+		got := shown{size: attachmentAt + len("\r\n--solanaReportBoundary--")}
+		var text, html string
+		for _, part := range mimeParts(t, message) {
+			switch {
+			case part.Filename == report.Filename:
+				content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(part.Body, "\n", ""))
+				if err != nil || !bytes.Equal(content, csv) {
+					t.Errorf("attachment does not hold the full CSV (%v)", err)
+				}
+			case part.ContentType == "image/png":
+				got.qr = true
+			case part.ContentType == "text/plain":
+				text = part.Body
+			case part.ContentType == "text/html":
+				html = part.Body
+			}
+		}
+		got.rows = strings.Count(html, `<td style="font-family: monospace;">`)
+		got.lines = strings.Count(text, ": rpc timeout")
+		if lines := strings.Count(html, ": rpc timeout"); lines != got.lines {
+			t.Errorf("HTML body kept %d report section lines, text body %d", lines, got.lines)
+		}
+		got.notice = strings.Contains(text, truncationNotice)
+		if strings.Contains(html, truncationNotice) != got.notice {
+			t.Errorf("truncation notice in text body %v, in HTML body %v", got.notice, !got.notice)
+		}
+		if strings.Contains(html, "cid:"+qrImageName) != got.qr {
+			t.Errorf("HTML refers to the QR code %v, image attached %v", !got.qr, got.qr)
+		}
+		return got
+	}
+
+	full := render(t, 0)
+	if !full.qr || full.rows != topN || full.lines != errorLines || full.notice {
+		t.Fatalf("uncapped message shows %+v, want everything", full)
+	}
+	smallest := render(t, 1)
+	if smallest.qr || smallest.rows != 0 || smallest.lines != 0 || !smallest.notice {
+		t.Fatalf("message capped at 1 byte shows %+v, want only the truncation notice", smallest)
+	}
+
+	tests := []struct {
+		name     string
+		maxBytes int
+		want     func(got shown) bool
+	}{
+		{
+			name:     "cap at the body size ignores the larger attachment",
+			maxBytes: full.size,
+			want:     func(got shown) bool { return got == full },
+		},
+		{
+			name:     "just over the cap drops only the QR code",
+			maxBytes: full.size - 1,
+			want:     func(got shown) bool { return !got.qr && got.rows == topN && got.lines == errorLines && !got.notice },
+		},
+		{
+			name:     "cap below the smallest body still keeps everything attached",
+			maxBytes: smallest.size - 1,
+			want:     func(got shown) bool { return got == smallest },
+		},
+	}
+	// Caps in between cut the table before the sections; only cut sections get the notice
+	tableCut, sectionsCut := false, false
+	for step := 1; step < 10; step++ {
+		maxBytes := smallest.size + (full.size-smallest.size)*step/10
+		tests = append(tests, struct {
+			name     string
+			maxBytes int
+			want     func(got shown) bool
+		}{
+			name:     fmt.Sprintf("cap at %d bytes", maxBytes),
+			maxBytes: maxBytes,
+			want: func(got shown) bool {
+				tableCut = tableCut || (got.rows > 0 && got.rows < topN)
+				sectionsCut = sectionsCut || (got.lines > 0 && got.lines < errorLines)
+				return got.size <= maxBytes && !got.qr && got.notice == (got.lines < errorLines) && (got.lines == errorLines || got.rows == 0)
+			},
+		})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(t, tt.maxBytes); !tt.want(got) {
+				t.Errorf("message capped at %d bytes (uncapped %d) shows %+v", tt.maxBytes, full.size, got)
+			}
+		})
+	}
+	if !tableCut || !sectionsCut {
+		t.Errorf("in-between caps kept part of the table %v and part of the sections %v, want both", tableCut, sectionsCut)
+	}
+}
+
+func TestTruncateSections(t *testing.T) {
+	sections := []Section{
+		{Title: "Errors", Lines: []string{"a", "b"}},
+		{Title: "Alerts", Lines: []string{"c"}},
+	}
+
+	tests := []struct {
+		name     string
+		sections []Section
+		keep     int
+		want     []Section
+	}{
+		{name: "no sections", keep: 0, want: nil},
+		{name: "every line kept", sections: sections, keep: 3, want: sections},
+		{
+			name: "cut within a section", sections: sections, keep: 1,
+			want: []Section{{Title: "Errors", Lines: []string{"a", truncationNotice}}},
+		},
+		{
+			name: "cut at a section boundary", sections: sections, keep: 2,
+			want: []Section{{Title: "Errors", Lines: []string{"a", "b", truncationNotice}}},
+		},
+		{
+			name: "no line kept", sections: sections, keep: 0,
+			want: []Section{{Title: "Errors", Lines: []string{truncationNotice}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateSections(tt.sections, tt.keep); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("truncateSections(%d) = %q, want %q", tt.keep, got, tt.want)
+			}
+		})
+	}
+	if len(sections[0].Lines) != 2 {
+		t.Errorf("truncateSections changed its input: %q", sections)
+	}
+}
@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// qrImageName is the file name and Content-ID of the inline QR code image
+const qrImageName = "report-sha256.png"
+
+// qrImageSize is the width and height of the QR code image in pixels
+const qrImageSize = 200
+
+// reportHashQR returns the hex SHA-256 of a report CSV and a PNG QR code encoding it
+func reportHashQR(content []byte) (string, Attachment, error) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	png, err := qrcode.Encode(hash, qrcode.Medium, qrImageSize)
+	if err != nil {
+		return "", Attachment{}, err
+	}
+	return hash, Attachment{Filename: qrImageName, Content: png}, nil
+}
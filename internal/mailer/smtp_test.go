@@ -0,0 +1,217 @@
+package mailer
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+)
+
+// fakeMessage is a message accepted by a fakeSMTP relay
+type fakeMessage struct {
+	From       string
+	Recipients []string
+	Data       string
+}
+
+// fakeSMTP is a plain-text SMTP relay on localhost that records the messages it accepts
+type fakeSMTP struct {
+	listener net.Listener
+	server   SMTPServer
+
+	// reject makes the relay refuse every sender with a permanent error
+	reject bool
+	// delay holds each message before accepting its data
+	delay time.Duration
+
+	mu        sync.Mutex
+	messages  []fakeMessage
+	sessions  int
+	active    int
+	maxActive int
+}
+
+// newFakeSMTP starts a relay that is shut down when the test ends
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting fake SMTP relay: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	addr := listener.Addr().(*net.TCPAddr)
+	f := &fakeSMTP{
+		listener: listener,
+		server:   SMTPServer{Host: "127.0.0.1", Port: addr.Port, Username: "user", Password: "secret"},
+	}
+	go f.serve()
+	return f
+}
+
+// Messages returns the messages accepted so far
+func (f *fakeSMTP) Messages() []fakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeMessage(nil), f.messages...)
+}
+
+// Sessions returns the number of connections the relay has handled
+func (f *fakeSMTP) Sessions() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessions
+}
+
+// MaxActive returns the largest number of messages in flight at once
+func (f *fakeSMTP) MaxActive() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.maxActive
+}
+
+func (f *fakeSMTP) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.sessions++
+		f.mu.Unlock()
+		go f.session(conn)
+	}
+}
+
+func (f *fakeSMTP) session(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) { text.PrintfLine(format, args...) }
+
+	reply("220 fake ESMTP")
+	var message fakeMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case "HELO", "NOOP", "RSET":
+			reply("250 OK")
+		case "AUTH":
+			reply("235 authenticated")
+		case "MAIL":
+			if f.reject {
+				reply("554 relay rejects all mail")
+				continue
+			}
+			message = fakeMessage{From: addressArg(line)}
+			reply("250 OK")
+		case "RCPT":
+			message.Recipients = append(message.Recipients, addressArg(line))
+			reply("250 OK")
+		case "DATA":
+			reply("354 send data")
+			f.track(1)
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				f.track(-1)
+				return
+			}
+			time.Sleep(f.delay)
+			message.Data = string(data)
+			f.mu.Lock()
+			f.messages = append(f.messages, message)
+			id := len(f.messages)
+			f.mu.Unlock()
+			f.track(-1)
+			reply("250 OK queued as " + strconv.Itoa(id))
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown command")
+		}
+	}
+}
+
+// track counts messages in flight
+func (f *fakeSMTP) track(delta int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.active += delta
+	if f.active > f.maxActive {
+		f.maxActive = f.active
+	}
+}
+
+// addressArg extracts the address from a MAIL FROM:<a> or RCPT TO:<a> command
+func addressArg(line string) string {
+	start, end := strings.Index(line, "<"), strings.LastIndex(line, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return line[start+1 : end]
+}
+
+// unusedServer returns a relay address that refuses connections
+func unusedServer(t *testing.T) SMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserving a port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return SMTPServer{Host: "127.0.0.1", Port: port}
+}
+
+// testLogger returns a logger writing to a temporary directory
+func testLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log
+}
+
+// testMailer returns a mailer without retries sending through servers
+func testMailer(t *testing.T, to []string, servers ...SMTPServer) *Mailer {
+	t.Helper()
+	m := New(servers, "reporter@example.com", to, 0, testLogger(t))
+	m.retryDelay = time.Millisecond
+	return m
+}
+
+// testReport is a report attachment named for 14:00 UTC on 1 March 2026
+func testReport() Attachment {
+	return Attachment{
+		Filename: "balance_2026-03-01_14_00_00.csv",
+		Content:  []byte("wallet_address,balance\nwallet1,1.5\n"),
+	}
+}
+
+// headerValue returns the value of a header in a raw message, or "" when absent
+func headerValue(message, name string) string {
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(message)))
+	header, _ := reader.ReadMIMEHeader()
+	return header.Get(name)
+}
+
+// String describes the relay in test failures
+func (f *fakeSMTP) String() string {
+	return fmt.Sprintf("%s:%d", f.server.Host, f.server.Port)
+}
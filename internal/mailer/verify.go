@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// statusPollInterval is the wait between polls of the delivery status endpoint
+var statusPollInterval = 5 * time.Second
+
+// deliveryStatus is the response of the delivery status endpoint
+type deliveryStatus struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// VerifyDelivery checks that a report was delivered. The relay's reply must be a 2xx
+// acceptance; when StatusURL is set, the endpoint is also polled with the message id
+// until it reports the message delivered or failed, or ctx ends.
+func (m *Mailer) VerifyDelivery(ctx context.Context, delivery Delivery) error {
+	if delivery.Code < 200 || delivery.Code > 299 {
+		return fmt.Errorf("relay %s replied %d %s", delivery.Server, delivery.Code, delivery.Response)
+	}
+	if m.StatusURL == "" {
+		return nil
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	for {
+		status, err := m.fetchStatus(ctx, client, delivery.MessageID)
+		if err != nil {
+			m.logger.LogError(fmt.Sprintf("Failed to check delivery status of %s", delivery.MessageID), err)
+		} else {
+			switch strings.ToLower(status.Status) {
+			case "delivered":
+				return nil
+			case "failed", "bounced", "rejected":
+				return fmt.Errorf("message %s %s: %s", delivery.MessageID, status.Status, status.Reason)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("delivery status of %s unknown: %w", delivery.MessageID, err)
+			}
+			return fmt.Errorf("message %s still %s when verification timed out", delivery.MessageID, status.Status)
+		case <-time.After(statusPollInterval):
+		}
+	}
+}
+
+// fetchStatus queries the delivery status endpoint for a message
+func (m *Mailer) fetchStatus(ctx context.Context, client *http.Client, messageID string) (deliveryStatus, error) {
+	var status deliveryStatus
+
+	statusURL, err := url.Parse(m.StatusURL)
+	if err != nil {
+		return status, fmt.Errorf("invalid status URL: %w", err)
+	}
+	query := statusURL.Query()
+	query.Set("message_id", strings.Trim(messageID, "<>"))
+	statusURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", statusURL.String(), nil)
+	if err != nil {
+		return status, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return status, fmt.Errorf("failed to query status endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("status endpoint returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("failed to decode status response: %w", err)
+	}
+	return status, nil
+}
+
+// Resend sends a delivered report again, unchanged, to the same recipients, within the
+// original send's deadline
+func (m *Mailer) Resend(delivery Delivery) (Delivery, error) {
+	reply, err := m.sendWithRetries(delivery.Recipients, delivery.message, delivery.deadline)
+	if err != nil {
+		return delivery, err
+	}
+
+	delivery.Server = reply.server
+	delivery.Code = reply.code
+	delivery.Response = reply.response
+	return delivery, nil
+}
@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVerifyDelivery(t *testing.T) {
+	defer func(interval time.Duration) { statusPollInterval = interval }(statusPollInterval)
+	statusPollInterval = time.Millisecond
+
+	tests := []struct {
+		name       string
+		statuses   []string // Answers of the status endpoint, the last one repeated
+		wantErr    string   // Empty when verification succeeds
+		wantResend bool
+	}{
+		{name: "delivered after queueing", statuses: []string{"queued", "delivered"}},
+		{name: "bounced", statuses: []string{"queued", "bounced"}, wantErr: "bounced", wantResend: true},
+		// The timeout may also land during a poll, which leaves the status unknown
+		{name: "still queued at the timeout", statuses: []string{"queued"}, wantErr: "verification timed out|unknown", wantResend: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var polled []string
+			status := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				polled = append(polled, r.URL.Query().Get("message_id"))
+				answer := tt.statuses[len(tt.statuses)-1]
+				if len(polled) <= len(tt.statuses) {
+					answer = tt.statuses[len(polled)-1]
+				}
+				w.Write([]byte(`{"status":"` + answer + `","reason":"mailbox full"}`))
+			}))
+			defer status.Close()
+
+			relay := newFakeSMTP(t)
+			m := testMailer(t, []string{"ops@example.com"}, relay.server)
+			m.StatusURL = status.URL
+			if err := m.SendReportAttachment(testReport(), nil, SendOptions{}); err != nil {
+				t.Fatalf("SendReportAttachment: %v", err)
+			}
+			deliveries := m.TakeDeliveries()
+			if len(deliveries) != 1 || deliveries[0].Code != 250 {
+				t.Fatalf("deliveries = %+v, want one accepted with 250", deliveries)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := m.VerifyDelivery(ctx, deliveries[0])
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("VerifyDelivery: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !containsAny(err.Error(), strings.Split(tt.wantErr, "|"))) {
+				t.Fatalf("VerifyDelivery error = %v, want %q", err, tt.wantErr)
+			}
+			mu.Lock()
+			if len(polled) == 0 || polled[0] != strings.Trim(deliveries[0].MessageID, "<>") {
+				t.Errorf("status endpoint polled for %v, want %s", polled, deliveries[0].MessageID)
+			}
+			mu.Unlock()
+
+			// The retry follow-up sends the same message again
+			if tt.wantResend {
+				resent, err := m.Resend(deliveries[0])
+				if err != nil {
+					t.Fatalf("Resend: %v", err)
+				}
+				messages := relay.Messages()
+				if len(messages) != 2 || messages[1].Data != messages[0].Data || resent.MessageID != deliveries[0].MessageID {
+					t.Errorf("relay accepted %d messages after the resend, want the original twice", len(messages))
+				}
+			}
+		})
+	}
+}
+
+// containsAny reports whether s contains any of substrs
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestVerifyDeliveryRejectedByRelay(t *testing.T) {
+	// A relay reply outside 2xx fails without polling the status endpoint
+	m := testMailer(t, []string{"ops@example.com"})
+	m.StatusURL = "http://127.0.0.1:1/status"
+	err := m.VerifyDelivery(context.Background(), Delivery{MessageID: "<1@example.com>", Server: "relay", Code: 451, Response: "try later"})
+	if err == nil || !strings.Contains(err.Error(), "451") {
+		t.Errorf("VerifyDelivery error = %v, want the relay's 451", err)
+	}
+}
@@ -0,0 +1,78 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Append adds a line per file to the checksum manifest at path, in the format
+// written by sha256sum ("<hex digest>  <file>") so it can be checked with sha256sum -c
+// from the manifest's directory; files are listed relative to it.
+// The manifest accumulates across cycles as an integrity record of every artifact.
+func Append(path string, files []string) error {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to resolve manifest directory: %w", err)
+	}
+
+	var lines strings.Builder
+	for _, file := range files {
+		sum, err := hashFile(file)
+		if err != nil {
+			return err
+		}
+		name, err := relativeTo(dir, file)
+		if err != nil {
+			return err
+		}
+		lines.WriteString(fmt.Sprintf("%s  %s\n", sum, name))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+
+	manifest, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer manifest.Close()
+
+	if _, err := manifest.WriteString(lines.String()); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// relativeTo returns the path of file relative to the absolute directory dir
+func relativeTo(dir, file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", file, err)
+	}
+	name, err := filepath.Rel(dir, abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to list %s in the manifest: %w", file, err)
+	}
+	return name, nil
+}
+
+// hashFile returns the hex SHA-256 digest of a file's content
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s for hashing: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,90 @@
+package manifest
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile creates a file with content, along with its directory
+func writeFile(t *testing.T, path, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAppendListsFilesRelativeToManifest(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifest  string
+		wantNames []string
+	}{
+		{
+			name:      "manifest in the run directory",
+			manifest:  "csv/run_2026-03-01_14_00_00/SHA256SUMS",
+			wantNames: []string{"balance.csv", filepath.Join("..", "..", "json", "run_2026-03-01_14_00_00", "summary.json")},
+		},
+		{
+			name:     "shared manifest",
+			manifest: "data/SHA256SUMS",
+			wantNames: []string{
+				filepath.Join("..", "csv", "run_2026-03-01_14_00_00", "balance.csv"),
+				filepath.Join("..", "json", "run_2026-03-01_14_00_00", "summary.json"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			files := []string{
+				writeFile(t, filepath.Join(root, "csv", "run_2026-03-01_14_00_00", "balance.csv"), "wallet_address,balance\na,1.00\n"),
+				writeFile(t, filepath.Join(root, "json", "run_2026-03-01_14_00_00", "summary.json"), "{}\n"),
+			}
+			manifestPath := filepath.Join(root, tt.manifest)
+			if err := Append(manifestPath, files); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+
+			manifest, err := os.Open(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer manifest.Close()
+
+			// Every listed file hashes to its recorded sum from the manifest's directory
+			var names []string
+			scanner := bufio.NewScanner(manifest)
+			for scanner.Scan() {
+				sum, name, ok := strings.Cut(scanner.Text(), "  ")
+				if !ok {
+					t.Fatalf("malformed manifest line %q", scanner.Text())
+				}
+				names = append(names, name)
+				if got, err := hashFile(filepath.Join(filepath.Dir(manifestPath), name)); err != nil || got != sum {
+					t.Errorf("%s hashes to %s, %v; manifest records %s", name, got, err, sum)
+				}
+			}
+			if strings.Join(names, "\n") != strings.Join(tt.wantNames, "\n") {
+				t.Errorf("manifest lists %q, want %q", names, tt.wantNames)
+			}
+
+			// The format is the one sha256sum checks, where it is installed
+			if _, err := exec.LookPath("sha256sum"); err == nil {
+				check := exec.Command("sha256sum", "-c", filepath.Base(manifestPath))
+				check.Dir = filepath.Dir(manifestPath)
+				if out, err := check.CombinedOutput(); err != nil {
+					t.Errorf("sha256sum -c: %v\n%s", err, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sink receives the reporter's counters and gauges. Names are snake_case without a
+// prefix; each backend applies its own namespace and naming conventions.
+type Sink interface {
+	// Count adds value to a monotonically increasing counter
+	Count(name string, value float64)
+
+	// Gauge sets a gauge to value
+	Gauge(name string, value float64)
+
+	// Flush publishes the values recorded since the last flush, if the backend batches
+	Flush() error
+}
+
+// Namespace prefixes every metric name
+const Namespace = "solana_balance_reporter"
+
+// New creates the sink for a backend: "prometheus" (text exposition file at path),
+// "statsd" (UDP packets to addr) or "none"
+func New(backend, path, addr string) (Sink, error) {
+	switch strings.ToLower(backend) {
+	case "", "none":
+		return Nop{}, nil
+	case "prometheus":
+		return NewPrometheus(path), nil
+	case "statsd":
+		return NewStatsd(addr)
+	default:
+		return nil, fmt.Errorf("unknown metrics backend %q", backend)
+	}
+}
+
+// Nop discards all metrics
+type Nop struct{}
+
+// Count implements Sink
+func (Nop) Count(string, float64) {}
+
+// Gauge implements Sink
+func (Nop) Gauge(string, float64) {}
+
+// Flush implements Sink
+func (Nop) Flush() error { return nil }
+
+// Tee sends every metric to each of its sinks
+type Tee []Sink
+
+// Count implements Sink
+func (t Tee) Count(name string, value float64) {
+	for _, sink := range t {
+		sink.Count(name, value)
+	}
+}
+
+// Gauge implements Sink
+func (t Tee) Gauge(name string, value float64) {
+	for _, sink := range t {
+		sink.Gauge(name, value)
+	}
+}
+
+// Flush implements Sink, flushing every sink and returning the first error
+func (t Tee) Flush() error {
+	var firstErr error
+	for _, sink := range t {
+		if err := sink.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordCycle feeds a sink the metrics of one cycle, as main does
+func recordCycle(sink Sink) {
+	sink.Gauge("wallets", 120)
+	sink.Gauge("wallets_failed", 3)
+	sink.Count("fetch_errors_total", 4)
+	sink.Count("cycles_total", 1)
+	sink.Gauge("cycle_duration_seconds", 12.5)
+}
+
+func TestStatsd(t *testing.T) {
+	daemon, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("starting statsd listener: %v", err)
+	}
+	defer daemon.Close()
+
+	sink, err := New("statsd", "", daemon.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	recordCycle(sink)
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := []string{
+		"solana_balance_reporter.wallets:120|g",
+		"solana_balance_reporter.wallets_failed:3|g",
+		"solana_balance_reporter.fetch_errors_total:4|c",
+		"solana_balance_reporter.cycles_total:1|c",
+		"solana_balance_reporter.cycle_duration_seconds:12.5|g",
+	}
+	buf := make([]byte, 512)
+	for _, line := range want {
+		daemon.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := daemon.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("waiting for %q: %v", line, err)
+		}
+		if got := string(buf[:n]); got != line {
+			t.Errorf("statsd packet = %q, want %q", got, line)
+		}
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "textfile", "reporter.prom")
+	sink, err := New("prometheus", path, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	recordCycle(sink)
+	recordCycle(sink) // counters add up across cycles, gauges keep the last value
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"# TYPE solana_balance_reporter_cycles_total counter",
+		"solana_balance_reporter_cycles_total 2",
+		"# TYPE solana_balance_reporter_fetch_errors_total counter",
+		"solana_balance_reporter_fetch_errors_total 8",
+		"# TYPE solana_balance_reporter_cycle_duration_seconds gauge",
+		"solana_balance_reporter_cycle_duration_seconds 12.5",
+		"# TYPE solana_balance_reporter_wallets gauge",
+		"solana_balance_reporter_wallets 120",
+		"# TYPE solana_balance_reporter_wallets_failed gauge",
+		"solana_balance_reporter_wallets_failed 3",
+	}, "\n") + "\n"
+	if string(content) != want {
+		t.Errorf("metrics file =\n%s\nwant\n%s", content, want)
+	}
+}
+
+func TestNewUnknownBackend(t *testing.T) {
+	if _, err := New("graphite", "", ""); err == nil {
+		t.Error("New accepted an unknown backend")
+	}
+}
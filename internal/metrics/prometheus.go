@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prometheus keeps metrics in memory and writes them in the Prometheus text exposition
+// format, e.g. for node_exporter's textfile collector
+type Prometheus struct {
+	path     string
+	mu       sync.Mutex
+	counters map[string]float64
+	gauges   map[string]float64
+}
+
+// NewPrometheus creates a sink that writes to path on every Flush; with an empty path the
+// metrics are only kept in memory for Render
+func NewPrometheus(path string) *Prometheus {
+	return &Prometheus{
+		path:     path,
+		counters: make(map[string]float64),
+		gauges:   make(map[string]float64),
+	}
+}
+
+// Count implements Sink
+func (p *Prometheus) Count(name string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counters[name] += value
+}
+
+// Gauge implements Sink
+func (p *Prometheus) Gauge(name string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.gauges[name] = value
+}
+
+// Render returns the current values in the text exposition format, sorted by name
+func (p *Prometheus) Render() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var text strings.Builder
+	write := func(values map[string]float64, kind string) {
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			full := Namespace + "_" + name
+			text.WriteString(fmt.Sprintf("# TYPE %s %s\n", full, kind))
+			text.WriteString(fmt.Sprintf("%s %s\n", full, strconv.FormatFloat(values[name], 'g', -1, 64)))
+		}
+	}
+	write(p.counters, "counter")
+	write(p.gauges, "gauge")
+
+	return text.String()
+}
+
+// Flush writes the metrics file atomically so scrapers never read a partial file
+func (p *Prometheus) Flush() error {
+	if p.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return fmt.Errorf("failed to create metrics directory: %w", err)
+	}
+
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(p.Render()), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	if err := os.Rename(tmp, p.path); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
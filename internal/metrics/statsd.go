@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Statsd sends each metric as a statsd line over UDP, e.g.
+// "solana_balance_reporter.wallets_failed:3|g"
+type Statsd struct {
+	conn net.Conn
+}
+
+// NewStatsd creates a sink sending to a statsd daemon at addr (host:port)
+func NewStatsd(addr string) (*Statsd, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd at %s: %w", addr, err)
+	}
+	return &Statsd{conn: conn}, nil
+}
+
+// Count implements Sink
+func (s *Statsd) Count(name string, value float64) {
+	s.send(name, value, "c")
+}
+
+// Gauge implements Sink
+func (s *Statsd) Gauge(name string, value float64) {
+	s.send(name, value, "g")
+}
+
+// Flush implements Sink; lines are sent as they are recorded
+func (s *Statsd) Flush() error {
+	return nil
+}
+
+// send writes one metric line. Delivery is best effort, as usual for statsd over UDP.
+func (s *Statsd) send(name string, value float64, kind string) {
+	line := fmt.Sprintf("%s.%s:%s|%s", Namespace, name, strconv.FormatFloat(value, 'f', -1, 64), kind)
+	s.conn.Write([]byte(line))
+}
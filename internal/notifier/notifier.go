@@ -0,0 +1,19 @@
+package notifier
+
+import "time"
+
+// Report summarises a finished cycle for a notification
+type Report struct {
+	RunTime     time.Time
+	Total       int
+	Success     int
+	Failed      int
+	CSVPath     string // Empty when the CSV was not written to disk
+	Partial     string // Reason the report is partial, empty when complete
+	Environment string // Non-production banner, empty in production
+}
+
+// Notifier announces a finished cycle on a channel other than email
+type Notifier interface {
+	Notify(summary Report) error
+}
@@ -0,0 +1,69 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Slack posts cycle summaries to a Slack incoming webhook
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlack creates a notifier posting to the incoming webhook at url
+func NewSlack(url string, timeout time.Duration) *Slack {
+	return &Slack{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// slackMessage is the JSON body of an incoming webhook request
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// Notify posts the summary as a message
+func (s *Slack) Notify(summary Report) error {
+	body, err := json.Marshal(slackMessage{Text: slackText(summary)})
+	if err != nil {
+		return fmt.Errorf("failed to encode Slack message: %w", err)
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post Slack message: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// slackText formats a summary with Slack's mrkdwn markup
+func slackText(summary Report) string {
+	var text strings.Builder
+	if summary.Environment != "" {
+		text.WriteString(fmt.Sprintf("*[%s]* ", summary.Environment))
+	}
+	text.WriteString(fmt.Sprintf("*Token Balance Report* for %s\n",
+		summary.RunTime.UTC().Truncate(time.Hour).Format("2 January 2006, 15:04 UTC")))
+	if summary.Partial != "" {
+		text.WriteString(fmt.Sprintf(":warning: Partial report: %s\n", summary.Partial))
+	}
+
+	icon := ":white_check_mark:"
+	if summary.Failed > 0 {
+		icon = ":x:"
+	}
+	text.WriteString(fmt.Sprintf("%s %d addresses: %d fetched, %d failed\n", icon, summary.Total, summary.Success, summary.Failed))
+
+	if summary.CSVPath != "" {
+		text.WriteString(fmt.Sprintf("CSV: `%s`\n", summary.CSVPath))
+	}
+	return text.String()
+}
@@ -0,0 +1,96 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubWebhook is a Slack incoming webhook that records the posted messages
+type stubWebhook struct {
+	server   *httptest.Server
+	status   int
+	messages []slackMessage
+}
+
+func newStubWebhook(t *testing.T, status int) *stubWebhook {
+	t.Helper()
+	s := &stubWebhook{status: status}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var message slackMessage
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("decoding posted JSON: %v", err)
+		}
+		s.messages = append(s.messages, message)
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func TestSlackNotify(t *testing.T) {
+	runTime := time.Date(2024, 3, 1, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		summary Report
+		status  int
+		want    []string // Substrings of the posted text
+		wantErr bool
+	}{
+		{
+			name:    "all fetched",
+			summary: Report{RunTime: runTime, Total: 3, Success: 3, CSVPath: "csv_files/balances.csv"},
+			status:  http.StatusOK,
+			want: []string{
+				"*Token Balance Report* for 1 March 2024, 14:00 UTC",
+				":white_check_mark: 3 addresses: 3 fetched, 0 failed",
+				"CSV: `csv_files/balances.csv`",
+			},
+		},
+		{
+			name:    "failures, partial and environment",
+			summary: Report{RunTime: runTime, Total: 3, Success: 1, Failed: 2, Partial: "deadline reached", Environment: "STAGING"},
+			status:  http.StatusOK,
+			want: []string{
+				"*[STAGING]* *Token Balance Report*",
+				":warning: Partial report: deadline reached",
+				":x: 3 addresses: 1 fetched, 2 failed",
+			},
+		},
+		{
+			name:    "webhook rejects the message",
+			summary: Report{RunTime: runTime, Total: 1, Success: 1},
+			status:  http.StatusForbidden,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := newStubWebhook(t, tt.status)
+			err := NewSlack(webhook.server.URL, 5*time.Second).Notify(tt.summary)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(webhook.messages) != 1 {
+				t.Fatalf("webhook received %d messages, want 1", len(webhook.messages))
+			}
+			text := webhook.messages[0].Text
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("message %q does not contain %q", text, want)
+				}
+			}
+			if tt.summary.CSVPath == "" && strings.Contains(text, "CSV:") {
+				t.Errorf("message %q links a CSV that was not written", text)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultNATSPort is used when the queue URL has no port
+const DefaultNATSPort = "4222"
+
+// NATS publishes with the NATS core text protocol. Reports are published once per
+// cycle, so each publish uses its own connection rather than keeping one idle.
+type NATS struct {
+	addr     string
+	user     string
+	password string
+	timeout  time.Duration
+}
+
+// NewNATS creates a publisher for a nats://[user:password@]host[:port] URL
+func NewNATS(u *url.URL, timeout time.Duration) *NATS {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), DefaultNATSPort)
+	}
+
+	n := &NATS{addr: addr, timeout: timeout}
+	if u.User != nil {
+		n.user = u.User.Username()
+		n.password, _ = u.User.Password()
+	}
+	return n
+}
+
+// Publish implements Publisher. It waits for the server to answer a PING after the
+// message so a rejected publish (e.g. a permissions error) is reported.
+func (n *NATS) Publish(topic string, payload []byte) error {
+	conn, err := net.DialTimeout("tcp", n.addr, n.timeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS at %s: %w", n.addr, err)
+	}
+	defer conn.Close()
+
+	if n.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(n.timeout))
+	}
+	reader := bufio.NewReader(conn)
+
+	// The server greets every connection with an INFO line
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read NATS server info: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO") {
+		return fmt.Errorf("unexpected NATS greeting: %q", strings.TrimSpace(line))
+	}
+
+	connect := map[string]interface{}{"verbose": false, "pedantic": false, "name": "solana-balance-reporter"}
+	if n.user != "" {
+		connect["user"] = n.user
+		connect["pass"] = n.password
+	}
+	options, err := json.Marshal(connect)
+	if err != nil {
+		return fmt.Errorf("failed to encode NATS connect options: %w", err)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "CONNECT %s\r\n", options)
+	fmt.Fprintf(&msg, "PUB %s %d\r\n", topic, len(payload))
+	msg.Write(payload)
+	msg.WriteString("\r\nPING\r\n")
+	if _, err := conn.Write([]byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to confirm NATS publish: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server rejected publish: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
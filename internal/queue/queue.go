@@ -0,0 +1,28 @@
+package queue
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Publisher publishes report payloads to a message queue topic
+type Publisher interface {
+	Publish(topic string, payload []byte) error
+}
+
+// New creates the publisher for a queue URL. Only NATS (nats://host:port) is
+// supported; Kafka deployments can bridge a NATS subject into a topic.
+func New(rawURL string, timeout time.Duration) (Publisher, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid queue URL %q: %w", rawURL, err)
+	}
+
+	switch parsed.Scheme {
+	case "nats":
+		return NewNATS(parsed, timeout), nil
+	default:
+		return nil, fmt.Errorf("unsupported queue URL scheme %q: expected nats", parsed.Scheme)
+	}
+}
@@ -0,0 +1,45 @@
+package reader
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// base58Alphabet is the Bitcoin alphabet used for Solana addresses
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// PubkeyLength is the size in bytes of a Solana public key
+const PubkeyLength = 32
+
+// decodeBase58 decodes a base58 string; each leading '1' stands for a zero byte
+func decodeBase58(s string) ([]byte, error) {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for i, c := range s {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q at position %d", c, i+1)
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), value.Bytes()...), nil
+}
+
+// validateAddress checks that an address is a base58-encoded 32-byte public key
+func validateAddress(address string) error {
+	decoded, err := decodeBase58(address)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != PubkeyLength {
+		return fmt.Errorf("decodes to %d bytes, expected %d", len(decoded), PubkeyLength)
+	}
+	return nil
+}
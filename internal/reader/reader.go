@@ -3,16 +3,138 @@ package reader
 import (
 	"bufio"
 	"fmt"
+	"net/mail"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
 )
 
-// AddressReader handles reading addresses from a file
+// AddressReader handles reading addresses from one or more files
 type AddressReader struct {
-	filePath string
+	filePath string // A file, or a comma-separated list of files and glob patterns
 	logger   *logger.Logger
+
+	// Normalize reduces addresses pasted from wallet apps, such as solana:ADDR URIs or
+	// quoted addresses, to the bare pubkey so they dedupe with their plain form
+	Normalize bool
+
+	// Strict fails the whole file when any line is not a valid address, instead of
+	// skipping those lines with a warning
+	Strict bool
+
+	// AllowDuplicates keeps repeated addresses instead of dropping all but the first
+	AllowDuplicates bool
+
+	// Source replaces the addresses files when set, e.g. with a database table
+	Source LineSource
+}
+
+// LineSource supplies the lines of an address roster kept somewhere other than files.
+// Each line is an address optionally followed by annotations, as in an addresses file.
+type LineSource interface {
+	// AddressLines returns the roster's lines in order
+	AddressLines() ([]string, error)
+	// String names the source in logs
+	String() string
+}
+
+// InvalidAddress is a line of an addresses file that is not a valid wallet address
+type InvalidAddress struct {
+	File    string
+	Line    int
+	Address string
+	Reason  string
+}
+
+// Entry is a wallet address together with its optional annotations.
+// Annotations follow the address on the same line, separated by whitespace:
+//
+//	<address> skip_sol expect>=1000
+//	<address> type=vote
+type Entry struct {
+	Address      string
+	SkipSol      bool               // Do not fetch the SOL balance for this wallet
+	AccountType  solana.AccountType // Fetch a vote or stake account's stake instead of a token balance
+	Expectations []Expectation      // Assertions on the token balance, checked after each fetch
+	Source       string             // Addresses file the wallet was read from
+}
+
+// Expectation asserts a bound on a wallet's token balance, written as expect>=N or expect<=N
+type Expectation struct {
+	Op    string // ">=" or "<="
+	Value float64
+}
+
+// Holds reports whether balance satisfies the expectation
+func (e Expectation) Holds(balance float64) bool {
+	if e.Op == "<=" {
+		return balance <= e.Value
+	}
+	return balance >= e.Value
+}
+
+// String renders the expectation as written in the addresses file, without the prefix
+func (e Expectation) String() string {
+	return e.Op + strconv.FormatFloat(e.Value, 'f', -1, 64)
+}
+
+// parseExpectation parses an expect>=N or expect<=N annotation
+func parseExpectation(annotation string) (Expectation, bool) {
+	rest, ok := strings.CutPrefix(strings.ToLower(annotation), "expect")
+	if !ok {
+		return Expectation{}, false
+	}
+	for _, op := range []string{">=", "<="} {
+		if number, ok := strings.CutPrefix(rest, op); ok {
+			value, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return Expectation{}, false
+			}
+			return Expectation{Op: op, Value: value}, true
+		}
+	}
+	return Expectation{}, false
+}
+
+// invisibleChars strips characters that copy-paste from chat apps leaves around
+// addresses: zero-width spaces and joiners and byte order marks are removed, and
+// non-breaking spaces become plain spaces so annotations still split
+var invisibleChars = strings.NewReplacer(
+	"\u200b", "", // zero-width space
+	"\u200c", "", // zero-width non-joiner
+	"\u200d", "", // zero-width joiner
+	"\u2060", "", // word joiner
+	"\ufeff", "", // byte order mark
+	"\u00a0", " ", // non-breaking space
+	"\u202f", " ", // narrow non-breaking space
+)
+
+// sanitizeLine removes invisible characters from a line and reports whether any were found
+func sanitizeLine(line string) (string, bool) {
+	sanitized := invisibleChars.Replace(line)
+	return sanitized, sanitized != line
+}
+
+// addressPunctuation is stripped from both ends of an address; none of it is base58
+const addressPunctuation = "\"'`<>()[]{},;./"
+
+// normalizeAddress strips surrounding punctuation and a solana: URI scheme with its
+// query string from an address. Base58 is case-sensitive, so case is kept.
+func normalizeAddress(address string) string {
+	normalized := strings.Trim(address, addressPunctuation)
+	const scheme = "solana:"
+	if len(normalized) > len(scheme) && strings.EqualFold(normalized[:len(scheme)], scheme) {
+		normalized = normalized[len(scheme):]
+	}
+	if i := strings.IndexAny(normalized, "?#"); i >= 0 {
+		normalized = normalized[:i]
+	}
+	return strings.Trim(normalized, addressPunctuation)
 }
 
 // New creates a new AddressReader
@@ -23,17 +145,233 @@ func New(filePath string, logger *logger.Logger) *AddressReader {
 	}
 }
 
-// ReadAddresses reads all addresses from the configured file
+// ReadAddresses reads all valid addresses from the configured files, ignoring annotations
 func (r *AddressReader) ReadAddresses() ([]string, error) {
-	r.logger.Log(fmt.Sprintf("Reading addresses from %s", r.filePath))
+	entries, _, err := r.ReadEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		addresses = append(addresses, entry.Address)
+	}
+	return addresses, nil
+}
+
+// files expands the configured path, a comma-separated list of files or glob patterns,
+// into the address files to read, in the order given
+func (r *AddressReader) files() ([]string, error) {
+	var files []string
+	for _, pattern := range strings.Split(r.filePath, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			files = append(files, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid addresses file pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no addresses files match %q", pattern)
+		}
+		files = append(files, matches...)
+	}
 
-	file, err := os.Open(r.filePath)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no addresses file configured")
+	}
+	return files, nil
+}
+
+// readLines returns the lines of a file
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open addresses file: %w", err)
 	}
 	defer file.Close()
 
-	var addresses []string
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading addresses file %s: %w", path, err)
+	}
+	return lines, nil
+}
+
+// readSource reads the lines of the configured LineSource
+func (r *AddressReader) readSource() ([]string, [][]string, error) {
+	lines, err := r.Source.AddressLines()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read addresses from %s: %w", r.Source, err)
+	}
+	return []string{r.Source.String()}, [][]string{lines}, nil
+}
+
+// readFiles reads the configured files concurrently, returning their lines in order
+func (r *AddressReader) readFiles() ([]string, [][]string, error) {
+	files, err := r.files()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contents := make([][]string, len(files))
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, path := range files {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			contents[i], errs[i] = readLines(path)
+		}(i, path)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return files, contents, nil
+}
+
+// ReadEntries reads all addresses and their annotations from the configured files,
+// which are read concurrently and merged in the configured order, or from the Source;
+// an address listed in several files keeps its first occurrence. Lines that are not a
+// base58-encoded 32-byte public key are skipped and returned as invalid, or fail the
+// whole read when Strict is set.
+func (r *AddressReader) ReadEntries() ([]Entry, []InvalidAddress, error) {
+	read, from := r.readFiles, r.filePath
+	if r.Source != nil {
+		read, from = r.readSource, r.Source.String()
+	}
+	r.logger.Log(fmt.Sprintf("Reading addresses from %s", from))
+
+	files, contents, err := read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []Entry
+	var invalid []InvalidAddress
+	seen := make(map[string]string) // Location of each address's first occurrence
+	duplicates := 0
+
+	for i, path := range files {
+		for index, rawLine := range contents[i] {
+			lineNumber := index + 1
+			location := fmt.Sprintf("line %d", lineNumber)
+			if r.Source != nil {
+				location = fmt.Sprintf("row %d", lineNumber)
+			} else if len(files) > 1 {
+				location = fmt.Sprintf("%s line %d", path, lineNumber)
+			}
+
+			// Rescue addresses pasted with invisible characters that break base58 decoding
+			line, changed := sanitizeLine(rawLine)
+			line = strings.TrimSpace(line)
+
+			// Skip empty lines and comments
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			if changed {
+				r.logger.Warn(fmt.Sprintf("removed invisible characters from %s", location))
+			}
+
+			fields := strings.Fields(line)
+			address := fields[0]
+			if r.Normalize {
+				if normalized := normalizeAddress(address); normalized != address {
+					r.logger.Debug(fmt.Sprintf("Normalized address %q to %s on %s", address, normalized, location))
+					address = normalized
+				}
+			}
+
+			// Catch typos here rather than as an RPC error later
+			if err := validateAddress(address); err != nil {
+				r.logger.Warn(fmt.Sprintf("skipping invalid address %q on %s: %v", address, location, err))
+				invalid = append(invalid, InvalidAddress{File: path, Line: lineNumber, Address: address, Reason: err.Error()})
+				continue
+			}
+
+			// Fetching a wallet twice would count its balance twice in totals
+			if first, ok := seen[address]; !ok {
+				seen[address] = location
+			} else if !r.AllowDuplicates {
+				r.logger.Warn(fmt.Sprintf("ignoring duplicate address %s on %s (first on %s)", address, location, first))
+				duplicates++
+				continue
+			}
+
+			entry := Entry{Address: address, Source: path}
+			for _, annotation := range fields[1:] {
+				if expectation, ok := parseExpectation(annotation); ok {
+					entry.Expectations = append(entry.Expectations, expectation)
+					continue
+				}
+
+				if value, ok := strings.CutPrefix(strings.ToLower(annotation), "type="); ok {
+					accountType, err := solana.ParseAccountType(value)
+					if err != nil {
+						r.logger.Warn(fmt.Sprintf("ignoring annotation %q on %s: %v", annotation, location, err))
+						continue
+					}
+					entry.AccountType = accountType
+					continue
+				}
+
+				switch strings.ToLower(annotation) {
+				case "skip_sol":
+					entry.SkipSol = true
+				default:
+					r.logger.Warn(fmt.Sprintf("ignoring unknown annotation %q on %s", annotation, location))
+				}
+			}
+
+			entries = append(entries, entry)
+		}
+	}
+
+	if r.Strict && len(invalid) > 0 {
+		return nil, invalid, fmt.Errorf("%d invalid addresses, first on line %d of %s: %s",
+			len(invalid), invalid[0].Line, invalid[0].File, invalid[0].Reason)
+	}
+
+	if duplicates > 0 {
+		r.logger.Log(fmt.Sprintf("Removed %d duplicate addresses", duplicates))
+	}
+
+	if r.Source != nil {
+		r.logger.Log(fmt.Sprintf("Successfully loaded %d addresses from %s (%d invalid skipped)",
+			len(entries), r.Source, len(invalid)))
+	} else {
+		r.logger.Log(fmt.Sprintf("Successfully loaded %d addresses from %d files (%d invalid skipped)",
+			len(entries), len(files), len(invalid)))
+	}
+	return entries, invalid, nil
+}
+
+// ReadRecipients reads email recipients from a file, one per line.
+// Empty lines and comments are ignored and invalid addresses are skipped with a warning.
+func ReadRecipients(filePath string, logger *logger.Logger) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recipients file: %w", err)
+	}
+	defer file.Close()
+
+	var recipients []string
 	scanner := bufio.NewScanner(file)
 	lineNumber := 0
 
@@ -46,13 +384,18 @@ func (r *AddressReader) ReadAddresses() ([]string, error) {
 			continue
 		}
 
-		addresses = append(addresses, line)
+		parsed, err := mail.ParseAddress(line)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("skipping invalid recipient %q on line %d: %v", line, lineNumber, err))
+			continue
+		}
+
+		recipients = append(recipients, parsed.Address)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading addresses file: %w", err)
+		return nil, fmt.Errorf("error reading recipients file: %w", err)
 	}
 
-	r.logger.Log(fmt.Sprintf("Successfully loaded %d addresses", len(addresses)))
-	return addresses, nil
+	return recipients, nil
 }
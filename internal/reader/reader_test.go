@@ -0,0 +1,250 @@
+package reader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+)
+
+// Valid addresses to list in test files
+const (
+	walletA = "So11111111111111111111111111111111111111112"
+	walletB = "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA"
+	walletC = "Vote111111111111111111111111111111111111111"
+)
+
+// testReader returns a reader of an addresses file with the given content
+func testReader(t *testing.T, content string) *AddressReader {
+	t.Helper()
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	path := filepath.Join(t.TempDir(), "addresses.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return New(path, log)
+}
+
+func TestExpectationAnnotations(t *testing.T) {
+	r := testReader(t, fmt.Sprintf("%s expect>=1000\n%s skip_sol EXPECT<=2.5 expect>=1\n%s expect=5\n", walletA, walletB, walletC))
+	entries, _, err := r.ReadEntries()
+	if err != nil {
+		t.Fatalf("ReadEntries: %v", err)
+	}
+
+	want := map[string]string{
+		walletA: "[>=1000]",
+		walletB: "[<=2.5 >=1]",
+		walletC: "[]",
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("read %d entries, want %d", len(entries), len(want))
+	}
+	for _, entry := range entries {
+		if got := fmt.Sprint(entry.Expectations); got != want[entry.Address] {
+			t.Errorf("%s expectations = %s, want %s", entry.Address, got, want[entry.Address])
+		}
+	}
+}
+
+func TestExpectationHolds(t *testing.T) {
+	tests := []struct {
+		expectation Expectation
+		balance     float64
+		want        bool
+	}{
+		{Expectation{">=", 1000}, 1000, true},
+		{Expectation{">=", 1000}, 999.99, false},
+		{Expectation{"<=", 2.5}, 2.5, true},
+		{Expectation{"<=", 2.5}, 3, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.expectation.Holds(tt.balance); got != tt.want {
+			t.Errorf("%s holds for %v = %v, want %v", tt.expectation, tt.balance, got, tt.want)
+		}
+	}
+}
+
+func TestInvisibleCharacters(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "zero-width space", line: "\u200b" + walletA + "\u200b"},
+		{name: "non-breaking spaces", line: "\u00a0" + walletA + "\u00a0\u202f"},
+		{name: "byte order mark", line: "\ufeff" + walletA},
+		{name: "joiners", line: walletA + "\u200c\u200d\u2060"},
+		{name: "non-breaking space before annotation", line: walletA + "\u00a0expect>=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testReader(t, tt.line+"\n")
+			addresses, err := r.ReadAddresses()
+			if err != nil {
+				t.Fatalf("ReadAddresses: %v", err)
+			}
+			if len(addresses) != 1 || addresses[0] != walletA {
+				t.Errorf("read %q, want [%s]", addresses, walletA)
+			}
+		})
+	}
+}
+
+func TestNormalizeAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		normalize bool
+		want      []string
+	}{
+		{
+			name:      "solana URI dedupes with the bare address",
+			content:   "solana:" + walletA + "\n" + walletA + "\n",
+			normalize: true,
+			want:      []string{walletA},
+		},
+		{
+			name:      "URI with query and punctuation",
+			content:   "<solana:" + walletA + "?amount=1&label=x>\n\"" + walletB + "\",\n" + walletB + "\n",
+			normalize: true,
+			want:      []string{walletA, walletB},
+		},
+		{
+			name:      "case is kept",
+			content:   "SOLANA:" + walletC + "\n",
+			normalize: true,
+			want:      []string{walletC},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testReader(t, tt.content)
+			r.Normalize = tt.normalize
+			addresses, err := r.ReadAddresses()
+			if err != nil {
+				t.Fatalf("ReadAddresses: %v", err)
+			}
+			if fmt.Sprint(addresses) != fmt.Sprint(tt.want) {
+				t.Errorf("read %q, want %q", addresses, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidAddresses(t *testing.T) {
+	content := walletA + "\n" +
+		"So1111111111\n" + // Too short to be a 32-byte key
+		"0OIl" + walletB[4:] + "\n" + // 0, O, I and l are not in the base58 alphabet
+		walletB + "\n"
+
+	tests := []struct {
+		strict      bool
+		wantErr     bool
+		wantEntries []string
+	}{
+		{strict: false, wantEntries: []string{walletA, walletB}},
+		{strict: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("strict=%v", tt.strict), func(t *testing.T) {
+			r := testReader(t, content)
+			r.Strict = tt.strict
+			entries, invalid, err := r.ReadEntries()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadEntries error = %v, want error %v", err, tt.wantErr)
+			}
+
+			// Both modes report every invalid line with its line number
+			if len(invalid) != 2 || invalid[0].Line != 2 || invalid[1].Line != 3 {
+				t.Errorf("invalid = %+v, want lines 2 and 3", invalid)
+			}
+			if len(entries) != len(tt.wantEntries) {
+				t.Fatalf("read %d entries, want %v", len(entries), tt.wantEntries)
+			}
+			for i, want := range tt.wantEntries {
+				if entries[i].Address != want {
+					t.Errorf("entry %d = %s, want %s", i, entries[i].Address, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicateAddresses(t *testing.T) {
+	// Interleaved repeats, one padded with whitespace
+	content := walletA + "\n" + walletB + "\n  " + walletA + "  \n" + walletC + "\n" + walletB + "\n"
+
+	tests := []struct {
+		allowDuplicates bool
+		want            []string
+	}{
+		{allowDuplicates: false, want: []string{walletA, walletB, walletC}},
+		{allowDuplicates: true, want: []string{walletA, walletB, walletA, walletC, walletB}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("allow=%v", tt.allowDuplicates), func(t *testing.T) {
+			r := testReader(t, content)
+			r.AllowDuplicates = tt.allowDuplicates
+			addresses, err := r.ReadAddresses()
+			if err != nil {
+				t.Fatalf("ReadAddresses: %v", err)
+			}
+			if fmt.Sprint(addresses) != fmt.Sprint(tt.want) {
+				t.Errorf("read %q, want %q", addresses, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeAddressFiles(t *testing.T) {
+	dir := t.TempDir()
+	teamA := filepath.Join(dir, "team_a.txt")
+	teamB := filepath.Join(dir, "team_b.txt")
+	if err := os.WriteFile(teamA, []byte(walletA+"\n"+walletB+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(teamB, []byte(walletB+"\n"+walletC+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// walletB is listed by both teams and keeps its first file
+	want := []Entry{{Address: walletA, Source: teamA}, {Address: walletB, Source: teamA}, {Address: walletC, Source: teamB}}
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "comma-separated list", path: teamA + ", " + teamB},
+		{name: "glob", path: filepath.Join(dir, "team_*.txt")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testReader(t, "")
+			r.filePath = tt.path
+			entries, invalid, err := r.ReadEntries()
+			if err != nil || len(invalid) != 0 {
+				t.Fatalf("ReadEntries = %v invalid, %v", invalid, err)
+			}
+			if len(entries) != len(want) {
+				t.Fatalf("read %d entries, want %d", len(entries), len(want))
+			}
+			for i, entry := range entries {
+				if entry.Address != want[i].Address || entry.Source != want[i].Source {
+					t.Errorf("entry %d = %s from %s, want %s from %s", i, entry.Address, entry.Source, want[i].Address, want[i].Source)
+				}
+			}
+		})
+	}
+}
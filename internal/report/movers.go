@@ -0,0 +1,68 @@
+package report
+
+import (
+	"sort"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// Mover is a wallet whose token balance changed since the previous run
+type Mover struct {
+	WalletAddress   string
+	PreviousBalance float64
+	CurrentBalance  float64
+	Change          float64
+	PercentChange   float64 // Zero when the previous balance was zero
+}
+
+// TopMovers returns up to n of the largest increases and decreases against the previous balances.
+// Wallets without prior data, failed fetches and unchanged balances are excluded.
+func TopMovers(balances []*solana.TokenBalance, previous map[string]float64, n int) (increases, decreases []Mover) {
+	for _, balance := range balances {
+		if balance.FetchError != nil {
+			continue
+		}
+		prev, ok := previous[balance.WalletAddress]
+		if !ok || prev == balance.Balance {
+			continue
+		}
+
+		mover := Mover{
+			WalletAddress:   balance.WalletAddress,
+			PreviousBalance: prev,
+			CurrentBalance:  balance.Balance,
+			Change:          balance.Balance - prev,
+		}
+		if prev != 0 {
+			mover.PercentChange = mover.Change / prev * 100
+		}
+
+		if mover.Change > 0 {
+			increases = append(increases, mover)
+		} else {
+			decreases = append(decreases, mover)
+		}
+	}
+
+	// Largest absolute change first, ties broken by address for stable output
+	sort.Slice(increases, func(i, j int) bool {
+		if increases[i].Change != increases[j].Change {
+			return increases[i].Change > increases[j].Change
+		}
+		return increases[i].WalletAddress < increases[j].WalletAddress
+	})
+	sort.Slice(decreases, func(i, j int) bool {
+		if decreases[i].Change != decreases[j].Change {
+			return decreases[i].Change < decreases[j].Change
+		}
+		return decreases[i].WalletAddress < decreases[j].WalletAddress
+	})
+
+	if len(increases) > n {
+		increases = increases[:n]
+	}
+	if len(decreases) > n {
+		decreases = decreases[:n]
+	}
+	return increases, decreases
+}
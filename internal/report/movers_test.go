@@ -0,0 +1,64 @@
+package report
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+func TestTopMovers(t *testing.T) {
+	previous := map[string]float64{"up10": 10, "up5": 5, "upFromZero": 0, "down8": 20, "down1": 3, "flat": 7, "failed": 1}
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "up10", Balance: 20},
+		{WalletAddress: "up5", Balance: 10},
+		{WalletAddress: "upFromZero", Balance: 5},
+		{WalletAddress: "down8", Balance: 12},
+		{WalletAddress: "down1", Balance: 2},
+		{WalletAddress: "flat", Balance: 7},
+		{WalletAddress: "failed", FetchError: errors.New("rpc timeout")},
+		{WalletAddress: "new", Balance: 100},
+	}
+
+	tests := []struct {
+		name          string
+		n             int
+		wantIncreases []string
+		wantDecreases []string
+	}{
+		{name: "all movers", n: 5, wantIncreases: []string{"up10", "up5", "upFromZero"}, wantDecreases: []string{"down8", "down1"}},
+		{name: "top one", n: 1, wantIncreases: []string{"up10"}, wantDecreases: []string{"down8"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			increases, decreases := TopMovers(balances, previous, tt.n)
+			checkMovers(t, "increases", increases, tt.wantIncreases)
+			checkMovers(t, "decreases", decreases, tt.wantDecreases)
+		})
+	}
+
+	increases, decreases := TopMovers(balances, previous, 5)
+	if got := increases[0]; got.Change != 10 || got.PercentChange != 100 {
+		t.Errorf("up10 changed by %v (%v%%), want 10 (100%%)", got.Change, got.PercentChange)
+	}
+	if got := increases[2]; got.PercentChange != 0 {
+		t.Errorf("a move from zero has a percent change of %v, want none", got.PercentChange)
+	}
+	if got := decreases[0]; got.Change != -8 || got.PercentChange != -40 {
+		t.Errorf("down8 changed by %v (%v%%), want -8 (-40%%)", got.Change, got.PercentChange)
+	}
+}
+
+// checkMovers compares the wallets of movers, in order, with want
+func checkMovers(t *testing.T, kind string, movers []Mover, want []string) {
+	t.Helper()
+	if len(movers) != len(want) {
+		t.Fatalf("%s = %+v, want %v", kind, movers, want)
+	}
+	for i, mover := range movers {
+		if mover.WalletAddress != want[i] {
+			t.Errorf("%s[%d] = %s, want %s", kind, i, mover.WalletAddress, want[i])
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package report
+
+import (
+	"sort"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// SortByBalance returns a copy of balances ordered by token balance, largest first.
+// Failed fetches sort after every numeric balance, and ties are broken by wallet
+// address so the output is deterministic.
+func SortByBalance(balances []*solana.TokenBalance) []*solana.TokenBalance {
+	sorted := make([]*solana.TokenBalance, len(balances))
+	copy(sorted, balances)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		aFailed, bFailed := a.FetchError != nil, b.FetchError != nil
+		if aFailed != bFailed {
+			return !aFailed
+		}
+		if !aFailed && a.Balance != b.Balance {
+			return a.Balance > b.Balance
+		}
+		return a.WalletAddress < b.WalletAddress
+	})
+
+	return sorted
+}
+
+// SortByAddress returns a copy of balances ordered by wallet address
+func SortByAddress(balances []*solana.TokenBalance) []*solana.TokenBalance {
+	sorted := make([]*solana.TokenBalance, len(balances))
+	copy(sorted, balances)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].WalletAddress < sorted[j].WalletAddress
+	})
+
+	return sorted
+}
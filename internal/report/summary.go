@@ -0,0 +1,76 @@
+package report
+
+import (
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// WalletBalance is a wallet and its token balance as listed in a summary
+type WalletBalance struct {
+	WalletAddress string  `json:"wallet_address"`
+	Balance       float64 `json:"balance"`
+}
+
+// Summary condenses a run's balances into totals, counts and the largest and smallest wallets
+type Summary struct {
+	Timestamp       time.Time       `json:"timestamp"`
+	TotalAddresses  int             `json:"total_addresses"`
+	Successful      int             `json:"successful"`
+	Failed          int             `json:"failed"`
+	TotalBalance    float64         `json:"total_balance"`
+	TotalSolBalance *float64        `json:"total_sol_balance,omitempty"`
+	TopWallets      []WalletBalance `json:"top_wallets"`
+	BottomWallets   []WalletBalance `json:"bottom_wallets"`
+}
+
+// Summarize builds a summary of balances fetched at ts, listing the n largest and
+// n smallest successfully fetched wallets. The SOL total is only set when SOL was fetched.
+func Summarize(balances []*solana.TokenBalance, ts time.Time, n int) Summary {
+	summary := Summary{
+		Timestamp:      ts.UTC(),
+		TotalAddresses: len(balances),
+		TopWallets:     []WalletBalance{},
+		BottomWallets:  []WalletBalance{},
+	}
+
+	solFetched := false
+	totalSol := 0.0
+	wallets := make([]*solana.TokenBalance, 0, len(balances))
+	for _, balance := range balances {
+		if balance.FetchError != nil {
+			summary.Failed++
+		} else {
+			summary.Successful++
+			summary.TotalBalance += balance.Balance
+		}
+		// Vote and stake accounts hold no tokens, so they are left out of the rankings
+		if balance.AccountType == solana.AccountWallet {
+			wallets = append(wallets, balance)
+		}
+		if balance.SolanaFetched && balance.SolanaError == nil {
+			solFetched = true
+			totalSol += balance.SolanaBalance
+		}
+	}
+	if solFetched {
+		summary.TotalSolBalance = &totalSol
+	}
+
+	// Failed fetches sort last, so the ranking stops at the first of them
+	ranked := SortByBalance(wallets)
+	for i, balance := range ranked {
+		if balance.FetchError != nil {
+			ranked = ranked[:i]
+			break
+		}
+	}
+	for i := 0; i < n && i < len(ranked); i++ {
+		summary.TopWallets = append(summary.TopWallets, WalletBalance{ranked[i].WalletAddress, ranked[i].Balance})
+	}
+	for i := len(ranked) - 1; i >= 0 && len(ranked)-1-i < n; i-- {
+		summary.BottomWallets = append(summary.BottomWallets, WalletBalance{ranked[i].WalletAddress, ranked[i].Balance})
+	}
+
+	return summary
+}
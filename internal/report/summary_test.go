@@ -0,0 +1,60 @@
+package report
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+func TestSummarize(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		balances []*solana.TokenBalance
+		n        int
+		want     Summary
+	}{
+		{
+			name: "wallets ranked, failed fetches counted",
+			balances: []*solana.TokenBalance{
+				{WalletAddress: "small", Balance: 1},
+				{WalletAddress: "large", Balance: 30},
+				{WalletAddress: "failed", FetchError: errors.New("rpc timeout")},
+				{WalletAddress: "mid", Balance: 5},
+			},
+			n: 2,
+			want: Summary{
+				Timestamp: ts, TotalAddresses: 4, Successful: 3, Failed: 1, TotalBalance: 36,
+				TopWallets:    []WalletBalance{{"large", 30}, {"mid", 5}},
+				BottomWallets: []WalletBalance{{"small", 1}, {"mid", 5}},
+			},
+		},
+		{
+			name: "vote and stake accounts not ranked",
+			balances: []*solana.TokenBalance{
+				{WalletAddress: "wallet", Balance: 2},
+				{WalletAddress: "vote", AccountType: solana.AccountVote, Stake: 1000},
+				{WalletAddress: "stake", AccountType: solana.AccountStake, Stake: 50},
+				{WalletAddress: "failed-stake", AccountType: solana.AccountStake, FetchError: errors.New("rpc timeout")},
+			},
+			n: 5,
+			want: Summary{
+				Timestamp: ts, TotalAddresses: 4, Successful: 3, Failed: 1, TotalBalance: 2,
+				TopWallets:    []WalletBalance{{"wallet", 2}},
+				BottomWallets: []WalletBalance{{"wallet", 2}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarize(tt.balances, ts, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Summarize = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// UnknownTier is the label of the tier holding wallets whose balance could not be fetched
+const UnknownTier = "unknown"
+
+// Tier is a token balance range and the wallets whose balance falls within it
+type Tier struct {
+	Label   string
+	Wallets []*solana.TokenBalance
+}
+
+// BucketByTier splits balances into tiers between ascending boundaries: with bounds
+// 0,100,10000 the tiers are 0-100, 100-10000 and >=10000, each including its lower
+// bound. Balances below the first boundary get a "<" tier, present only when non-empty,
+// and failed fetches go to the unknown tier, which is always last. Wallets keep their
+// input order within a tier.
+func BucketByTier(balances []*solana.TokenBalance, bounds []float64) []Tier {
+	var below Tier
+	if len(bounds) > 0 {
+		below.Label = "<" + formatBound(bounds[0])
+	}
+
+	tiers := make([]Tier, len(bounds))
+	for i, bound := range bounds {
+		if i+1 < len(bounds) {
+			tiers[i].Label = fmt.Sprintf("%s-%s", formatBound(bound), formatBound(bounds[i+1]))
+		} else {
+			tiers[i].Label = ">=" + formatBound(bound)
+		}
+	}
+	unknown := Tier{Label: UnknownTier}
+
+	for _, balance := range balances {
+		if balance.FetchError != nil {
+			unknown.Wallets = append(unknown.Wallets, balance)
+			continue
+		}
+
+		// The last boundary the balance reaches picks its tier
+		tier := -1
+		for i, bound := range bounds {
+			if balance.Balance >= bound {
+				tier = i
+			}
+		}
+		if tier < 0 {
+			below.Wallets = append(below.Wallets, balance)
+			continue
+		}
+		tiers[tier].Wallets = append(tiers[tier].Wallets, balance)
+	}
+
+	if len(below.Wallets) > 0 {
+		tiers = append([]Tier{below}, tiers...)
+	}
+	return append(tiers, unknown)
+}
+
+// formatBound formats a tier boundary without trailing zeros
+func formatBound(bound float64) string {
+	return strconv.FormatFloat(bound, 'f', -1, 64)
+}
@@ -0,0 +1,69 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+func TestBucketByTier(t *testing.T) {
+	balances := []*solana.TokenBalance{
+		{WalletAddress: "whale", Balance: 25000},
+		{WalletAddress: "dust", Balance: 0.5},
+		{WalletAddress: "edge", Balance: 100}, // A boundary belongs to the tier above it
+		{WalletAddress: "failed", FetchError: errors.New("rpc timeout")},
+		{WalletAddress: "mid", Balance: 9999.99},
+		{WalletAddress: "negative", Balance: -1},
+	}
+
+	tests := []struct {
+		name   string
+		bounds []float64
+		order  []string            // Tier labels in order
+		want   map[string][]string // Wallets per tier label
+	}{
+		{
+			name:   "TIERS=0,100,10000",
+			bounds: []float64{0, 100, 10000},
+			order:  []string{"<0", "0-100", "100-10000", ">=10000", UnknownTier},
+			want: map[string][]string{
+				"<0":        {"negative"},
+				"0-100":     {"dust"},
+				"100-10000": {"edge", "mid"},
+				">=10000":   {"whale"},
+				UnknownTier: {"failed"},
+			},
+		},
+		{
+			name:   "empty tiers are kept",
+			bounds: []float64{1e6},
+			order:  []string{"<1000000", ">=1000000", UnknownTier},
+			want: map[string][]string{
+				"<1000000":  {"whale", "dust", "edge", "mid", "negative"},
+				UnknownTier: {"failed"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tiers := BucketByTier(balances, tt.bounds)
+			var labels []string
+			for _, tier := range tiers {
+				labels = append(labels, tier.Label)
+				var wallets []string
+				for _, balance := range tier.Wallets {
+					wallets = append(wallets, balance.WalletAddress)
+				}
+				if fmt.Sprint(wallets) != fmt.Sprint(tt.want[tier.Label]) {
+					t.Errorf("tier %s holds %v, want %v", tier.Label, wallets, tt.want[tier.Label])
+				}
+			}
+			if fmt.Sprint(labels) != fmt.Sprint(tt.order) {
+				t.Errorf("tiers = %v, want %v", labels, tt.order)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package retention
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the timestamps embedded in generated file names, newest format first
+var timestampLayouts = []string{"2006-01-02_15_04_05", "2006-01-02_15"}
+
+// Clean deletes the files under dir named <prefix><timestamp><ext>, optionally with a
+// further suffix such as .gz or a rotated log's .1, that are older than cutoff. The age
+// comes from the timestamp in the name, or the modification time if it does not parse.
+// Subdirectories such as per-run directories are searched too, and removed when the
+// cleanup empties them.
+// It returns the number of files deleted; files that cannot be deleted are skipped and
+// the first error is returned.
+func Clean(dir, prefix, ext string, cutoff time.Time) (int, error) {
+	removed := 0
+	var firstErr error
+	emptied := make(map[string]bool) // Subdirectories that had files removed
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if firstErr == nil && !os.IsNotExist(err) {
+				firstErr = err
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !hasExt(name, ext) {
+			return nil
+		}
+
+		created, ok := nameTime(strings.TrimPrefix(name, prefix))
+		if !ok {
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+			created = info.ModTime()
+		}
+		if !created.Before(cutoff) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+			return nil
+		}
+		removed++
+		if parent := filepath.Dir(path); parent != filepath.Clean(dir) {
+			emptied[parent] = true
+		}
+		return nil
+	})
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	// os.Remove leaves directories that still hold other files alone. Deepest first, so
+	// a directory emptied by removing its subdirectories goes too.
+	subdirs := make([]string, 0, len(emptied))
+	for subdir := range emptied {
+		for ; subdir != filepath.Clean(dir) && subdir != "."; subdir = filepath.Dir(subdir) {
+			subdirs = append(subdirs, subdir)
+		}
+	}
+	sort.Slice(subdirs, func(i, j int) bool { return len(subdirs[i]) > len(subdirs[j]) })
+	for _, subdir := range subdirs {
+		os.Remove(subdir)
+	}
+
+	return removed, firstErr
+}
+
+// hasExt reports whether name ends in ext, allowing a compressed file's .gz and a
+// rotated log's numeric suffix after it
+func hasExt(name, ext string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	if suffix := filepath.Ext(name); len(suffix) > 1 && strings.Trim(suffix[1:], "0123456789") == "" {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return filepath.Ext(name) == ext
+}
+
+// nameTime parses the UTC timestamp at the start of a file name's remainder
+func nameTime(rest string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if len(rest) < len(layout) {
+			continue
+		}
+		if t, err := time.Parse(layout, rest[:len(layout)]); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
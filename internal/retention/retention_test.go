@@ -0,0 +1,128 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClean(t *testing.T) {
+	cutoff := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	old, recent := cutoff.Add(-48*time.Hour), cutoff.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		prefix   string
+		ext      string
+		files    map[string]time.Time // Files to create and their modification times
+		wantKept []string
+	}{
+		{
+			name:   "CSV files by their embedded timestamp",
+			prefix: "balance_", ext: ".csv",
+			files: map[string]time.Time{
+				"balance_2026-02-20_14_00_00.csv":     recent, // The name wins over the mtime
+				"balance_2026-02-20_14.csv.gz":        recent,
+				"balance_2026-03-02_14_00_00.csv":     old,
+				"balance_renamed.csv":                 old, // No timestamp: the mtime decides
+				"balance_renamed-recently.csv":        recent,
+				"balance_2026-02-20_14_00_00.csv.bak": recent, // Not a CSV
+				"balance_2026-02-20_14_00_00.csvx":    recent,
+				"summary_2026-02-20_14_00_00.json":    recent,
+			},
+			wantKept: []string{
+				"balance_2026-02-20_14_00_00.csv.bak",
+				"balance_2026-02-20_14_00_00.csvx",
+				"balance_2026-03-02_14_00_00.csv",
+				"balance_renamed-recently.csv",
+				"summary_2026-02-20_14_00_00.json",
+			},
+		},
+		{
+			name:   "logs and their size-rotated backups",
+			prefix: "activity_", ext: ".log",
+			files: map[string]time.Time{
+				"activity_2026-02-20_14_00_00.log":     recent,
+				"activity_2026-02-20_14_00_00.log.1":   recent,
+				"activity_2026-03-02_14_00_00.log.2":   recent,
+				"activity_2026-02-20_14_00_00.logfile": recent,
+			},
+			wantKept: []string{"activity_2026-02-20_14_00_00.logfile", "activity_2026-03-02_14_00_00.log.2"},
+		},
+		{
+			name:   "per-run directories emptied by the cleanup",
+			prefix: "balance_", ext: ".csv",
+			files: map[string]time.Time{
+				filepath.Join("run_2026-02-20_14_00_00", "balance_2026-02-20_14_00_00.csv"):            recent,
+				filepath.Join("archive", "run_2026-02-21_14_00_00", "balance_2026-02-21_14_00_00.csv"): recent,
+				filepath.Join("run_2026-02-22_14_00_00", "balance_2026-02-22_14_00_00.csv"):            recent,
+				filepath.Join("run_2026-02-22_14_00_00", "SHA256SUMS"):                                 recent,
+				filepath.Join("run_2026-03-02_14_00_00", "balance_2026-03-02_14_00_00.csv"):            recent,
+			},
+			wantKept: []string{
+				filepath.Join("run_2026-02-22_14_00_00", "SHA256SUMS"),
+				filepath.Join("run_2026-03-02_14_00_00", "balance_2026-03-02_14_00_00.csv"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, modified := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, modified, modified); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			removed, err := Clean(dir, tt.prefix, tt.ext, cutoff)
+			if err != nil {
+				t.Fatalf("Clean: %v", err)
+			}
+			if want := len(tt.files) - len(tt.wantKept); removed != want {
+				t.Errorf("Clean removed %d files, want %d", removed, want)
+			}
+
+			// Only kept files remain, and no directory is left empty
+			var kept, dirs []string
+			filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil || path == dir {
+					return err
+				}
+				rel, _ := filepath.Rel(dir, path)
+				if info.IsDir() {
+					dirs = append(dirs, rel)
+				} else {
+					kept = append(kept, rel)
+				}
+				return nil
+			})
+			sort.Strings(kept)
+			if strings.Join(kept, "\n") != strings.Join(tt.wantKept, "\n") {
+				t.Errorf("kept %q, want %q", kept, tt.wantKept)
+			}
+			for _, subdir := range dirs {
+				if entries, _ := os.ReadDir(filepath.Join(dir, subdir)); len(entries) == 0 {
+					t.Errorf("empty directory %s was left behind", subdir)
+				}
+			}
+		})
+	}
+}
+
+func TestCleanMissingDir(t *testing.T) {
+	removed, err := Clean(filepath.Join(t.TempDir(), "missing"), "balance_", ".csv", time.Now())
+	if removed != 0 || err != nil {
+		t.Errorf("Clean of a missing directory = %d, %v; want 0, nil", removed, err)
+	}
+}
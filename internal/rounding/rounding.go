@@ -0,0 +1,98 @@
+package rounding
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Mode identifies how balances are rounded to a fixed number of places
+type Mode string
+
+const (
+	HalfUp   Mode = "half_up"
+	HalfEven Mode = "half_even"
+	Floor    Mode = "floor"
+	Ceil     Mode = "ceil"
+)
+
+// ParseMode validates a rounding mode name
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case HalfUp, HalfEven, Floor, Ceil:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown rounding mode %q", value)
+	}
+}
+
+// Rounder formats balances with a fixed number of decimal places
+type Rounder struct {
+	Places int // Negative disables rounding and keeps Go's shortest formatting
+	Mode   Mode
+}
+
+// Format renders a balance using the configured rounding.
+// The float is first converted to its shortest decimal representation so that
+// rounding operates on the value users see (e.g. 1.2345) rather than its binary approximation.
+func (r Rounder) Format(value float64) string {
+	return r.FormatDecimal(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// FormatExact renders exact, a decimal string such as the RPC's uiAmountString, when it
+// is set, and value otherwise
+func (r Rounder) FormatExact(value float64, exact string) string {
+	if exact == "" {
+		return r.Format(value)
+	}
+	return r.FormatDecimal(exact)
+}
+
+// FormatDecimal rounds a decimal string without going through a float, so every digit
+// it carries is kept. Strings that are not decimals are returned unchanged.
+func (r Rounder) FormatDecimal(value string) string {
+	if r.Places < 0 {
+		return value
+	}
+
+	exact, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return value
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(r.Places)), nil)
+	scaled := new(big.Rat).Mul(exact, new(big.Rat).SetInt(scale))
+
+	// Split the scaled value into integer quotient and remainder
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if remainder.Sign() != 0 {
+		// Twice the remainder compared with the denominator tells us where we sit relative to .5
+		half := new(big.Int).Abs(remainder)
+		half.Mul(half, big.NewInt(2))
+		cmpHalf := half.Cmp(scaled.Denom())
+		negative := scaled.Sign() < 0
+
+		roundAway := false
+		switch r.Mode {
+		case Floor:
+			roundAway = negative
+		case Ceil:
+			roundAway = !negative
+		case HalfEven:
+			roundAway = cmpHalf > 0 || (cmpHalf == 0 && quotient.Bit(0) == 1)
+		default:
+			roundAway = cmpHalf >= 0
+		}
+
+		if roundAway {
+			if negative {
+				quotient.Sub(quotient, big.NewInt(1))
+			} else {
+				quotient.Add(quotient, big.NewInt(1))
+			}
+		}
+	}
+
+	return new(big.Rat).SetFrac(quotient, scale).FloatString(r.Places)
+}
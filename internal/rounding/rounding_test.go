@@ -0,0 +1,96 @@
+package rounding
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		mode   Mode
+		places int
+		value  float64
+		want   string
+	}{
+		// 1.2345 sits exactly on the boundary at 3 places
+		{HalfUp, 3, 1.2345, "1.235"},
+		{HalfEven, 3, 1.2345, "1.234"},
+		{Floor, 3, 1.2345, "1.234"},
+		{Ceil, 3, 1.2345, "1.235"},
+
+		// Half-even rounds the boundary to the even neighbour, up as well as down
+		{HalfEven, 3, 1.2355, "1.236"},
+		{HalfUp, 3, 1.2355, "1.236"},
+
+		// Away from the boundary every half mode agrees
+		{HalfUp, 2, 1.2345, "1.23"},
+		{HalfEven, 2, 1.2345, "1.23"},
+		{Floor, 2, 1.239, "1.23"},
+		{Ceil, 2, 1.231, "1.24"},
+
+		// Negative values round towards negative infinity for floor and away from zero at .5
+		{HalfUp, 3, -1.2345, "-1.235"},
+		{HalfEven, 3, -1.2345, "-1.234"},
+		{Floor, 3, -1.2345, "-1.235"},
+		{Ceil, 3, -1.2345, "-1.234"},
+
+		// Exact values are padded, not rounded
+		{Floor, 4, 2, "2.0000"},
+		{HalfUp, 0, 2.5, "3"},
+
+		// Negative places keep the shortest representation
+		{HalfUp, -1, 1.2345, "1.2345"},
+	}
+
+	for _, tt := range tests {
+		got := Rounder{Places: tt.places, Mode: tt.mode}.Format(tt.value)
+		if got != tt.want {
+			t.Errorf("%s to %d places of %v = %s, want %s", tt.mode, tt.places, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFormatExact(t *testing.T) {
+	// The float is the nearest float64 to the string, which has more digits than it holds
+	const value, exact = 123456789012.34567, "123456789012.345678901"
+	tests := []struct {
+		places int
+		exact  string
+		want   string
+	}{
+		{-1, exact, exact},
+		{8, exact, "123456789012.34567890"},
+		{2, exact, "123456789012.35"},
+		{-1, "", "123456789012.34567"},
+		{8, "", "123456789012.34567000"},
+
+		// A string that is not a decimal is printed as it came
+		{2, "n/a", "n/a"},
+	}
+
+	for _, tt := range tests {
+		got := Rounder{Places: tt.places, Mode: HalfUp}.FormatExact(value, tt.exact)
+		if got != tt.want {
+			t.Errorf("%d places of %v (exact %q) = %s, want %s", tt.places, value, tt.exact, got, tt.want)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Mode
+		wantErr bool
+	}{
+		{value: "half_up", want: HalfUp},
+		{value: " HALF_EVEN ", want: HalfEven},
+		{value: "floor", want: Floor},
+		{value: "Ceil", want: Ceil},
+		{value: "truncate", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMode(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily window, in minutes after midnight, during which emails are held back.
+// A window whose end is before its start spans midnight (e.g. 22:00-06:00).
+type QuietHours struct {
+	Start int
+	End   int
+}
+
+// ParseQuietHours parses a window written as "HH:MM-HH:MM"
+func ParseQuietHours(value string) (*QuietHours, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected HH:MM-HH:MM, got %q", value)
+	}
+
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("quiet hours %q start and end at the same time", value)
+	}
+
+	return &QuietHours{Start: start, End: end}, nil
+}
+
+// parseClock converts "HH:MM" to minutes after midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t falls inside the window, using t's own location
+func (q *QuietHours) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if q.Start < q.End {
+		return minute >= q.Start && minute < q.End
+	}
+	return minute >= q.Start || minute < q.End
+}
+
+// String renders the window as "HH:MM-HH:MM"
+func (q *QuietHours) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", q.Start/60, q.Start%60, q.End/60, q.End%60)
+}
@@ -0,0 +1,21 @@
+package solana
+
+import "context"
+
+// attemptsKey is the context key of an attempt counter, see CountAttempts
+type attemptsKey struct{}
+
+// CountAttempts returns a context in which RecordAttempt counts the requests made for a
+// fetch, retries included, and the counter it increments. The context must not be
+// shared by concurrent fetches.
+func CountAttempts(ctx context.Context) (context.Context, *int) {
+	attempts := new(int)
+	return context.WithValue(ctx, attemptsKey{}, attempts), attempts
+}
+
+// RecordAttempt counts a request attempt on the context's counter, if it has one
+func RecordAttempt(ctx context.Context) {
+	if attempts, ok := ctx.Value(attemptsKey{}).(*int); ok {
+		*attempts++
+	}
+}
@@ -0,0 +1,319 @@
+package solana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BulkChunkSize is the number of wallets per getMultipleAccounts request and per batch
+// of getTokenAccountsByOwner requests; getMultipleAccounts accepts at most 100 accounts
+const BulkChunkSize = 100
+
+// rpcResponse is one response object of a JSON-RPC batch
+type rpcResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// callBatch sends a JSON-RPC batch with one request per params entry and returns the raw
+// result or error of each request, in order. The returned error is set when the batch
+// as a whole failed.
+func (c *Client) callBatch(ctx context.Context, target, method string, paramsList [][]interface{}) ([]json.RawMessage, []error, error) {
+	requests := make([]map[string]interface{}, len(paramsList))
+	for i, params := range paramsList {
+		requests[i] = map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      i,
+			"method":  method,
+			"params":  params,
+		}
+	}
+
+	requestJSON, err := json.Marshal(requests)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal batch request: %w", err)
+	}
+
+	body, err := c.post(ctx, target, method, requestJSON)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var responses []rpcResponse
+	if err := json.Unmarshal(body, &responses); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse batch response: %w", err)
+	}
+
+	// Responses may arrive in any order and a node may drop some; match them by id
+	results := make([]json.RawMessage, len(paramsList))
+	errs := make([]error, len(paramsList))
+	for i := range errs {
+		errs[i] = fmt.Errorf("no response to %s in batch", method)
+	}
+	for _, response := range responses {
+		if response.ID < 0 || response.ID >= len(paramsList) {
+			continue
+		}
+		if response.Error != nil {
+			errs[response.ID] = response.Error
+			continue
+		}
+		results[response.ID] = response.Result
+		errs[response.ID] = nil
+	}
+
+	return results, errs, nil
+}
+
+// fetchLamportsChunk fetches the SOL balances of up to BulkChunkSize wallets with a single
+// getMultipleAccounts request. Wallets without an account on chain hold 0 lamports.
+// Like single-wallet reads, the request carries the commitment and any pinned slot.
+func (c *Client) fetchLamportsChunk(ctx context.Context, wallets []string) ([]Lamports, error) {
+	params := []interface{}{
+		wallets,
+		c.requestConfig(map[string]interface{}{
+			"encoding": "base64",
+			// Only the lamports are needed, not the account data
+			"dataSlice": map[string]int{"offset": 0, "length": 0},
+		}),
+	}
+
+	var result struct {
+		Value []*struct {
+			Lamports Lamports `json:"lamports"`
+		} `json:"value"`
+	}
+
+	target := fmt.Sprintf("%d wallets", len(wallets))
+	if err := c.call(ctx, target, "getMultipleAccounts", params, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Value) != len(wallets) {
+		return nil, fmt.Errorf("getMultipleAccounts returned %d accounts for %d wallets", len(result.Value), len(wallets))
+	}
+
+	lamports := make([]Lamports, len(wallets))
+	for i, account := range result.Value {
+		if account != nil {
+			lamports[i] = account.Lamports
+		}
+	}
+	return lamports, nil
+}
+
+// fetchSolChunk fetches the SOL balances of up to BulkChunkSize wallets. When the
+// getMultipleAccounts request fails as a whole (e.g. one invalid address fails it) the
+// wallets are fetched one by one with getBalance, so each error belongs to its wallet.
+func (c *Client) fetchSolChunk(ctx context.Context, wallets []string) ([]Lamports, []error) {
+	errs := make([]error, len(wallets))
+	lamports, err := c.fetchLamportsChunk(ctx, wallets)
+	if err == nil {
+		return lamports, errs
+	}
+
+	lamports = make([]Lamports, len(wallets))
+	if ctx.Err() != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return lamports, errs
+	}
+
+	c.logger.Warn(fmt.Sprintf("getMultipleAccounts for %d wallets failed, fetching them one by one: %v", len(wallets), err))
+	for i, wallet := range wallets {
+		lamports[i], errs[i] = c.FetchLamports(ctx, wallet)
+	}
+	return lamports, errs
+}
+
+// fetchTokenChunk fetches the token balances of up to BulkChunkSize wallets with a single
+// batch of getTokenAccountsByOwner requests. Each wallet gets a balance or an error.
+// Vote and stake accounts hold no token accounts and are fetched one by one instead.
+func (c *Client) fetchTokenChunk(ctx context.Context, wallets []string) ([]*TokenBalance, []error) {
+	balances := make([]*TokenBalance, len(wallets))
+	errs := make([]error, len(wallets))
+
+	var batched []int // Indexes of the plain wallets in wallets
+	for i, wallet := range wallets {
+		if accountType := c.accountTypes[wallet]; accountType != AccountWallet {
+			balances[i], errs[i] = c.fetchDerived(ctx, wallet, accountType)
+			continue
+		}
+		batched = append(batched, i)
+	}
+	if len(batched) == 0 {
+		return balances, errs
+	}
+
+	paramsList := make([][]interface{}, len(batched))
+	for i, index := range batched {
+		paramsList[i] = []interface{}{
+			wallets[index],
+			map[string]string{
+				"mint": c.tokenMint,
+			},
+			c.requestConfig(map[string]interface{}{
+				"encoding": "jsonParsed",
+			}),
+		}
+	}
+
+	target := fmt.Sprintf("%d wallets", len(batched))
+	results, callErrs, err := c.callBatch(ctx, target, "getTokenAccountsByOwner", paramsList)
+	if err != nil {
+		for _, index := range batched {
+			errs[index] = err
+		}
+		return balances, errs
+	}
+
+	for i, index := range batched {
+		wallet := wallets[index]
+		var result tokenAccountsResult
+		if callErrs[i] != nil {
+			if !c.isZeroBalanceError(callErrs[i]) {
+				errs[index] = callErrs[i]
+				continue
+			}
+			c.logger.Debug(fmt.Sprintf("Treating %v for %s as a zero balance", callErrs[i], wallet))
+		} else if err := json.Unmarshal(results[i], &result); err != nil {
+			errs[index] = fmt.Errorf("failed to parse getTokenAccountsByOwner result: %w", err)
+			continue
+		}
+		balances[index] = result.tokenBalance(wallet, c.PreferUIString)
+	}
+	return balances, errs
+}
+
+// chunkAddresses splits addresses into consecutive chunks of at most size
+func chunkAddresses(addresses []string, size int) [][]string {
+	var chunks [][]string
+	for start := 0; start < len(addresses); start += size {
+		end := start + size
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+		chunks = append(chunks, addresses[start:end])
+	}
+	return chunks
+}
+
+// fetchBulk implements FetchTokenBalances in BulkMode. Token balances are fetched in
+// batches of getTokenAccountsByOwner requests while SOL balances are fetched with
+// chunked getMultipleAccounts requests in parallel; the two are merged by wallet.
+// concurrencyLimit bounds the number of requests in flight.
+func (c *Client) fetchBulk(ctx context.Context, addresses []string, concurrencyLimit int) ([]*TokenBalance, []error) {
+	balances := make([]*TokenBalance, 0, len(addresses))
+	errors := make([]error, 0)
+
+	tokenChunks := chunkAddresses(addresses, BulkChunkSize)
+
+	var solWallets []string
+	if c.FetchSol {
+		for _, address := range addresses {
+			if !c.skipSol[address] {
+				solWallets = append(solWallets, address)
+			}
+		}
+	}
+	solChunks := chunkAddresses(solWallets, BulkChunkSize)
+
+	c.logger.Log(fmt.Sprintf("Starting bulk fetch of %d addresses in %d token and %d SOL requests with concurrency limit %d",
+		len(addresses), len(tokenChunks), len(solChunks), concurrencyLimit))
+
+	sem := make(chan struct{}, concurrencyLimit)
+	var wg sync.WaitGroup
+
+	// Token batches write to their own slice range, so they need no lock
+	tokens := make([]*TokenBalance, len(addresses))
+	tokenErrs := make([]error, len(addresses))
+	tokenAttempts := make([]int, len(addresses))
+	for i, chunk := range tokenChunks {
+		wg.Add(1)
+		go func(offset int, chunk []string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			// Every wallet of a batch shares its request attempts
+			chunkCtx, attempts := CountAttempts(ctx)
+			chunkBalances, chunkErrs := c.fetchTokenChunk(chunkCtx, chunk)
+			copy(tokens[offset:], chunkBalances)
+			copy(tokenErrs[offset:], chunkErrs)
+			for j := range chunk {
+				tokenAttempts[offset+j] = *attempts
+			}
+		}(i*BulkChunkSize, chunk)
+	}
+
+	var solLock sync.Mutex
+	lamports := make(map[string]Lamports, len(solWallets))
+	solErrs := make(map[string]error)
+	for _, chunk := range solChunks {
+		wg.Add(1)
+		go func(chunk []string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			values, errs := c.fetchSolChunk(ctx, chunk)
+
+			solLock.Lock()
+			defer solLock.Unlock()
+			for i, wallet := range chunk {
+				if errs[i] != nil {
+					solErrs[wallet] = errs[i]
+				} else {
+					lamports[wallet] = values[i]
+				}
+			}
+		}(chunk)
+	}
+
+	wg.Wait()
+
+	// Merge the two passes in address order
+	for i, address := range addresses {
+		balance, err := tokens[i], tokenErrs[i]
+		if err != nil {
+			// Add a placeholder with error for failed fetches
+			balance = &TokenBalance{
+				WalletAddress: address,
+				Balance:       0,
+				Timestamp:     time.Now().UTC(),
+				FetchError:    err,
+				Status:        StatusError,
+			}
+			errors = append(errors, fmt.Errorf("error fetching balance for address %s: %w", address, err))
+			c.logger.LogError(fmt.Sprintf("Failed to fetch balance for address %s", address), err)
+		}
+		balance.Attempts = tokenAttempts[i]
+		balance.AccountType = c.accountTypes[address]
+
+		if c.FetchSol && !c.skipSol[address] {
+			balance.SolanaLamports = uint64(lamports[address])
+			balance.SolanaBalance = float64(lamports[address]) / LamportsPerSol
+			balance.SolanaError = solErrs[address]
+			balance.SolanaFetched = true
+
+			if balance.SolanaError != nil {
+				errors = append(errors, fmt.Errorf("error fetching SOL balance for address %s: %w",
+					address, balance.SolanaError))
+				c.logger.LogError(fmt.Sprintf("Failed to fetch SOL balance for address %s",
+					address), balance.SolanaError)
+			}
+		}
+
+		balances = append(balances, balance)
+		if c.OnResult != nil {
+			c.OnResult(balance)
+		}
+	}
+
+	c.logCompletion(balances)
+	return balances, errors
+}
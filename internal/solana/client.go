@@ -3,91 +3,311 @@ package solana
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"math"
 	"math/big"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
 )
 
+// SystemProgramID owns every plain wallet account
+const SystemProgramID = "11111111111111111111111111111111"
+
+// DefaultMaxResponseBytes is the default cap on an RPC response body
+const DefaultMaxResponseBytes = 10 << 20
+
+// LamportsPerSol is the number of lamports in one SOL
+const LamportsPerSol = 1_000_000_000
+
+// QueryStatus describes the outcome of a token balance query
+type QueryStatus string
+
+const (
+	StatusOK        QueryStatus = "ok"         // The wallet holds at least one token account for the mint
+	StatusNoAccount QueryStatus = "no_account" // The query succeeded but the wallet has no token account
+	StatusError     QueryStatus = "error"      // The query failed
+)
+
+// Lamports is a lamport amount that decodes from either a JSON number or a numeric string,
+// since some providers return getBalance values as strings
+type Lamports uint64
+
+// UnmarshalJSON implements json.Unmarshaler
+func (l *Lamports) UnmarshalJSON(data []byte) error {
+	text := strings.Trim(string(data), `"`)
+	value, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid lamports value %s: %w", data, err)
+	}
+	*l = Lamports(value)
+	return nil
+}
+
 // TokenBalance represents a token balance entry
 type TokenBalance struct {
 	WalletAddress string
 	Balance       float64
 	Timestamp     time.Time
 	FetchError    error // Track if there was an error fetching this balance
+	Status        QueryStatus
+	SolanaBalance float64
+	SolanaFetched bool     // False when the SOL balance was not requested for this wallet
+	SolanaError   error    // Track if there was an error fetching the SOL balance
+	TokenAccounts []string // Addresses of the wallet's token accounts for the mint
+
+	SolanaLamports uint64 // Exact SOL balance in lamports
+	TokenRawAmount string // Exact token amount in base units as returned by the RPC
+	TokenUIAmount  string // Exact decimal token balance from uiAmountString, set with PreferUIString
+
+	Attempts int // Requests made for the token balance, retries included
+
+	AccountType   AccountType // Vote and stake accounts report their stake instead of a token balance
+	Stake         float64     // Activated or delegated stake in SOL of a vote or stake account
+	StakeLamports uint64      // Exact stake in lamports
+}
+
+// BalanceFetcher fetches token balances for a list of wallet addresses.
+// Failed fetches are returned as entries with FetchError set alongside the error list.
+type BalanceFetcher interface {
+	FetchTokenBalances(ctx context.Context, addresses []string, concurrencyLimit int) ([]*TokenBalance, []error)
 }
 
 // Client represents a Solana RPC client
 type Client struct {
-	rpcURL     string
 	tokenMint  string
 	httpClient *http.Client
 	logger     *logger.Logger
 	maxRetries int
 	retryDelay time.Duration
+
+	// after waits between attempts; replaced in tests
+	after func(time.Duration) <-chan time.Time
+
+	// endpoints are the RPC URLs in priority order, see SetEndpoints; serving indexes
+	// the one the last request went to
+	endpoints     []*endpoint
+	serving       int
+	endpointsLock sync.Mutex
+
+	// commitment is the bank state requests are answered from: processed, confirmed or finalized
+	commitment string
+
+	// minContextSlot pins every request to at least this slot when non-zero
+	minContextSlot uint64
+
+	// skipSol lists wallets whose SOL balance is not fetched this cycle
+	skipSol map[string]bool
+
+	// accountTypes lists the vote and stake accounts of this cycle, see SetAccountTypes
+	accountTypes map[string]AccountType
+
+	// FetchSol also fetches each wallet's SOL balance alongside the token balance
+	FetchSol bool
+
+	// PreferUIString reads token balances from uiAmountString rather than the float uiAmount,
+	// keeping the string in TokenUIAmount so reports print it without float artifacts
+	PreferUIString bool
+
+	// BulkMode fetches balances with batched requests instead of one request per wallet,
+	// see fetchBulk
+	BulkMode bool
+
+	// OnResult, when set, is called for each wallet as soon as its fetch completes
+	OnResult func(*TokenBalance)
+
+	// RetryLogEvery limits retry log lines, see ShouldLogRetry
+	RetryLogEvery int
+
+	// MaxResponseBytes caps the size of a response body; larger responses fail and are retried
+	MaxResponseBytes int64
+
+	// ZeroBalanceCodes lists JSON-RPC error codes that mean the wallet holds nothing
+	// (e.g. a provider's account-not-found code) rather than a failed fetch
+	ZeroBalanceCodes []int
+
+	// RetryOn500 also retries HTTP 500 responses, see IsRetriableStatus
+	RetryOn500 bool
+}
+
+// ShouldLogRetry reports whether a retry attempt (1-based) is logged. The first and last
+// attempts always are; in between every Nth attempt is, or none when every is 0.
+// An every of 1 logs all attempts.
+func ShouldLogRetry(attempt, maxRetries, every int) bool {
+	if attempt == 1 || attempt == maxRetries {
+		return true
+	}
+	return every > 0 && attempt%every == 0
 }
 
-// New creates a new Solana RPC client
-func New(rpcURL, tokenMint string, timeout time.Duration, maxRetries int, logger *logger.Logger) *Client {
+// New creates a new Solana RPC client. An empty commitment leaves the node's default.
+func New(rpcURL, tokenMint, commitment string, timeout time.Duration, maxRetries int, logger *logger.Logger) *Client {
 	return &Client{
-		rpcURL:     rpcURL,
 		tokenMint:  tokenMint,
+		endpoints:  newEndpoints([]string{rpcURL}),
+		commitment: commitment,
 		httpClient: &http.Client{Timeout: timeout},
 		logger:     logger,
 		maxRetries: maxRetries,
 		retryDelay: 500 * time.Millisecond,
+		after:      time.After,
+
+		RetryLogEvery:    1,
+		MaxResponseBytes: DefaultMaxResponseBytes,
 	}
 }
 
-// FetchTokenBalance fetches the token balance for a wallet address
-func (c *Client) FetchTokenBalance(ctx context.Context, walletAddress string) (*TokenBalance, error) {
-	var resp *http.Response
-	var err error
+// SetRootCAs verifies TLS connections against pool instead of the system roots
+func (c *Client) SetRootCAs(pool *x509.CertPool) {
+	c.transport().TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+}
+
+// SetResolver resolves the RPC host through resolver when opening connections
+func (c *Client) SetResolver(resolver *Resolver) {
+	c.transport().DialContext = resolver.DialContext
+}
+
+// transport returns the client's own transport, cloning the default one on first use
+func (c *Client) transport() *http.Transport {
+	if transport, ok := c.httpClient.Transport.(*http.Transport); ok {
+		return transport
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c.httpClient.Transport = transport
+	return transport
+}
 
+// rpcError represents a JSON-RPC error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// isZeroBalanceError reports whether err is an RPC error configured to mean a zero balance
+func (c *Client) isZeroBalanceError(err error) bool {
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	for _, code := range c.ZeroBalanceCodes {
+		if rpcErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// call sends a JSON-RPC request with retries and decodes the result into result
+func (c *Client) call(ctx context.Context, target, method string, params []interface{}, result interface{}) error {
 	// Prepare the JSON-RPC request
 	requestBody := map[string]interface{}{
 		"jsonrpc": "2.0",
 		"id":      1,
-		"method":  "getTokenAccountsByOwner",
-		"params": []interface{}{
-			walletAddress,
-			map[string]string{
-				"mint": c.tokenMint,
-			},
-			map[string]string{
-				"encoding": "jsonParsed",
-			},
-		},
+		"method":  method,
+		"params":  params,
 	}
 
 	requestJSON, err := json.Marshal(requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	body, err := c.post(ctx, target, method, requestJSON)
+	if err != nil {
+		return err
+	}
+
+	// Parse the response
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for RPC error
+	if response.Error != nil {
+		return response.Error
 	}
 
-	// Retry logic with exponential backoff
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("failed to parse %s result: %w", method, err)
+	}
+
+	return nil
+}
+
+// post sends a JSON-RPC request body with retries and returns the response body
+func (c *Client) post(ctx context.Context, target, method string, requestJSON []byte) ([]byte, error) {
+	var resp *http.Response
+	var body []byte
+
+	// Summarise retry attempts that were not logged individually
+	suppressed := 0
+	defer func() {
+		if suppressed > 0 {
+			c.logger.Log(fmt.Sprintf("Suppressed %d retry log lines for %s on %s", suppressed, method, target))
+		}
+	}()
+
+	// Retry logic with exponential backoff, or the wait a rate-limited node asked for
+	var retryAfter time.Duration
+	hasRetryAfter := false
+
+	// An endpoint that fails in a way a retry cannot fix hands over to the next at once,
+	// without using up a retry; each endpoint gets one such chance per request
+	failovers := 0
+	failedOver := false
 	for attempt := 0; attempt <= c.maxRetries; attempt++ {
-		if attempt > 0 {
+		if attempt > 0 && !failedOver {
 			// Calculate exponential backoff
-			backoff := time.Duration(math.Pow(2, float64(attempt-1))) * c.retryDelay
-			c.logger.Log(fmt.Sprintf("Retrying fetch for %s (attempt %d/%d) after %v",
-				walletAddress, attempt, c.maxRetries, backoff))
+			wait := time.Duration(math.Pow(2, float64(attempt-1))) * c.retryDelay
+			reason := ""
+			if hasRetryAfter {
+				wait = retryAfter
+				reason = " (Retry-After)"
+				// Waiting past the deadline would only end in cancellation
+				if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+					wait = time.Until(deadline)
+					reason = " (Retry-After, capped by the deadline)"
+				}
+			}
+			if ShouldLogRetry(attempt, c.maxRetries, c.RetryLogEvery) {
+				c.logger.Log(fmt.Sprintf("Retrying %s for %s (attempt %d/%d) after %v%s",
+					method, target, attempt, c.maxRetries, wait, reason))
+			} else {
+				suppressed++
+			}
 
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
-			case <-time.After(backoff):
+			case <-c.after(wait):
 				// Continue with retry
 			}
 		}
 
+		failedOver = false
+
 		// Create a new request
-		req, err := http.NewRequestWithContext(ctx, "POST", c.rpcURL, bytes.NewBuffer(requestJSON))
+		RecordAttempt(ctx)
+		ep := c.pickEndpoint()
+		req, err := http.NewRequestWithContext(ctx, "POST", ep.url, bytes.NewBuffer(requestJSON))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create request: %w", err)
 		}
@@ -96,72 +316,213 @@ func (c *Client) FetchTokenBalance(ctx context.Context, walletAddress string) (*
 		// Send the request
 		resp, err = c.httpClient.Do(req)
 		if err == nil && resp.StatusCode == http.StatusOK {
-			break
+			// Read a bounded body so a huge payload cannot exhaust memory
+			body, err = ReadBody(resp.Body, c.MaxResponseBytes)
+			resp.Body.Close()
+			if err == nil {
+				c.endpointSucceeded(ep)
+				break
+			}
+			err = fmt.Errorf("failed to read response: %w", err)
+		}
+
+		// Stop early on cancellation and on transport errors a retry cannot fix
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if !IsRetriableError(err) {
+				if failovers < c.endpointCount()-1 {
+					c.endpointFailed(ep, true)
+					failovers++
+					failedOver = true
+					attempt--
+					continue
+				}
+				return nil, fmt.Errorf("failed to call %s: %w", method, err)
+			}
 		}
 
+		hasRetryAfter = false
 		if resp != nil {
 			resp.Body.Close()
+
+			// Client errors and server bugs will not go away on retry
+			if err == nil && !IsRetriableStatus(resp.StatusCode, c.RetryOn500) {
+				if failovers < c.endpointCount()-1 {
+					c.endpointFailed(ep, true)
+					failovers++
+					failedOver = true
+					attempt--
+					continue
+				}
+				return nil, fmt.Errorf("failed to call %s: status code %d", method, resp.StatusCode)
+			}
+
+			// A rate-limited or unavailable node may say when to come back
+			if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+				retryAfter, hasRetryAfter = RetryAfter(resp.Header.Get("Retry-After"), time.Now())
+			}
 		}
+		c.endpointFailed(ep, false)
 
 		// If this was the last attempt, return the error
 		if attempt == c.maxRetries {
 			if err != nil {
-				return nil, fmt.Errorf("failed to fetch token balance after %d attempts: %w", c.maxRetries+1, err)
+				return nil, fmt.Errorf("failed to call %s after %d attempts: %w", method, c.maxRetries+1, err)
 			}
-			return nil, fmt.Errorf("failed to fetch token balance after %d attempts: status code %d", c.maxRetries+1, resp.StatusCode)
+			return nil, fmt.Errorf("failed to call %s after %d attempts: status code %d", method, c.maxRetries+1, resp.StatusCode)
 		}
 	}
 
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	return body, nil
+}
+
+// requestConfig adds the shared consistency settings to a request config object
+func (c *Client) requestConfig(config map[string]interface{}) map[string]interface{} {
+	if c.commitment != "" {
+		config["commitment"] = c.commitment
+	}
+	if c.minContextSlot > 0 {
+		config["minContextSlot"] = c.minContextSlot
+	}
+	return config
+}
+
+// PinSlot fetches the current slot and pins all following requests to it, so every
+// wallet in a cycle is read from a state at least as recent as the same slot.
+// On failure the previous pin is cleared and requests are left unpinned.
+func (c *Client) PinSlot() (uint64, error) {
+	c.minContextSlot = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.httpClient.Timeout*time.Duration(c.maxRetries+1))
+	defer cancel()
+
+	var slot uint64
+	if err := c.call(ctx, "cycle", "getSlot", []interface{}{c.requestConfig(map[string]interface{}{})}, &slot); err != nil {
+		return 0, fmt.Errorf("failed to fetch current slot: %w", err)
+	}
+
+	c.minContextSlot = slot
+	return slot, nil
+}
+
+// SetSkipSol sets the wallets whose SOL balance should not be fetched this cycle
+func (c *Client) SetSkipSol(wallets []string) {
+	c.skipSol = make(map[string]bool, len(wallets))
+	for _, wallet := range wallets {
+		c.skipSol[wallet] = true
+	}
+}
+
+// FetchSolanaBalance fetches the SOL balance for a wallet address
+func (c *Client) FetchSolanaBalance(ctx context.Context, walletAddress string) (float64, error) {
+	lamports, err := c.FetchLamports(ctx, walletAddress)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return 0, err
 	}
+	return float64(lamports) / LamportsPerSol, nil
+}
 
-	// Parse the response
-	var response struct {
-		Result struct {
-			Value []struct {
-				Account struct {
-					Data struct {
-						Parsed struct {
-							Info struct {
-								TokenAmount struct {
-									Amount   string  `json:"amount"`
-									Decimals int     `json:"decimals"`
-									UIAmount float64 `json:"uiAmount"`
-								} `json:"tokenAmount"`
-							} `json:"info"`
-						} `json:"parsed"`
-					} `json:"data"`
-				} `json:"account"`
-			} `json:"value"`
-		} `json:"result"`
-		Error *struct {
-			Code    int    `json:"code"`
-			Message string `json:"message"`
-		} `json:"error"`
+// FetchLamports fetches the exact SOL balance of a wallet address in lamports
+func (c *Client) FetchLamports(ctx context.Context, walletAddress string) (Lamports, error) {
+	params := []interface{}{
+		walletAddress,
+		c.requestConfig(map[string]interface{}{}),
 	}
 
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	var result struct {
+		Value Lamports `json:"value"`
 	}
 
-	// Check for RPC error
-	if response.Error != nil {
-		return nil, fmt.Errorf("RPC error %d: %s", response.Error.Code, response.Error.Message)
+	if err := c.call(ctx, walletAddress, "getBalance", params, &result); err != nil {
+		if c.isZeroBalanceError(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return result.Value, nil
+}
+
+// MinimumBalanceForRentExemption returns the SOL an account with dataLen bytes must hold
+// to be rent exempt; plain wallets have no data
+func (c *Client) MinimumBalanceForRentExemption(ctx context.Context, dataLen int) (float64, error) {
+	var lamports Lamports
+	if err := c.call(ctx, "rent", "getMinimumBalanceForRentExemption", []interface{}{dataLen}, &lamports); err != nil {
+		return 0, err
+	}
+	return float64(lamports) / LamportsPerSol, nil
+}
+
+// FetchTokenBalance fetches the token balance for a wallet address
+func (c *Client) FetchTokenBalance(ctx context.Context, walletAddress string) (*TokenBalance, error) {
+	params := []interface{}{
+		walletAddress,
+		map[string]string{
+			"mint": c.tokenMint,
+		},
+		c.requestConfig(map[string]interface{}{
+			"encoding": "jsonParsed",
+		}),
+	}
+
+	var result tokenAccountsResult
+	if err := c.call(ctx, walletAddress, "getTokenAccountsByOwner", params, &result); err != nil {
+		if !c.isZeroBalanceError(err) {
+			return nil, err
+		}
+		c.logger.Debug(fmt.Sprintf("Treating %v for %s as a zero balance", err, walletAddress))
 	}
 
+	return result.tokenBalance(walletAddress, c.PreferUIString), nil
+}
+
+// tokenAccountsResult is the jsonParsed result of getTokenAccountsByOwner
+type tokenAccountsResult struct {
+	Value []struct {
+		Pubkey  string `json:"pubkey"`
+		Account struct {
+			Data struct {
+				Parsed struct {
+					Info struct {
+						TokenAmount struct {
+							Amount         string  `json:"amount"`
+							Decimals       int     `json:"decimals"`
+							UIAmount       float64 `json:"uiAmount"`
+							UIAmountString string  `json:"uiAmountString"`
+						} `json:"tokenAmount"`
+					} `json:"info"`
+				} `json:"parsed"`
+			} `json:"data"`
+		} `json:"account"`
+	} `json:"value"`
+}
+
+// tokenBalance converts the token accounts of a wallet into its balance entry.
+// preferUIString reads the balance from uiAmountString, which keeps the exact decimal
+// value, instead of the float uiAmount, and carries the string in TokenUIAmount.
+func (result tokenAccountsResult) tokenBalance(walletAddress string, preferUIString bool) *TokenBalance {
 	// Extract balance
 	balance := 0.0
-	if len(response.Result.Value) > 0 {
+	rawAmount := "0"
+	uiAmount := ""
+	if len(result.Value) > 0 {
+		rawAmount = result.Value[0].Account.Data.Parsed.Info.TokenAmount.Amount
+
 		// Get UI amount directly if available
-		balance = response.Result.Value[0].Account.Data.Parsed.Info.TokenAmount.UIAmount
+		balance = result.Value[0].Account.Data.Parsed.Info.TokenAmount.UIAmount
+		if uiString := result.Value[0].Account.Data.Parsed.Info.TokenAmount.UIAmountString; preferUIString && uiString != "" {
+			if parsed, ok := new(big.Float).SetPrec(128).SetString(uiString); ok {
+				balance, _ = parsed.Float64()
+				uiAmount = uiString
+			}
+		}
 
 		// If UIAmount is 0, try to calculate from raw amount and decimals
 		if balance == 0 {
-			amountStr := response.Result.Value[0].Account.Data.Parsed.Info.TokenAmount.Amount
-			decimals := response.Result.Value[0].Account.Data.Parsed.Info.TokenAmount.Decimals
+			amountStr := result.Value[0].Account.Data.Parsed.Info.TokenAmount.Amount
+			decimals := result.Value[0].Account.Data.Parsed.Info.TokenAmount.Decimals
 
 			amount, ok := new(big.Int).SetString(amountStr, 10)
 			if ok {
@@ -175,16 +536,36 @@ func (c *Client) FetchTokenBalance(ctx context.Context, walletAddress string) (*
 	}
 	// When no accounts found, balance stays 0
 
+	// Keep every matched token account for reconciliation
+	tokenAccounts := make([]string, 0, len(result.Value))
+	for _, account := range result.Value {
+		tokenAccounts = append(tokenAccounts, account.Pubkey)
+	}
+
+	status := StatusOK
+	if len(result.Value) == 0 {
+		status = StatusNoAccount
+	}
+
 	return &TokenBalance{
-		WalletAddress: walletAddress,
-		Balance:       balance,
-		Timestamp:     time.Now().UTC(),
-		FetchError:    nil,
-	}, nil
+		WalletAddress:  walletAddress,
+		Balance:        balance,
+		Timestamp:      time.Now().UTC(),
+		FetchError:     nil,
+		Status:         status,
+		TokenAccounts:  tokenAccounts,
+		TokenRawAmount: rawAmount,
+		TokenUIAmount:  uiAmount,
+	}
 }
 
-// FetchTokenBalances fetches token balances for multiple wallet addresses concurrently
-func (c *Client) FetchTokenBalances(addresses []string, concurrencyLimit int) ([]*TokenBalance, []error) {
+// FetchTokenBalances fetches token balances for multiple wallet addresses concurrently.
+// When ctx is cancelled, wallets not yet fetched are returned with the context error.
+func (c *Client) FetchTokenBalances(ctx context.Context, addresses []string, concurrencyLimit int) ([]*TokenBalance, []error) {
+	if c.BulkMode {
+		return c.fetchBulk(ctx, addresses, concurrencyLimit)
+	}
+
 	balances := make([]*TokenBalance, 0, len(addresses))
 	errors := make([]error, 0)
 
@@ -196,7 +577,7 @@ func (c *Client) FetchTokenBalances(addresses []string, concurrencyLimit int) ([
 		index   int
 	}, len(addresses))
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	c.logger.Log(fmt.Sprintf("Starting to fetch balances for %d addresses with concurrency limit %d",
@@ -209,7 +590,29 @@ func (c *Client) FetchTokenBalances(addresses []string, concurrencyLimit int) ([
 		go func(i int, address string) {
 			defer func() { <-sem }() // Release semaphore
 
-			balance, err := c.FetchTokenBalance(ctx, address)
+			tokenCtx, attempts := CountAttempts(ctx)
+			balance, err := c.fetchBalance(tokenCtx, address)
+			if err != nil {
+				// Add a placeholder with error for failed fetches
+				balance = &TokenBalance{
+					WalletAddress: address,
+					Balance:       0,
+					Timestamp:     time.Now().UTC(),
+					FetchError:    err,
+					Status:        StatusError,
+				}
+			}
+			balance.Attempts = *attempts
+			balance.AccountType = c.accountTypes[address]
+
+			if c.FetchSol && !c.skipSol[address] {
+				lamports, err := c.FetchLamports(ctx, address)
+				balance.SolanaLamports = uint64(lamports)
+				balance.SolanaBalance = float64(lamports) / LamportsPerSol
+				balance.SolanaError = err
+				balance.SolanaFetched = true
+			}
+
 			resultCh <- struct {
 				balance *TokenBalance
 				err     error
@@ -221,31 +624,36 @@ func (c *Client) FetchTokenBalances(addresses []string, concurrencyLimit int) ([
 	// Collect results
 	for i := 0; i < len(addresses); i++ {
 		result := <-resultCh
+		address := addresses[result.index]
+		balances = append(balances, result.balance)
+		if c.OnResult != nil {
+			c.OnResult(result.balance)
+		}
 
 		if result.err != nil {
-			address := addresses[result.index]
 			errors = append(errors, fmt.Errorf("error fetching balance for address %s: %w",
 				address, result.err))
 			c.logger.LogError(fmt.Sprintf("Failed to fetch balance for address %s",
 				address), result.err)
+		} else if len(balances)%50 == 0 {
+			// Log every 50 fetches
+			c.logger.Debug(fmt.Sprintf("Fetched %d/%d balances", len(balances), len(addresses)))
+		}
 
-			// Add a placeholder with error for failed fetches
-			balances = append(balances, &TokenBalance{
-				WalletAddress: address,
-				Balance:       0,
-				Timestamp:     time.Now().UTC(),
-				FetchError:    result.err,
-			})
-		} else {
-			balances = append(balances, result.balance)
-
-			// Log every 50 successful fetches
-			if len(balances)%50 == 0 {
-				c.logger.Log(fmt.Sprintf("Fetched %d/%d balances", len(balances), len(addresses)))
-			}
+		if result.balance.SolanaError != nil {
+			errors = append(errors, fmt.Errorf("error fetching SOL balance for address %s: %w",
+				address, result.balance.SolanaError))
+			c.logger.LogError(fmt.Sprintf("Failed to fetch SOL balance for address %s",
+				address), result.balance.SolanaError)
 		}
 	}
 
+	c.logCompletion(balances)
+	return balances, errors
+}
+
+// logCompletion logs the number of successful and failed fetches of a cycle
+func (c *Client) logCompletion(balances []*TokenBalance) {
 	// Count successful and failed fetches
 	successCount := 0
 	failedCount := 0
@@ -259,6 +667,93 @@ func (c *Client) FetchTokenBalances(addresses []string, concurrencyLimit int) ([
 
 	c.logger.Log(fmt.Sprintf("Completed fetching balances. Success: %d, Errors: %d",
 		successCount, failedCount))
+}
 
-	return balances, errors
+// GetAccountOwner returns the program that owns an account and whether the account exists
+func (c *Client) GetAccountOwner(ctx context.Context, address string) (string, bool, error) {
+	params := []interface{}{
+		address,
+		c.requestConfig(map[string]interface{}{
+			"encoding": "base64",
+		}),
+	}
+
+	var result struct {
+		Value *struct {
+			Owner      string `json:"owner"`
+			Executable bool   `json:"executable"`
+		} `json:"value"`
+	}
+
+	if err := c.call(ctx, address, "getAccountInfo", params, &result); err != nil {
+		return "", false, err
+	}
+
+	if result.Value == nil {
+		return "", false, nil
+	}
+	return result.Value.Owner, true, nil
+}
+
+// ValidateAccounts checks that each address is a system-owned wallet rather than a
+// program, mint or token account, or owned by the vote or stake program when it is
+// typed as such. Non-wallet entries are logged and, if skip is set,
+// removed from the returned list. Unfunded addresses are treated as wallets.
+func (c *Client) ValidateAccounts(addresses []string, concurrencyLimit int, skip bool) []string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.logger.Log(fmt.Sprintf("Validating account types for %d addresses", len(addresses)))
+
+	// Create a semaphore channel to limit concurrency
+	sem := make(chan struct{}, concurrencyLimit)
+	isWallet := make([]bool, len(addresses))
+	var wg sync.WaitGroup
+
+	for i, address := range addresses {
+		sem <- struct{}{} // Acquire semaphore
+		wg.Add(1)
+
+		go func(i int, address string) {
+			defer wg.Done()
+			defer func() { <-sem }() // Release semaphore
+
+			owner, exists, err := c.GetAccountOwner(ctx, address)
+			if err != nil {
+				// Keep the address; the balance fetch will surface the problem
+				c.logger.LogError(fmt.Sprintf("Failed to validate account type for %s", address), err)
+				isWallet[i] = true
+				return
+			}
+
+			// Vote and stake accounts are expected to be owned by their program
+			isWallet[i] = !exists || owner == c.accountTypes[address].programID()
+			if !isWallet[i] {
+				c.logger.Warn(fmt.Sprintf("address %s is not a wallet (owned by program %s)", address, owner))
+			}
+		}(i, address)
+	}
+	wg.Wait()
+
+	valid := make([]string, 0, len(addresses))
+	flagged := 0
+	for i, address := range addresses {
+		if !isWallet[i] {
+			flagged++
+			if skip {
+				continue
+			}
+		}
+		valid = append(valid, address)
+	}
+
+	if flagged > 0 {
+		action := "kept"
+		if skip {
+			action = "skipped"
+		}
+		c.logger.Log(fmt.Sprintf("Found %d non-wallet addresses (%s)", flagged, action))
+	}
+
+	return valid
 }
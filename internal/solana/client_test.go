@@ -0,0 +1,1063 @@
+package solana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/rounding"
+)
+
+// testMint is the token mint test clients report on
+const testMint = "Mint1111111111111111111111111111111111111111"
+
+// rpcCall is a JSON-RPC request received by a stubRPC
+type rpcCall struct {
+	ID     int               `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// stringParam decodes the string parameter at index i, or returns "" when there is none
+func (call rpcCall) stringParam(i int) string {
+	var value string
+	if i < len(call.Params) {
+		json.Unmarshal(call.Params[i], &value)
+	}
+	return value
+}
+
+// configParam decodes the config object that is the last parameter
+func (call rpcCall) configParam() map[string]interface{} {
+	config := map[string]interface{}{}
+	if len(call.Params) > 0 {
+		json.Unmarshal(call.Params[len(call.Params)-1], &config)
+	}
+	return config
+}
+
+// stubRPC is a JSON-RPC node that answers single and batched requests with respond
+type stubRPC struct {
+	server  *httptest.Server
+	respond func(call rpcCall) (interface{}, *rpcError)
+
+	mu    sync.Mutex
+	calls []rpcCall
+	posts int
+}
+
+// newStubRPC starts a node that is shut down when the test ends
+func newStubRPC(t *testing.T, respond func(call rpcCall) (interface{}, *rpcError)) *stubRPC {
+	t.Helper()
+	s := &stubRPC{respond: respond}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// Calls returns the requests received so far, batched requests one by one
+func (s *stubRPC) Calls() []rpcCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]rpcCall(nil), s.calls...)
+}
+
+func (s *stubRPC) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	batch := bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+
+	var calls []rpcCall
+	if batch {
+		json.Unmarshal(body, &calls)
+	} else {
+		var call rpcCall
+		json.Unmarshal(body, &call)
+		calls = []rpcCall{call}
+	}
+
+	s.mu.Lock()
+	s.posts++
+	s.calls = append(s.calls, calls...)
+	s.mu.Unlock()
+
+	responses := make([]map[string]interface{}, len(calls))
+	for i, call := range calls {
+		result, rpcErr := s.respond(call)
+		responses[i] = map[string]interface{}{"jsonrpc": "2.0", "id": call.ID}
+		if rpcErr != nil {
+			responses[i]["error"] = rpcErr
+		} else {
+			responses[i]["result"] = result
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		json.NewEncoder(w).Encode(responses)
+		return
+	}
+	json.NewEncoder(w).Encode(responses[0])
+}
+
+// testLogger returns a logger writing to a temporary directory
+func testLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log
+}
+
+// testClient returns a client of url without retries
+func testClient(t *testing.T, url string) *Client {
+	t.Helper()
+	c := New(url, testMint, "", 5*time.Second, 0, testLogger(t))
+	c.retryDelay = time.Millisecond
+	return c
+}
+
+// balanceNode answers balance reads: every wallet holds 2 SOL and 3.5 tokens in one
+// token account, and the current slot is 1234
+func balanceNode(call rpcCall) (interface{}, *rpcError) {
+	context := map[string]int{"slot": 1234}
+	switch call.Method {
+	case "getSlot":
+		return 1234, nil
+	case "getBalance":
+		return map[string]interface{}{"context": context, "value": 2 * LamportsPerSol}, nil
+	case "getMultipleAccounts":
+		var wallets []string
+		json.Unmarshal(call.Params[0], &wallets)
+		accounts := make([]interface{}, len(wallets))
+		for i := range accounts {
+			accounts[i] = map[string]interface{}{"lamports": 2 * LamportsPerSol, "owner": SystemProgramID}
+		}
+		return map[string]interface{}{"context": context, "value": accounts}, nil
+	case "getTokenAccountsByOwner":
+		return map[string]interface{}{"context": context, "value": []interface{}{tokenAccount("3500000", 6, 3.5, "3.5")}}, nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "method not found"}
+}
+
+// tokenAccount is a jsonParsed token account holding amount base units
+func tokenAccount(amount string, decimals int, uiAmount float64, uiAmountString string) map[string]interface{} {
+	return map[string]interface{}{
+		"pubkey": "Ata" + amount,
+		"account": map[string]interface{}{
+			"data": map[string]interface{}{
+				"parsed": map[string]interface{}{
+					"info": map[string]interface{}{
+						"tokenAmount": map[string]interface{}{
+							"amount":         amount,
+							"decimals":       decimals,
+							"uiAmount":       uiAmount,
+							"uiAmountString": uiAmountString,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// accountInfo is a getAccountInfo result for an account owned by owner
+func accountInfo(owner string) map[string]interface{} {
+	return map[string]interface{}{
+		"context": map[string]int{"slot": 1},
+		"value":   map[string]interface{}{"owner": owner, "lamports": 1, "executable": false},
+	}
+}
+
+func TestValidateAccounts(t *testing.T) {
+	const (
+		wallet     = "Wa11et1111111111111111111111111111111111111"
+		program    = "Program111111111111111111111111111111111111"
+		unfunded   = "Unfunded11111111111111111111111111111111111"
+		tokenOwner = "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA"
+	)
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		switch call.stringParam(0) {
+		case wallet:
+			return accountInfo(SystemProgramID), nil
+		case program:
+			return accountInfo(tokenOwner), nil
+		}
+		return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": nil}, nil
+	})
+
+	tests := []struct {
+		name string
+		skip bool
+		want []string
+	}{
+		{name: "program accounts are skipped", skip: true, want: []string{wallet, unfunded}},
+		{name: "program accounts are kept", skip: false, want: []string{wallet, program, unfunded}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, node.server.URL)
+			got := c.ValidateAccounts([]string{wallet, program, unfunded}, 2, tt.skip)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ValidateAccounts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPinSlot(t *testing.T) {
+	node := newStubRPC(t, balanceNode)
+	c := testClient(t, node.server.URL)
+	c.FetchSol = true
+
+	slot, err := c.PinSlot()
+	if err != nil || slot != 1234 {
+		t.Fatalf("PinSlot = %d, %v; want 1234", slot, err)
+	}
+
+	tests := []struct {
+		name     string
+		bulkMode bool
+	}{
+		{name: "one request per wallet"},
+		{name: "bulk mode", bulkMode: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.BulkMode = tt.bulkMode
+			before := len(node.Calls())
+			if _, errs := c.FetchTokenBalances(context.Background(), []string{"wallet1", "wallet2"}, 2); len(errs) != 0 {
+				t.Fatalf("FetchTokenBalances: %v", errs)
+			}
+
+			calls := node.Calls()[before:]
+			if len(calls) == 0 {
+				t.Fatal("no requests were made")
+			}
+			for _, call := range calls {
+				if got := call.configParam()["minContextSlot"]; got != float64(1234) {
+					t.Errorf("%s has minContextSlot %v, want 1234", call.Method, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSkipSol(t *testing.T) {
+	tests := []struct {
+		name     string
+		bulkMode bool
+	}{
+		{name: "one request per wallet"},
+		{name: "bulk mode", bulkMode: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newStubRPC(t, balanceNode)
+			c := testClient(t, node.server.URL)
+			c.FetchSol = true
+			c.BulkMode = tt.bulkMode
+			c.SetSkipSol([]string{"tokenOnly"})
+
+			balances, errs := c.FetchTokenBalances(context.Background(), []string{"wallet", "tokenOnly"}, 2)
+			if len(errs) != 0 {
+				t.Fatalf("FetchTokenBalances: %v", errs)
+			}
+
+			for _, call := range node.Calls() {
+				switch call.Method {
+				case "getBalance":
+					if call.stringParam(0) == "tokenOnly" {
+						t.Error("getBalance was requested for a skip_sol wallet")
+					}
+				case "getMultipleAccounts":
+					var wallets []string
+					json.Unmarshal(call.Params[0], &wallets)
+					if strings.Join(wallets, ",") != "wallet" {
+						t.Errorf("getMultipleAccounts requested %v, want only wallet", wallets)
+					}
+				}
+			}
+
+			for _, balance := range balances {
+				wantSol := balance.WalletAddress == "wallet"
+				if balance.SolanaFetched != wantSol || (wantSol && balance.SolanaBalance != 2) {
+					t.Errorf("%s: SOL fetched %v with %v SOL, want fetched %v", balance.WalletAddress,
+						balance.SolanaFetched, balance.SolanaBalance, wantSol)
+				}
+				if balance.Balance != 3.5 {
+					t.Errorf("%s: token balance %v, want 3.5", balance.WalletAddress, balance.Balance)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryStatus(t *testing.T) {
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		context := map[string]int{"slot": 1}
+		switch call.stringParam(0) {
+		case "holder":
+			return map[string]interface{}{"context": context, "value": []interface{}{tokenAccount("0", 6, 0, "0")}}, nil
+		case "empty":
+			return map[string]interface{}{"context": context, "value": []interface{}{}}, nil
+		}
+		return nil, &rpcError{Code: -32602, Message: "Invalid param: could not find account"}
+	})
+
+	tests := []struct {
+		name       string
+		bulkMode   bool
+		zeroCodes  []int
+		wantFailed QueryStatus
+	}{
+		{name: "one request per wallet", wantFailed: StatusError},
+		{name: "bulk mode", bulkMode: true, wantFailed: StatusError},
+		{name: "error code treated as zero", zeroCodes: []int{-32602}, wantFailed: StatusNoAccount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, node.server.URL)
+			c.BulkMode = tt.bulkMode
+			c.ZeroBalanceCodes = tt.zeroCodes
+
+			balances, _ := c.FetchTokenBalances(context.Background(), []string{"holder", "empty", "failed"}, 1)
+			got := map[string]QueryStatus{}
+			for _, balance := range balances {
+				got[balance.WalletAddress] = balance.Status
+			}
+
+			// A zero balance in an existing token account is still a successful query
+			want := map[string]QueryStatus{"holder": StatusOK, "empty": StatusNoAccount, "failed": tt.wantFailed}
+			for wallet, status := range want {
+				if got[wallet] != status {
+					t.Errorf("%s: status %q, want %q", wallet, got[wallet], status)
+				}
+			}
+		})
+	}
+}
+
+func TestLamportsUnmarshal(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Lamports
+		wantErr bool
+	}{
+		{json: `2039280`, want: 2039280},
+		{json: `"2039280"`, want: 2039280},
+		{json: `"18446744073709551615"`, want: 18446744073709551615},
+		{json: `0`, want: 0},
+		{json: `"1.5"`, wantErr: true},
+		{json: `"-1"`, wantErr: true},
+		{json: `null`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var got Lamports
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v; want %d, error %v", tt.json, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// A provider returning getBalance as a string is read like a number
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": "2039280"}, nil
+	})
+	sol, err := testClient(t, node.server.URL).FetchSolanaBalance(context.Background(), "wallet")
+	if err != nil || sol != 0.00203928 {
+		t.Errorf("FetchSolanaBalance = %v, %v; want 0.00203928", sol, err)
+	}
+}
+
+func TestFetchStopsAtDeadline(t *testing.T) {
+	// The slow wallets' token accounts never arrive before the cycle deadline
+	release := make(chan struct{})
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		if call.Method == "getTokenAccountsByOwner" && strings.HasPrefix(call.stringParam(0), "slow") {
+			<-release
+		}
+		return balanceNode(call)
+	})
+	t.Cleanup(func() { close(release) })
+
+	c := testClient(t, node.server.URL)
+	addresses := []string{"fast1", "slow1", "fast2", "slow2", "fast3"}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	balances, errs := c.FetchTokenBalances(ctx, addresses, 3)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("fetch took %v, want it to end at the 200ms deadline", elapsed)
+	}
+
+	if len(balances) != len(addresses) {
+		t.Fatalf("got %d balances, want one per address", len(balances))
+	}
+	if len(errs) != 2 {
+		t.Errorf("got %d errors, want one per slow wallet: %v", len(errs), errs)
+	}
+	for _, balance := range balances {
+		slow := strings.HasPrefix(balance.WalletAddress, "slow")
+		switch {
+		case slow && !errors.Is(balance.FetchError, context.DeadlineExceeded):
+			t.Errorf("%s error = %v, want the deadline", balance.WalletAddress, balance.FetchError)
+		case !slow && (balance.FetchError != nil || balance.Balance != 3.5):
+			t.Errorf("%s = %v, %v; want the completed balance 3.5", balance.WalletAddress, balance.Balance, balance.FetchError)
+		}
+	}
+}
+
+func TestTokenAccounts(t *testing.T) {
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		if call.Method != "getTokenAccountsByOwner" {
+			return balanceNode(call)
+		}
+		accounts := []interface{}{}
+		switch call.stringParam(0) {
+		case "single":
+			accounts = append(accounts, tokenAccount("1000000", 6, 1, "1"))
+		case "several":
+			accounts = append(accounts, tokenAccount("2000000", 6, 2, "2"), tokenAccount("500000", 6, 0.5, "0.5"))
+		}
+		return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": accounts}, nil
+	})
+	c := testClient(t, node.server.URL)
+
+	tests := []struct {
+		wallet string
+		want   []string
+	}{
+		{wallet: "single", want: []string{"Ata1000000"}},
+		{wallet: "several", want: []string{"Ata2000000", "Ata500000"}},
+		{wallet: "empty", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		balance, err := c.FetchTokenBalance(context.Background(), tt.wallet)
+		if err != nil {
+			t.Fatalf("FetchTokenBalance(%s): %v", tt.wallet, err)
+		}
+		if strings.Join(balance.TokenAccounts, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s token accounts = %v, want %v", tt.wallet, balance.TokenAccounts, tt.want)
+		}
+	}
+}
+
+func TestPerWalletQueriesAreSerial(t *testing.T) {
+	// With a single mint the token and SOL queries of a wallet run one after the other
+	var mu sync.Mutex
+	active, maxActive := map[string]int{}, 0
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		wallet := call.stringParam(0)
+		mu.Lock()
+		active[wallet]++
+		if active[wallet] > maxActive {
+			maxActive = active[wallet]
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active[wallet]--
+		mu.Unlock()
+		return balanceNode(call)
+	})
+
+	c := testClient(t, node.server.URL)
+	c.FetchSol = true
+	balances, errs := c.FetchTokenBalances(context.Background(), []string{"a", "b", "c", "d"}, 4)
+	if len(errs) != 0 {
+		t.Fatalf("FetchTokenBalances errors: %v", errs)
+	}
+	for _, balance := range balances {
+		if balance.Balance != 3.5 || balance.SolanaBalance != 2 {
+			t.Errorf("%s = %v tokens, %v SOL; want 3.5 and 2", balance.WalletAddress, balance.Balance, balance.SolanaBalance)
+		}
+	}
+	if maxActive != 1 {
+		t.Errorf("%d queries of one wallet were in flight at once, want 1", maxActive)
+	}
+}
+
+func TestShouldLogRetry(t *testing.T) {
+	tests := []struct {
+		every int
+		want  []int
+	}{
+		{every: 1, want: []int{1, 2, 3, 4, 5, 6}},
+		{every: 0, want: []int{1, 6}},
+		{every: 2, want: []int{1, 2, 4, 6}},
+		{every: 4, want: []int{1, 4, 6}},
+	}
+
+	for _, tt := range tests {
+		var logged []int
+		for attempt := 1; attempt <= 6; attempt++ {
+			if ShouldLogRetry(attempt, 6, tt.every) {
+				logged = append(logged, attempt)
+			}
+		}
+		if fmt.Sprint(logged) != fmt.Sprint(tt.want) {
+			t.Errorf("every %d logs attempts %v, want %v", tt.every, logged, tt.want)
+		}
+	}
+}
+
+func TestRetryLogSuppression(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	logDir := t.TempDir()
+	log, err := logger.New(logDir)
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	defer log.Close()
+
+	c := New(server.URL, testMint, "", 5*time.Second, 6, log)
+	c.retryDelay = time.Microsecond
+	c.RetryLogEvery = 0
+	if _, err := c.FetchTokenBalance(context.Background(), "wallet1"); err == nil {
+		t.Fatal("FetchTokenBalance succeeded against a failing node")
+	}
+
+	var content []byte
+	paths, _ := filepath.Glob(filepath.Join(logDir, "*"))
+	for _, path := range paths {
+		data, _ := os.ReadFile(path)
+		content = append(content, data...)
+	}
+	logged := string(content)
+	for attempt := 1; attempt <= 6; attempt++ {
+		line := fmt.Sprintf("(attempt %d/6)", attempt)
+		want := attempt == 1 || attempt == 6
+		if strings.Contains(logged, line) != want {
+			t.Errorf("log has retry line %s = %v, want %v", line, !want, want)
+		}
+	}
+	if !strings.Contains(logged, "Suppressed 4 retry log lines for getTokenAccountsByOwner on wallet1") {
+		t.Errorf("log does not summarise the suppressed attempts:\n%s", logged)
+	}
+}
+
+func TestZeroBalanceCodes(t *testing.T) {
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		return nil, &rpcError{Code: -32602, Message: "Invalid param: could not find account"}
+	})
+
+	tests := []struct {
+		name      string
+		zeroCodes []int
+		wantErr   bool
+	}{
+		{name: "configured code", zeroCodes: []int{-32001, -32602}},
+		{name: "other codes configured", zeroCodes: []int{-32001}, wantErr: true},
+		{name: "none configured", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testClient(t, node.server.URL)
+			c.ZeroBalanceCodes = tt.zeroCodes
+			balance, err := c.FetchTokenBalance(context.Background(), "wallet1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchTokenBalance error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (balance.Balance != 0 || balance.FetchError != nil) {
+				t.Errorf("balance = %+v, want 0 without an error", balance)
+			}
+		})
+	}
+}
+
+func TestRawAmounts(t *testing.T) {
+	// Both values are beyond what a float64 holds exactly
+	const lamports, amount = 9007199254740993, "123456789012345678901"
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		switch call.Method {
+		case "getBalance":
+			return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": uint64(lamports)}, nil
+		case "getTokenAccountsByOwner":
+			account := tokenAccount(amount, 9, 123456789012.345678901, "123456789012.345678901")
+			return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": []interface{}{account}}, nil
+		}
+		return balanceNode(call)
+	})
+
+	c := testClient(t, node.server.URL)
+	c.FetchSol = true
+	balances, errs := c.FetchTokenBalances(context.Background(), []string{"wallet1"}, 1)
+	if len(errs) != 0 {
+		t.Fatalf("FetchTokenBalances errors: %v", errs)
+	}
+	if got := balances[0].SolanaLamports; got != lamports {
+		t.Errorf("SolanaLamports = %d, want %d", got, uint64(lamports))
+	}
+	if got := balances[0].TokenRawAmount; got != amount {
+		t.Errorf("TokenRawAmount = %s, want %s", got, amount)
+	}
+}
+
+func TestPreferUIString(t *testing.T) {
+	// uiAmount is the float the RPC rounded uiAmountString to
+	const uiString = "123456789012.345678901"
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		if call.Method == "getTokenAccountsByOwner" {
+			account := tokenAccount("123456789012345678901", 9, 123456789012.345678901, uiString)
+			return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": []interface{}{account}}, nil
+		}
+		return balanceNode(call)
+	})
+
+	tests := []struct {
+		preferUIString bool
+		wantUIAmount   string
+		wantFormatted  string
+	}{
+		{false, "", "123456789012.34567"},
+		{true, uiString, uiString},
+	}
+	for _, tt := range tests {
+		c := testClient(t, node.server.URL)
+		c.PreferUIString = tt.preferUIString
+		balances, errs := c.FetchTokenBalances(context.Background(), []string{"wallet1"}, 1)
+		if len(errs) != 0 {
+			t.Fatalf("FetchTokenBalances errors: %v", errs)
+		}
+		balance := balances[0]
+		if balance.TokenUIAmount != tt.wantUIAmount {
+			t.Errorf("PreferUIString %v: TokenUIAmount = %q, want %q", tt.preferUIString, balance.TokenUIAmount, tt.wantUIAmount)
+		}
+		if balance.Balance != 123456789012.345678901 {
+			t.Errorf("PreferUIString %v: Balance = %v", tt.preferUIString, balance.Balance)
+		}
+		if got := (rounding.Rounder{Places: -1}).FormatExact(balance.Balance, balance.TokenUIAmount); got != tt.wantFormatted {
+			t.Errorf("PreferUIString %v: formatted balance = %s, want %s", tt.preferUIString, got, tt.wantFormatted)
+		}
+	}
+}
+
+func TestMinimumBalanceForRentExemption(t *testing.T) {
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		if call.Method == "getMinimumBalanceForRentExemption" {
+			return 890880, nil
+		}
+		return balanceNode(call)
+	})
+
+	minSol, err := testClient(t, node.server.URL).MinimumBalanceForRentExemption(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("MinimumBalanceForRentExemption: %v", err)
+	}
+	if minSol != 0.00089088 {
+		t.Errorf("MinimumBalanceForRentExemption = %v, want 0.00089088 SOL", minSol)
+	}
+}
+
+func TestCommitment(t *testing.T) {
+	tests := []struct {
+		name       string
+		commitment string
+		want       interface{}
+	}{
+		{name: "node default", commitment: "", want: nil},
+		{name: "finalized", commitment: "finalized", want: "finalized"},
+		{name: "processed", commitment: "processed", want: "processed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newStubRPC(t, balanceNode)
+			c := testClient(t, stub.server.URL)
+			c.commitment = tt.commitment
+
+			if _, err := c.FetchSolanaBalance(context.Background(), "wallet1"); err != nil {
+				t.Fatalf("FetchSolanaBalance: %v", err)
+			}
+			if _, err := c.FetchTokenBalance(context.Background(), "wallet1"); err != nil {
+				t.Fatalf("FetchTokenBalance: %v", err)
+			}
+
+			calls := stub.Calls()
+			if len(calls) == 0 {
+				t.Fatal("no RPC calls were made")
+			}
+			for _, call := range calls {
+				if got := call.configParam()["commitment"]; got != tt.want {
+					t.Errorf("%s commitment = %v, want %v", call.Method, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkFetch(t *testing.T) {
+	// Wallet i holds i tokens and i*1000 lamports; every seventh wallet has no account
+	addresses := make([]string, 250)
+	index := make(map[string]int, len(addresses))
+	for i := range addresses {
+		addresses[i] = fmt.Sprintf("wallet%03d", i)
+		index[addresses[i]] = i
+	}
+	node := func(call rpcCall) (interface{}, *rpcError) {
+		context := map[string]int{"slot": 1234}
+		switch call.Method {
+		case "getMultipleAccounts":
+			var wallets []string
+			json.Unmarshal(call.Params[0], &wallets)
+			accounts := make([]interface{}, len(wallets))
+			for i, wallet := range wallets {
+				if index[wallet]%7 != 0 {
+					accounts[i] = map[string]interface{}{"lamports": index[wallet] * 1000, "owner": SystemProgramID}
+				}
+			}
+			return map[string]interface{}{"context": context, "value": accounts}, nil
+		case "getTokenAccountsByOwner":
+			i := index[call.stringParam(0)]
+			amount := fmt.Sprint(i * 1000000)
+			return map[string]interface{}{"context": context, "value": []interface{}{tokenAccount(amount, 6, float64(i), fmt.Sprint(i))}}, nil
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found"}
+	}
+
+	tests := []struct {
+		name         string
+		fetchSol     bool
+		wantSolCalls int
+	}{
+		{name: "tokens only"},
+		{name: "tokens and SOL", fetchSol: true, wantSolCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newStubRPC(t, node)
+			c := testClient(t, stub.server.URL)
+			c.BulkMode = true
+			c.FetchSol = tt.fetchSol
+
+			balances, errs := c.FetchTokenBalances(context.Background(), addresses, 4)
+			if len(errs) != 0 {
+				t.Fatalf("FetchTokenBalances errors: %v", errs)
+			}
+
+			// Three batches of 100, 100 and 50 token requests, plus as many SOL requests
+			calls := map[string]int{}
+			for _, call := range stub.Calls() {
+				calls[call.Method]++
+			}
+			if calls["getTokenAccountsByOwner"] != 250 || calls["getMultipleAccounts"] != tt.wantSolCalls {
+				t.Errorf("calls = %v, want 250 getTokenAccountsByOwner and %d getMultipleAccounts", calls, tt.wantSolCalls)
+			}
+			if stub.posts != 3+tt.wantSolCalls {
+				t.Errorf("posted %d requests, want %d", stub.posts, 3+tt.wantSolCalls)
+			}
+
+			if len(balances) != len(addresses) {
+				t.Fatalf("got %d balances, want %d", len(balances), len(addresses))
+			}
+			for i, balance := range balances {
+				if balance.WalletAddress != addresses[i] || balance.Balance != float64(i) {
+					t.Errorf("balance %d = %s %v, want %s %d", i, balance.WalletAddress, balance.Balance, addresses[i], i)
+				}
+				wantLamports := uint64(i * 1000)
+				if i%7 == 0 {
+					wantLamports = 0
+				}
+				if balance.SolanaFetched != tt.fetchSol || (tt.fetchSol && balance.SolanaLamports != wantLamports) {
+					t.Errorf("%s SOL = fetched %v, %d lamports, want fetched %v, %d lamports",
+						balance.WalletAddress, balance.SolanaFetched, balance.SolanaLamports, tt.fetchSol, wantLamports)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkFetchSol(t *testing.T) {
+	// Wallets named empty have no account on chain; invalid fails any request naming it
+	lamportsOf := func(wallet string) interface{} {
+		if strings.HasPrefix(wallet, "empty") {
+			return nil
+		}
+		return map[string]interface{}{"lamports": len(wallet) * 1000, "owner": SystemProgramID}
+	}
+	invalidParam := &rpcError{Code: -32602, Message: "Invalid param: WrongSize"}
+	node := func(call rpcCall) (interface{}, *rpcError) {
+		context := map[string]int{"slot": 1234}
+		switch call.Method {
+		case "getMultipleAccounts":
+			var wallets []string
+			json.Unmarshal(call.Params[0], &wallets)
+			accounts := make([]interface{}, len(wallets))
+			for i, wallet := range wallets {
+				if wallet == "invalid" {
+					return nil, invalidParam
+				}
+				accounts[i] = lamportsOf(wallet)
+			}
+			return map[string]interface{}{"context": context, "value": accounts}, nil
+		case "getBalance":
+			wallet := call.stringParam(0)
+			if wallet == "invalid" {
+				return nil, invalidParam
+			}
+			lamports := 0
+			if account, ok := lamportsOf(wallet).(map[string]interface{}); ok {
+				lamports = account["lamports"].(int)
+			}
+			return map[string]interface{}{"context": context, "value": lamports}, nil
+		case "getTokenAccountsByOwner":
+			return map[string]interface{}{"context": context, "value": []interface{}{}}, nil
+		}
+		return nil, &rpcError{Code: -32601, Message: "method not found"}
+	}
+
+	many := make([]string, 230)
+	for i := range many {
+		many[i] = fmt.Sprintf("wallet%03d", i)
+	}
+
+	tests := []struct {
+		name          string
+		addresses     []string
+		skipSol       []string
+		wantCalls     map[string]int // SOL requests
+		wantLamports  map[string]uint64
+		wantErrWallet string
+	}{
+		{
+			name:         "mixed null accounts",
+			addresses:    []string{"a", "empty1", "bbb", "empty2"},
+			wantCalls:    map[string]int{"getMultipleAccounts": 1},
+			wantLamports: map[string]uint64{"a": 1000, "empty1": 0, "bbb": 3000, "empty2": 0},
+		},
+		{
+			name:         "chunks of 100",
+			addresses:    many,
+			wantCalls:    map[string]int{"getMultipleAccounts": 3},
+			wantLamports: map[string]uint64{"wallet000": 9000, "wallet229": 9000},
+		},
+		{
+			name:          "failed chunk is fetched one by one",
+			addresses:     []string{"a", "invalid", "empty1"},
+			wantCalls:     map[string]int{"getMultipleAccounts": 1, "getBalance": 3},
+			wantLamports:  map[string]uint64{"a": 1000, "empty1": 0},
+			wantErrWallet: "invalid",
+		},
+		{
+			name:         "skip_sol wallets left out",
+			addresses:    []string{"a", "bbb", "cc"},
+			skipSol:      []string{"bbb"},
+			wantCalls:    map[string]int{"getMultipleAccounts": 1},
+			wantLamports: map[string]uint64{"a": 1000, "cc": 2000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newStubRPC(t, node)
+			c := testClient(t, stub.server.URL)
+			c.BulkMode = true
+			c.FetchSol = true
+			c.SetSkipSol(tt.skipSol)
+			var reported []string
+			c.OnResult = func(balance *TokenBalance) { reported = append(reported, balance.WalletAddress) }
+			balances, errs := c.FetchTokenBalances(context.Background(), tt.addresses, 2)
+
+			calls := map[string]int{}
+			for _, call := range stub.Calls() {
+				if call.Method == "getTokenAccountsByOwner" {
+					continue
+				}
+				calls[call.Method]++
+				if call.Method == "getMultipleAccounts" {
+					var wallets []string
+					json.Unmarshal(call.Params[0], &wallets)
+					for _, wallet := range wallets {
+						for _, skipped := range tt.skipSol {
+							if wallet == skipped {
+								t.Errorf("getMultipleAccounts asked for skip_sol wallet %s", wallet)
+							}
+						}
+					}
+				}
+			}
+			if fmt.Sprint(calls) != fmt.Sprint(tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+
+			if len(balances) != len(tt.addresses) {
+				t.Fatalf("got %d balances, want %d", len(balances), len(tt.addresses))
+			}
+			if fmt.Sprint(reported) != fmt.Sprint(tt.addresses) {
+				t.Errorf("OnResult saw %v, want %v", reported, tt.addresses)
+			}
+			for i, balance := range balances {
+				skipped := false
+				for _, wallet := range tt.skipSol {
+					skipped = skipped || wallet == balance.WalletAddress
+				}
+				if balance.WalletAddress != tt.addresses[i] || balance.SolanaFetched == skipped {
+					t.Errorf("balance %d = %s SOL fetched %v, want %s fetched %v", i, balance.WalletAddress, balance.SolanaFetched, tt.addresses[i], !skipped)
+				}
+				if (balance.SolanaError != nil) != (balance.WalletAddress == tt.wantErrWallet) {
+					t.Errorf("%s SOL error = %v", balance.WalletAddress, balance.SolanaError)
+				}
+				if want, ok := tt.wantLamports[balance.WalletAddress]; ok && balance.SolanaLamports != want {
+					t.Errorf("%s lamports = %d, want %d", balance.WalletAddress, balance.SolanaLamports, want)
+				}
+			}
+
+			wantErrs := 0
+			if tt.wantErrWallet != "" {
+				wantErrs = 1
+			}
+			if len(errs) != wantErrs {
+				t.Errorf("errors = %v, want %d", errs, wantErrs)
+			}
+		})
+	}
+}
+
+func TestBulkRequestsCarryConsistency(t *testing.T) {
+	tests := []struct {
+		name       string
+		commitment string
+		pin        bool
+		want       map[string]interface{}
+	}{
+		{name: "node defaults", want: map[string]interface{}{}},
+		{name: "commitment", commitment: "finalized", want: map[string]interface{}{"commitment": "finalized"}},
+		{name: "commitment and pinned slot", commitment: "confirmed", pin: true,
+			want: map[string]interface{}{"commitment": "confirmed", "minContextSlot": float64(1234)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newStubRPC(t, balanceNode)
+			c := testClient(t, stub.server.URL)
+			c.commitment = tt.commitment
+			c.BulkMode = true
+			c.FetchSol = true
+			if tt.pin {
+				if _, err := c.PinSlot(); err != nil {
+					t.Fatalf("PinSlot: %v", err)
+				}
+			}
+
+			if _, errs := c.FetchTokenBalances(context.Background(), []string{"wallet1", "wallet2"}, 2); len(errs) != 0 {
+				t.Fatalf("FetchTokenBalances errors: %v", errs)
+			}
+
+			methods := map[string]int{}
+			for _, call := range stub.Calls() {
+				if call.Method == "getSlot" {
+					continue
+				}
+				methods[call.Method]++
+				config := call.configParam()
+				for key, want := range tt.want {
+					if config[key] != want {
+						t.Errorf("%s %s = %v, want %v", call.Method, key, config[key], want)
+					}
+				}
+				for _, key := range []string{"commitment", "minContextSlot"} {
+					if _, ok := tt.want[key]; !ok && config[key] != nil {
+						t.Errorf("%s sent %s = %v, want none", call.Method, key, config[key])
+					}
+				}
+			}
+			if methods["getMultipleAccounts"] != 1 || methods["getTokenAccountsByOwner"] != 2 {
+				t.Errorf("calls = %v, want one getMultipleAccounts and two getTokenAccountsByOwner", methods)
+			}
+		})
+	}
+}
+
+func TestAccountTypes(t *testing.T) {
+	const vote, stake, wallet = "Vote1", "Stake1", "wallet1"
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		switch call.Method {
+		case "getVoteAccounts":
+			account := map[string]interface{}{"votePubkey": vote, "activatedStake": 3 * LamportsPerSol}
+			return map[string]interface{}{"current": []interface{}{account}, "delinquent": []interface{}{}}, nil
+		case "getAccountInfo":
+			info := map[string]interface{}{"stake": map[string]interface{}{"delegation": map[string]interface{}{"stake": "1500000000"}}}
+			value := map[string]interface{}{"owner": StakeProgramID, "data": map[string]interface{}{"parsed": map[string]interface{}{"info": info}}}
+			return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": value}, nil
+		case "getTokenAccountsByOwner":
+			account := tokenAccount("5000000", 6, 5, "5")
+			return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": []interface{}{account}}, nil
+		}
+		return balanceNode(call)
+	})
+
+	want := map[string]struct {
+		accountType AccountType
+		balance     float64
+		stake       float64
+		method      string // The method the address is queried with
+	}{
+		vote:   {AccountVote, 0, 3, "getVoteAccounts"},
+		stake:  {AccountStake, 0, 1.5, "getAccountInfo"},
+		wallet: {AccountWallet, 5, 0, "getTokenAccountsByOwner"},
+	}
+
+	for _, bulk := range []bool{false, true} {
+		t.Run(fmt.Sprintf("bulk=%v", bulk), func(t *testing.T) {
+			c := testClient(t, node.server.URL)
+			c.BulkMode = bulk
+			c.SetAccountTypes(map[string]AccountType{vote: AccountVote, stake: AccountStake})
+			before := len(node.Calls())
+
+			balances, errs := c.FetchTokenBalances(context.Background(), []string{vote, stake, wallet}, 1)
+			if len(errs) != 0 {
+				t.Fatalf("FetchTokenBalances errors: %v", errs)
+			}
+			for _, balance := range balances {
+				w := want[balance.WalletAddress]
+				if balance.AccountType != w.accountType || balance.Balance != w.balance || balance.Stake != w.stake {
+					t.Errorf("%s: type %q, balance %v, stake %v; want type %q, balance %v, stake %v", balance.WalletAddress,
+						balance.AccountType, balance.Balance, balance.Stake, w.accountType, w.balance, w.stake)
+				}
+			}
+
+			queried := map[string]string{}
+			for _, call := range node.Calls()[before:] {
+				address := call.stringParam(0)
+				if call.Method == "getVoteAccounts" {
+					address, _ = call.configParam()["votePubkey"].(string)
+				}
+				queried[address] = call.Method
+			}
+			for address, w := range want {
+				if queried[address] != w.method {
+					t.Errorf("%s queried with %q, want %q", address, queried[address], w.method)
+				}
+			}
+		})
+	}
+}
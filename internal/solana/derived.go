@@ -0,0 +1,171 @@
+package solana
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// VoteProgramID and StakeProgramID own vote and stake accounts
+const (
+	VoteProgramID  = "Vote111111111111111111111111111111111111111"
+	StakeProgramID = "Stake11111111111111111111111111111111111111"
+)
+
+// AccountType is the kind of account an address is fetched as
+type AccountType string
+
+const (
+	AccountWallet AccountType = ""      // A plain wallet, reporting its token balance
+	AccountVote   AccountType = "vote"  // A vote account, reporting its activated stake in SOL
+	AccountStake  AccountType = "stake" // A stake account, reporting its delegated stake in SOL
+)
+
+// ParseAccountType parses a type=vote or type=stake annotation value
+func ParseAccountType(value string) (AccountType, error) {
+	switch accountType := AccountType(value); accountType {
+	case AccountVote, AccountStake:
+		return accountType, nil
+	}
+	return AccountWallet, fmt.Errorf("unknown account type %q: expected vote or stake", value)
+}
+
+// String returns the label of the account type in reports
+func (t AccountType) String() string {
+	if t == AccountWallet {
+		return "wallet"
+	}
+	return string(t)
+}
+
+// programID returns the program owning accounts of the type
+func (t AccountType) programID() string {
+	switch t {
+	case AccountVote:
+		return VoteProgramID
+	case AccountStake:
+		return StakeProgramID
+	}
+	return SystemProgramID
+}
+
+// SetAccountTypes sets the addresses fetched as vote or stake accounts this cycle;
+// other addresses are fetched as wallets
+func (c *Client) SetAccountTypes(types map[string]AccountType) {
+	c.accountTypes = types
+}
+
+// fetchBalance fetches an address according to its account type
+func (c *Client) fetchBalance(ctx context.Context, address string) (*TokenBalance, error) {
+	accountType := c.accountTypes[address]
+	if accountType == AccountWallet {
+		return c.FetchTokenBalance(ctx, address)
+	}
+	return c.fetchDerived(ctx, address, accountType)
+}
+
+// fetchDerived fetches the stake of a vote or stake account into Stake, leaving the
+// token balance at zero as such accounts hold no tokens
+func (c *Client) fetchDerived(ctx context.Context, address string, accountType AccountType) (*TokenBalance, error) {
+	var lamports Lamports
+	var found bool
+	var err error
+	switch accountType {
+	case AccountVote:
+		lamports, found, err = c.fetchVoteStake(ctx, address)
+	case AccountStake:
+		lamports, found, err = c.fetchDelegatedStake(ctx, address)
+	default:
+		return nil, fmt.Errorf("unknown account type %q", accountType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := StatusOK
+	if !found {
+		status = StatusNoAccount
+	}
+	return &TokenBalance{
+		WalletAddress:  address,
+		Timestamp:      time.Now().UTC(),
+		Status:         status,
+		TokenRawAmount: "0",
+		AccountType:    accountType,
+		Stake:          float64(lamports) / LamportsPerSol,
+		StakeLamports:  uint64(lamports),
+	}, nil
+}
+
+// fetchVoteStake returns the activated stake of a vote account with getVoteAccounts,
+// including delinquent validators
+func (c *Client) fetchVoteStake(ctx context.Context, address string) (Lamports, bool, error) {
+	// getVoteAccounts does not take a minimum context slot
+	config := map[string]interface{}{"votePubkey": address}
+	if c.commitment != "" {
+		config["commitment"] = c.commitment
+	}
+
+	type voteAccount struct {
+		VotePubkey     string   `json:"votePubkey"`
+		ActivatedStake Lamports `json:"activatedStake"`
+	}
+	var result struct {
+		Current    []voteAccount `json:"current"`
+		Delinquent []voteAccount `json:"delinquent"`
+	}
+
+	if err := c.call(ctx, address, "getVoteAccounts", []interface{}{config}, &result); err != nil {
+		return 0, false, err
+	}
+
+	for _, account := range append(result.Current, result.Delinquent...) {
+		if account.VotePubkey == address {
+			return account.ActivatedStake, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// fetchDelegatedStake returns the stake delegated by a stake account, read from its
+// jsonParsed account data; an undelegated stake account holds no stake
+func (c *Client) fetchDelegatedStake(ctx context.Context, address string) (Lamports, bool, error) {
+	params := []interface{}{
+		address,
+		c.requestConfig(map[string]interface{}{
+			"encoding": "jsonParsed",
+		}),
+	}
+
+	var result struct {
+		Value *struct {
+			Owner string `json:"owner"`
+			Data  struct {
+				Parsed struct {
+					Info struct {
+						Stake *struct {
+							Delegation struct {
+								Stake Lamports `json:"stake"`
+							} `json:"delegation"`
+						} `json:"stake"`
+					} `json:"info"`
+				} `json:"parsed"`
+			} `json:"data"`
+		} `json:"value"`
+	}
+
+	if err := c.call(ctx, address, "getAccountInfo", params, &result); err != nil {
+		return 0, false, err
+	}
+
+	if result.Value == nil {
+		return 0, false, nil
+	}
+	if result.Value.Owner != StakeProgramID {
+		return 0, false, fmt.Errorf("%s is not a stake account (owned by program %s)", address, result.Value.Owner)
+	}
+	if stake := result.Value.Data.Parsed.Info.Stake; stake != nil {
+		return stake.Delegation.Stake, true, nil
+	}
+	return 0, true, nil
+}
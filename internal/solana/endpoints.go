@@ -0,0 +1,113 @@
+package solana
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Endpoint failover tuning, used when the client has more than one RPC endpoint
+const (
+	// EndpointMaxFailures is the number of failed requests in a row after which an
+	// endpoint is skipped in favour of the next one
+	EndpointMaxFailures = 3
+
+	// EndpointSkipDuration is how long a failing endpoint is skipped before it is tried again
+	EndpointSkipDuration = time.Minute
+)
+
+// endpoint is an RPC URL and its recent health
+type endpoint struct {
+	url       string
+	host      string    // Logged instead of the URL, which may carry an API key
+	failures  int       // Failed requests in a row
+	skipUntil time.Time // Skipped until then after failing
+}
+
+// newEndpoints returns the endpoints of urls, in priority order
+func newEndpoints(urls []string) []*endpoint {
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, rawURL := range urls {
+		host := rawURL
+		if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+			host = parsed.Host
+		}
+		endpoints = append(endpoints, &endpoint{url: rawURL, host: host})
+	}
+	return endpoints
+}
+
+// SetEndpoints replaces the RPC endpoint with urls, tried in order: requests go to the
+// first endpoint that is not being skipped, so a fallback serves only while the ones
+// before it are failing.
+func (c *Client) SetEndpoints(urls []string) {
+	c.endpointsLock.Lock()
+	defer c.endpointsLock.Unlock()
+
+	c.endpoints = newEndpoints(urls)
+	c.serving = 0
+}
+
+// pickEndpoint returns the endpoint for the next request. When every endpoint is being
+// skipped the one that comes back soonest is used rather than failing outright.
+func (c *Client) pickEndpoint() *endpoint {
+	c.endpointsLock.Lock()
+	defer c.endpointsLock.Unlock()
+
+	picked := 0
+	now := time.Now()
+	for i, ep := range c.endpoints {
+		if !now.Before(ep.skipUntil) {
+			picked = i
+			break
+		}
+		if ep.skipUntil.Before(c.endpoints[picked].skipUntil) {
+			picked = i
+		}
+	}
+
+	if picked != c.serving {
+		c.logger.Log(fmt.Sprintf("Switching RPC requests from %s to %s",
+			c.endpoints[c.serving].host, c.endpoints[picked].host))
+		c.serving = picked
+	}
+	return c.endpoints[picked]
+}
+
+// endpointFailed records a failed request to ep. With other endpoints to fall back on,
+// ep is skipped after EndpointMaxFailures failures in a row, or at once when down is set
+// because the failure (e.g. a rejected API key) will not heal on retry.
+func (c *Client) endpointFailed(ep *endpoint, down bool) {
+	c.endpointsLock.Lock()
+	defer c.endpointsLock.Unlock()
+
+	ep.failures++
+	if len(c.endpoints) < 2 || (!down && ep.failures < EndpointMaxFailures) {
+		return
+	}
+	ep.skipUntil = time.Now().Add(EndpointSkipDuration)
+	if down {
+		c.logger.Warn(fmt.Sprintf("RPC endpoint %s failed in a way a retry cannot fix, skipping it for %v",
+			ep.host, EndpointSkipDuration))
+	} else {
+		c.logger.Warn(fmt.Sprintf("RPC endpoint %s failed %d times in a row, skipping it for %v",
+			ep.host, ep.failures, EndpointSkipDuration))
+	}
+	ep.failures = 0
+}
+
+// endpointSucceeded records a successful request to ep
+func (c *Client) endpointSucceeded(ep *endpoint) {
+	c.endpointsLock.Lock()
+	defer c.endpointsLock.Unlock()
+
+	ep.failures = 0
+}
+
+// endpointCount returns the number of RPC endpoints
+func (c *Client) endpointCount() int {
+	c.endpointsLock.Lock()
+	defer c.endpointsLock.Unlock()
+
+	return len(c.endpoints)
+}
@@ -0,0 +1,102 @@
+package solana
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEndpointFailover(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int // Every response of the first endpoint
+		requests    int
+		wantPrimary int32 // Requests the first endpoint received
+	}{
+		// Three 503s skip the endpoint; the later requests go straight to the fallback
+		{name: "repeated 5xx", status: http.StatusServiceUnavailable, requests: 3, wantPrimary: EndpointMaxFailures},
+		// A rejected API key will not heal, so the fallback takes over at once
+		{name: "non-retriable failure", status: http.StatusUnauthorized, requests: 3, wantPrimary: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var primaryHits, fallbackHits int32
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&primaryHits, 1)
+				w.WriteHeader(tt.status)
+			}))
+			defer primary.Close()
+			fallback := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+				atomic.AddInt32(&fallbackHits, 1)
+				return balanceNode(call)
+			})
+
+			c := testClient(t, primary.URL)
+			c.maxRetries = EndpointMaxFailures
+			c.SetEndpoints([]string{primary.URL, fallback.server.URL})
+
+			for i := 0; i < tt.requests; i++ {
+				balance, err := c.FetchSolanaBalance(context.Background(), fmt.Sprintf("wallet%d", i))
+				if err != nil || balance != 2 {
+					t.Fatalf("request %d = %v, %v, want 2 SOL from the fallback", i+1, balance, err)
+				}
+			}
+			if primaryHits != tt.wantPrimary {
+				t.Errorf("first endpoint received %d requests, want %d", primaryHits, tt.wantPrimary)
+			}
+			if fallbackHits != int32(tt.requests) {
+				t.Errorf("fallback received %d requests, want %d", fallbackHits, tt.requests)
+			}
+		})
+	}
+}
+
+func TestEndpointRecovers(t *testing.T) {
+	primary := newStubRPC(t, balanceNode)
+	fallback := newStubRPC(t, balanceNode)
+	c := testClient(t, primary.server.URL)
+	c.SetEndpoints([]string{primary.server.URL, fallback.server.URL})
+
+	// While the primary is skipped the fallback serves; once the skip ends the primary is back
+	c.endpoints[0].skipUntil = time.Now().Add(time.Hour)
+	if ep := c.pickEndpoint(); ep.url != fallback.server.URL {
+		t.Errorf("picked %s while the primary is skipped, want the fallback", ep.host)
+	}
+	c.endpoints[0].skipUntil = time.Now().Add(-time.Second)
+	if ep := c.pickEndpoint(); ep.url != primary.server.URL {
+		t.Errorf("picked %s after the skip ended, want the primary", ep.host)
+	}
+
+	// With every endpoint skipped the one back soonest is used
+	c.endpoints[0].skipUntil = time.Now().Add(time.Hour)
+	c.endpoints[1].skipUntil = time.Now().Add(time.Minute)
+	if ep := c.pickEndpoint(); ep.url != fallback.server.URL {
+		t.Errorf("picked %s with both skipped, want the one back soonest", ep.host)
+	}
+}
+
+func TestSingleEndpointIsNeverSkipped(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	c := testClient(t, server.URL)
+	c.maxRetries = 2 * EndpointMaxFailures
+	if _, err := c.FetchSolanaBalance(context.Background(), "wallet1"); err == nil {
+		t.Fatal("FetchSolanaBalance succeeded against a failing endpoint")
+	}
+	if hits != int32(c.maxRetries+1) {
+		t.Errorf("endpoint received %d requests, want %d", hits, c.maxRetries+1)
+	}
+	if !c.endpoints[0].skipUntil.IsZero() {
+		t.Error("the only endpoint was skipped")
+	}
+}
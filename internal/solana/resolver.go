@@ -0,0 +1,126 @@
+package solana
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolver bounds concurrent DNS lookups and caches the results. The RPC host is
+// constant, so at high concurrency every new connection would otherwise query the
+// OS resolver for the same name.
+type Resolver struct {
+	lookup func(ctx context.Context, host string) ([]string, error)
+	dialer *net.Dialer
+
+	// sem bounds concurrent lookups; nil means unbounded
+	sem chan struct{}
+
+	// ttl is how long a lookup result is reused; 0 disables caching
+	ttl time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedHost
+}
+
+// cachedHost is a resolved host and when it stops being reused
+type cachedHost struct {
+	addrs   []string
+	expires time.Time
+}
+
+// NewResolver creates a resolver allowing at most maxLookups concurrent lookups
+// (0 for no limit) and caching results for ttl (0 to disable caching)
+func NewResolver(maxLookups int, ttl time.Duration) *Resolver {
+	r := &Resolver{
+		lookup: net.DefaultResolver.LookupHost,
+		dialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		ttl:    ttl,
+		cache:  make(map[string]cachedHost),
+	}
+	if maxLookups > 0 {
+		r.sem = make(chan struct{}, maxLookups)
+	}
+	return r
+}
+
+// LookupHost resolves host, serving it from the cache while the last result is fresh
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r.cached(host); ok {
+		return addrs, nil
+	}
+
+	if r.sem != nil {
+		select {
+		case r.sem <- struct{}{}:
+			defer func() { <-r.sem }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		// Another caller may have resolved the host while we waited
+		if addrs, ok := r.cached(host); ok {
+			return addrs, nil
+		}
+	}
+
+	addrs, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.cache[host] = cachedHost{addrs: addrs, expires: time.Now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return addrs, nil
+}
+
+// cached returns the unexpired cached addresses for host
+func (r *Resolver) cached(host string) ([]string, bool) {
+	if r.ttl <= 0 {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.cache[host]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.addrs, true
+}
+
+// DialContext resolves the host through the resolver and dials each address in turn
+// until one connects. It is suitable for http.Transport.DialContext.
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return r.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
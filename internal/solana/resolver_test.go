@@ -0,0 +1,99 @@
+package solana
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingLookup resolves every host to addr, counting lookups and the most in flight at once
+type countingLookup struct {
+	addr string
+
+	mu        sync.Mutex
+	lookups   int
+	active    int
+	maxActive int
+}
+
+func (l *countingLookup) lookup(ctx context.Context, host string) ([]string, error) {
+	l.mu.Lock()
+	l.lookups++
+	l.active++
+	if l.active > l.maxActive {
+		l.maxActive = l.active
+	}
+	l.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	return []string{l.addr}, nil
+}
+
+func TestResolverLookups(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxLookups    int
+		ttl           time.Duration
+		wantLookups   int
+		wantMaxActive int
+	}{
+		{name: "cached", maxLookups: 1, ttl: time.Minute, wantLookups: 1, wantMaxActive: 1},
+		{name: "bounded without caching", maxLookups: 2, wantLookups: 20, wantMaxActive: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &countingLookup{addr: "127.0.0.1"}
+			r := NewResolver(tt.maxLookups, tt.ttl)
+			r.lookup = fake.lookup
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := r.LookupHost(context.Background(), "rpc.example.com"); err != nil {
+						t.Errorf("LookupHost: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if fake.lookups != tt.wantLookups {
+				t.Errorf("resolved the host %d times, want %d", fake.lookups, tt.wantLookups)
+			}
+			if fake.maxActive > tt.wantMaxActive {
+				t.Errorf("%d lookups ran at once, want at most %d", fake.maxActive, tt.wantMaxActive)
+			}
+		})
+	}
+}
+
+func TestResolverDialsRPCHost(t *testing.T) {
+	node := newStubRPC(t, balanceNode)
+	port := node.server.Listener.Addr().(*net.TCPAddr).Port
+
+	fake := &countingLookup{addr: "127.0.0.1"}
+	resolver := NewResolver(1, time.Minute)
+	resolver.lookup = fake.lookup
+
+	c := testClient(t, fmt.Sprintf("http://rpc.example.com:%d", port))
+	c.SetResolver(resolver)
+	c.transport().DisableKeepAlives = true // every request opens a new connection
+
+	for i := 0; i < 5; i++ {
+		if _, err := c.FetchTokenBalance(context.Background(), "wallet1"); err != nil {
+			t.Fatalf("FetchTokenBalance through the resolver: %v", err)
+		}
+	}
+	if fake.lookups != 1 {
+		t.Errorf("resolved the RPC host %d times for 5 connections, want 1", fake.lookups)
+	}
+}
@@ -0,0 +1,108 @@
+package solana
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrResponseTooLarge is returned when a response body exceeds the configured limit
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// ReadBody reads at most limit bytes of a response body, failing with ErrResponseTooLarge
+// instead of loading an oversized payload into memory. A limit of 0 or less disables the cap.
+func ReadBody(body io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(body)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, limit)
+	}
+	return data, nil
+}
+
+// IsRetriableStatus reports whether an HTTP status from the RPC is worth retrying:
+// timeouts, rate limiting and gateway errors. A 500 usually means a server bug that a
+// retry will hit again, so it is only retried when retry500 is set, for providers that
+// return transient 500s under load.
+func IsRetriableStatus(code int, retry500 bool) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusInternalServerError:
+		return retry500
+	}
+	return false
+}
+
+// RetryAfter parses a Retry-After header, given either as delay seconds or as an HTTP
+// date, into the time to wait from now. It reports false when the header is absent or
+// malformed; a date in the past means no wait.
+func RetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// IsRetriableError reports whether a transport error from an HTTP request is worth retrying.
+// DNS failures are retried, a missing name included, as resolvers and records recover. A
+// network operation error is retried when it timed out, the dial was refused (the node may
+// be restarting) or an established connection was reset; a malformed URL will not heal.
+func IsRetriableError(err error) bool {
+	// A misbehaving provider may well answer sensibly on the next attempt
+	if errors.Is(err, ErrResponseTooLarge) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		if opErr.Timeout() {
+			return true
+		}
+		if opErr.Op == "dial" && errors.Is(opErr, syscall.ECONNREFUSED) {
+			return true
+		}
+		// The server reset a connection that was already carrying the request
+		return (opErr.Op == "read" || opErr.Op == "write") && errors.Is(opErr, syscall.ECONNRESET)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// The server closed the connection mid-response
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,295 @@
+package solana
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetriableError(t *testing.T) {
+	// Errors as http.Client.Do returns them, wrapped in a *url.Error
+	do := func(err error) error { return &url.Error{Op: "Post", URL: "https://rpc.example.com", Err: err} }
+	opErr := func(op string, err error) error {
+		return do(&net.OpError{Op: op, Net: "tcp", Err: &os.SyscallError{Syscall: op, Err: err}})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "name does not exist", err: do(&net.DNSError{Err: "no such host", Name: "rpc.example.com", IsNotFound: true}), want: true},
+		{name: "name not found by a failing resolver", err: do(&net.DNSError{Err: "no such host", IsNotFound: true, IsTemporary: true}), want: true},
+		{name: "resolver timeout", err: do(&net.DNSError{Err: "i/o timeout", IsTimeout: true}), want: true},
+		{name: "resolver failure", err: do(&net.DNSError{Err: "server misbehaving", IsTemporary: true}), want: true},
+		{name: "connection refused", err: opErr("dial", syscall.ECONNREFUSED), want: true},
+		{name: "reset while dialing", err: opErr("dial", syscall.ECONNRESET), want: false},
+		{name: "reset while reading", err: opErr("read", syscall.ECONNRESET), want: true},
+		{name: "reset while writing", err: opErr("write", syscall.ECONNRESET), want: true},
+		{name: "dial timeout", err: do(&net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}), want: true},
+		{name: "client timeout", err: do(timeoutError{}), want: true},
+		{name: "server closed the connection", err: do(io.EOF), want: true},
+		{name: "truncated response", err: fmt.Errorf("failed to read response: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "oversized response", err: fmt.Errorf("failed to read response: %w", ErrResponseTooLarge), want: true},
+		{name: "unsupported scheme", err: do(errors.New(`unsupported protocol scheme "ftp"`)), want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetriableError(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetriableError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRefusedConnectionIsRetried(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + listener.Addr().String()
+	listener.Close()
+
+	c := New(refused, testMint, "", 5*time.Second, 3, testLogger(t))
+	c.retryDelay = time.Millisecond
+	balances, _ := c.FetchTokenBalances(context.Background(), []string{"wallet1"}, 1)
+	if balances[0].FetchError == nil {
+		t.Fatal("fetch from a closed port succeeded")
+	}
+	if balances[0].Attempts != 4 {
+		t.Errorf("made %d attempts against a refusing server, want 4 (3 retries)", balances[0].Attempts)
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	// The flaky wallet's first token request is rate limited
+	node := newStubRPC(t, func(call rpcCall) (interface{}, *rpcError) {
+		if call.Method == "getTokenAccountsByOwner" {
+			account := tokenAccount("1000000000", 9, 1, "1")
+			return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": []interface{}{account}}, nil
+		}
+		return balanceNode(call)
+	})
+	var limited sync.Once
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		throttled := false
+		if bytes.Contains(body, []byte("flaky")) {
+			limited.Do(func() { throttled = true })
+		}
+		if throttled {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		node.serveHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := testClient(t, server.URL)
+	c.maxRetries = 2
+	balances, errs := c.FetchTokenBalances(context.Background(), []string{"steady", "flaky"}, 1)
+	if len(errs) != 0 {
+		t.Fatalf("FetchTokenBalances errors: %v", errs)
+	}
+	for i, want := range []int{1, 2} {
+		if balances[i].Attempts != want {
+			t.Errorf("%s took %d attempts, want %d", balances[i].WalletAddress, balances[i].Attempts, want)
+		}
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		limit   int64
+		wantErr bool
+	}{
+		{name: "under the limit", body: "0123456789", limit: 11},
+		{name: "at the limit", body: "0123456789", limit: 10},
+		{name: "over the limit", body: "0123456789", limit: 9, wantErr: true},
+		{name: "no limit", body: "0123456789", limit: 0},
+	}
+
+	for _, tt := range tests {
+		got, err := ReadBody(strings.NewReader(tt.body), tt.limit)
+		if tt.wantErr {
+			if !errors.Is(err, ErrResponseTooLarge) {
+				t.Errorf("%s: ReadBody error = %v, want ErrResponseTooLarge", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.body {
+			t.Errorf("%s: ReadBody = %q, %v; want the whole body", tt.name, got, err)
+		}
+	}
+}
+
+func TestOversizedResponse(t *testing.T) {
+	// A node that pads its answer far beyond the configured limit
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"value":[],"padding":"`))
+		w.Write(bytes.Repeat([]byte("x"), 1<<20))
+		w.Write([]byte(`"}}`))
+	}))
+	defer server.Close()
+
+	c := New(server.URL, testMint, "", 5*time.Second, 2, testLogger(t))
+	c.retryDelay = time.Millisecond
+	c.MaxResponseBytes = 4096
+
+	balances, _ := c.FetchTokenBalances(context.Background(), []string{"wallet1"}, 1)
+	if !errors.Is(balances[0].FetchError, ErrResponseTooLarge) {
+		t.Fatalf("fetch error = %v, want ErrResponseTooLarge", balances[0].FetchError)
+	}
+	if balances[0].Attempts != 3 {
+		t.Errorf("made %d attempts, want the oversized reply retried to 3", balances[0].Attempts)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{header: "", wantOK: false},
+		{header: "2", want: 2 * time.Second, wantOK: true},
+		{header: " 0 ", want: 0, wantOK: true},
+		{header: "-1", wantOK: false},
+		{header: "Sun, 01 Mar 2026 14:00:30 GMT", want: 30 * time.Second, wantOK: true},
+		{header: "Sun, 01 Mar 2026 13:59:00 GMT", want: 0, wantOK: true},
+		{header: "soon", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := RetryAfter(tt.header, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("RetryAfter(%q) = %v, %v, want %v, %v", tt.header, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		deadline   time.Duration // Context deadline, 0 for none
+		wantMin    time.Duration
+		wantMax    time.Duration
+	}{
+		{name: "429 in seconds", status: http.StatusTooManyRequests, retryAfter: "2", wantMin: 2 * time.Second, wantMax: 2 * time.Second},
+		{name: "503 as a date", status: http.StatusServiceUnavailable, retryAfter: time.Now().Add(5 * time.Second).UTC().Format(http.TimeFormat), wantMin: 3 * time.Second, wantMax: 5 * time.Second},
+		{name: "no header falls back to backoff", status: http.StatusTooManyRequests, wantMin: time.Millisecond, wantMax: time.Millisecond},
+		{name: "capped by the deadline", status: http.StatusTooManyRequests, retryAfter: "120", deadline: 10 * time.Second, wantMin: 5 * time.Second, wantMax: 10 * time.Second},
+		{name: "ignored on a gateway error", status: http.StatusBadGateway, retryAfter: "2", wantMin: time.Millisecond, wantMax: time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests == 1 {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(tt.status)
+					return
+				}
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"context":{"slot":1},"value":1000000000}}`)
+			}))
+			defer server.Close()
+
+			c := testClient(t, server.URL)
+			c.maxRetries = 1
+			var waits []time.Duration
+			c.after = func(d time.Duration) <-chan time.Time {
+				waits = append(waits, d)
+				return time.After(0)
+			}
+
+			ctx := context.Background()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.deadline)
+				defer cancel()
+			}
+			balance, err := c.FetchSolanaBalance(ctx, "wallet1")
+			if err != nil || balance != 1 {
+				t.Fatalf("FetchSolanaBalance = %v, %v, want 1 SOL", balance, err)
+			}
+			if len(waits) != 1 || waits[0] < tt.wantMin || waits[0] > tt.wantMax {
+				t.Errorf("waited %v before retrying, want one wait of %v to %v", waits, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestRetryOn500(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		retryOn500   bool
+		wantRequests int
+	}{
+		{name: "500 with RETRY_ON_500", status: http.StatusInternalServerError, retryOn500: true, wantRequests: 2},
+		{name: "500 by default", status: http.StatusInternalServerError, wantRequests: 1},
+		{name: "503 is always retried", status: http.StatusServiceUnavailable, wantRequests: 2},
+		{name: "400 is never retried", status: http.StatusBadRequest, retryOn500: true, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetriableStatus(tt.status, tt.retryOn500); got != (tt.wantRequests > 1) {
+				t.Errorf("IsRetriableStatus(%d, %v) = %v", tt.status, tt.retryOn500, got)
+			}
+
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests == 1 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":{"context":{"slot":1},"value":1000000000}}`)
+			}))
+			defer server.Close()
+
+			c := testClient(t, server.URL)
+			c.maxRetries = 1
+			c.RetryOn500 = tt.retryOn500
+			balance, err := c.FetchSolanaBalance(context.Background(), "wallet1")
+			if requests != tt.wantRequests {
+				t.Errorf("made %d requests, want %d", requests, tt.wantRequests)
+			}
+			if retried := tt.wantRequests > 1; retried && (err != nil || balance != 1) {
+				t.Errorf("FetchSolanaBalance after the retry = %v, %v; want 1 SOL", balance, err)
+			} else if !retried && err == nil {
+				t.Error("FetchSolanaBalance succeeded without a retry")
+			}
+		})
+	}
+}
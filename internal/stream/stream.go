@@ -0,0 +1,194 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// flushInterval bounds how long a partial batch waits for more balances
+var flushInterval = time.Second
+
+// Balance is a fetched balance as posted to the webhook
+type Balance struct {
+	WalletAddress string    `json:"wallet_address"`
+	TokenBalance  *float64  `json:"token_balance"`
+	SolBalance    *float64  `json:"sol_balance,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	FetchedAt     time.Time `json:"fetched_at"`
+}
+
+// Batch is the JSON body of a webhook request
+type Batch struct {
+	RunTimestamp time.Time `json:"run_timestamp"`
+	Balances     []Balance `json:"balances"`
+}
+
+// Streamer posts balances to a webhook in batches while a cycle is still fetching,
+// for live dashboards. Balances wait in a bounded buffer and at most maxInFlight
+// requests are outstanding; when the endpoint falls behind and the buffer is full,
+// further balances are dropped rather than slowing the fetch.
+type Streamer struct {
+	url         string
+	runTime     time.Time
+	batchSize   int
+	client      *http.Client
+	logger      *logger.Logger
+	queue       chan *solana.TokenBalance
+	sem         chan struct{}
+	inFlight    sync.WaitGroup
+	done        chan struct{}
+	dropped     int64
+	posted      int64
+	failed      int64
+	warnDropped sync.Once
+}
+
+// New starts a streamer posting the balances of the run at runTime to url, batchSize at a
+// time. bufferSize bounds the balances waiting to be posted and maxInFlight the
+// concurrent requests.
+func New(url string, runTime time.Time, batchSize, bufferSize, maxInFlight int, timeout time.Duration, logger *logger.Logger) *Streamer {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+
+	s := &Streamer{
+		url:       url,
+		runTime:   runTime,
+		batchSize: batchSize,
+		client:    &http.Client{Timeout: timeout},
+		logger:    logger,
+		queue:     make(chan *solana.TokenBalance, bufferSize),
+		sem:       make(chan struct{}, maxInFlight),
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Add queues a balance for posting without blocking, dropping it if the buffer is full
+func (s *Streamer) Add(balance *solana.TokenBalance) {
+	select {
+	case s.queue <- balance:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+		s.warnDropped.Do(func() {
+			s.logger.Warn(fmt.Sprintf("balance stream buffer is full, dropping balances for %s", s.url))
+		})
+	}
+}
+
+// Close posts the remaining balances, waits for outstanding requests and returns the
+// number of balances posted, dropped because the buffer was full, and lost to failed requests
+func (s *Streamer) Close() (posted, dropped, failed int) {
+	close(s.queue)
+	<-s.done
+	s.inFlight.Wait()
+	return int(atomic.LoadInt64(&s.posted)), int(atomic.LoadInt64(&s.dropped)), int(atomic.LoadInt64(&s.failed))
+}
+
+// run drains the queue into batches, posting one when it is full or has waited flushInterval
+func (s *Streamer) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Balance, 0, s.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		s.sem <- struct{}{}
+		s.inFlight.Add(1)
+		go func(batch []Balance) {
+			defer s.inFlight.Done()
+			defer func() { <-s.sem }()
+			s.post(batch)
+		}(batch)
+		batch = make([]Balance, 0, s.batchSize)
+	}
+
+	for {
+		select {
+		case balance, ok := <-s.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, newBalance(balance))
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// post sends a batch to the webhook
+func (s *Streamer) post(balances []Balance) {
+	body, err := json.Marshal(Batch{RunTimestamp: s.runTime.UTC(), Balances: balances})
+	if err != nil {
+		s.logger.LogError("Failed to encode balance stream batch", err)
+		atomic.AddInt64(&s.failed, int64(len(balances)))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		s.logger.LogError("Failed to create balance stream request", err)
+		atomic.AddInt64(&s.failed, int64(len(balances)))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.LogError(fmt.Sprintf("Failed to post %d balances to stream webhook", len(balances)), err)
+		atomic.AddInt64(&s.failed, int64(len(balances)))
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		s.logger.LogError(fmt.Sprintf("Failed to post %d balances to stream webhook", len(balances)),
+			fmt.Errorf("webhook returned %s", resp.Status))
+		atomic.AddInt64(&s.failed, int64(len(balances)))
+		return
+	}
+	atomic.AddInt64(&s.posted, int64(len(balances)))
+}
+
+// newBalance converts a fetched balance for the webhook; failed amounts are null
+func newBalance(balance *solana.TokenBalance) Balance {
+	streamed := Balance{WalletAddress: balance.WalletAddress, FetchedAt: balance.Timestamp.UTC()}
+	if balance.FetchError != nil {
+		streamed.Error = balance.FetchError.Error()
+	} else {
+		token := balance.Balance
+		streamed.TokenBalance = &token
+	}
+	if balance.SolanaFetched && balance.SolanaError == nil {
+		sol := balance.SolanaBalance
+		streamed.SolBalance = &sol
+	}
+	return streamed
+}
@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nehalshaquib/solana-balance-reporter/internal/logger"
+	"github.com/nehalshaquib/solana-balance-reporter/internal/solana"
+)
+
+// testLogger returns a logger writing to a temporary directory
+func testLogger(t *testing.T) *logger.Logger {
+	t.Helper()
+	log, err := logger.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log
+}
+
+// webhook is a mock endpoint recording the batches posted to it
+type webhook struct {
+	server  *httptest.Server
+	status  int
+	release chan struct{} // When set, requests wait until it is closed
+
+	mu      sync.Mutex
+	batches []Batch
+}
+
+func newWebhook(t *testing.T, status int) *webhook {
+	t.Helper()
+	w := &webhook{status: status}
+	w.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if w.release != nil {
+			<-w.release
+		}
+		var batch Batch
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("webhook received an invalid batch: %v", err)
+		}
+		w.mu.Lock()
+		w.batches = append(w.batches, batch)
+		w.mu.Unlock()
+		rw.WriteHeader(w.status)
+	}))
+	t.Cleanup(w.server.Close)
+	return w
+}
+
+func TestStreamBatches(t *testing.T) {
+	runTime := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		status     int
+		wantPosted int
+		wantFailed int
+	}{
+		{name: "accepted", status: http.StatusOK, wantPosted: 7},
+		{name: "endpoint fails", status: http.StatusInternalServerError, wantFailed: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := newWebhook(t, tt.status)
+			s := New(hook.server.URL, runTime, 3, 100, 2, 5*time.Second, testLogger(t))
+			for i := 0; i < 7; i++ {
+				balance := &solana.TokenBalance{WalletAddress: fmt.Sprintf("wallet%d", i), Balance: float64(i)}
+				if i == 6 {
+					balance.FetchError = errors.New("rpc timeout")
+				}
+				s.Add(balance)
+			}
+
+			posted, dropped, failed := s.Close()
+			if posted != tt.wantPosted || dropped != 0 || failed != tt.wantFailed {
+				t.Errorf("Close = %d posted, %d dropped, %d failed; want %d, 0, %d", posted, dropped, failed, tt.wantPosted, tt.wantFailed)
+			}
+
+			// Every balance arrives once, in batches of at most 3
+			seen := make(map[string]Balance)
+			for _, batch := range hook.batches {
+				if len(batch.Balances) == 0 || len(batch.Balances) > 3 {
+					t.Errorf("batch of %d balances, want 1 to 3", len(batch.Balances))
+				}
+				if !batch.RunTimestamp.Equal(runTime) {
+					t.Errorf("batch run_timestamp = %v, want %v", batch.RunTimestamp, runTime)
+				}
+				for _, balance := range batch.Balances {
+					seen[balance.WalletAddress] = balance
+				}
+			}
+			if len(seen) != 7 {
+				t.Fatalf("webhook received %d distinct balances, want 7", len(seen))
+			}
+			if failedFetch := seen["wallet6"]; failedFetch.TokenBalance != nil || failedFetch.Error == "" {
+				t.Errorf("failed fetch posted as %+v, want a null balance with the error", failedFetch)
+			}
+			if fetched := seen["wallet5"]; fetched.TokenBalance == nil || *fetched.TokenBalance != 5 {
+				t.Errorf("wallet5 posted as %+v, want a balance of 5", fetched)
+			}
+		})
+	}
+}
+
+func TestStreamDropsWhenBufferIsFull(t *testing.T) {
+	hook := newWebhook(t, http.StatusOK)
+	hook.release = make(chan struct{})
+
+	// One request in flight and one balance buffered: while the endpoint stalls the
+	// streamer holds at most a posting batch, a waiting batch and the buffer
+	s := New(hook.server.URL, time.Now(), 1, 1, 1, 5*time.Second, testLogger(t))
+	for i := 0; i < 10; i++ {
+		s.Add(&solana.TokenBalance{WalletAddress: fmt.Sprintf("wallet%d", i), Balance: 1})
+	}
+	close(hook.release)
+
+	posted, dropped, failed := s.Close()
+	if dropped < 7 || posted+dropped != 10 || failed != 0 {
+		t.Errorf("Close = %d posted, %d dropped, %d failed; want at least 7 dropped and the rest posted", posted, dropped, failed)
+	}
+}